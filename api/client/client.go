@@ -0,0 +1,259 @@
+// Package client is a typed Go client for the todo API. It only depends on
+// validate, so programs such as the desktop app can use it without pulling
+// in the store and its sqlite driver.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/mcadenas-bjss/go-do-it/validate"
+)
+
+// DefaultRetries is how many times a failed request is retried when New is
+// not given WithRetries.
+const DefaultRetries = 2
+
+// DefaultBackoff is the wait before the first retry. It doubles with every
+// retry after that.
+const DefaultBackoff = 100 * time.Millisecond
+
+// Client calls the API under a base URL such as http://localhost:8000/api.
+// It is safe for concurrent use.
+type Client struct {
+	baseURL string
+	http    *http.Client
+	token   string
+	actor   string
+	// username and password are sent with basic auth instead of the token
+	// when set.
+	username string
+	password string
+	retries  int
+	backoff  time.Duration
+}
+
+// Option configures optional Client settings.
+type Option func(*Client)
+
+// WithHTTPClient sends requests with c instead of http.DefaultClient, for
+// example to set a timeout or trust another certificate authority.
+func WithHTTPClient(c *http.Client) Option {
+	return func(cl *Client) {
+		cl.http = c
+	}
+}
+
+// WithToken sends token as a bearer token with every request.
+func WithToken(token string) Option {
+	return func(c *Client) {
+		c.token = token
+	}
+}
+
+// WithActor names who makes the changes in the history, with the X-Actor
+// header.
+func WithActor(actor string) Option {
+	return func(c *Client) {
+		c.actor = actor
+	}
+}
+
+// WithRetries sets how many times a request that failed to reach the API, or
+// that the API could not serve, is retried. Only requests that are safe to
+// repeat are retried: reads, PUT, DELETE and any write made with a revision.
+func WithRetries(n int, backoff time.Duration) Option {
+	return func(c *Client) {
+		c.retries = n
+		c.backoff = backoff
+	}
+}
+
+func New(baseURL string, opts ...Option) *Client {
+	c := &Client{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		http:    http.DefaultClient,
+		retries: DefaultRetries,
+		backoff: DefaultBackoff,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// ErrUnavailable is matched by errors from requests that never got an
+// answer from the API, even after retrying.
+var ErrUnavailable = errors.New("the API cannot be reached")
+
+// Errors matched with errors.Is by an *Error with the same code.
+var (
+	ErrNotFound           = errors.New("not found")
+	ErrConflict           = errors.New("conflict")
+	ErrPreconditionFailed = errors.New("precondition failed")
+	ErrValidation         = errors.New("validation failed")
+	ErrUnauthenticated    = errors.New("unauthenticated")
+	ErrInsufficientScope  = errors.New("insufficient scope")
+	ErrForbidden          = errors.New("forbidden")
+)
+
+// Error is a problem reported by the API, decoded from its RFC 7807 body.
+type Error struct {
+	Type   string `json:"type"`
+	Title  string `json:"title"`
+	Status int    `json:"status"`
+	Detail string `json:"detail,omitempty"`
+	Code   string `json:"code"`
+	// Errors lists every invalid field of a validation_failed problem.
+	Errors validate.Errors `json:"errors,omitempty"`
+	// Operation is the index of the operation that failed a batch.
+	Operation *int `json:"operation,omitempty"`
+}
+
+func (e *Error) Error() string {
+	if len(e.Errors) > 0 {
+		return fmt.Sprintf("%s: %s", e.Code, e.Errors)
+	}
+	if e.Detail != "" {
+		return fmt.Sprintf("%s: %s", e.Code, e.Detail)
+	}
+	return fmt.Sprintf("%s: %s", e.Code, e.Title)
+}
+
+func (e *Error) Is(target error) bool {
+	switch target {
+	case ErrNotFound:
+		return e.Code == "not_found"
+	case ErrConflict:
+		return e.Code == "conflict"
+	case ErrPreconditionFailed:
+		return e.Code == "precondition_failed"
+	case ErrValidation:
+		return e.Code == "validation_failed"
+	case ErrUnauthenticated:
+		return e.Code == "unauthenticated"
+	case ErrInsufficientScope:
+		return e.Code == "insufficient_scope"
+	case ErrForbidden:
+		return e.Code == "forbidden"
+	}
+	return false
+}
+
+// request describes one call to the API.
+type request struct {
+	method string
+	path   string
+	query  url.Values
+	body   any
+	// contentType of the body, application/json unless set.
+	contentType string
+	// revision is sent as If-Match when set.
+	id, revision int
+}
+
+func (r request) retryable() bool {
+	switch r.method {
+	case http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return r.revision > 0
+}
+
+// do sends the request, retrying with backoff when allowed, and decodes a
+// successful JSON response into out unless it is nil. Failed responses are
+// returned as *Error.
+func (c *Client) do(ctx context.Context, r request, out any) (*http.Response, error) {
+	var body []byte
+	if r.body != nil {
+		var err error
+		if body, err = json.Marshal(r.body); err != nil {
+			return nil, err
+		}
+	}
+
+	backoff := c.backoff
+	for attempt := 0; ; attempt++ {
+		response, err := c.send(ctx, r, body)
+		retry := err != nil || response.StatusCode >= http.StatusInternalServerError
+		if !retry || !r.retryable() || attempt >= c.retries {
+			if err != nil {
+				return nil, fmt.Errorf("%w: %w", ErrUnavailable, err)
+			}
+			return response, decodeResponse(response, out)
+		}
+		if response != nil {
+			response.Body.Close()
+		}
+
+		select {
+		case <-time.After(backoff):
+			backoff *= 2
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+func (c *Client) send(ctx context.Context, r request, body []byte) (*http.Response, error) {
+	u := c.baseURL + r.path
+	if len(r.query) > 0 {
+		u += "?" + r.query.Encode()
+	}
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, r.method, u, reader)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		contentType := r.contentType
+		if contentType == "" {
+			contentType = "application/json"
+		}
+		req.Header.Set("Content-Type", contentType)
+	}
+	if r.revision > 0 {
+		req.Header.Set("If-Match", fmt.Sprintf(`"%d-%d"`, r.id, r.revision))
+	}
+	if c.username != "" {
+		req.SetBasicAuth(c.username, c.password)
+	} else if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	if c.actor != "" {
+		req.Header.Set("X-Actor", c.actor)
+	}
+	return c.http.Do(req)
+}
+
+func decodeResponse(response *http.Response, out any) error {
+	defer response.Body.Close()
+
+	if response.StatusCode >= http.StatusBadRequest {
+		problem := &Error{Status: response.StatusCode, Title: http.StatusText(response.StatusCode)}
+		if err := json.NewDecoder(response.Body).Decode(problem); err != nil || problem.Code == "" {
+			problem.Code = "http_" + fmt.Sprint(response.StatusCode)
+		}
+		return problem
+	}
+	if out == nil || response.StatusCode == http.StatusNoContent || response.StatusCode == http.StatusNotModified {
+		io.Copy(io.Discard, response.Body)
+		return nil
+	}
+	if err := json.NewDecoder(response.Body).Decode(out); err != nil {
+		return fmt.Errorf("decoding the response of %s failed: %w", response.Request.URL.Path, err)
+	}
+	return nil
+}
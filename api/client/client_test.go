@@ -0,0 +1,203 @@
+package client_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mcadenas-bjss/go-do-it/client"
+	"github.com/mcadenas-bjss/go-do-it/server"
+	"github.com/mcadenas-bjss/go-do-it/store"
+)
+
+func TestMain(m *testing.M) {
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+func newClient(t *testing.T, opts ...client.Option) *client.Client {
+	t.Helper()
+	ts := httptest.NewServer(server.NewTodoServer(store.NewMemoryTodoStore()))
+	t.Cleanup(ts.Close)
+	return client.New(ts.URL+"/api", opts...)
+}
+
+func TestClient(t *testing.T) {
+	ctx := context.Background()
+	c := newClient(t, client.WithActor("alice"))
+
+	if err := c.Health(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	due := time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC)
+	milk, err := c.Create(ctx, client.Todo{Description: "Buy milk", Time: &due})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if milk.Id != 1 || milk.Revision != 1 || !milk.Time.Equal(due) {
+		t.Fatalf("unexpected todo %+v", milk)
+	}
+	eggs, _ := c.Create(ctx, client.Todo{Description: "Buy eggs"})
+
+	t.Run("gets and lists todos", func(t *testing.T) {
+		got, err := c.Get(ctx, milk.Id)
+		if err != nil || got.Description != "Buy milk" {
+			t.Errorf("got %+v, %v", got, err)
+		}
+
+		page, err := c.List(ctx, client.ListOptions{Limit: 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(page.Todos) != 1 || page.Todos[0].Id != milk.Id || page.Next == "" {
+			t.Fatalf("unexpected first page %+v", page)
+		}
+		page, err = c.List(ctx, client.ListOptions{Limit: 1, Cursor: page.Next})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(page.Todos) != 1 || page.Todos[0].Id != eggs.Id || page.Next != "" {
+			t.Errorf("unexpected last page %+v", page)
+		}
+
+		page, _ = c.List(ctx, client.ListOptions{Query: "EGG"})
+		if len(page.Todos) != 1 || page.Todos[0].Id != eggs.Id {
+			t.Errorf("unexpected filtered page %+v", page)
+		}
+	})
+
+	t.Run("writes with revisions", func(t *testing.T) {
+		if err := c.Toggle(ctx, milk.Id, milk.Revision); err != nil {
+			t.Fatal(err)
+		}
+		err := c.Toggle(ctx, milk.Id, milk.Revision)
+		if !errors.Is(err, client.ErrPreconditionFailed) {
+			t.Errorf("got %v want %v", err, client.ErrPreconditionFailed)
+		}
+
+		patched, err := c.Patch(ctx, milk.Id, 2, map[string]any{"Description": "Buy oat milk"})
+		if err != nil || patched.Description != "Buy oat milk" || !patched.Completed || patched.Revision != 3 {
+			t.Errorf("got %+v, %v", patched, err)
+		}
+
+		patched.Description = "Buy soy milk"
+		if err := c.Update(ctx, patched); err != nil {
+			t.Error(err)
+		}
+
+		history, err := c.History(ctx, milk.Id)
+		if err != nil || len(history) != 4 || history[3].Actor != "alice" || history[3].After.Description != "Buy soy milk" {
+			t.Errorf("got %+v, %v", history, err)
+		}
+	})
+
+	t.Run("deletes and restores", func(t *testing.T) {
+		if err := c.Delete(ctx, eggs.Id, 0); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := c.Get(ctx, eggs.Id); !errors.Is(err, client.ErrNotFound) {
+			t.Errorf("got %v want %v", err, client.ErrNotFound)
+		}
+		trash, err := c.Trash(ctx)
+		if err != nil || len(trash) != 1 || trash[0].Id != eggs.Id || trash[0].DeletedAt.IsZero() {
+			t.Errorf("got %+v, %v", trash, err)
+		}
+		restored, err := c.Restore(ctx, eggs.Id, 0)
+		if err != nil || restored.Id != eggs.Id {
+			t.Errorf("got %+v, %v", restored, err)
+		}
+	})
+
+	t.Run("moves todos", func(t *testing.T) {
+		moved, err := c.Move(ctx, eggs.Id, 0, client.Move{Before: milk.Id})
+		if err != nil || moved.Position == "" {
+			t.Fatalf("got %+v, %v", moved, err)
+		}
+		page, _ := c.List(ctx, client.ListOptions{})
+		if len(page.Todos) != 2 || page.Todos[0].Id != eggs.Id {
+			t.Errorf("want eggs listed first, got %+v", page.Todos)
+		}
+		if _, err := c.Move(ctx, eggs.Id, 0, client.Move{After: 99}); !errors.Is(err, client.ErrValidation) {
+			t.Errorf("got %v want %v", err, client.ErrValidation)
+		}
+	})
+
+	t.Run("reports validation errors", func(t *testing.T) {
+		_, err := c.Create(ctx, client.Todo{})
+		var problem *client.Error
+		if !errors.As(err, &problem) || !errors.Is(err, client.ErrValidation) {
+			t.Fatalf("got %v want a validation problem", err)
+		}
+		if len(problem.Errors) != 1 || problem.Errors[0].Field != "Description" {
+			t.Errorf("unexpected field errors %+v", problem.Errors)
+		}
+	})
+
+	t.Run("runs batches", func(t *testing.T) {
+		results, err := c.Batch(ctx, []client.Operation{
+			{Op: client.OpCreate, Todo: &client.Todo{Description: "Buy bread"}},
+			{Op: client.OpToggle, Id: eggs.Id},
+		}, false)
+		if err != nil || len(results) != 2 || results[0].Todo.Description != "Buy bread" {
+			t.Fatalf("got %+v, %v", results, err)
+		}
+
+		_, err = c.Batch(ctx, []client.Operation{{Op: client.OpDelete, Id: 99}}, false)
+		var problem *client.Error
+		if !errors.As(err, &problem) || problem.Operation == nil || *problem.Operation != 0 {
+			t.Errorf("got %v want the failed operation", err)
+		}
+
+		n, err := c.CompleteAll(ctx)
+		if err != nil || n != 1 {
+			t.Errorf("got %d, %v want 1 completed", n, err)
+		}
+		n, err = c.DeleteCompleted(ctx)
+		if err != nil || n != 3 {
+			t.Errorf("got %d, %v want 3 deleted", n, err)
+		}
+	})
+}
+
+func TestRetries(t *testing.T) {
+	ctx := context.Background()
+	var calls atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"Id": 1, "Description": "Buy milk", "Revision": 1}`))
+	}))
+	defer ts.Close()
+	c := client.New(ts.URL, client.WithRetries(2, time.Millisecond))
+
+	t.Run("retries reads", func(t *testing.T) {
+		todo, err := c.Get(ctx, 1)
+		if err != nil || todo.Description != "Buy milk" || calls.Load() != 3 {
+			t.Errorf("got %+v, %v after %d calls", todo, err, calls.Load())
+		}
+	})
+
+	t.Run("does not retry unconditional toggles", func(t *testing.T) {
+		calls.Store(0)
+		if err := c.Toggle(ctx, 1, 0); err == nil || calls.Load() != 1 {
+			t.Errorf("got %v after %d calls", err, calls.Load())
+		}
+	})
+
+	t.Run("reports an unreachable API", func(t *testing.T) {
+		c := client.New("http://127.0.0.1:1", client.WithRetries(1, time.Millisecond))
+		if err := c.Health(ctx); !errors.Is(err, client.ErrUnavailable) {
+			t.Errorf("got %v want %v", err, client.ErrUnavailable)
+		}
+	})
+}
@@ -0,0 +1,287 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// Todo is a todo as the API sends it. Time is nil when there is no due date.
+type Todo struct {
+	Id          int
+	Time        *time.Time `json:",omitempty"`
+	Description string
+	Completed   bool
+	Revision    int
+	// Position orders the todos of a list, and is changed with Move.
+	Position string
+	Section  int `json:",omitempty"`
+}
+
+type TrashedTodo struct {
+	Todo
+	DeletedAt time.Time
+}
+
+// SearchResult is a todo matching a search, with the matched words of its
+// description wrapped in <mark> in Snippet.
+type SearchResult struct {
+	Todo
+	Rank    float64
+	Snippet string
+}
+
+// Event is one entry of the history.
+type Event struct {
+	Id     int
+	TodoId int
+	Op     string
+	Before *Todo
+	After  *Todo
+	At     time.Time
+	Actor  string
+}
+
+// ListOptions filters and orders List. The zero value lists every todo by
+// position.
+type ListOptions struct {
+	Limit int
+	// Cursor is the Next of the previous page.
+	Cursor string
+	// Sort is position, id, time or description.
+	Sort      string
+	Desc      bool
+	Completed *bool
+	DueBefore time.Time
+	DueAfter  time.Time
+	// Query matches descriptions containing it, ignoring case.
+	Query string
+}
+
+func (o ListOptions) values() url.Values {
+	v := url.Values{}
+	if o.Limit > 0 {
+		v.Set("limit", strconv.Itoa(o.Limit))
+	}
+	if o.Cursor != "" {
+		v.Set("cursor", o.Cursor)
+	}
+	if o.Sort != "" {
+		v.Set("sort", o.Sort)
+	}
+	if o.Desc {
+		v.Set("order", "desc")
+	}
+	if o.Completed != nil {
+		v.Set("completed", strconv.FormatBool(*o.Completed))
+	}
+	if !o.DueBefore.IsZero() {
+		v.Set("due_before", o.DueBefore.Format(time.RFC3339))
+	}
+	if !o.DueAfter.IsZero() {
+		v.Set("due_after", o.DueAfter.Format(time.RFC3339))
+	}
+	if o.Query != "" {
+		v.Set("q", o.Query)
+	}
+	return v
+}
+
+type Page struct {
+	Todos []Todo
+	// Next is the cursor of the next page, empty on the last one.
+	Next string
+}
+
+var nextCursor = regexp.MustCompile(`[?&]cursor=([^&>]*)[^>]*>;\s*rel="next"`)
+
+func (c *Client) Health(ctx context.Context) error {
+	_, err := c.do(ctx, request{method: http.MethodGet, path: "/health"}, nil)
+	return err
+}
+
+func (c *Client) Get(ctx context.Context, id int) (Todo, error) {
+	var todo Todo
+	_, err := c.do(ctx, request{method: http.MethodGet, path: todoPath(id)}, &todo)
+	return todo, err
+}
+
+func (c *Client) List(ctx context.Context, opts ListOptions) (Page, error) {
+	var page Page
+	response, err := c.do(ctx, request{method: http.MethodGet, path: "/todos", query: opts.values()}, &page.Todos)
+	if err != nil {
+		return Page{}, err
+	}
+	if m := nextCursor.FindStringSubmatch(response.Header.Get("Link")); m != nil {
+		page.Next, _ = url.QueryUnescape(m[1])
+	}
+	return page, nil
+}
+
+// Search returns the todos matching every word of q, best match first. A
+// limit of zero uses the API's default.
+func (c *Client) Search(ctx context.Context, q string, limit int) ([]SearchResult, error) {
+	query := url.Values{"q": {q}}
+	if limit > 0 {
+		query.Set("limit", strconv.Itoa(limit))
+	}
+	var results []SearchResult
+	_, err := c.do(ctx, request{method: http.MethodGet, path: "/todos/search", query: query}, &results)
+	return results, err
+}
+
+// Create stores a new todo and returns it with its id and revision.
+func (c *Client) Create(ctx context.Context, todo Todo) (Todo, error) {
+	todo.Id, todo.Revision = 0, 0
+	var created Todo
+	_, err := c.do(ctx, request{method: http.MethodPost, path: "/todo", body: todo}, &created)
+	return created, err
+}
+
+// Update replaces a todo. With a non-zero Revision it fails with
+// ErrPreconditionFailed when the todo has been changed since.
+func (c *Client) Update(ctx context.Context, todo Todo) error {
+	r := request{method: http.MethodPut, path: todoPath(todo.Id), body: todo, id: todo.Id, revision: todo.Revision}
+	_, err := c.do(ctx, r, nil)
+	return err
+}
+
+// Patch applies a JSON Merge Patch, such as map[string]any{"Completed": true},
+// and returns the updated todo. A revision of zero applies it
+// unconditionally.
+func (c *Client) Patch(ctx context.Context, id, revision int, patch any) (Todo, error) {
+	r := request{method: http.MethodPatch, path: todoPath(id), body: patch, contentType: "application/merge-patch+json", id: id, revision: revision}
+	var todo Todo
+	_, err := c.do(ctx, r, &todo)
+	return todo, err
+}
+
+// Delete moves a todo to the trash. A revision of zero deletes it
+// unconditionally.
+func (c *Client) Delete(ctx context.Context, id, revision int) error {
+	_, err := c.do(ctx, request{method: http.MethodDelete, path: todoPath(id), id: id, revision: revision}, nil)
+	return err
+}
+
+// Toggle flips whether a todo is completed. A revision of zero toggles it
+// unconditionally.
+func (c *Client) Toggle(ctx context.Context, id, revision int) error {
+	r := request{method: http.MethodPost, path: fmt.Sprintf("/todo/toggle/%d", id), id: id, revision: revision}
+	_, err := c.do(ctx, r, nil)
+	return err
+}
+
+// CompleteAll marks every todo as completed and returns how many changed.
+func (c *Client) CompleteAll(ctx context.Context) (int, error) {
+	var reply struct{ Updated int }
+	_, err := c.do(ctx, request{method: http.MethodPost, path: "/todos/complete-all"}, &reply)
+	return reply.Updated, err
+}
+
+// DeleteCompleted moves completed todos to the trash and returns how many
+// were moved.
+func (c *Client) DeleteCompleted(ctx context.Context) (int, error) {
+	var reply struct{ Deleted int }
+	_, err := c.do(ctx, request{method: http.MethodDelete, path: "/todos/completed"}, &reply)
+	return reply.Deleted, err
+}
+
+// Trash lists deleted todos, most recently deleted first.
+func (c *Client) Trash(ctx context.Context) ([]TrashedTodo, error) {
+	var trash []TrashedTodo
+	_, err := c.do(ctx, request{method: http.MethodGet, path: "/trash"}, &trash)
+	return trash, err
+}
+
+// Restore moves a todo back from the trash. A revision of zero restores it
+// unconditionally.
+func (c *Client) Restore(ctx context.Context, id, revision int) (Todo, error) {
+	r := request{method: http.MethodPost, path: todoPath(id) + "/restore", id: id, revision: revision}
+	var todo Todo
+	_, err := c.do(ctx, r, &todo)
+	return todo, err
+}
+
+// Move is where to move a todo to: between the todos with ids After and
+// Before, either of which may be left zero, and into Section when set.
+type Move struct {
+	After   int
+	Before  int
+	Section *int `json:",omitempty"`
+}
+
+// Move reorders a todo or moves it to another section. A revision of zero
+// moves it unconditionally.
+func (c *Client) Move(ctx context.Context, id, revision int, move Move) (Todo, error) {
+	r := request{method: http.MethodPost, path: todoPath(id) + "/move", body: move, id: id, revision: revision}
+	var todo Todo
+	_, err := c.do(ctx, r, &todo)
+	return todo, err
+}
+
+// History lists the changes to a todo, oldest first.
+func (c *Client) History(ctx context.Context, id int) ([]Event, error) {
+	var events []Event
+	_, err := c.do(ctx, request{method: http.MethodGet, path: todoPath(id) + "/history"}, &events)
+	return events, err
+}
+
+// Events returns up to limit changes after the event with id since, oldest
+// first. A limit of zero uses the API's default.
+func (c *Client) Events(ctx context.Context, since, limit int) ([]Event, error) {
+	query := url.Values{"since": {strconv.Itoa(since)}}
+	if limit > 0 {
+		query.Set("limit", strconv.Itoa(limit))
+	}
+	var events []Event
+	_, err := c.do(ctx, request{method: http.MethodGet, path: "/events", query: query}, &events)
+	return events, err
+}
+
+// Batch kinds of operation.
+const (
+	OpCreate = "create"
+	OpUpdate = "update"
+	OpDelete = "delete"
+	OpToggle = "toggle"
+)
+
+// Operation is one write of a batch. Id names the todo of updates, deletes
+// and toggles, and a non-zero Revision makes the write conditional.
+type Operation struct {
+	Op       string `json:"op"`
+	Id       int    `json:"id,omitempty"`
+	Revision int    `json:"revision,omitempty"`
+	Todo     *Todo  `json:"todo,omitempty"`
+}
+
+// OperationResult reports one operation of a batch. Todo is nil for deletes
+// and Error is set when the operation failed.
+type OperationResult struct {
+	Status int    `json:"status"`
+	Todo   *Todo  `json:"todo,omitempty"`
+	Error  *Error `json:"error,omitempty"`
+}
+
+// Batch applies operations in one transaction. Unless continueOnError is set
+// the first failure rolls back the whole batch and is returned as an *Error
+// whose Operation is the index of the failed operation.
+func (c *Client) Batch(ctx context.Context, ops []Operation, continueOnError bool) ([]OperationResult, error) {
+	body := struct {
+		ContinueOnError bool        `json:"continueOnError"`
+		Operations      []Operation `json:"operations"`
+	}{continueOnError, ops}
+	var reply struct {
+		Results []OperationResult `json:"results"`
+	}
+	_, err := c.do(ctx, request{method: http.MethodPost, path: "/todos/batch", body: body}, &reply)
+	return reply.Results, err
+}
+
+func todoPath(id int) string {
+	return "/todo/" + strconv.Itoa(id)
+}
@@ -0,0 +1,421 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mcadenas-bjss/go-do-it/client"
+	"golang.org/x/term"
+)
+
+// listPageSize is how many todos ls and export fetch per request.
+const listPageSize = 100
+
+func (c *cli) add(fs *flag.FlagSet) func(context.Context, []string) error {
+	due := fs.String("due", "", `Due date, such as "tomorrow 5pm", "fri", "in 2 days" or "2024-06-01 09:00"`)
+	return func(ctx context.Context, args []string) error {
+		if len(args) == 0 {
+			return errUsage
+		}
+		todo := client.Todo{Description: strings.Join(args, " ")}
+		if *due != "" {
+			t, err := parseDue(*due, c.now())
+			if err != nil {
+				return err
+			}
+			todo.Time = &t
+		}
+		api, err := c.apiClient()
+		if err != nil {
+			return err
+		}
+		created, err := api.Create(ctx, todo)
+		if err != nil {
+			return err
+		}
+		return c.printTodo(created)
+	}
+}
+
+func (c *cli) ls(fs *flag.FlagSet) func(context.Context, []string) error {
+	done := fs.Bool("done", false, "Only list completed todos")
+	pending := fs.Bool("pending", false, "Only list todos that are not completed")
+	query := fs.String("q", "", "Only list todos whose description contains this, ignoring case")
+	dueBefore := fs.String("due-before", "", "Only list todos due before this date")
+	dueAfter := fs.String("due-after", "", "Only list todos due after this date")
+	sort := fs.String("sort", "", "Order by position, id, time or description")
+	desc := fs.Bool("desc", false, "Reverse the order")
+	limit := fs.Int("limit", 0, "List at most this many todos, 0 for all")
+	return func(ctx context.Context, args []string) error {
+		if len(args) > 0 || (*done && *pending) {
+			return errUsage
+		}
+		opts := client.ListOptions{Sort: *sort, Desc: *desc, Query: *query}
+		if *done || *pending {
+			opts.Completed = done
+		}
+		var err error
+		if opts.DueBefore, err = c.optionalDue(*dueBefore); err != nil {
+			return err
+		}
+		if opts.DueAfter, err = c.optionalDue(*dueAfter); err != nil {
+			return err
+		}
+		todos, err := c.listAll(ctx, opts, *limit)
+		if err != nil {
+			return err
+		}
+		return c.printTodos(todos)
+	}
+}
+
+func (c *cli) done(fs *flag.FlagSet) func(context.Context, []string) error {
+	undo := fs.Bool("undo", false, "Mark the todos as not completed instead")
+	return func(ctx context.Context, args []string) error {
+		ids, err := parseIds(args)
+		if err != nil {
+			return err
+		}
+		api, err := c.apiClient()
+		if err != nil {
+			return err
+		}
+		// A merge patch sets the state, so running done twice does not undo
+		// it the way toggling would.
+		var todos []client.Todo
+		for _, id := range ids {
+			todo, err := api.Patch(ctx, id, 0, map[string]any{"Completed": !*undo})
+			if err != nil {
+				return fmt.Errorf("todo %d: %w", id, err)
+			}
+			todos = append(todos, todo)
+		}
+		return c.printTodos(todos)
+	}
+}
+
+func (c *cli) edit(fs *flag.FlagSet) func(context.Context, []string) error {
+	description := fs.String("d", "", "New description")
+	due := fs.String("due", "", "New due date")
+	noDue := fs.Bool("no-due", false, "Remove the due date")
+	return func(ctx context.Context, args []string) error {
+		ids, err := parseIds(args)
+		if err != nil {
+			return err
+		}
+		if len(ids) != 1 || (*due != "" && *noDue) {
+			return errUsage
+		}
+		patch := map[string]any{}
+		if *description != "" {
+			patch["Description"] = *description
+		}
+		if *due != "" {
+			t, err := parseDue(*due, c.now())
+			if err != nil {
+				return err
+			}
+			patch["Time"] = t
+		}
+		if *noDue {
+			patch["Time"] = nil
+		}
+		if len(patch) == 0 {
+			return fmt.Errorf("nothing to change, use -d, -due or -no-due")
+		}
+
+		api, err := c.apiClient()
+		if err != nil {
+			return err
+		}
+		// Patch the revision that was read so a change made elsewhere in the
+		// meantime is reported instead of overwritten.
+		current, err := api.Get(ctx, ids[0])
+		if err != nil {
+			return err
+		}
+		todo, err := api.Patch(ctx, current.Id, current.Revision, patch)
+		if err != nil {
+			return err
+		}
+		return c.printTodo(todo)
+	}
+}
+
+func (c *cli) rm(fs *flag.FlagSet) func(context.Context, []string) error {
+	return func(ctx context.Context, args []string) error {
+		ids, err := parseIds(args)
+		if err != nil {
+			return err
+		}
+		api, err := c.apiClient()
+		if err != nil {
+			return err
+		}
+		for _, id := range ids {
+			if err := api.Delete(ctx, id, 0); err != nil {
+				return fmt.Errorf("todo %d: %w", id, err)
+			}
+			if c.format == formatTable {
+				fmt.Fprintf(c.out, "Moved todo %d to the trash\n", id)
+			}
+		}
+		if c.format == formatJSON {
+			return c.printJSON(ids)
+		}
+		return nil
+	}
+}
+
+func (c *cli) show(fs *flag.FlagSet) func(context.Context, []string) error {
+	history := fs.Bool("history", false, "Also list the changes made to the todo")
+	return func(ctx context.Context, args []string) error {
+		ids, err := parseIds(args)
+		if err != nil {
+			return err
+		}
+		if len(ids) != 1 {
+			return errUsage
+		}
+		api, err := c.apiClient()
+		if err != nil {
+			return err
+		}
+		todo, err := api.Get(ctx, ids[0])
+		if err != nil {
+			return err
+		}
+		if !*history {
+			return c.printTodo(todo)
+		}
+		events, err := api.History(ctx, todo.Id)
+		if err != nil {
+			return err
+		}
+		if c.format == formatJSON {
+			return c.printJSON(struct {
+				Todo    client.Todo
+				History []client.Event
+			}{todo, events})
+		}
+		if err := c.printTodo(todo); err != nil {
+			return err
+		}
+		fmt.Fprintln(c.out)
+		return c.printEvents(events)
+	}
+}
+
+func (c *cli) search(fs *flag.FlagSet) func(context.Context, []string) error {
+	limit := fs.Int("limit", 0, "Show at most this many results, 0 for the API's default")
+	return func(ctx context.Context, args []string) error {
+		if len(args) == 0 {
+			return errUsage
+		}
+		api, err := c.apiClient()
+		if err != nil {
+			return err
+		}
+		results, err := api.Search(ctx, strings.Join(args, " "), *limit)
+		if err != nil {
+			return err
+		}
+		if c.format == formatJSON {
+			return c.printJSON(results)
+		}
+		todos := make([]client.Todo, len(results))
+		for i, r := range results {
+			todos[i] = r.Todo
+		}
+		return c.printTodos(todos)
+	}
+}
+
+func (c *cli) export(fs *flag.FlagSet) func(context.Context, []string) error {
+	format := fs.String("format", "json", "Export format: json or csv")
+	return func(ctx context.Context, args []string) error {
+		if len(args) > 0 || (*format != "json" && *format != "csv") {
+			return errUsage
+		}
+		todos, err := c.listAll(ctx, client.ListOptions{}, 0)
+		if err != nil {
+			return err
+		}
+		if *format == "json" {
+			return c.printJSON(todos)
+		}
+
+		w := csv.NewWriter(c.out)
+		w.Write([]string{"id", "description", "due", "completed", "revision"})
+		for _, t := range todos {
+			due := ""
+			if t.Time != nil {
+				due = t.Time.Format(time.RFC3339)
+			}
+			w.Write([]string{strconv.Itoa(t.Id), t.Description, due, strconv.FormatBool(t.Completed), strconv.Itoa(t.Revision)})
+		}
+		w.Flush()
+		return w.Error()
+	}
+}
+
+func (c *cli) config(fs *flag.FlagSet) func(context.Context, []string) error {
+	return func(ctx context.Context, args []string) error {
+		switch {
+		case len(args) == 0:
+			config, err := c.settings()
+			if err != nil {
+				return err
+			}
+			if config.Token != "" {
+				config.Token = "(set)"
+			}
+			if c.format == formatJSON {
+				return c.printJSON(config)
+			}
+			fmt.Fprintf(c.out, "file:   %s\nserver: %s\ntoken:  %s\n", c.configPath, config.Server, config.Token)
+			return nil
+		case len(args) == 3 && args[0] == "set":
+			// Only the file is changed, without the environment or flags.
+			config, err := loadConfig(c.configPath)
+			if err != nil {
+				return err
+			}
+			switch args[1] {
+			case "server":
+				config.Server = args[2]
+			case "token":
+				config.Token = args[2]
+			default:
+				return fmt.Errorf("unknown key %q, use server or token", args[1])
+			}
+			return config.save(c.configPath)
+		}
+		return errUsage
+	}
+}
+
+func (c *cli) login(fs *flag.FlagSet) func(context.Context, []string) error {
+	name := fs.String("name", defaultTokenName(), "Name of the token, to tell it apart from the account's other tokens")
+	return func(ctx context.Context, args []string) error {
+		if len(args) != 1 {
+			return errUsage
+		}
+		config, err := c.settings()
+		if err != nil {
+			return err
+		}
+		if err := checkServer(config.Server); err != nil {
+			return err
+		}
+		password, err := c.readPassword(fmt.Sprintf("Password for %s: ", args[0]))
+		if err != nil {
+			return err
+		}
+
+		api := client.New(config.Server, client.WithBasicAuth(args[0], password))
+		token, err := api.CreateToken(ctx, client.TokenRequest{Name: *name})
+		if err != nil {
+			return err
+		}
+		// The token is saved without the server or token given by the
+		// environment or flags.
+		file, err := loadConfig(c.configPath)
+		if err != nil {
+			return err
+		}
+		file.Token = token.Token
+		if err := file.save(c.configPath); err != nil {
+			return err
+		}
+		fmt.Fprintf(c.errOut, "Signed in as %s, the token is saved in %s\n", args[0], c.configPath)
+		return nil
+	}
+}
+
+// defaultTokenName names tokens after the machine they were created on.
+func defaultTokenName() string {
+	host, err := os.Hostname()
+	if err != nil {
+		return "godoit"
+	}
+	return "godoit on " + host
+}
+
+// readPassword prompts for a password without echoing it when reading from
+// a terminal, and otherwise reads the first line of the input so scripts can
+// pipe it in.
+func (c *cli) readPassword(prompt string) (string, error) {
+	if f, ok := c.in.(*os.File); ok && term.IsTerminal(int(f.Fd())) {
+		fmt.Fprint(c.errOut, prompt)
+		password, err := term.ReadPassword(int(f.Fd()))
+		fmt.Fprintln(c.errOut)
+		return string(password), err
+	}
+	line, err := bufio.NewReader(c.in).ReadString('\n')
+	if err != nil && line == "" {
+		return "", fmt.Errorf("reading the password failed: %w", err)
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// listAll fetches todos page by page, stopping after limit todos unless it
+// is zero.
+func (c *cli) listAll(ctx context.Context, opts client.ListOptions, limit int) ([]client.Todo, error) {
+	api, err := c.apiClient()
+	if err != nil {
+		return nil, err
+	}
+	todos := []client.Todo{}
+	opts.Limit = listPageSize
+	for {
+		if limit > 0 && limit-len(todos) < opts.Limit {
+			opts.Limit = limit - len(todos)
+		}
+		page, err := api.List(ctx, opts)
+		if err != nil {
+			return nil, err
+		}
+		todos = append(todos, page.Todos...)
+		if page.Next == "" || (limit > 0 && len(todos) >= limit) {
+			return todos, nil
+		}
+		opts.Cursor = page.Next
+	}
+}
+
+func (c *cli) optionalDue(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	return parseDue(s, c.now())
+}
+
+func parseIds(args []string) ([]int, error) {
+	if len(args) == 0 {
+		return nil, errUsage
+	}
+	ids := make([]int, len(args))
+	for i, arg := range args {
+		id, err := strconv.Atoi(arg)
+		if err != nil || id < 1 {
+			return nil, fmt.Errorf("%q is not a todo id", arg)
+		}
+		ids[i] = id
+	}
+	return ids, nil
+}
+
+func (c *cli) printJSON(v any) error {
+	encoder := json.NewEncoder(c.out)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+)
+
+func (c *cli) completion(fs *flag.FlagSet) func(context.Context, []string) error {
+	return func(ctx context.Context, args []string) error {
+		if len(args) != 1 {
+			return errUsage
+		}
+		switch args[0] {
+		case "bash":
+			writeBashCompletion(c.out)
+		case "zsh":
+			// zsh runs bash completions through bashcompinit.
+			fmt.Fprint(c.out, "autoload -U +X bashcompinit && bashcompinit\n")
+			writeBashCompletion(c.out)
+		case "fish":
+			writeFishCompletion(c.out)
+		default:
+			return errUsage
+		}
+		return nil
+	}
+}
+
+// commandFlags lists the flags of a command, with a leading dash.
+func commandFlags(cmd command) []string {
+	fs := (&cli{}).flagSet(cmd.name)
+	cmd.setup(&cli{}, fs)
+	var flags []string
+	fs.VisitAll(func(f *flag.Flag) {
+		flags = append(flags, "-"+f.Name)
+	})
+	return flags
+}
+
+func commandNames() []string {
+	names := make([]string, len(commands))
+	for i, cmd := range commands {
+		names[i] = cmd.name
+	}
+	return names
+}
+
+func writeBashCompletion(w io.Writer) {
+	fmt.Fprint(w, "_godoit() {\n")
+	fmt.Fprint(w, "  local cur=${COMP_WORDS[COMP_CWORD]} cmd=\"\" i\n")
+	fmt.Fprint(w, "  for ((i = 1; i < COMP_CWORD; i++)); do\n")
+	fmt.Fprint(w, "    case ${COMP_WORDS[i]} in\n")
+	fmt.Fprint(w, "      -o|-server|-token|-config) ((i++)) ;;\n")
+	fmt.Fprint(w, "      -*) ;;\n")
+	fmt.Fprint(w, "      *) cmd=${COMP_WORDS[i]}; break ;;\n")
+	fmt.Fprint(w, "    esac\n")
+	fmt.Fprint(w, "  done\n")
+	fmt.Fprint(w, "  local words\n")
+	fmt.Fprint(w, "  case $cmd in\n")
+	fmt.Fprintf(w, "    \"\") words=%q ;;\n", strings.Join(commandNames(), " "))
+	for _, cmd := range commands {
+		words := commandFlags(cmd)
+		switch cmd.name {
+		case "completion":
+			words = append(words, "bash", "zsh", "fish")
+		case "config":
+			words = append(words, "set", "server", "token")
+		}
+		fmt.Fprintf(w, "    %s) words=%q ;;\n", cmd.name, strings.Join(words, " "))
+	}
+	fmt.Fprint(w, "  esac\n")
+	fmt.Fprint(w, "  COMPREPLY=($(compgen -W \"$words\" -- \"$cur\"))\n")
+	fmt.Fprint(w, "}\n")
+	fmt.Fprint(w, "complete -F _godoit godoit\n")
+}
+
+func writeFishCompletion(w io.Writer) {
+	fmt.Fprint(w, "complete -c godoit -f\n")
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "complete -c godoit -n __fish_use_subcommand -a %s -d %q\n", cmd.name, cmd.summary)
+		for _, f := range commandFlags(cmd) {
+			fmt.Fprintf(w, "complete -c godoit -n '__fish_seen_subcommand_from %s' -o %s\n", cmd.name, strings.TrimPrefix(f, "-"))
+		}
+	}
+	fmt.Fprint(w, "complete -c godoit -n '__fish_seen_subcommand_from completion' -a 'bash zsh fish'\n")
+}
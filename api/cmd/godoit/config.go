@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Config is how godoit reaches the API. It is read from the config file, then
+// the environment and finally the command line flags.
+type Config struct {
+	// Server is the base of every API path, such as
+	// http://localhost:8000/api.
+	Server string `json:"server"`
+	// Token is sent as a bearer token when set.
+	Token string `json:"token,omitempty"`
+}
+
+// Environment variables overriding the config file, shared with the desktop
+// app.
+const (
+	envConfig = "GODOIT_CONFIG"
+	envServer = "GODOIT_SERVER_URL"
+	envToken  = "GODOIT_TOKEN"
+)
+
+func defaultConfig() Config {
+	return Config{Server: "http://localhost:8000/api"}
+}
+
+// defaultConfigPath is godoit.json in the user's config directory.
+func defaultConfigPath() string {
+	if path, ok := os.LookupEnv(envConfig); ok {
+		return path
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		dir = "."
+	}
+	return filepath.Join(dir, "go-do-it", "godoit.json")
+}
+
+// loadConfig reads the config file on top of the defaults. A missing file is
+// not an error.
+func loadConfig(path string) (Config, error) {
+	c := defaultConfig()
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return Config{}, err
+	}
+	if err := json.Unmarshal(data, &c); err != nil {
+		return Config{}, fmt.Errorf("reading %s failed: %w", path, err)
+	}
+	return c, nil
+}
+
+// save writes the config file. It is only readable by the user as it may
+// hold a token.
+func (c Config) save(path string) error {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o600)
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Times of day used when a due date names a day but not a time.
+const (
+	endOfDayHour, endOfDayMinute = 23, 59
+	tonightHour                  = 20
+)
+
+var (
+	relativeDue = regexp.MustCompile(`^in (an?|\d+) (minute|hour|day|week)s?$`)
+	clock       = regexp.MustCompile(`^(\d{1,2})(?::(\d{2}))?(am|pm)?$`)
+)
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "sunday": time.Sunday,
+	"mon": time.Monday, "monday": time.Monday,
+	"tue": time.Tuesday, "tues": time.Tuesday, "tuesday": time.Tuesday,
+	"wed": time.Wednesday, "wednesday": time.Wednesday,
+	"thu": time.Thursday, "thurs": time.Thursday, "thursday": time.Thursday,
+	"fri": time.Friday, "friday": time.Friday,
+	"sat": time.Saturday, "saturday": time.Saturday,
+}
+
+// parseDue reads a due date relative to now, such as "tomorrow 5pm",
+// "fri at 9:30", "next monday", "in 3 days", "2024-06-01" or an RFC 3339
+// time. Days given without a time are due at the end of the day, except
+// "tonight".
+func parseDue(s string, now time.Time) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	for _, layout := range []string{time.RFC3339, "2006-01-02T15:04", "2006-01-02 15:04"} {
+		if t, err := time.ParseInLocation(layout, s, now.Location()); err == nil {
+			return t, nil
+		}
+	}
+
+	lower := strings.ToLower(s)
+	if m := relativeDue.FindStringSubmatch(lower); m != nil {
+		now = now.Truncate(time.Minute)
+		n := 1
+		if m[1] != "a" && m[1] != "an" {
+			n, _ = strconv.Atoi(m[1])
+		}
+		switch m[2] {
+		case "minute":
+			return now.Add(time.Duration(n) * time.Minute), nil
+		case "hour":
+			return now.Add(time.Duration(n) * time.Hour), nil
+		case "day":
+			return now.AddDate(0, 0, n), nil
+		default:
+			return now.AddDate(0, 0, 7*n), nil
+		}
+	}
+
+	words := strings.Fields(lower)
+	hour, minute, timed := endOfDayHour, endOfDayMinute, false
+	if n := len(words); n > 0 {
+		if h, m, ok := clockTime(words[n-1]); ok {
+			hour, minute, timed = h, m, true
+			words = words[:n-1]
+			if n := len(words); n > 0 && words[n-1] == "at" {
+				words = words[:n-1]
+			}
+		}
+	}
+
+	day, ok := dayOf(strings.Join(words, " "), now)
+	if !ok || (len(words) == 0 && !timed) {
+		return time.Time{}, fmt.Errorf("%q is not a due date, try \"tomorrow 5pm\", \"fri\", \"in 2 days\" or \"2024-06-01 09:00\"", s)
+	}
+	if !timed && len(words) == 1 && words[0] == "tonight" {
+		hour, minute = tonightHour, 0
+	}
+	return time.Date(day.Year(), day.Month(), day.Day(), hour, minute, 0, 0, now.Location()), nil
+}
+
+// dayOf resolves the day part of a due date. An empty day is today.
+func dayOf(s string, now time.Time) (time.Time, bool) {
+	switch s {
+	case "", "today", "tonight":
+		return now, true
+	case "tomorrow":
+		return now.AddDate(0, 0, 1), true
+	case "next week":
+		return now.AddDate(0, 0, 7), true
+	}
+	if t, err := time.ParseInLocation("2006-01-02", s, now.Location()); err == nil {
+		return t, true
+	}
+	// "friday" and "next friday" are both the first Friday after today.
+	if day, ok := weekdays[strings.TrimPrefix(s, "next ")]; ok {
+		ahead := (int(day) - int(now.Weekday()) + 7) % 7
+		if ahead == 0 {
+			ahead = 7
+		}
+		return now.AddDate(0, 0, ahead), true
+	}
+	return time.Time{}, false
+}
+
+// clockTime reads a time of day such as 17:00, 5pm, 9:30am or noon. A bare
+// number is not a time, so it is never mistaken for part of a date.
+func clockTime(s string) (hour, minute int, ok bool) {
+	switch s {
+	case "noon":
+		return 12, 0, true
+	case "midnight":
+		return 0, 0, true
+	}
+	m := clock.FindStringSubmatch(s)
+	if m == nil || (m[2] == "" && m[3] == "") {
+		return 0, 0, false
+	}
+	hour, _ = strconv.Atoi(m[1])
+	if m[2] != "" {
+		minute, _ = strconv.Atoi(m[2])
+	}
+	switch m[3] {
+	case "am", "pm":
+		if hour < 1 || hour > 12 {
+			return 0, 0, false
+		}
+		hour %= 12
+		if m[3] == "pm" {
+			hour += 12
+		}
+	}
+	if hour > 23 || minute > 59 {
+		return 0, 0, false
+	}
+	return hour, minute, true
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseDue(t *testing.T) {
+	// A Wednesday.
+	now := time.Date(2024, 5, 15, 10, 30, 45, 0, time.UTC)
+	day := func(d, h, m int) time.Time {
+		return time.Date(2024, 5, d, h, m, 0, 0, time.UTC)
+	}
+
+	cases := []struct {
+		input string
+		want  time.Time
+	}{
+		{"2024-06-01T09:00:00+02:00", time.Date(2024, 6, 1, 7, 0, 0, 0, time.UTC)},
+		{"2024-06-01 09:00", time.Date(2024, 6, 1, 9, 0, 0, 0, time.UTC)},
+		{"2024-06-01", time.Date(2024, 6, 1, 23, 59, 0, 0, time.UTC)},
+		{"2024-06-01 5pm", time.Date(2024, 6, 1, 17, 0, 0, 0, time.UTC)},
+		{"today", day(15, 23, 59)},
+		{"tonight", day(15, 20, 0)},
+		{"5pm", day(15, 17, 0)},
+		{"Tomorrow at 9:30am", day(16, 9, 30)},
+		{"tomorrow noon", day(16, 12, 0)},
+		{"fri", day(17, 23, 59)},
+		{"next monday 17:00", day(20, 17, 0)},
+		{"wednesday", day(22, 23, 59)},
+		{"next week", day(22, 23, 59)},
+		{"in 3 days", day(18, 10, 30)},
+		{"in an hour", day(15, 11, 30)},
+		{"in 2 weeks", day(29, 10, 30)},
+	}
+	for _, c := range cases {
+		t.Run(c.input, func(t *testing.T) {
+			got, err := parseDue(c.input, now)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !got.Equal(c.want) {
+				t.Errorf("got %v want %v", got, c.want)
+			}
+		})
+	}
+
+	for _, input := range []string{"", "someday", "at", "13pm", "25:00", "tomorrow 5", "2024-02-30"} {
+		t.Run("rejects "+input, func(t *testing.T) {
+			if got, err := parseDue(input, now); err == nil {
+				t.Errorf("got %v want an error", got)
+			}
+		})
+	}
+}
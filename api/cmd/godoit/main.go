@@ -0,0 +1,228 @@
+// Command godoit manages todos from the terminal through the API.
+//
+//	godoit add Buy milk -due "tomorrow 5pm"
+//	godoit ls -pending
+//	godoit done 3
+//
+// Run godoit help for every command.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/mcadenas-bjss/go-do-it/client"
+)
+
+// Output formats.
+const (
+	formatTable = "table"
+	formatJSON  = "json"
+)
+
+// errUsage is returned for bad arguments, after the usage has been printed.
+var errUsage = errors.New("usage")
+
+// cli is the state shared by every command.
+type cli struct {
+	in          io.Reader
+	out, errOut io.Writer
+	now         func() time.Time
+
+	// Flags accepted before and after the command name.
+	configPath, server, token, format string
+
+	api *client.Client
+}
+
+// command is one godoit subcommand. setup registers the command's flags and
+// returns what runs it with the remaining arguments.
+type command struct {
+	name    string
+	args    string
+	summary string
+	setup   func(c *cli, fs *flag.FlagSet) func(ctx context.Context, args []string) error
+}
+
+// commands lists every subcommand in the order help shows them. It is filled
+// in by init to let help and completion refer to it.
+var commands []command
+
+func init() {
+	commands = []command{
+		{"add", "<description>...", "Add a todo", (*cli).add},
+		{"ls", "", "List todos", (*cli).ls},
+		{"done", "<id>...", "Mark todos as completed", (*cli).done},
+		{"edit", "<id>", "Change the description or due date of a todo", (*cli).edit},
+		{"rm", "<id>...", "Move todos to the trash", (*cli).rm},
+		{"show", "<id>", "Show a todo", (*cli).show},
+		{"search", "<words>...", "Search descriptions, best match first", (*cli).search},
+		{"export", "", "Write every todo as JSON or CSV", (*cli).export},
+		{"login", "<username>", "Sign in and save an API token to the config file", (*cli).login},
+		{"config", "[set <key> <value>]", "Show or change the config file", (*cli).config},
+		{"completion", "bash|zsh|fish", "Print a shell completion script", (*cli).completion},
+	}
+}
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	os.Exit(run(ctx, os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// run runs godoit with the given arguments and returns the exit code: 0 on
+// success, 1 when the command failed and 2 for bad arguments.
+func run(ctx context.Context, args []string, in io.Reader, out, errOut io.Writer) int {
+	c := &cli{in: in, out: out, errOut: errOut, now: time.Now, configPath: defaultConfigPath(), format: formatTable}
+
+	fs := c.flagSet("godoit")
+	fs.Usage = c.usage
+	if err := fs.Parse(args); err != nil {
+		return exitCode(err)
+	}
+	args = fs.Args()
+	if len(args) == 0 || args[0] == "help" {
+		c.usage()
+		if len(args) == 0 {
+			return 2
+		}
+		return 0
+	}
+
+	for _, cmd := range commands {
+		if cmd.name != args[0] {
+			continue
+		}
+		fs := c.flagSet("godoit " + cmd.name)
+		runCmd := cmd.setup(c, fs)
+		fs.Usage = func() {
+			fmt.Fprintf(errOut, "Usage: godoit %s [flags] %s\n\n%s.\n\nFlags:\n", cmd.name, cmd.args, cmd.summary)
+			fs.PrintDefaults()
+		}
+		positional, err := parseInterspersed(fs, args[1:])
+		if err != nil {
+			return exitCode(err)
+		}
+		if c.format != formatTable && c.format != formatJSON {
+			fmt.Fprintf(errOut, "godoit: -o must be %s or %s\n", formatTable, formatJSON)
+			return 2
+		}
+		if err := runCmd(ctx, positional); err != nil {
+			if errors.Is(err, errUsage) {
+				fs.Usage()
+				return 2
+			}
+			fmt.Fprintf(errOut, "godoit: %v\n", err)
+			return 1
+		}
+		return 0
+	}
+	fmt.Fprintf(errOut, "godoit: unknown command %q, run godoit help\n", args[0])
+	return 2
+}
+
+// flagSet returns a flag set with the flags every command accepts.
+func (c *cli) flagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(c.errOut)
+	fs.StringVar(&c.configPath, "config", c.configPath, "Config file, also set with $"+envConfig)
+	fs.StringVar(&c.server, "server", c.server, "Base URL of the API, overriding the config file")
+	fs.StringVar(&c.token, "token", c.token, "Token sent to the API, overriding the config file")
+	fs.StringVar(&c.format, "o", c.format, "Output format: table or json")
+	return fs
+}
+
+// parseInterspersed parses flags wherever they are among the arguments, so
+// "godoit add Buy milk -due friday" works. Arguments after -- are never
+// flags.
+func parseInterspersed(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		rest := fs.Args()
+		if len(rest) == 0 {
+			return positional, nil
+		}
+		// Parse drops a -- that ends the flags, leaving only positional
+		// arguments.
+		if len(rest) < len(args) && args[len(args)-len(rest)-1] == "--" {
+			return append(positional, rest...), nil
+		}
+		positional = append(positional, rest[0])
+		args = rest[1:]
+	}
+}
+
+func exitCode(err error) int {
+	if errors.Is(err, flag.ErrHelp) {
+		return 0
+	}
+	return 2
+}
+
+func (c *cli) usage() {
+	fmt.Fprint(c.errOut, "Usage: godoit [flags] <command> [arguments]\n\nCommands:\n")
+	for _, cmd := range commands {
+		fmt.Fprintf(c.errOut, "  %-11s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprint(c.errOut, "\nRun godoit <command> -h for the flags of a command.\n\nFlags:\n")
+	fs := c.flagSet("godoit")
+	fs.PrintDefaults()
+}
+
+// apiClient returns the API client, reading the config file the first time.
+func (c *cli) apiClient() (*client.Client, error) {
+	if c.api != nil {
+		return c.api, nil
+	}
+	config, err := c.settings()
+	if err != nil {
+		return nil, err
+	}
+	if err := checkServer(config.Server); err != nil {
+		return nil, err
+	}
+	var opts []client.Option
+	if config.Token != "" {
+		opts = append(opts, client.WithToken(config.Token))
+	}
+	c.api = client.New(config.Server, opts...)
+	return c.api, nil
+}
+
+func checkServer(server string) error {
+	if !strings.HasPrefix(server, "http://") && !strings.HasPrefix(server, "https://") {
+		return fmt.Errorf("server %q must be an http or https URL", server)
+	}
+	return nil
+}
+
+// settings returns the config file with the environment and flags applied.
+func (c *cli) settings() (Config, error) {
+	config, err := loadConfig(c.configPath)
+	if err != nil {
+		return Config{}, err
+	}
+	if v, ok := os.LookupEnv(envServer); ok {
+		config.Server = v
+	}
+	if v, ok := os.LookupEnv(envToken); ok {
+		config.Token = v
+	}
+	if c.server != "" {
+		config.Server = c.server
+	}
+	if c.token != "" {
+		config.Token = c.token
+	}
+	return config, nil
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mcadenas-bjss/go-do-it/client"
+	"github.com/mcadenas-bjss/go-do-it/server"
+	"github.com/mcadenas-bjss/go-do-it/store"
+)
+
+func TestMain(m *testing.M) {
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+// godoit runs the CLI against a server with a config file in a temporary
+// directory.
+type godoit struct {
+	t      *testing.T
+	config string
+}
+
+func newGodoit(t *testing.T) godoit {
+	t.Helper()
+	ts := httptest.NewServer(server.NewTodoServer(store.NewMemoryTodoStore()))
+	t.Cleanup(ts.Close)
+	t.Setenv(envServer, ts.URL+"/api")
+	return godoit{t: t, config: filepath.Join(t.TempDir(), "godoit.json")}
+}
+
+func (g godoit) run(args ...string) (stdout, stderr string, code int) {
+	return g.runWithInput("", args...)
+}
+
+func (g godoit) runWithInput(input string, args ...string) (stdout, stderr string, code int) {
+	var out, errOut bytes.Buffer
+	code = run(context.Background(), append([]string{"-config", g.config}, args...), strings.NewReader(input), &out, &errOut)
+	return out.String(), errOut.String(), code
+}
+
+// mustRun runs godoit and decodes its JSON output into v.
+func (g godoit) mustRun(v any, args ...string) {
+	g.t.Helper()
+	stdout, stderr, code := g.run(append([]string{"-o", "json"}, args...)...)
+	if code != 0 {
+		g.t.Fatalf("godoit %v exited with %d: %s", args, code, stderr)
+	}
+	if v != nil {
+		if err := json.Unmarshal([]byte(stdout), v); err != nil {
+			g.t.Fatalf("godoit %v printed %q: %v", args, stdout, err)
+		}
+	}
+}
+
+func TestCommands(t *testing.T) {
+	g := newGodoit(t)
+
+	var milk, quoted client.Todo
+	g.mustRun(&milk, "add", "Buy", "milk", "-due", "2024-06-01 09:00")
+	if milk.Id != 1 || milk.Description != "Buy milk" || milk.Time == nil {
+		t.Fatalf("unexpected todo %+v", milk)
+	}
+	g.mustRun(&quoted, "add", `Say "hello" to Bob's cat`)
+	if quoted.Description != `Say "hello" to Bob's cat` {
+		t.Errorf("got description %q", quoted.Description)
+	}
+
+	t.Run("marks todos as done", func(t *testing.T) {
+		var todos []client.Todo
+		g.mustRun(&todos, "done", "1", "2")
+		g.mustRun(nil, "done", "2")
+		g.mustRun(&todos, "ls", "-done")
+		if len(todos) != 2 {
+			t.Errorf("got %+v want both todos done", todos)
+		}
+		g.mustRun(nil, "done", "-undo", "2")
+		g.mustRun(&todos, "ls", "-pending")
+		if len(todos) != 1 || todos[0].Id != 2 {
+			t.Errorf("got %+v want todo 2 pending", todos)
+		}
+	})
+
+	t.Run("edits todos", func(t *testing.T) {
+		var todo client.Todo
+		g.mustRun(&todo, "edit", "1", "-d", "Buy oat milk", "-no-due")
+		if todo.Description != "Buy oat milk" || todo.Time != nil {
+			t.Errorf("unexpected todo %+v", todo)
+		}
+		if _, stderr, code := g.run("edit", "1"); code != 1 || !strings.Contains(stderr, "nothing to change") {
+			t.Errorf("got %d %q", code, stderr)
+		}
+	})
+
+	t.Run("shows todos as a table", func(t *testing.T) {
+		stdout, _, code := g.run("show", "-history", "1")
+		if code != 0 || !strings.Contains(stdout, "ID  DONE  DUE  DESCRIPTION") || !strings.Contains(stdout, `renamed to "Buy oat milk"`) {
+			t.Errorf("got %d %q", code, stdout)
+		}
+	})
+
+	t.Run("removes todos", func(t *testing.T) {
+		stdout, _, code := g.run("rm", "2")
+		if code != 0 || stdout != "Moved todo 2 to the trash\n" {
+			t.Errorf("got %d %q", code, stdout)
+		}
+		_, stderr, code := g.run("show", "2")
+		if code != 1 || !strings.Contains(stderr, "not_found") {
+			t.Errorf("got %d %q", code, stderr)
+		}
+	})
+
+	t.Run("exports todos", func(t *testing.T) {
+		stdout, _, code := g.run("export", "-format", "csv")
+		want := "id,description,due,completed,revision\n1,Buy oat milk,,true,3\n"
+		if code != 0 || stdout != want {
+			t.Errorf("got %d %q want %q", code, stdout, want)
+		}
+	})
+
+	t.Run("lists every page", func(t *testing.T) {
+		for i := 0; i < listPageSize; i++ {
+			g.mustRun(nil, "add", "todo")
+		}
+		var todos []client.Todo
+		g.mustRun(&todos, "ls")
+		if len(todos) != listPageSize+1 {
+			t.Errorf("got %d todos want %d", len(todos), listPageSize+1)
+		}
+		g.mustRun(&todos, "ls", "-limit", "5")
+		if len(todos) != 5 {
+			t.Errorf("got %d todos want 5", len(todos))
+		}
+	})
+}
+
+func TestConfig(t *testing.T) {
+	g := newGodoit(t)
+	t.Setenv(envServer, "")
+	os.Unsetenv(envServer)
+
+	if _, _, code := g.run("config", "set", "server", "ftp://nowhere"); code != 0 {
+		t.Fatalf("config set exited with %d", code)
+	}
+	if _, stderr, code := g.run("ls"); code != 1 || !strings.Contains(stderr, "must be an http or https URL") {
+		t.Errorf("got %d %q", code, stderr)
+	}
+
+	g.run("config", "set", "token", "secret")
+	var config Config
+	g.mustRun(&config, "config")
+	if config.Server != "ftp://nowhere" || config.Token != "(set)" {
+		t.Errorf("unexpected config %+v", config)
+	}
+
+	_, stderr, code := g.run("config", "set", "colour", "blue")
+	if code != 1 || !strings.Contains(stderr, "unknown key") {
+		t.Errorf("got %d %q", code, stderr)
+	}
+}
+
+func TestLogin(t *testing.T) {
+	s := store.NewMemoryTodoStore()
+	ts := httptest.NewServer(server.NewTodoServer(s, server.WithAuth(s)))
+	t.Cleanup(ts.Close)
+	t.Setenv(envServer, ts.URL+"/api")
+	g := godoit{t: t, config: filepath.Join(t.TempDir(), "godoit.json")}
+
+	response, err := http.Post(ts.URL+"/api/auth/register", "application/json", strings.NewReader(`{"Username": "alice", "Password": "correct horse"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+
+	if _, stderr, code := g.run("ls"); code != 1 || !strings.Contains(stderr, "unauthenticated") {
+		t.Errorf("got %d %q before signing in", code, stderr)
+	}
+	if _, stderr, code := g.runWithInput("wrong password\n", "login", "alice"); code != 1 || !strings.Contains(stderr, "wrong username or password") {
+		t.Errorf("got %d %q", code, stderr)
+	}
+	if _, stderr, code := g.runWithInput("correct horse\n", "login", "-name", "test", "alice"); code != 0 {
+		t.Fatalf("login exited with %d: %s", code, stderr)
+	}
+
+	config, err := loadConfig(g.config)
+	if err != nil || !strings.HasPrefix(config.Token, "gdi_") {
+		t.Errorf("got %+v, %v want a saved token", config, err)
+	}
+	g.mustRun(nil, "add", "Buy milk")
+	var todos []client.Todo
+	g.mustRun(&todos, "ls")
+	if len(todos) != 1 {
+		t.Errorf("got %+v", todos)
+	}
+}
+
+func TestUsage(t *testing.T) {
+	g := godoit{t: t, config: filepath.Join(t.TempDir(), "godoit.json")}
+
+	cases := []struct {
+		args []string
+		code int
+	}{
+		{nil, 2},
+		{[]string{"help"}, 0},
+		{[]string{"frobnicate"}, 2},
+		{[]string{"add"}, 2},
+		{[]string{"show", "abc"}, 1},
+		{[]string{"ls", "-done", "-pending"}, 2},
+		{[]string{"-o", "yaml", "ls"}, 2},
+		{[]string{"add", "-h"}, 0},
+	}
+	for _, c := range cases {
+		if _, _, code := g.run(c.args...); code != c.code {
+			t.Errorf("godoit %v exited with %d want %d", c.args, code, c.code)
+		}
+	}
+}
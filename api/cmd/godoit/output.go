@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"text/tabwriter"
+	"time"
+
+	"github.com/mcadenas-bjss/go-do-it/client"
+)
+
+// dueLayout shows due dates in the local timezone.
+const dueLayout = "Mon 02 Jan 2006 15:04"
+
+// printTodo writes one todo as a table or a JSON object.
+func (c *cli) printTodo(todo client.Todo) error {
+	if c.format == formatJSON {
+		return c.printJSON(todo)
+	}
+	return c.printTodos([]client.Todo{todo})
+}
+
+// printTodos writes todos as a table or a JSON array.
+func (c *cli) printTodos(todos []client.Todo) error {
+	if c.format == formatJSON {
+		return c.printJSON(todos)
+	}
+
+	w := tabwriter.NewWriter(c.out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tDONE\tDUE\tDESCRIPTION")
+	for _, t := range todos {
+		done := ""
+		if t.Completed {
+			done = "x"
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", t.Id, done, formatDue(t.Time), t.Description)
+	}
+	return w.Flush()
+}
+
+// printEvents writes the history of a todo as a table.
+func (c *cli) printEvents(events []client.Event) error {
+	w := tabwriter.NewWriter(c.out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "AT\tBY\tCHANGE")
+	for _, e := range events {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", e.At.Local().Format(dueLayout), e.Actor, describeEvent(e))
+	}
+	return w.Flush()
+}
+
+// describeEvent summarises what an event changed.
+func describeEvent(e client.Event) string {
+	switch {
+	case e.Before == nil && e.After != nil:
+		return fmt.Sprintf("created %q", e.After.Description)
+	case e.After == nil:
+		return "deleted"
+	case e.Before.Description != e.After.Description:
+		return fmt.Sprintf("renamed to %q", e.After.Description)
+	case e.Before.Completed != e.After.Completed:
+		if e.After.Completed {
+			return "completed"
+		}
+		return "reopened"
+	case formatDue(e.Before.Time) != formatDue(e.After.Time):
+		if e.After.Time == nil {
+			return "due date removed"
+		}
+		return "due " + formatDue(e.After.Time)
+	}
+	return e.Op
+}
+
+func formatDue(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.Local().Format(dueLayout)
+}
@@ -5,4 +5,8 @@ go 1.22.6
 require (
 	github.com/mattn/go-sqlite3 v1.14.22
 	github.com/pkg/errors v0.9.1
+	golang.org/x/crypto v0.23.0
+	golang.org/x/net v0.25.0
+	golang.org/x/sys v0.21.0 // indirect
+	golang.org/x/term v0.21.0
 )
@@ -1,10 +1,15 @@
 package main
 
 import (
+	"context"
 	"flag"
+	"fmt"
+	"io"
 	"log"
 	"net/http"
+	"os"
 	"strconv"
+	"time"
 
 	"github.com/mcadenas-bjss/go-do-it/logger"
 	"github.com/mcadenas-bjss/go-do-it/server"
@@ -14,31 +19,112 @@ import (
 func main() {
 	log := logger.NewLogger(nil)
 	log.SetLevel(logger.Info)
-	var port, logLevel int
-	var db string
+	var port, logLevel, readers int
+	var db, file, backend, migrate, tz string
+	var trashRetention time.Duration
+	var auth bool
 
 	// Get the command line arguments
 	flag.IntVar(&port, "port", 8000, "Port number")
 	flag.IntVar(&logLevel, "logLevel", 0, "Log level")
+	flag.IntVar(&readers, "readers", store.DefaultReadWorkers, "Number of read requests served in parallel")
 	flag.StringVar(&db, "db", "todo.db", "Database file path")
+	flag.StringVar(&file, "file", "todo.json", "JSON file path used by the file store")
+	flag.StringVar(&backend, "store", "sqlite", "Storage backend: sqlite, memory or file")
+	flag.StringVar(&tz, "tz", "Local", "IANA timezone due dates are shown in when the client does not send one")
+	flag.DurationVar(&trashRetention, "trashRetention", server.DefaultTrashRetention, "How long deleted todos stay in the trash before being purged, 0 to keep them")
+	flag.BoolVar(&auth, "auth", true, "Require users to sign in and give each their own todos, false for one shared list")
+	flag.StringVar(&migrate, "migrate", "", "Inspect or apply schema migrations and exit: status, dry-run or up")
 
 	flag.Parse()
 
+	if migrate != "" {
+		if err := runMigrations(db, migrate, os.Stdout); err != nil {
+			log.Error(err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	// logger.SetLevel(logLevel)
 
-	dataStore, err := store.NewDbTodoStore(db)
+	location, err := time.LoadLocation(tz)
+	if err != nil {
+		log.Error(err)
+		os.Exit(1)
+	}
 
+	dataStore, err := newStore(backend, db, file)
 	if err != nil {
 		panic(err)
 	}
 
 	log.Info("Starting server on port " + strconv.Itoa(port))
-	server := server.NewTodoServer(dataStore)
-	if err := http.ListenAndServe("localhost:"+strconv.Itoa(port), server); err != nil {
+	opts := []server.Option{server.WithReadWorkers(readers), server.WithTimezone(location), server.WithTrashRetention(trashRetention)}
+	if auth {
+		opts = append(opts, server.WithAuth(dataStore.(store.UserStore)), server.WithLists(dataStore.(store.ListStore)))
+	}
+	todoServer := server.NewTodoServer(dataStore, opts...)
+	go todoServer.PurgeTrash(context.Background(), server.PurgeInterval)
+	if err := http.ListenAndServe("localhost:"+strconv.Itoa(port), todoServer); err != nil {
 		log.Error(err)
 	}
 }
 
+func newStore(backend, db, file string) (store.TodoStore, error) {
+	switch backend {
+	case "sqlite":
+		return store.NewDbTodoStore(db)
+	case "memory":
+		return store.NewMemoryTodoStore(), nil
+	case "file":
+		return store.NewFileTodoStore(file)
+	default:
+		return nil, fmt.Errorf("unknown -store %q, expected sqlite, memory or file", backend)
+	}
+}
+
+func runMigrations(db, mode string, w io.Writer) error {
+	migrator, err := store.OpenMigrator(db)
+	if err != nil {
+		return err
+	}
+	defer migrator.Close()
+
+	ctx := context.Background()
+	status, err := migrator.Status(ctx)
+	if err != nil {
+		return err
+	}
+
+	switch mode {
+	case "status":
+		fmt.Fprintf(w, "current version: %d\nlatest version: %d\n", status.Current, status.Latest)
+		for _, m := range status.Pending {
+			fmt.Fprintf(w, "pending: %04d_%s\n", m.Version, m.Name)
+		}
+	case "dry-run":
+		if len(status.Pending) == 0 {
+			fmt.Fprintln(w, "schema is up to date")
+		}
+		for _, m := range status.Pending {
+			fmt.Fprintf(w, "-- %04d_%s\n%s\n", m.Version, m.Name, m.Up)
+		}
+	case "up":
+		applied, err := migrator.Up(ctx)
+		if err != nil {
+			return err
+		}
+		for _, m := range applied {
+			fmt.Fprintf(w, "applied: %04d_%s\n", m.Version, m.Name)
+		}
+		fmt.Fprintf(w, "current version: %d\n", status.Latest)
+	default:
+		return fmt.Errorf("unknown -migrate mode %q, expected status, dry-run or up", mode)
+	}
+	return nil
+}
+
 func setUpLogging() {
 	log.SetFlags(log.LstdFlags | log.Lmicroseconds | log.Llongfile)
 }
@@ -0,0 +1,280 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mcadenas-bjss/go-do-it/store"
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	REGISTER_PATH = "POST /api/auth/register"
+	LOGIN_PATH    = "POST /api/auth/login"
+	LOGOUT_PATH   = "POST /api/auth/logout"
+	ME_PATH       = "GET /api/auth/me"
+)
+
+const sessionCookie = "session"
+
+// Passwords are limited to the bytes bcrypt looks at.
+const (
+	minPasswordSize = 8
+	maxPasswordSize = 72
+)
+
+// SessionLifetime is how long a session cookie stays valid after signing in.
+const SessionLifetime = 30 * 24 * time.Hour
+
+// publicPaths are served without signing in.
+var publicPaths = map[string]bool{
+	"/api/health":        true,
+	"/api/auth/register": true,
+	"/api/auth/login":    true,
+	"/api/auth/logout":   true,
+}
+
+var usernamePattern = regexp.MustCompile(`^[A-Za-z0-9_.-]{3,32}$`)
+
+// WithAuth requires every request but health checks and signing in to be
+// made by a user, with a session cookie or an API token, and scopes the todos
+// it sees to theirs. Without it the server has a single shared list.
+func WithAuth(users store.UserStore) Option {
+	return func(t *TodoServer) {
+		t.users = users
+	}
+}
+
+// Credentials is the body of register and login requests.
+type Credentials struct {
+	Username string
+	Password string
+}
+
+type userKey struct{}
+
+// requestUser returns the user a request was authenticated as.
+func requestUser(r *http.Request) (store.User, bool) {
+	user, ok := r.Context().Value(userKey{}).(store.User)
+	return user, ok
+}
+
+func (t *TodoServer) handleAuth(router *http.ServeMux) {
+	router.Handle(REGISTER_PATH, http.HandlerFunc(t.handleRegister))
+	router.Handle(LOGIN_PATH, http.HandlerFunc(t.handleLogin))
+	router.Handle(LOGOUT_PATH, http.HandlerFunc(t.handleLogout))
+	router.Handle(ME_PATH, http.HandlerFunc(t.handleMe))
+}
+
+// authenticate rejects requests to private paths without a valid session
+// cookie or bearer token. The user's name is recorded as the actor of their
+// changes, and the scopes of their API token limit the routes they may use.
+func (t *TodoServer) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if publicPaths[r.URL.Path] {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		user, token, err := t.signedInUser(r)
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="go-do-it"`)
+			writeError(w, r, err)
+			return
+		}
+		ctx := context.WithValue(r.Context(), userKey{}, user)
+		if token != nil {
+			ctx = context.WithValue(ctx, tokenKey{}, *token)
+		}
+		ctx = store.WithOwner(store.WithActor(ctx, user.Username), user.Id)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// signedInUser checks the credentials of a request: a bearer token, then the
+// session cookie. The API token is returned when one was used. Creating a
+// token also accepts a username and password with basic auth, so scripts can
+// get one without a browser.
+func (t *TodoServer) signedInUser(r *http.Request) (store.User, *store.APIToken, error) {
+	if header := r.Header.Get("Authorization"); header != "" {
+		scheme, credentials, _ := strings.Cut(header, " ")
+		switch {
+		case strings.EqualFold(scheme, "Bearer"):
+			user, token, err := t.users.TokenUser(r.Context(), hashToken(strings.TrimSpace(credentials)))
+			if err != nil {
+				return store.User{}, nil, errors.Wrap(err, "the API token is unknown, expired or was revoked")
+			}
+			return user, &token, nil
+		case strings.EqualFold(scheme, "Basic") && r.Method == http.MethodPost && r.URL.Path == TOKENS_PATH:
+			username, password, _ := r.BasicAuth()
+			user, err := t.checkPassword(r.Context(), username, password)
+			return user, nil, err
+		}
+		return store.User{}, nil, errors.Wrapf(store.ErrUnauthenticated, "unsupported Authorization scheme %q", scheme)
+	}
+
+	if cookie, err := r.Cookie(sessionCookie); err == nil {
+		user, err := t.users.SessionUser(r.Context(), hashToken(cookie.Value))
+		return user, nil, errors.Wrap(err, "the session expired, sign in again")
+	}
+	return store.User{}, nil, errors.Wrap(store.ErrUnauthenticated, "sign in or send an API token")
+}
+
+// dummyHash is compared against when a username is unknown, so failed
+// logins take as long whether or not the user exists.
+var dummyHash = sync.OnceValue(func() []byte {
+	hash, _ := bcrypt.GenerateFromPassword([]byte("not a password"), bcrypt.DefaultCost)
+	return hash
+})
+
+func (t *TodoServer) checkPassword(ctx context.Context, username, password string) (store.User, error) {
+	user, hash, err := t.users.UserByName(ctx, username)
+	if errors.Is(err, store.ErrUnauthenticated) {
+		hash = dummyHash()
+	} else if err != nil {
+		return store.User{}, err
+	}
+	if bcrypt.CompareHashAndPassword(hash, []byte(password)) != nil || err != nil {
+		return store.User{}, errors.Wrap(store.ErrUnauthenticated, "wrong username or password")
+	}
+	return user, nil
+}
+
+func (t *TodoServer) handleRegister(w http.ResponseWriter, r *http.Request) {
+	log.Printf("%s %s", r.Method, r.URL.Path)
+
+	var c Credentials
+	if err := decodeJSONBody(w, r, &c); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if err := c.check(); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(c.Password), bcrypt.DefaultCost)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	user, err := t.users.CreateUser(r.Context(), c.Username, hash)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if err := t.startSession(w, r, user); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.Header().Set("content-type", jsonContentType)
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(user)
+}
+
+// check validates the credentials of a new user.
+func (c Credentials) check() error {
+	var msg string
+	switch {
+	case !usernamePattern.MatchString(c.Username):
+		msg = "Username must be 3 to 32 letters, digits, dots, dashes or underscores"
+	case len(c.Password) < minPasswordSize || len(c.Password) > maxPasswordSize:
+		msg = fmt.Sprintf("Password must be %d to %d bytes long", minPasswordSize, maxPasswordSize)
+	default:
+		return nil
+	}
+	return &malformedRequest{status: http.StatusUnprocessableEntity, code: CodeValidationFailed, msg: msg}
+}
+
+func (t *TodoServer) handleLogin(w http.ResponseWriter, r *http.Request) {
+	log.Printf("%s %s", r.Method, r.URL.Path)
+
+	var c Credentials
+	if err := decodeJSONBody(w, r, &c); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	user, err := t.checkPassword(r.Context(), c.Username, c.Password)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if err := t.startSession(w, r, user); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.Header().Set("content-type", jsonContentType)
+	json.NewEncoder(w).Encode(user)
+}
+
+// startSession stores a new session for the user and sets its cookie.
+func (t *TodoServer) startSession(w http.ResponseWriter, r *http.Request, user store.User) error {
+	token, err := newToken()
+	if err != nil {
+		return err
+	}
+	expires := time.Now().Add(SessionLifetime)
+	if err := t.users.CreateSession(r.Context(), user.Id, hashToken(token), expires); err != nil {
+		return err
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookie,
+		Value:    token,
+		Path:     "/",
+		Expires:  expires,
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return nil
+}
+
+func (t *TodoServer) handleLogout(w http.ResponseWriter, r *http.Request) {
+	log.Printf("%s %s", r.Method, r.URL.Path)
+
+	if cookie, err := r.Cookie(sessionCookie); err == nil {
+		if err := t.users.DeleteSession(r.Context(), hashToken(cookie.Value)); err != nil {
+			writeError(w, r, err)
+			return
+		}
+	}
+	http.SetCookie(w, &http.Cookie{Name: sessionCookie, Path: "/", MaxAge: -1, HttpOnly: true, SameSite: http.SameSiteLaxMode})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (t *TodoServer) handleMe(w http.ResponseWriter, r *http.Request) {
+	log.Printf("%s %s", r.Method, r.URL.Path)
+
+	user, _ := requestUser(r)
+	w.Header().Set("content-type", jsonContentType)
+	json.NewEncoder(w).Encode(user)
+}
+
+// newToken returns a random secret for a session or API token.
+func newToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashToken is how session and API tokens are stored, so a leaked database
+// cannot be used to sign in. The tokens are random enough not to need a slow
+// hash like passwords do.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,209 @@
+package server_test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mcadenas-bjss/go-do-it/server"
+	"github.com/mcadenas-bjss/go-do-it/store"
+)
+
+// authClient makes requests to a server with auth enabled, keeping the
+// session cookie it is given.
+type authClient struct {
+	t     *testing.T
+	url   string
+	http  *http.Client
+	token string
+}
+
+func newAuthClient(t *testing.T, url string) *authClient {
+	jar, _ := cookiejar.New(nil)
+	return &authClient{t: t, url: url, http: &http.Client{Jar: jar}}
+}
+
+func (c *authClient) do(method, path string, body any, want int) *http.Response {
+	c.t.Helper()
+	var buf bytes.Buffer
+	if body != nil {
+		json.NewEncoder(&buf).Encode(body)
+	}
+	request, _ := http.NewRequest(method, c.url+path, &buf)
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("Accept", "application/json")
+	if c.token != "" {
+		request.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	response, err := c.http.Do(request)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	c.t.Cleanup(func() { response.Body.Close() })
+	assertStatus(c.t, response.StatusCode, want)
+	return response
+}
+
+func (c *authClient) decode(response *http.Response, v any) {
+	c.t.Helper()
+	if err := json.NewDecoder(response.Body).Decode(v); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+func TestAuth(t *testing.T) {
+	s := store.NewMemoryTodoStore()
+	ts := httptest.NewServer(server.NewTodoServer(s, server.WithAuth(s)))
+	defer ts.Close()
+
+	alice, bob, anonymous := newAuthClient(t, ts.URL), newAuthClient(t, ts.URL), newAuthClient(t, ts.URL)
+
+	t.Run("requires signing in", func(t *testing.T) {
+		anonymous.do(http.MethodGet, "/api/health", nil, http.StatusOK)
+		response := anonymous.do(http.MethodGet, "/api/todos", nil, http.StatusUnauthorized)
+		var p server.Problem
+		anonymous.decode(response, &p)
+		if p.Code != server.CodeUnauthenticated || response.Header.Get("WWW-Authenticate") == "" {
+			t.Errorf("unexpected problem %+v", p)
+		}
+	})
+
+	t.Run("registers users", func(t *testing.T) {
+		var user store.User
+		alice.decode(alice.do(http.MethodPost, "/api/auth/register", server.Credentials{Username: "alice", Password: "correct horse"}, http.StatusCreated), &user)
+		if user.Id == 0 || user.Username != "alice" {
+			t.Errorf("unexpected user %+v", user)
+		}
+		bob.do(http.MethodPost, "/api/auth/register", server.Credentials{Username: "bob", Password: "battery staple"}, http.StatusCreated)
+
+		anonymous.do(http.MethodPost, "/api/auth/register", server.Credentials{Username: "ALICE", Password: "correct horse"}, http.StatusConflict)
+		anonymous.do(http.MethodPost, "/api/auth/register", server.Credentials{Username: "carol", Password: "short"}, http.StatusUnprocessableEntity)
+		anonymous.do(http.MethodPost, "/api/auth/register", server.Credentials{Username: "no spaces", Password: "correct horse"}, http.StatusUnprocessableEntity)
+
+		alice.decode(alice.do(http.MethodGet, "/api/auth/me", nil, http.StatusOK), &user)
+		if user.Username != "alice" {
+			t.Errorf("got %+v want alice", user)
+		}
+	})
+
+	var milk store.Todo
+	t.Run("keeps each user's todos apart", func(t *testing.T) {
+		alice.decode(alice.do(http.MethodPost, "/api/todo", store.Todo{Description: "Buy milk"}, http.StatusCreated), &milk)
+
+		var todos []store.Todo
+		bob.decode(bob.do(http.MethodGet, "/api/todos", nil, http.StatusOK), &todos)
+		if len(todos) != 0 {
+			t.Errorf("got %+v want none of alice's todos", todos)
+		}
+		bob.do(http.MethodGet, "/api/todo/1", nil, http.StatusNotFound)
+		bob.do(http.MethodDelete, "/api/todo/1", nil, http.StatusNotFound)
+
+		var history []store.Event
+		alice.decode(alice.do(http.MethodGet, "/api/todo/1/history", nil, http.StatusOK), &history)
+		if len(history) != 1 || history[0].Actor != "alice" {
+			t.Errorf("got %+v want the change recorded as alice's", history)
+		}
+	})
+
+	t.Run("signs in and out", func(t *testing.T) {
+		carol := newAuthClient(t, ts.URL)
+		carol.do(http.MethodPost, "/api/auth/login", server.Credentials{Username: "alice", Password: "wrong password"}, http.StatusUnauthorized)
+		carol.do(http.MethodPost, "/api/auth/login", server.Credentials{Username: "nobody", Password: "correct horse"}, http.StatusUnauthorized)
+
+		response := carol.do(http.MethodPost, "/api/auth/login", server.Credentials{Username: "Alice", Password: "correct horse"}, http.StatusOK)
+		cookies := response.Cookies()
+		if len(cookies) != 1 || !cookies[0].HttpOnly || cookies[0].SameSite != http.SameSiteLaxMode {
+			t.Errorf("unexpected cookies %+v", cookies)
+		}
+		var todos []store.Todo
+		carol.decode(carol.do(http.MethodGet, "/api/todos", nil, http.StatusOK), &todos)
+		if len(todos) != 1 {
+			t.Errorf("got %+v want alice's todo", todos)
+		}
+
+		carol.do(http.MethodPost, "/api/auth/logout", nil, http.StatusNoContent)
+		carol.do(http.MethodGet, "/api/todos", nil, http.StatusUnauthorized)
+	})
+
+	t.Run("authenticates with API tokens", func(t *testing.T) {
+		request, _ := http.NewRequest(http.MethodPost, ts.URL+"/api/tokens", strings.NewReader(`{"Name": "laptop"}`))
+		request.SetBasicAuth("alice", "correct horse")
+		response, err := http.DefaultClient.Do(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer response.Body.Close()
+		assertStatus(t, response.StatusCode, http.StatusCreated)
+		var token server.NewToken
+		alice.decode(response, &token)
+		if !strings.HasPrefix(token.Token, "gdi_") || token.Name != "laptop" {
+			t.Fatalf("unexpected token %+v", token)
+		}
+
+		script := newAuthClient(t, ts.URL)
+		script.token = token.Token
+		var todos []store.Todo
+		script.decode(script.do(http.MethodGet, "/api/todos", nil, http.StatusOK), &todos)
+		if len(todos) != 1 || todos[0].Id != milk.Id {
+			t.Errorf("got %+v want alice's todo", todos)
+		}
+
+		var tokens []store.APIToken
+		alice.decode(alice.do(http.MethodGet, "/api/tokens", nil, http.StatusOK), &tokens)
+		if len(tokens) != 1 || tokens[0].Name != "laptop" {
+			t.Errorf("unexpected tokens %+v", tokens)
+		}
+		bob.do(http.MethodDelete, "/api/tokens/1", nil, http.StatusNotFound)
+		alice.do(http.MethodDelete, "/api/tokens/1", nil, http.StatusNoContent)
+		script.do(http.MethodGet, "/api/todos", nil, http.StatusUnauthorized)
+
+		// Basic auth is only for creating tokens.
+		request, _ = http.NewRequest(http.MethodGet, ts.URL+"/api/todos", nil)
+		request.SetBasicAuth("alice", "correct horse")
+		response, err = http.DefaultClient.Do(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		response.Body.Close()
+		assertStatus(t, response.StatusCode, http.StatusUnauthorized)
+	})
+
+	t.Run("streams only the user's own changes", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		request, _ := http.NewRequestWithContext(ctx, http.MethodGet, ts.URL+"/api/events/stream", nil)
+		response, err := bob.http.Do(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer response.Body.Close()
+		assertStatus(t, response.StatusCode, http.StatusOK)
+
+		alice.do(http.MethodPost, "/api/todo/toggle/1", nil, http.StatusOK)
+		var bread store.Todo
+		bob.decode(bob.do(http.MethodPost, "/api/todo", store.Todo{Description: "Buy bread"}, http.StatusCreated), &bread)
+
+		reader := bufio.NewReader(response.Body)
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				t.Fatal(err)
+			}
+			if data, ok := strings.CutPrefix(line, "data: "); ok {
+				var e store.Event
+				json.Unmarshal([]byte(data), &e)
+				if e.TodoId != bread.Id {
+					t.Errorf("got event %+v want bob's todo", e)
+				}
+				return
+			}
+		}
+	})
+}
@@ -0,0 +1,194 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/mcadenas-bjss/go-do-it/store"
+	"github.com/mcadenas-bjss/go-do-it/validate"
+)
+
+// maxBatchSize caps the number of operations in one batch request.
+const maxBatchSize = 1000
+
+// batchRequest is the body of POST /api/todos/batch.
+type batchRequest struct {
+	ContinueOnError bool             `json:"continueOnError"`
+	Operations      []batchOperation `json:"operations"`
+}
+
+// batchOperation is one write of a batch. Id and Revision name the todo an
+// update, delete or toggle applies to; a non-zero Revision makes the op
+// conditional like If-Match does.
+type batchOperation struct {
+	Op       store.OpKind   `json:"op"`
+	Id       int            `json:"id,omitempty"`
+	Revision int            `json:"revision,omitempty"`
+	Todo     *validate.Todo `json:"todo,omitempty"`
+}
+
+// batchResult reports one operation, in the order they were sent. Todo is
+// omitted for deletes and failed operations.
+type batchResult struct {
+	Status int         `json:"status"`
+	Todo   *store.Todo `json:"todo,omitempty"`
+	Error  *Problem    `json:"error,omitempty"`
+}
+
+type batchResponse struct {
+	Results []batchResult `json:"results"`
+}
+
+// storeOp checks an operation and converts it for the store.
+func (o batchOperation) storeOp() (store.Op, error) {
+	op := store.Op{Kind: o.Op, Ref: store.Ref{Id: o.Id, Revision: o.Revision}}
+
+	switch o.Op {
+	case store.OpCreate:
+		if o.Id != 0 || o.Revision != 0 {
+			return op, batchMalformed("a create must not have an id or revision")
+		}
+		if o.Todo == nil {
+			return op, batchMalformed("a create must have a todo")
+		}
+		if err := o.Todo.Create(); err != nil {
+			return op, err
+		}
+	case store.OpUpdate:
+		if o.Id == 0 || o.Todo == nil {
+			return op, batchMalformed("an update must have an id and a todo")
+		}
+		if err := o.Todo.Update(o.Id); err != nil {
+			return op, err
+		}
+	case store.OpDelete, store.OpToggle:
+		if o.Id == 0 {
+			return op, batchMalformed(fmt.Sprintf("a %s must have an id", o.Op))
+		}
+		if o.Todo != nil {
+			return op, batchMalformed(fmt.Sprintf("a %s must not have a todo", o.Op))
+		}
+		return op, nil
+	default:
+		return op, batchMalformed(fmt.Sprintf("op must be one of %s, %s, %s or %s", store.OpCreate, store.OpUpdate, store.OpDelete, store.OpToggle))
+	}
+
+	todo, err := store.TodoFromInput(*o.Todo)
+	if err != nil {
+		return op, err
+	}
+	op.Todo = todo
+	return op, nil
+}
+
+func batchMalformed(msg string) *malformedRequest {
+	return &malformedRequest{status: http.StatusBadRequest, code: CodeMalformedRequest, msg: msg}
+}
+
+// handleBatch applies a list of writes in one store transaction. By default
+// the first failing operation fails the request and nothing is written; with
+// continueOnError every operation gets its own result instead.
+func (t *TodoServer) handleBatch(w http.ResponseWriter, r *http.Request) {
+	log.Printf("%s %s", r.Method, r.URL.Path)
+
+	var req batchRequest
+	if err := decodeJSONBody(w, r, &req); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if len(req.Operations) > maxBatchSize {
+		writeError(w, r, batchMalformed(fmt.Sprintf("a batch must have at most %d operations", maxBatchSize)))
+		return
+	}
+
+	// Operations that fail before reaching the store keep their slot in
+	// results; indexes maps the ops sent to the store back to it.
+	results := make([]batchResult, len(req.Operations))
+	batch := store.Batch{ContinueOnError: req.ContinueOnError}
+	var indexes []int
+	for i, o := range req.Operations {
+		op, err := o.storeOp()
+		if err != nil {
+			if !req.ContinueOnError {
+				writeError(w, r, &store.BatchError{Index: i, Err: err})
+				return
+			}
+			results[i] = failedResult(r, err)
+			continue
+		}
+		batch.Ops = append(batch.Ops, op)
+		indexes = append(indexes, i)
+	}
+
+	cmd := store.NewBatchCommand(r.Context(), batch)
+	t.cmds <- cmd
+
+	opResults, err := cmd.Wait()
+	if err != nil {
+		var be *store.BatchError
+		if errors.As(err, &be) {
+			err = &store.BatchError{Index: indexes[be.Index], Err: be.Err}
+		}
+		writeError(w, r, err)
+		return
+	}
+
+	for i, res := range opResults {
+		op := batch.Ops[i]
+		switch {
+		case res.Err != nil:
+			results[indexes[i]] = failedResult(r, res.Err)
+		case op.Kind == store.OpDelete:
+			results[indexes[i]] = batchResult{Status: http.StatusNoContent}
+		case op.Kind == store.OpCreate:
+			results[indexes[i]] = batchResult{Status: http.StatusCreated, Todo: &res.Todo}
+		default:
+			results[indexes[i]] = batchResult{Status: http.StatusOK, Todo: &res.Todo}
+		}
+	}
+
+	w.Header().Set("content-type", jsonContentType)
+	json.NewEncoder(w).Encode(batchResponse{Results: results})
+}
+
+func failedResult(r *http.Request, err error) batchResult {
+	p := problemFor(err)
+	if p.Status >= http.StatusInternalServerError {
+		log.Printf("%s %s operation failed: %s", r.Method, r.URL.Path, err.Error())
+	}
+	p.Instance = r.URL.Path
+	return batchResult{Status: p.Status, Error: &p}
+}
+
+func (t *TodoServer) handleCompleteAll(w http.ResponseWriter, r *http.Request) {
+	log.Printf("%s %s", r.Method, r.URL.Path)
+
+	cmd := store.NewCompleteAllCommand(r.Context())
+	t.cmds <- cmd
+
+	n, err := cmd.Wait()
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.Header().Set("content-type", jsonContentType)
+	json.NewEncoder(w).Encode(map[string]int{"updated": n})
+}
+
+func (t *TodoServer) handleDeleteCompleted(w http.ResponseWriter, r *http.Request) {
+	log.Printf("%s %s", r.Method, r.URL.Path)
+
+	cmd := store.NewDeleteCompletedCommand(r.Context())
+	t.cmds <- cmd
+
+	n, err := cmd.Wait()
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.Header().Set("content-type", jsonContentType)
+	json.NewEncoder(w).Encode(map[string]int{"deleted": n})
+}
@@ -0,0 +1,121 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/mcadenas-bjss/go-do-it/store"
+	"github.com/mcadenas-bjss/go-do-it/validate"
+)
+
+const problemContentType = "application/problem+json"
+
+// ErrorCode identifies a kind of failure. Codes are part of the API and do
+// not change once published; clients should branch on them rather than on
+// the human readable title or detail.
+type ErrorCode string
+
+const (
+	CodeMalformedRequest     ErrorCode = "malformed_request"
+	CodeUnsupportedMediaType ErrorCode = "unsupported_media_type"
+	CodePayloadTooLarge      ErrorCode = "payload_too_large"
+	CodeInvalidParameter     ErrorCode = "invalid_parameter"
+	CodeInvalidCursor        ErrorCode = "invalid_cursor"
+	CodeInvalidPatch         ErrorCode = "invalid_patch"
+	CodeUnauthenticated      ErrorCode = "unauthenticated"
+	CodeInsufficientScope    ErrorCode = "insufficient_scope"
+	CodeForbidden            ErrorCode = "forbidden"
+	CodeNotFound             ErrorCode = "not_found"
+	CodeConflict             ErrorCode = "conflict"
+	CodePreconditionFailed   ErrorCode = "precondition_failed"
+	CodeValidationFailed     ErrorCode = "validation_failed"
+	CodeRequestCancelled     ErrorCode = "request_cancelled"
+	CodeOverloaded           ErrorCode = "overloaded"
+	CodeInternal             ErrorCode = "internal_error"
+)
+
+// Problem is an RFC 7807 problem details body, sent as
+// application/problem+json for every failed request.
+type Problem struct {
+	Type     string    `json:"type"`
+	Title    string    `json:"title"`
+	Status   int       `json:"status"`
+	Detail   string    `json:"detail,omitempty"`
+	Instance string    `json:"instance,omitempty"`
+	Code     ErrorCode `json:"code"`
+	// Errors lists every invalid field of a validation_failed problem.
+	Errors validate.Errors `json:"errors,omitempty"`
+	// Operation is the index of the operation that failed a batch.
+	Operation *int `json:"operation,omitempty"`
+}
+
+func newProblem(status int, code ErrorCode, detail string) Problem {
+	return Problem{
+		Type:   "urn:go-do-it:problem:" + string(code),
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: detail,
+		Code:   code,
+	}
+}
+
+// problemFor maps an error from a handler or the store to the response sent
+// to the client. Unexpected errors are reported without their details.
+func problemFor(err error) Problem {
+	var batch *store.BatchError
+	var mr *malformedRequest
+	var invalid validate.Errors
+	switch {
+	case errors.As(err, &batch):
+		p := problemFor(batch.Err)
+		p.Operation = &batch.Index
+		return p
+	case errors.As(err, &mr):
+		return newProblem(mr.status, mr.code, mr.msg)
+	case errors.As(err, &invalid):
+		p := newProblem(http.StatusUnprocessableEntity, CodeValidationFailed, "the todo has invalid fields")
+		p.Errors = invalid
+		return p
+	case errors.Is(err, store.ErrUnauthenticated):
+		return newProblem(http.StatusUnauthorized, CodeUnauthenticated, err.Error())
+	case errors.Is(err, store.ErrNotFound), errors.Is(err, store.ErrTokenNotFound),
+		errors.Is(err, store.ErrListNotFound), errors.Is(err, store.ErrMemberNotFound),
+		errors.Is(err, store.ErrInvitationNotFound), errors.Is(err, store.ErrUserNotFound),
+		errors.Is(err, store.ErrSectionNotFound):
+		return newProblem(http.StatusNotFound, CodeNotFound, err.Error())
+	case errors.Is(err, store.ErrRevisionMismatch):
+		return newProblem(http.StatusPreconditionFailed, CodePreconditionFailed, err.Error())
+	case errors.Is(err, store.ErrConflict), errors.Is(err, store.ErrUserExists),
+		errors.Is(err, store.ErrAlreadyMember), errors.Is(err, store.ErrLastOwner), errors.Is(err, store.ErrListNotEmpty),
+		errors.Is(err, store.ErrSectionNotEmpty):
+		return newProblem(http.StatusConflict, CodeConflict, err.Error())
+	case errors.Is(err, store.ErrValidation):
+		return newProblem(http.StatusUnprocessableEntity, CodeValidationFailed, err.Error())
+	case errors.Is(err, store.ErrInvalidPatch):
+		return newProblem(http.StatusBadRequest, CodeInvalidPatch, err.Error())
+	case errors.Is(err, store.ErrInvalidCursor):
+		return newProblem(http.StatusBadRequest, CodeInvalidCursor, "cursor is not one returned by a previous page")
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return newProblem(http.StatusServiceUnavailable, CodeRequestCancelled, "the request was cancelled before it completed")
+	case errors.Is(err, store.ErrOverloaded):
+		return newProblem(http.StatusServiceUnavailable, CodeOverloaded, "the server is too busy, try again later")
+	default:
+		return newProblem(http.StatusInternalServerError, CodeInternal, "")
+	}
+}
+
+// writeError sends err to the client as problem details.
+func writeError(w http.ResponseWriter, r *http.Request, err error) {
+	p := problemFor(err)
+	if p.Status >= http.StatusInternalServerError {
+		log.Printf("%s %s failed: %s", r.Method, r.URL.Path, err.Error())
+	}
+	p.Instance = r.URL.Path
+
+	w.Header().Set("content-type", problemContentType)
+	w.WriteHeader(p.Status)
+	json.NewEncoder(w).Encode(p)
+}
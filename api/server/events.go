@@ -0,0 +1,101 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/mcadenas-bjss/go-do-it/store"
+)
+
+// AnonymousActor is recorded in the history for requests that do not name an
+// actor.
+const AnonymousActor = "anonymous"
+
+// withActor records the X-Actor header as the actor of every change made by
+// the request.
+func withActor(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		actor := r.Header.Get("X-Actor")
+		if actor == "" {
+			actor = AnonymousActor
+		}
+		next.ServeHTTP(w, r.WithContext(store.WithActor(r.Context(), actor)))
+	})
+}
+
+// visibleTo reports whether an event published by the hub is about a todo
+// in the personal or shared list the context is scoped to, if any.
+func visibleTo(ctx context.Context, e store.Event) bool {
+	return store.InScope(ctx, e.Owner, e.List)
+}
+
+func (t *TodoServer) handleTodoHistory(w http.ResponseWriter, r *http.Request) {
+	log.Printf("%s %s", r.Method, r.URL.Path)
+
+	id, err := pathId(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	cmd := store.NewHistoryCommand(r.Context(), id)
+	t.cmds <- cmd
+
+	events, err := cmd.Wait()
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.Header().Set("content-type", jsonContentType)
+	json.NewEncoder(w).Encode(events)
+}
+
+// handleEvents serves the feed of every change, oldest first. since is
+// either the id of the last event already seen or an RFC 3339 time. Full
+// pages link to the next one.
+func (t *TodoServer) handleEvents(w http.ResponseWriter, r *http.Request) {
+	log.Printf("%s %s", r.Method, r.URL.Path)
+
+	query := r.URL.Query()
+	q := store.EventQuery{Limit: store.DefaultEventLimit}
+	if v := query.Get("since"); v != "" {
+		if id, err := strconv.Atoi(v); err == nil && id >= 0 {
+			q.AfterId = id
+		} else if since, err := store.ParseTimestamp(v); err == nil {
+			q.Since = since
+		} else {
+			writeError(w, r, badParameter("since must be an event id or an RFC 3339 timestamp"))
+			return
+		}
+	}
+	if v := query.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > maxPageSize {
+			writeError(w, r, badParameter(fmt.Sprintf("limit must be a number between 1 and %d", maxPageSize)))
+			return
+		}
+		q.Limit = limit
+	}
+
+	cmd := store.NewEventsCommand(r.Context(), q)
+	t.cmds <- cmd
+
+	events, err := cmd.Wait()
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	if len(events) == q.Limit {
+		next := *r.URL
+		query.Set("since", strconv.Itoa(events[len(events)-1].Id))
+		next.RawQuery = query.Encode()
+		w.Header().Set("Link", fmt.Sprintf(`<%s>; rel="next"`, next.RequestURI()))
+	}
+	w.Header().Set("content-type", jsonContentType)
+	json.NewEncoder(w).Encode(events)
+}
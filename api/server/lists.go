@@ -0,0 +1,417 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/mcadenas-bjss/go-do-it/store"
+	"github.com/pkg/errors"
+)
+
+const (
+	LISTS_PATH            = "/api/lists"
+	LIST_ID_PATH          = "/api/lists/{listId}"
+	MEMBERS_PATH          = "GET /api/lists/{listId}/members"
+	MEMBER_PATH           = "/api/lists/{listId}/members/{userId}"
+	LIST_INVITATIONS_PATH = "/api/lists/{listId}/invitations"
+	LIST_INVITATION_PATH  = "DELETE /api/lists/{listId}/invitations/{id}"
+	INVITATIONS_PATH      = "GET /api/invitations"
+	ACCEPT_PATH           = "POST /api/invitations/{id}/accept"
+	DECLINE_PATH          = "DELETE /api/invitations/{id}"
+)
+
+// maxNameSize is the longest list or section name, in characters.
+const maxNameSize = 100
+
+// WithLists lets users share lists of todos. Every todo route is also served
+// under /api/lists/{listId}, for the todos of that list: viewers may use the
+// routes reading todos, and editors and owners every route. Only owners may
+// rename or delete a list and manage who is in it. It needs WithAuth.
+func WithLists(lists store.ListStore) Option {
+	return func(t *TodoServer) {
+		t.lists = lists
+	}
+}
+
+// ListRequest is the body of a request creating or renaming a list.
+type ListRequest struct {
+	Name string
+}
+
+// MemberRequest is the body of a request changing the role of a member.
+type MemberRequest struct {
+	Role store.Role
+}
+
+// InvitationRequest is the body of a request inviting a user to a list. Role
+// defaults to viewer.
+type InvitationRequest struct {
+	Username string
+	Role     store.Role
+}
+
+type listKey struct{}
+
+// requestList returns the list of a request to a route under
+// /api/lists/{listId}, with the role of the user in it.
+func requestList(r *http.Request) store.List {
+	list, _ := r.Context().Value(listKey{}).(store.List)
+	return list
+}
+
+// todoBase is the path the todo routes of a request are under: /api, or the
+// path of the shared list it was made to.
+func todoBase(r *http.Request) string {
+	if list, ok := store.ListFrom(r.Context()); ok {
+		return fmt.Sprintf("%s/%d", LISTS_PATH, list)
+	}
+	return "/api"
+}
+
+func forbidden(msg string) *malformedRequest {
+	return &malformedRequest{status: http.StatusForbidden, code: CodeForbidden, msg: msg}
+}
+
+func (t *TodoServer) handleLists(router *http.ServeMux, routes []route) {
+	// The todo routes of a list, where reading needs a viewer and anything
+	// else an editor.
+	for _, route := range routes {
+		method, path, _ := strings.Cut(route.pattern, " ")
+		role := store.RoleEditor
+		if route.scope == store.ScopeTodosRead {
+			role = store.RoleViewer
+		}
+		pattern := fmt.Sprintf("%s %s%s", method, LIST_ID_PATH, strings.TrimPrefix(path, "/api"))
+		router.Handle(pattern, requireScope(route.scope, t.inList(role, route.handler)))
+	}
+
+	router.Handle(fmt.Sprintf("GET %s", LISTS_PATH), requireScope(store.ScopeTodosRead, t.handleGetLists))
+	router.Handle(fmt.Sprintf("POST %s", LISTS_PATH), requireScope(store.ScopeTodosWrite, t.handlePostList))
+	router.Handle(fmt.Sprintf("GET %s", LIST_ID_PATH), requireScope(store.ScopeTodosRead, t.inList(store.RoleViewer, t.handleGetList)))
+	router.Handle(fmt.Sprintf("PUT %s", LIST_ID_PATH), requireScope(store.ScopeTodosWrite, t.inList(store.RoleOwner, t.handlePutList)))
+	router.Handle(fmt.Sprintf("DELETE %s", LIST_ID_PATH), requireScope(store.ScopeTodosWrite, t.inList(store.RoleOwner, t.handleDeleteList)))
+	router.Handle(MEMBERS_PATH, requireScope(store.ScopeTodosRead, t.inList(store.RoleViewer, t.handleGetMembers)))
+	router.Handle(fmt.Sprintf("PUT %s", MEMBER_PATH), requireScope(store.ScopeTodosWrite, t.inList(store.RoleOwner, t.handlePutMember)))
+	// Members may leave a list, so the handler checks who is removed.
+	router.Handle(fmt.Sprintf("DELETE %s", MEMBER_PATH), requireScope(store.ScopeTodosWrite, t.inList(store.RoleViewer, t.handleDeleteMember)))
+	router.Handle(fmt.Sprintf("GET %s", LIST_INVITATIONS_PATH), requireScope(store.ScopeTodosRead, t.inList(store.RoleOwner, t.handleGetListInvitations)))
+	router.Handle(fmt.Sprintf("POST %s", LIST_INVITATIONS_PATH), requireScope(store.ScopeTodosWrite, t.inList(store.RoleOwner, t.handlePostInvitation)))
+	router.Handle(LIST_INVITATION_PATH, requireScope(store.ScopeTodosWrite, t.inList(store.RoleOwner, t.handleCancelInvitation)))
+	router.Handle(INVITATIONS_PATH, requireScope(store.ScopeTodosRead, t.handleGetInvitations))
+	router.Handle(ACCEPT_PATH, requireScope(store.ScopeTodosWrite, t.handleAcceptInvitation))
+	router.Handle(DECLINE_PATH, requireScope(store.ScopeTodosWrite, t.handleDeclineInvitation))
+}
+
+// inList serves requests to a list the user has at least the role in, with
+// the todos they read and write scoped to it. Lists the user is not a member
+// of are not found.
+func (t *TodoServer) inList(role store.Role, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := pathNumber(r, "listId")
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+		user, _ := requestUser(r)
+		list, err := t.lists.MemberList(r.Context(), id, user.Id)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+		if !list.Role.Allows(role) {
+			writeError(w, r, forbidden(fmt.Sprintf("only a list's %ss may do this, you are a %s", role, list.Role)))
+			return
+		}
+
+		ctx := context.WithValue(store.WithList(r.Context(), list.Id), listKey{}, list)
+		next(w, r.WithContext(ctx))
+	}
+}
+
+// handleGetLists returns the shared lists of the user. HTMX requests get the
+// list switcher instead, marking the list named by the list query parameter.
+func (t *TodoServer) handleGetLists(w http.ResponseWriter, r *http.Request) {
+	log.Printf("%s %s", r.Method, r.URL.Path)
+
+	user, _ := requestUser(r)
+	lists, err := t.lists.Lists(r.Context(), user.Id)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	if wantsHTML(r) {
+		current, _ := strconv.Atoi(r.URL.Query().Get("list"))
+		var buf bytes.Buffer
+		if err := t.renderer.RenderListSwitcher(&buf, lists, current); err != nil {
+			writeError(w, r, errors.Wrap(err, "failed to render list switcher"))
+			return
+		}
+		w.Header().Set("content-type", htmlContentType)
+		buf.WriteTo(w)
+		return
+	}
+	w.Header().Set("content-type", jsonContentType)
+	json.NewEncoder(w).Encode(lists)
+}
+
+func (t *TodoServer) handlePostList(w http.ResponseWriter, r *http.Request) {
+	log.Printf("%s %s", r.Method, r.URL.Path)
+
+	var input ListRequest
+	if err := decodeJSONBody(w, r, &input); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if err := input.check(); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	user, _ := requestUser(r)
+	list, err := t.lists.CreateList(r.Context(), user.Id, input.Name)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.Header().Set("content-type", jsonContentType)
+	w.Header().Set("Location", fmt.Sprintf("%s/%d", LISTS_PATH, list.Id))
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(list)
+}
+
+// check validates the name of a list.
+func (input *ListRequest) check() error {
+	return checkName(&input.Name)
+}
+
+// checkName trims the name of a list or section and checks its length.
+func checkName(name *string) error {
+	*name = strings.TrimSpace(*name)
+	if *name == "" || utf8.RuneCountInString(*name) > maxNameSize {
+		msg := fmt.Sprintf("Name must be 1 to %d characters long", maxNameSize)
+		return &malformedRequest{status: http.StatusUnprocessableEntity, code: CodeValidationFailed, msg: msg}
+	}
+	return nil
+}
+
+func (t *TodoServer) handleGetList(w http.ResponseWriter, r *http.Request) {
+	log.Printf("%s %s", r.Method, r.URL.Path)
+
+	w.Header().Set("content-type", jsonContentType)
+	json.NewEncoder(w).Encode(requestList(r))
+}
+
+func (t *TodoServer) handlePutList(w http.ResponseWriter, r *http.Request) {
+	log.Printf("%s %s", r.Method, r.URL.Path)
+
+	var input ListRequest
+	if err := decodeJSONBody(w, r, &input); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if err := input.check(); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	list := requestList(r)
+	if err := t.lists.RenameList(r.Context(), list.Id, input.Name); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	list.Name = input.Name
+	w.Header().Set("content-type", jsonContentType)
+	json.NewEncoder(w).Encode(list)
+}
+
+// handleDeleteList deletes an empty list. Its todos have to be deleted and
+// purged from the trash first.
+func (t *TodoServer) handleDeleteList(w http.ResponseWriter, r *http.Request) {
+	log.Printf("%s %s", r.Method, r.URL.Path)
+
+	if err := t.lists.DeleteList(r.Context(), requestList(r).Id); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (t *TodoServer) handleGetMembers(w http.ResponseWriter, r *http.Request) {
+	log.Printf("%s %s", r.Method, r.URL.Path)
+
+	members, err := t.lists.Members(r.Context(), requestList(r).Id)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.Header().Set("content-type", jsonContentType)
+	json.NewEncoder(w).Encode(members)
+}
+
+func (t *TodoServer) handlePutMember(w http.ResponseWriter, r *http.Request) {
+	log.Printf("%s %s", r.Method, r.URL.Path)
+
+	userId, err := pathNumber(r, "userId")
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	var input MemberRequest
+	if err := decodeJSONBody(w, r, &input); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if err := checkRole(input.Role); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	if err := t.lists.SetRole(r.Context(), requestList(r).Id, userId, input.Role); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleDeleteMember removes a member from a list. Owners may remove anyone,
+// and other members only themselves.
+func (t *TodoServer) handleDeleteMember(w http.ResponseWriter, r *http.Request) {
+	log.Printf("%s %s", r.Method, r.URL.Path)
+
+	userId, err := pathNumber(r, "userId")
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	list := requestList(r)
+	if user, _ := requestUser(r); userId != user.Id && !list.Role.Allows(store.RoleOwner) {
+		writeError(w, r, forbidden("only a list's owners may remove other members"))
+		return
+	}
+
+	if err := t.lists.RemoveMember(r.Context(), list.Id, userId); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// checkRole validates the role of a member or invitation.
+func checkRole(role store.Role) error {
+	if slices.Contains(store.Roles, role) {
+		return nil
+	}
+	msg := fmt.Sprintf("Role must be one of %v", store.Roles)
+	return &malformedRequest{status: http.StatusUnprocessableEntity, code: CodeValidationFailed, msg: msg}
+}
+
+func (t *TodoServer) handleGetListInvitations(w http.ResponseWriter, r *http.Request) {
+	log.Printf("%s %s", r.Method, r.URL.Path)
+
+	invitations, err := t.lists.ListInvitations(r.Context(), requestList(r).Id)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.Header().Set("content-type", jsonContentType)
+	json.NewEncoder(w).Encode(invitations)
+}
+
+func (t *TodoServer) handlePostInvitation(w http.ResponseWriter, r *http.Request) {
+	log.Printf("%s %s", r.Method, r.URL.Path)
+
+	var input InvitationRequest
+	if err := decodeJSONBody(w, r, &input); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if input.Role == "" {
+		input.Role = store.RoleViewer
+	}
+	if err := checkRole(input.Role); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	user, _ := requestUser(r)
+	invitation, err := t.lists.Invite(r.Context(), requestList(r).Id, strings.TrimSpace(input.Username), input.Role, user.Id)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.Header().Set("content-type", jsonContentType)
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(invitation)
+}
+
+func (t *TodoServer) handleCancelInvitation(w http.ResponseWriter, r *http.Request) {
+	log.Printf("%s %s", r.Method, r.URL.Path)
+
+	id, err := pathId(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if err := t.lists.CancelInvitation(r.Context(), requestList(r).Id, id); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleGetInvitations returns the invitations sent to the user.
+func (t *TodoServer) handleGetInvitations(w http.ResponseWriter, r *http.Request) {
+	log.Printf("%s %s", r.Method, r.URL.Path)
+
+	user, _ := requestUser(r)
+	invitations, err := t.lists.UserInvitations(r.Context(), user.Id)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.Header().Set("content-type", jsonContentType)
+	json.NewEncoder(w).Encode(invitations)
+}
+
+func (t *TodoServer) handleAcceptInvitation(w http.ResponseWriter, r *http.Request) {
+	log.Printf("%s %s", r.Method, r.URL.Path)
+
+	id, err := pathId(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	user, _ := requestUser(r)
+	list, err := t.lists.AcceptInvitation(r.Context(), user.Id, id)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.Header().Set("content-type", jsonContentType)
+	json.NewEncoder(w).Encode(list)
+}
+
+func (t *TodoServer) handleDeclineInvitation(w http.ResponseWriter, r *http.Request) {
+	log.Printf("%s %s", r.Method, r.URL.Path)
+
+	id, err := pathId(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	user, _ := requestUser(r)
+	if err := t.lists.DeclineInvitation(r.Context(), user.Id, id); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,147 @@
+package server_test
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mcadenas-bjss/go-do-it/server"
+	"github.com/mcadenas-bjss/go-do-it/store"
+)
+
+func TestLists(t *testing.T) {
+	s := store.NewMemoryTodoStore()
+	ts := httptest.NewServer(server.NewTodoServer(s, server.WithAuth(s), server.WithLists(s)))
+	defer ts.Close()
+
+	register := func(username string) *authClient {
+		c := newAuthClient(t, ts.URL)
+		c.do(http.MethodPost, "/api/auth/register", server.Credentials{Username: username, Password: "correct horse"}, http.StatusCreated)
+		return c
+	}
+	alice, bob, carol, dave := register("alice"), register("bob"), register("carol"), register("dave")
+
+	var list store.List
+	alice.decode(alice.do(http.MethodPost, "/api/lists", server.ListRequest{Name: " Sprint chores "}, http.StatusCreated), &list)
+	if list.Name != "Sprint chores" || list.Role != store.RoleOwner {
+		t.Fatalf("unexpected list %+v", list)
+	}
+	alice.do(http.MethodPost, "/api/lists", server.ListRequest{Name: ""}, http.StatusUnprocessableEntity)
+
+	t.Run("invites members", func(t *testing.T) {
+		alice.do(http.MethodPost, "/api/lists/1/invitations", server.InvitationRequest{Username: "bob", Role: store.RoleEditor}, http.StatusCreated)
+		alice.do(http.MethodPost, "/api/lists/1/invitations", server.InvitationRequest{Username: "carol"}, http.StatusCreated)
+		alice.do(http.MethodPost, "/api/lists/1/invitations", server.InvitationRequest{Username: "erin"}, http.StatusNotFound)
+		alice.do(http.MethodPost, "/api/lists/1/invitations", server.InvitationRequest{Username: "bob"}, http.StatusConflict)
+		alice.do(http.MethodPost, "/api/lists/1/invitations", server.InvitationRequest{Username: "dave", Role: "admin"}, http.StatusUnprocessableEntity)
+		bob.do(http.MethodPost, "/api/lists/1/invitations", server.InvitationRequest{Username: "dave"}, http.StatusNotFound)
+
+		for _, c := range []*authClient{bob, carol} {
+			var invitations []store.Invitation
+			c.decode(c.do(http.MethodGet, "/api/invitations", nil, http.StatusOK), &invitations)
+			if len(invitations) != 1 || invitations[0].ListName != "Sprint chores" || invitations[0].InvitedBy != "alice" {
+				t.Fatalf("unexpected invitations %+v", invitations)
+			}
+			dave.do(http.MethodPost, fmt.Sprintf("/api/invitations/%d/accept", invitations[0].Id), nil, http.StatusNotFound)
+			c.do(http.MethodPost, fmt.Sprintf("/api/invitations/%d/accept", invitations[0].Id), nil, http.StatusOK)
+		}
+
+		var members []store.Member
+		carol.decode(carol.do(http.MethodGet, "/api/lists/1/members", nil, http.StatusOK), &members)
+		if len(members) != 3 || members[1].Role != store.RoleEditor || members[2].Role != store.RoleViewer {
+			t.Errorf("unexpected members %+v", members)
+		}
+	})
+
+	t.Run("shares the todos of a list", func(t *testing.T) {
+		response := bob.do(http.MethodPost, "/api/lists/1/todo", store.Todo{Description: "Do the dishes"}, http.StatusCreated)
+		if location := response.Header.Get("Location"); location != "/api/lists/1/todo/1" {
+			t.Errorf("got Location %q", location)
+		}
+
+		var todos []store.Todo
+		alice.decode(alice.do(http.MethodGet, "/api/lists/1/todos", nil, http.StatusOK), &todos)
+		if len(todos) != 1 || todos[0].Description != "Do the dishes" {
+			t.Errorf("unexpected list todos %+v", todos)
+		}
+		alice.decode(alice.do(http.MethodGet, "/api/todos", nil, http.StatusOK), &todos)
+		if len(todos) != 0 {
+			t.Errorf("want the list's todos kept out of the personal list, got %+v", todos)
+		}
+		alice.do(http.MethodGet, "/api/todo/1", nil, http.StatusNotFound)
+		alice.do(http.MethodPost, "/api/lists/1/todo/toggle/1", nil, http.StatusOK)
+	})
+
+	t.Run("checks roles", func(t *testing.T) {
+		carol.do(http.MethodGet, "/api/lists/1/todos", nil, http.StatusOK)
+		carol.do(http.MethodGet, "/api/lists/1/todo/1/history", nil, http.StatusOK)
+		if snapshot := carol.sync("/api/lists/1/sync"); snapshot.Type != server.SyncSnapshot || len(snapshot.Todos) != 1 {
+			t.Errorf("unexpected snapshot %+v", snapshot)
+		}
+		var p server.Problem
+		carol.decode(carol.do(http.MethodPost, "/api/lists/1/todo", store.Todo{Description: "Buy soap"}, http.StatusForbidden), &p)
+		if p.Code != server.CodeForbidden {
+			t.Errorf("unexpected problem %+v", p)
+		}
+		carol.do(http.MethodDelete, "/api/lists/1/todo/1", nil, http.StatusForbidden)
+		carol.do(http.MethodPost, "/api/lists/1/sections", server.SectionRequest{Name: "Kitchen"}, http.StatusForbidden)
+		bob.do(http.MethodPost, "/api/lists/1/sections", server.SectionRequest{Name: "Kitchen"}, http.StatusCreated)
+		carol.do(http.MethodGet, "/api/lists/1/sections", nil, http.StatusOK)
+
+		dave.do(http.MethodGet, "/api/lists/1/todos", nil, http.StatusNotFound)
+		dave.do(http.MethodGet, "/api/lists/1", nil, http.StatusNotFound)
+
+		bob.do(http.MethodPut, "/api/lists/1", server.ListRequest{Name: "Mine now"}, http.StatusForbidden)
+		bob.do(http.MethodPut, "/api/lists/1/members/3", server.MemberRequest{Role: store.RoleEditor}, http.StatusForbidden)
+		bob.do(http.MethodDelete, "/api/lists/1/members/1", nil, http.StatusForbidden)
+		bob.do(http.MethodGet, "/api/lists/1/invitations", nil, http.StatusForbidden)
+		bob.do(http.MethodDelete, "/api/lists/1", nil, http.StatusForbidden)
+	})
+
+	t.Run("lets owners manage the list", func(t *testing.T) {
+		alice.decode(alice.do(http.MethodPut, "/api/lists/1", server.ListRequest{Name: "Chores"}, http.StatusOK), &list)
+		if list.Name != "Chores" {
+			t.Errorf("unexpected list %+v", list)
+		}
+		alice.do(http.MethodPut, "/api/lists/1/members/3", server.MemberRequest{Role: "boss"}, http.StatusUnprocessableEntity)
+		alice.do(http.MethodPut, "/api/lists/1/members/3", server.MemberRequest{Role: store.RoleEditor}, http.StatusNoContent)
+		carol.do(http.MethodPost, "/api/lists/1/todo", store.Todo{Description: "Buy soap"}, http.StatusCreated)
+
+		alice.do(http.MethodPut, "/api/lists/1/members/1", server.MemberRequest{Role: store.RoleViewer}, http.StatusConflict)
+		carol.do(http.MethodDelete, "/api/lists/1/members/3", nil, http.StatusNoContent)
+		carol.do(http.MethodGet, "/api/lists/1/todos", nil, http.StatusNotFound)
+
+		alice.do(http.MethodDelete, "/api/lists/1", nil, http.StatusConflict)
+	})
+
+	t.Run("renders lists for HTMX", func(t *testing.T) {
+		alice.do(http.MethodPost, "/api/lists", server.ListRequest{Name: "Groceries"}, http.StatusCreated)
+
+		switcher := htmx(t, alice, http.MethodGet, "/api/lists?list=1")
+		if !strings.Contains(switcher, `href="/?list=1" aria-current="page"`) || !strings.Contains(switcher, "Groceries") {
+			t.Errorf("unexpected switcher %s", switcher)
+		}
+		undo := htmx(t, bob, http.MethodDelete, "/api/lists/1/todo/1")
+		if !strings.Contains(undo, `hx-post="/api/lists/1/todo/1/restore"`) {
+			t.Errorf("want undo to restore through the list, got %s", undo)
+		}
+	})
+}
+
+// htmx makes a request as HTMX does and returns the partial.
+func htmx(t *testing.T, c *authClient, method, path string) string {
+	t.Helper()
+	request, _ := http.NewRequest(method, c.url+path, nil)
+	request.Header.Set("HX-Request", "true")
+	response, err := c.http.Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	assertStatus(t, response.StatusCode, http.StatusOK)
+	body, _ := io.ReadAll(response.Body)
+	return string(body)
+}
@@ -0,0 +1,186 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/mcadenas-bjss/go-do-it/store"
+	"github.com/pkg/errors"
+)
+
+const (
+	SECTIONS_PATH   = "/api/sections"
+	SECTION_ID_PATH = "/api/sections/{id}"
+)
+
+// SectionRequest is the body of a request creating or renaming a section.
+type SectionRequest struct {
+	Name string
+}
+
+// MoveRequest is the body of POST /api/todo/{id}/move. After and Before are
+// the ids of the todos to move it between, and Section the section to move
+// it to, 0 taking it out of its section.
+type MoveRequest struct {
+	After   int
+	Before  int
+	Section *int
+}
+
+// check validates a move of todo id.
+func (input MoveRequest) check(id int) error {
+	msg := ""
+	switch {
+	case input.After == 0 && input.Before == 0 && input.Section == nil:
+		msg = "a move needs After, Before or Section"
+	case input.After == id || input.Before == id:
+		msg = "a todo cannot be moved next to itself"
+	default:
+		return nil
+	}
+	return &malformedRequest{status: http.StatusUnprocessableEntity, code: CodeValidationFailed, msg: msg}
+}
+
+// sectionRoutes are the routes of the sections of a list, served when the
+// store keeps sections.
+func (t *TodoServer) sectionRoutes() []route {
+	return []route{
+		{fmt.Sprintf("GET %s", SECTIONS_PATH), store.ScopeTodosRead, t.handleGetSections},
+		{fmt.Sprintf("POST %s", SECTIONS_PATH), store.ScopeTodosWrite, t.handlePostSection},
+		{fmt.Sprintf("PUT %s", SECTION_ID_PATH), store.ScopeTodosWrite, t.handlePutSection},
+		{fmt.Sprintf("DELETE %s", SECTION_ID_PATH), store.ScopeTodosWrite, t.handleDeleteSection},
+	}
+}
+
+func (t *TodoServer) handleGetSections(w http.ResponseWriter, r *http.Request) {
+	log.Printf("%s %s", r.Method, r.URL.Path)
+
+	sections, err := t.sections.Sections(r.Context())
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.Header().Set("content-type", jsonContentType)
+	json.NewEncoder(w).Encode(sections)
+}
+
+func (t *TodoServer) handlePostSection(w http.ResponseWriter, r *http.Request) {
+	log.Printf("%s %s", r.Method, r.URL.Path)
+
+	var input SectionRequest
+	if err := decodeJSONBody(w, r, &input); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if err := checkName(&input.Name); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	section, err := t.sections.CreateSection(r.Context(), input.Name)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.Header().Set("content-type", jsonContentType)
+	w.Header().Set("Location", fmt.Sprintf("%s/sections/%d", todoBase(r), section.Id))
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(section)
+}
+
+func (t *TodoServer) handlePutSection(w http.ResponseWriter, r *http.Request) {
+	log.Printf("%s %s", r.Method, r.URL.Path)
+
+	id, err := pathId(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	var input SectionRequest
+	if err := decodeJSONBody(w, r, &input); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if err := checkName(&input.Name); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	section, err := t.sections.RenameSection(r.Context(), id, input.Name)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.Header().Set("content-type", jsonContentType)
+	json.NewEncoder(w).Encode(section)
+}
+
+// handleDeleteSection deletes an empty section. Its todos have to be moved
+// out of it first, including those in the trash.
+func (t *TodoServer) handleDeleteSection(w http.ResponseWriter, r *http.Request) {
+	log.Printf("%s %s", r.Method, r.URL.Path)
+
+	id, err := pathId(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if err := t.sections.DeleteSection(r.Context(), id); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleMoveTodo moves a todo between two others or to another section and
+// returns it, or its list item for HTMX.
+func (t *TodoServer) handleMoveTodo(w http.ResponseWriter, r *http.Request) {
+	log.Printf("%s %s", r.Method, r.URL.Path)
+
+	id, err := pathId(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	var input MoveRequest
+	if err := decodeJSONBody(w, r, &input); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if err := input.check(id); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	revision, err := ifMatchRevision(r, id)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	move := store.Move{After: input.After, Before: input.Before, Section: input.Section}
+	cmd := store.NewMoveCommand(r.Context(), store.Ref{Id: id, Revision: revision}, move)
+	t.cmds <- cmd
+
+	todo, err := cmd.Wait()
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.Header().Set("ETag", todoETag(todo))
+
+	if wantsHTML(r) {
+		var buf bytes.Buffer
+		if err := t.renderer.RenderTodo(&buf, todo, todoBase(r), requestLocation(r, t.location)); err != nil {
+			writeError(w, r, errors.Wrap(err, "failed to render todo"))
+			return
+		}
+		w.Header().Set("content-type", htmlContentType)
+		buf.WriteTo(w)
+		return
+	}
+	w.Header().Set("content-type", jsonContentType)
+	json.NewEncoder(w).Encode(todo)
+}
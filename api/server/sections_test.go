@@ -0,0 +1,89 @@
+package server_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mcadenas-bjss/go-do-it/server"
+	"github.com/mcadenas-bjss/go-do-it/store"
+)
+
+func TestMoveTodo(t *testing.T) {
+	ts := httptest.NewServer(server.NewTodoServer(store.NewMemoryTodoStore(
+		store.Todo{Id: 1, Description: "Buy milk"},
+		store.Todo{Id: 2, Description: "Buy eggs"},
+		store.Todo{Id: 3, Description: "Buy bread"},
+	)))
+	defer ts.Close()
+	c := newAuthClient(t, ts.URL)
+
+	order := func() []int {
+		var todos []store.Todo
+		c.decode(c.do(http.MethodGet, "/api/todos", nil, http.StatusOK), &todos)
+		ids := make([]int, len(todos))
+		for i, todo := range todos {
+			ids[i] = todo.Id
+		}
+		return ids
+	}
+
+	t.Run("reorders todos", func(t *testing.T) {
+		var todo store.Todo
+		response := c.do(http.MethodPost, "/api/todo/3/move", server.MoveRequest{Before: 1}, http.StatusOK)
+		c.decode(response, &todo)
+		if todo.Revision != 2 || response.Header.Get("ETag") != `"3-2"` {
+			t.Errorf("unexpected todo %+v", todo)
+		}
+		c.do(http.MethodPost, "/api/todo/1/move", server.MoveRequest{After: 2}, http.StatusOK)
+		if got := order(); len(got) != 3 || got[0] != 3 || got[1] != 2 || got[2] != 1 {
+			t.Errorf("got order %v want [3 2 1]", got)
+		}
+	})
+
+	t.Run("rejects bad moves", func(t *testing.T) {
+		c.do(http.MethodPost, "/api/todo/1/move", server.MoveRequest{}, http.StatusUnprocessableEntity)
+		c.do(http.MethodPost, "/api/todo/1/move", server.MoveRequest{After: 1}, http.StatusUnprocessableEntity)
+		c.do(http.MethodPost, "/api/todo/1/move", server.MoveRequest{After: 2, Before: 3}, http.StatusUnprocessableEntity)
+		c.do(http.MethodPost, "/api/todo/1/move", server.MoveRequest{After: 99}, http.StatusUnprocessableEntity)
+		c.do(http.MethodPost, "/api/todo/99/move", server.MoveRequest{After: 1}, http.StatusNotFound)
+	})
+
+	t.Run("moves todos into sections", func(t *testing.T) {
+		var section store.Section
+		response := c.do(http.MethodPost, "/api/sections", server.SectionRequest{Name: " Shopping "}, http.StatusCreated)
+		c.decode(response, &section)
+		if section.Name != "Shopping" || response.Header.Get("Location") != "/api/sections/1" {
+			t.Errorf("unexpected section %+v", section)
+		}
+		c.do(http.MethodPost, "/api/sections", server.SectionRequest{}, http.StatusUnprocessableEntity)
+		c.do(http.MethodPut, "/api/sections/1", server.SectionRequest{Name: "Groceries"}, http.StatusOK)
+		c.do(http.MethodPut, "/api/sections/2", server.SectionRequest{Name: "Groceries"}, http.StatusNotFound)
+
+		var todo store.Todo
+		c.decode(c.do(http.MethodPost, "/api/todo/2/move", server.MoveRequest{Section: &section.Id}, http.StatusOK), &todo)
+		if todo.Section != section.Id {
+			t.Errorf("unexpected todo %+v", todo)
+		}
+		missing := 2
+		c.do(http.MethodPost, "/api/todo/2/move", server.MoveRequest{Section: &missing}, http.StatusUnprocessableEntity)
+
+		var sections []store.Section
+		c.decode(c.do(http.MethodGet, "/api/sections", nil, http.StatusOK), &sections)
+		if len(sections) != 1 || sections[0].Name != "Groceries" {
+			t.Errorf("unexpected sections %+v", sections)
+		}
+		c.do(http.MethodDelete, "/api/sections/1", nil, http.StatusConflict)
+	})
+
+	t.Run("creates todos at the end", func(t *testing.T) {
+		var todo store.Todo
+		c.decode(c.do(http.MethodPost, "/api/todo", store.Todo{Description: "Buy eggs"}, http.StatusCreated), &todo)
+		if todo.Position == "" || todo.Revision != 1 {
+			t.Errorf("unexpected todo %+v", todo)
+		}
+		if got := order(); got[len(got)-1] != todo.Id {
+			t.Errorf("got order %v want %d last", got, todo.Id)
+		}
+	})
+}
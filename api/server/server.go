@@ -1,41 +1,91 @@
 package server
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"log"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/mcadenas-bjss/go-do-it/store"
+	"github.com/mcadenas-bjss/go-do-it/validate"
 	"github.com/mcadenas-bjss/go-do-it/views"
 	"github.com/pkg/errors"
 )
 
-type TodoStore interface {
-	StartManager() chan<- store.Command
-}
-
 type TodoServer struct {
-	store TodoStore
+	store    store.TodoStore
+	users    store.UserStore
+	lists    store.ListStore
+	sections store.SectionStore
 	http.Handler
-	cmds     chan<- store.Command
-	renderer views.TodoRenderer
+	cmds           chan<- store.Command
+	hub            *store.Hub
+	renderer       views.TodoRenderer
+	readWorkers    int
+	location       *time.Location
+	trashRetention time.Duration
+}
+
+// route is an API route with the scope an API token needs to use it.
+type route struct {
+	pattern string
+	scope   store.Scope
+	handler http.HandlerFunc
+}
+
+// Option configures optional TodoServer settings.
+type Option func(*TodoServer)
+
+// WithReadWorkers sets how many read commands the store manager serves in
+// parallel.
+func WithReadWorkers(n int) Option {
+	return func(t *TodoServer) {
+		t.readWorkers = n
+	}
 }
 
 const jsonContentType = "application/json"
 const htmlContentType = "text/html"
+const mergePatchContentType = "application/merge-patch+json"
+const jsonPatchContentType = "application/json-patch+json"
+const eventStreamContentType = "text/event-stream"
 const (
 	HEALTH_PATH    = "GET /api/health"
 	TODO_ID_PATH   = "/api/todo/{id}"
 	POST_TODO_PATH = "POST /api/todo"
 	GET_TODOS_PATH = "GET /api/todos"
+	SEARCH_PATH    = "GET /api/todos/search"
+	BATCH_PATH     = "POST /api/todos/batch"
+	COMPLETE_PATH  = "POST /api/todos/complete-all"
+	CLEAR_PATH     = "DELETE /api/todos/completed"
+	TRASH_PATH     = "GET /api/trash"
+	ACTION_PATH    = "POST /api/todo/{id}/{action}"
+	HISTORY_PATH   = "GET /api/todo/{id}/history"
+	EVENTS_PATH    = "GET /api/events"
+	STREAM_PATH    = "GET /api/events/stream"
+	SYNC_PATH      = "GET /api/sync"
 )
 
-func NewTodoServer(store TodoStore) *TodoServer {
+// WithTimezone sets the timezone relative due dates are rendered in when a
+// request does not name one.
+func WithTimezone(loc *time.Location) Option {
+	return func(t *TodoServer) {
+		t.location = loc
+	}
+}
+
+func NewTodoServer(s store.TodoStore, opts ...Option) *TodoServer {
 	t := new(TodoServer)
 
-	t.store = store
+	t.store = s
+	t.location = time.Local
+	for _, opt := range opts {
+		opt(t)
+	}
 
 	renderer, err := views.NewTodoRenderer()
 	if err != nil {
@@ -45,22 +95,52 @@ func NewTodoServer(store TodoStore) *TodoServer {
 	}
 	t.renderer = *renderer
 
-	t.cmds = t.store.StartManager()
+	t.hub = store.NewHub()
+	t.cmds = store.StartManager(t.store, t.readWorkers, store.WithHub(t.hub))
 
 	router := http.NewServeMux()
 
-	// API CRUD
+	// API CRUD. Every route names the scope an API token needs to use it.
 	router.Handle(HEALTH_PATH, http.HandlerFunc(t.healthHandler))
-	router.Handle(fmt.Sprintf("GET %s", TODO_ID_PATH), http.HandlerFunc(t.handleGetTodo))
-	router.Handle(POST_TODO_PATH, http.HandlerFunc(t.handlePostTodo))
-	router.Handle(fmt.Sprintf("DELETE %s", TODO_ID_PATH), http.HandlerFunc(t.handleDeleteTodo))
-	router.Handle(fmt.Sprintf("PUT %s", TODO_ID_PATH), http.HandlerFunc(t.handlePutTodo))
-	router.Handle(GET_TODOS_PATH, http.HandlerFunc(t.handleGetAllTodo))
-
-	// Partials
-	router.Handle("POST /api/todo/toggle/{id}", http.HandlerFunc(t.handleToggleCompleteState))
+	routes := []route{
+		{fmt.Sprintf("GET %s", TODO_ID_PATH), store.ScopeTodosRead, t.handleGetTodo},
+		{POST_TODO_PATH, store.ScopeTodosWrite, t.handlePostTodo},
+		{fmt.Sprintf("DELETE %s", TODO_ID_PATH), store.ScopeTodosWrite, t.handleDeleteTodo},
+		{fmt.Sprintf("PUT %s", TODO_ID_PATH), store.ScopeTodosWrite, t.handlePutTodo},
+		{fmt.Sprintf("PATCH %s", TODO_ID_PATH), store.ScopeTodosWrite, t.handlePatchTodo},
+		{GET_TODOS_PATH, store.ScopeTodosRead, t.handleGetAllTodo},
+		{SEARCH_PATH, store.ScopeTodosRead, t.handleSearchTodos},
+		{BATCH_PATH, store.ScopeTodosWrite, t.handleBatch},
+		{COMPLETE_PATH, store.ScopeTodosWrite, t.handleCompleteAll},
+		{CLEAR_PATH, store.ScopeTodosWrite, t.handleDeleteCompleted},
+		{TRASH_PATH, store.ScopeTodosRead, t.handleGetTrash},
+		{ACTION_PATH, store.ScopeTodosWrite, t.handleTodoAction},
+		{HISTORY_PATH, store.ScopeTodosRead, t.handleTodoHistory},
+		{EVENTS_PATH, store.ScopeTodosRead, t.handleEvents},
+		{STREAM_PATH, store.ScopeTodosRead, t.handleEventStream},
+		{SYNC_PATH, store.ScopeTodosRead, t.handleSync},
+
+		// Partials
+		{"POST /api/todo/toggle/{id}", store.ScopeTodosWrite, t.handleToggleCompleteState},
+	}
+	if sections, ok := s.(store.SectionStore); ok {
+		t.sections = sections
+		routes = append(routes, t.sectionRoutes()...)
+	}
+	for _, route := range routes {
+		router.Handle(route.pattern, requireScope(route.scope, route.handler))
+	}
 
-	t.Handler = router
+	if t.users != nil {
+		t.handleAuth(router)
+		t.handleTokens(router)
+		if t.lists != nil {
+			t.handleLists(router, routes)
+		}
+		t.Handler = withActor(t.authenticate(router))
+	} else {
+		t.Handler = withActor(router)
+	}
 
 	return t
 }
@@ -74,168 +154,312 @@ func (t *TodoServer) healthHandler(w http.ResponseWriter, r *http.Request) {
 
 func (t *TodoServer) handleGetTodo(w http.ResponseWriter, r *http.Request) {
 	log.Printf("%s %s", r.Method, r.URL.Path)
-	id, err := strconv.Atoi(r.PathValue("id"))
+	id, err := pathId(r)
 	if err != nil {
-		log.Println(errors.Wrap(err, "failed to get id from path"))
-		w.WriteHeader(http.StatusBadRequest)
+		writeError(w, r, err)
+		return
 	}
 
-	errChannel := make(chan error)
-	replyChan := make(chan interface{})
-	t.cmds <- store.Command{Cmd: store.GetCommand, Ctx: r.Context(), Payload: id, Reply: replyChan, Err: errChannel}
+	cmd := store.NewGetCommand(r.Context(), id)
+	t.cmds <- cmd
 
-	select {
-	case err := <-errChannel:
-		switch err.Error() {
-		case "todo not found":
-			w.WriteHeader(http.StatusNotFound)
-			return
-		default:
-			w.WriteHeader(http.StatusInternalServerError)
-			return
-		}
-	case reply := <-replyChan:
-		json.NewEncoder(w).Encode(reply)
+	todo, err := cmd.Wait()
+	if err != nil {
+		writeError(w, r, err)
+		return
 	}
+
+	etag := todoETag(todo)
+	w.Header().Set("ETag", etag)
+	if etagMatches(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	json.NewEncoder(w).Encode(todo)
 }
 
 func (t *TodoServer) handleGetAllTodo(w http.ResponseWriter, r *http.Request) {
 	log.Printf("%s %s", r.Method, r.URL.Path)
 
-	errChan := make(chan error)
-	replyChan := make(chan interface{})
-	t.cmds <- store.Command{Cmd: store.GetAllCommand, Ctx: r.Context(), Payload: nil, Reply: replyChan, Err: errChan}
+	opts, err := parseListOptions(r.URL.Query())
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	cmd := store.NewGetAllCommand(r.Context(), opts)
+	t.cmds <- cmd
+
+	page, err := cmd.Wait()
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	if page.NextCursor != "" {
+		next := *r.URL
+		query := next.Query()
+		query.Set("cursor", page.NextCursor)
+		next.RawQuery = query.Encode()
+		w.Header().Set("Link", fmt.Sprintf(`<%s>; rel="next"`, next.RequestURI()))
+	}
+
+	var buf bytes.Buffer
+	json.NewEncoder(&buf).Encode(page.Todos)
+	etag := bodyETag(buf.Bytes())
+	w.Header().Set("ETag", etag)
+	if etagMatches(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	buf.WriteTo(w)
+}
+
+func (t *TodoServer) handleSearchTodos(w http.ResponseWriter, r *http.Request) {
+	log.Printf("%s %s", r.Method, r.URL.Path)
+
+	query := r.URL.Query()
+	q := store.SearchQuery{Query: query.Get("q")}
+	if strings.TrimSpace(q.Query) == "" {
+		writeError(w, r, badParameter("q must not be empty"))
+		return
+	}
+	if v := query.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > maxPageSize {
+			writeError(w, r, badParameter(fmt.Sprintf("limit must be a number between 1 and %d", maxPageSize)))
+			return
+		}
+		q.Limit = limit
+	}
+
+	cmd := store.NewSearchCommand(r.Context(), q)
+	t.cmds <- cmd
+
+	results, err := cmd.Wait()
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
 
-	select {
-	case err := <-errChan:
-		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
+	if wantsHTML(r) {
+		var buf bytes.Buffer
+		if err := t.renderer.RenderSearchResults(&buf, q.Query, results, requestLocation(r, t.location)); err != nil {
+			writeError(w, r, errors.Wrap(err, "failed to render search results"))
 			return
 		}
-	case reply := <-replyChan:
-		json.NewEncoder(w).Encode(reply)
+		w.Header().Set("content-type", htmlContentType)
+		buf.WriteTo(w)
+		return
 	}
+	w.Header().Set("content-type", jsonContentType)
+	json.NewEncoder(w).Encode(results)
 }
 
 func (t *TodoServer) handlePostTodo(w http.ResponseWriter, r *http.Request) {
 	log.Printf("%s %s", r.Method, r.URL.Path)
 
-	var todo store.Todo
-	err := decodeJSONBody(w, r, &todo)
+	var input validate.Todo
+	if err := decodeJSONBody(w, r, &input); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if err := input.Create(); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	todo, err := store.TodoFromInput(input)
 	if err != nil {
-		var mr *malformedRequest
-		if errors.As(err, &mr) {
-			http.Error(w, mr.msg, mr.status)
-		} else {
-			log.Print(err.Error())
-			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
-		}
+		writeError(w, r, err)
 		return
 	}
 
-	errChannel := make(chan error)
-	replyChan := make(chan interface{})
-	t.cmds <- store.Command{Cmd: store.InsertCommand, Ctx: r.Context(), Payload: todo, Reply: replyChan, Err: errChannel}
+	cmd := store.NewInsertCommand(r.Context(), todo)
+	t.cmds <- cmd
 
-	select {
-	case err := <-errChannel:
-		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			return
-		}
-	case reply := <-replyChan:
-		newTodo := store.Todo{Id: reply.(int), Time: todo.Time, Description: todo.Description, Completed: todo.Completed}
-		if err := t.renderer.RenderTodo(w, newTodo); err != nil {
-			log.Printf("failed to render todo: %s", err.Error())
-			w.WriteHeader(http.StatusInternalServerError)
-			return
-		}
+	newTodo, err := cmd.Wait()
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	if wantsJSON(r) {
+		w.Header().Set("content-type", jsonContentType)
+		w.Header().Set("Location", fmt.Sprintf("%s/todo/%d", todoBase(r), newTodo.Id))
+		w.Header().Set("ETag", todoETag(newTodo))
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(newTodo)
+		return
+	}
+	var buf bytes.Buffer
+	if err := t.renderer.RenderTodo(&buf, newTodo, todoBase(r), requestLocation(r, t.location)); err != nil {
+		writeError(w, r, errors.Wrap(err, "failed to render todo"))
+		return
 	}
+	buf.WriteTo(w)
 }
 
 func (t *TodoServer) handlePutTodo(w http.ResponseWriter, r *http.Request) {
 	log.Printf("%s %s", r.Method, r.URL.Path)
 
-	var todo store.Todo
-	err := decodeJSONBody(w, r, &todo)
+	id, err := pathId(r)
 	if err != nil {
-		var mr *malformedRequest
-		if errors.As(err, &mr) {
-			http.Error(w, mr.msg, mr.status)
-		} else {
-			log.Print(err.Error())
-			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
-		}
+		writeError(w, r, err)
 		return
 	}
 
-	id, err := strconv.Atoi(r.PathValue("id"))
+	var input validate.Todo
+	if err := decodeJSONBody(w, r, &input); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if err := input.Update(id); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	revision, err := ifMatchRevision(r, id)
 	if err != nil {
-		log.Println(errors.Wrap(err, "failed to get id from path"))
-		w.WriteHeader(http.StatusBadRequest)
+		writeError(w, r, err)
+		return
+	}
+	todo, err := store.TodoFromInput(input)
+	if err != nil {
+		writeError(w, r, err)
+		return
 	}
-
 	todo.Id = id
+	todo.Revision = revision
+
+	cmd := store.NewUpdateCommand(r.Context(), todo)
+	t.cmds <- cmd
+
+	ok, err := cmd.Wait()
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	json.NewEncoder(w).Encode(ok)
+}
+
+// handlePatchTodo applies a JSON Merge Patch, or a JSON Patch when sent as
+// application/json-patch+json, and returns the updated todo.
+func (t *TodoServer) handlePatchTodo(w http.ResponseWriter, r *http.Request) {
+	log.Printf("%s %s", r.Method, r.URL.Path)
+
+	id, err := pathId(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	var patch store.Patch
+	switch mediaType(r) {
+	case mergePatchContentType, jsonContentType:
+		var mp json.RawMessage
+		err = decodeBody(w, r, &mp)
+		patch = store.MergePatch(mp)
+	case jsonPatchContentType:
+		var jp store.JSONPatch
+		err = decodeBody(w, r, &jp)
+		patch = jp
+	default:
+		msg := fmt.Sprintf("Content-Type header must be %s or %s", mergePatchContentType, jsonPatchContentType)
+		err = &malformedRequest{status: http.StatusUnsupportedMediaType, code: CodeUnsupportedMediaType, msg: msg}
+	}
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	revision, err := ifMatchRevision(r, id)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	cmd := store.NewPatchCommand(r.Context(), store.Ref{Id: id, Revision: revision}, patch)
+	t.cmds <- cmd
 
-	errChannel := make(chan error)
-	replyChan := make(chan interface{})
-	t.cmds <- store.Command{Cmd: store.UpdateCommand, Ctx: r.Context(), Payload: todo, Reply: replyChan, Err: errChannel}
+	todo, err := cmd.Wait()
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.Header().Set("ETag", todoETag(todo))
 
-	select {
-	case err := <-errChannel:
-		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
+	if wantsHTML(r) {
+		var buf bytes.Buffer
+		if err := t.renderer.RenderTodo(&buf, todo, todoBase(r), requestLocation(r, t.location)); err != nil {
+			writeError(w, r, errors.Wrap(err, "failed to render todo"))
 			return
 		}
-	case reply := <-replyChan:
-		json.NewEncoder(w).Encode(reply)
+		w.Header().Set("content-type", htmlContentType)
+		buf.WriteTo(w)
+		return
 	}
+	w.Header().Set("content-type", jsonContentType)
+	json.NewEncoder(w).Encode(todo)
 }
 
 func (t *TodoServer) handleDeleteTodo(w http.ResponseWriter, r *http.Request) {
 	log.Printf("%s %s", r.Method, r.URL.Path)
 
-	id, err := strconv.Atoi(r.PathValue("id"))
+	id, err := pathId(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	revision, err := ifMatchRevision(r, id)
 	if err != nil {
-		log.Println(errors.Wrap(err, "failed to get id from path"))
-		w.WriteHeader(http.StatusBadRequest)
+		writeError(w, r, err)
+		return
 	}
 
-	errChannel := make(chan error)
-	replyChan := make(chan interface{})
-	t.cmds <- store.Command{Cmd: store.DeleteCommand, Ctx: r.Context(), Payload: id, Reply: replyChan, Err: errChannel}
+	cmd := store.NewDeleteCommand(r.Context(), store.Ref{Id: id, Revision: revision})
+	t.cmds <- cmd
+
+	ok, err := cmd.Wait()
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
 
-	select {
-	case err := <-errChannel:
-		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
+	if wantsHTML(r) {
+		var buf bytes.Buffer
+		if err := t.renderer.RenderUndo(&buf, id, todoBase(r)); err != nil {
+			writeError(w, r, errors.Wrap(err, "failed to render undo"))
 			return
 		}
-	case reply := <-replyChan:
-		json.NewEncoder(w).Encode(reply)
+		w.Header().Set("content-type", htmlContentType)
+		buf.WriteTo(w)
+		return
 	}
+	json.NewEncoder(w).Encode(ok)
 }
 
 func (t *TodoServer) handleToggleCompleteState(w http.ResponseWriter, r *http.Request) {
 	log.Printf("%s %s", r.Method, r.URL.Path)
 
-	id, err := strconv.Atoi(r.PathValue("id"))
+	id, err := pathId(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	revision, err := ifMatchRevision(r, id)
 	if err != nil {
-		log.Println(errors.Wrap(err, "failed to get id from path"))
-		w.WriteHeader(http.StatusBadRequest)
+		writeError(w, r, err)
+		return
 	}
 
-	errChannel := make(chan error)
-	replyChan := make(chan interface{})
-	t.cmds <- store.Command{Cmd: store.ToggleCommand, Ctx: r.Context(), Payload: id, Reply: replyChan, Err: errChannel}
+	cmd := store.NewToggleCommand(r.Context(), store.Ref{Id: id, Revision: revision})
+	t.cmds <- cmd
 
-	select {
-	case err := <-errChannel:
-		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			return
-		}
-	case reply := <-replyChan:
-		json.NewEncoder(w).Encode(reply)
+	ok, err := cmd.Wait()
+	if err != nil {
+		writeError(w, r, err)
+		return
 	}
+	json.NewEncoder(w).Encode(ok)
 }
@@ -3,11 +3,13 @@ package server_test
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/mcadenas-bjss/go-do-it/server"
 	"github.com/mcadenas-bjss/go-do-it/store"
@@ -21,11 +23,11 @@ const expectedJson = `<li id="todo-1">
     <p>test todo</p>
     <button
       hx-delete="/api/todo/1"
-      hx-swap="delete"
+      hx-swap="outerHTML"
       hx-target="#todo-1">Delete</button
     >
     <div class="meta">
-      <time datetime=2024-01-01T00:00:00.000Z>Mon, 01 Jan 2024 00:00</time>
+      <time datetime=2024-01-01T00:00:00Z>Mon, 01 Jan 2024 00:00</time>
     </div>
   </div>
 </li>`
@@ -33,17 +35,19 @@ const expectedJson = `<li id="todo-1">
 func TestInsertingTodoItemsAndRetrievingThem(t *testing.T) {
 	os.Setenv("env", "test")
 	dbStore, err := store.NewDbTodoStore(DBConnection)
+	if errors.Is(err, store.ErrNoFTS5) {
+		t.Skip(err)
+	}
 	if err != nil {
 		t.Error(err)
 	}
 
 	defer dbStore.Close()
 
-	srv := *server.NewTodoServer(dbStore)
+	srv := *server.NewTodoServer(dbStore, server.WithTimezone(time.UTC))
 
 	newTodo := &store.Todo{
-		Id:          1, // This ID is ignored in the insert operation as the db creates them sequentially.
-		Time:        "2024-01-01T00:00:00.000Z",
+		Time:        due("2024-01-01T00:00:00.000Z"),
 		Description: "test todo",
 		Completed:   false,
 	}
@@ -53,6 +57,10 @@ func TestInsertingTodoItemsAndRetrievingThem(t *testing.T) {
 	srv.ServeHTTP(insertResp, NewPostTodoRequest(*newTodo))
 	assertHtml(t, insertResp.Body, expectedJson) // assert html response
 
+	newTodo.Id = 1 // the db assigns ids sequentially
+	newTodo.Revision = 1
+	newTodo.Position = "00000000V" // the first todo of the list
+
 	// get
 	response := httptest.NewRecorder()
 	srv.ServeHTTP(response, NewGetTodoRequest(1))
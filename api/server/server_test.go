@@ -4,12 +4,14 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
-	"errors"
 	"fmt"
-	"log"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/mcadenas-bjss/go-do-it/server"
 	"github.com/mcadenas-bjss/go-do-it/store"
@@ -19,113 +21,89 @@ type StubStore struct {
 	todos map[int]store.Todo
 }
 
-func (s *StubStore) StartManager() chan<- store.Command {
-	cmds := make(chan store.Command)
-
-	go func() {
-		for cmd := range cmds {
-			switch cmd.Cmd {
-			case store.GetCommand:
-				if todo, err := s.get(cmd.Ctx, cmd.Payload.(int)); err != nil {
-					cmd.Err <- err
-				} else {
-					cmd.Reply <- todo
-				}
-			case store.GetAllCommand:
-				if todos, err := s.all(cmd.Ctx); err != nil {
-					cmd.Err <- err
-				} else {
-					cmd.Reply <- todos
-				}
-			case store.InsertCommand:
-				if id, err := s.insert(cmd.Ctx, cmd.Payload.(store.Todo)); err != nil {
-					cmd.Err <- err
-				} else {
-					cmd.Reply <- id
-				}
-			case store.UpdateCommand:
-				if ok, err := s.update(cmd.Ctx, cmd.Payload.(store.Todo)); err != nil {
-					cmd.Err <- err
-				} else {
-					cmd.Reply <- ok
-				}
-			case store.DeleteCommand:
-				if ok, err := s.delete(cmd.Ctx, cmd.Payload.(int)); err != nil {
-					cmd.Err <- err
-				} else {
-					cmd.Reply <- ok
-				}
-			case store.ToggleCommand:
-				if ok, err := s.toggle(cmd.Ctx, cmd.Payload.(int)); err != nil {
-					cmd.Err <- err
-				} else {
-					cmd.Reply <- ok
-				}
-			default:
-				log.Fatal("unknown command type", cmd.Cmd)
-			}
-		}
-	}()
-	return cmds
-}
-
-func (s *StubStore) get(ctx context.Context, id int) (store.Todo, error) {
-	data := make(chan store.Todo, 1)
-	e := make(chan error, 1)
-
-	go func() {
-		var result store.Todo
-		select {
-		case <-ctx.Done():
-			return
-		default:
-			if t, ok := s.todos[id]; !ok {
-				e <- errors.New("todo not found")
-				return
-			} else {
-				result = t
-			}
-		}
-		data <- result
-	}()
-
-	select {
-	case <-ctx.Done():
-		return store.Todo{}, ctx.Err()
-	case todo := <-data:
-		return todo, nil
-	case err := <-e:
-		return store.Todo{}, err
+func (s *StubStore) Get(ctx context.Context, id int) (store.Todo, error) {
+	if t, ok := s.todos[id]; ok {
+		return t, nil
 	}
+	return store.Todo{}, store.ErrNotFound
 }
 
-func (s *StubStore) all(ctx context.Context) ([]store.Todo, error) {
+func (s *StubStore) List(ctx context.Context, opts store.ListOptions) (store.Page, error) {
 	v := make([]store.Todo, 0, len(s.todos))
 
 	for _, value := range s.todos {
 		v = append(v, value)
 	}
-	return v, nil
+	return store.Page{Todos: v}, nil
 }
 
-func (s *StubStore) insert(ctx context.Context, todo store.Todo) (int, error) {
+func (s *StubStore) Insert(ctx context.Context, todo store.Todo) (store.Todo, error) {
 	newId := len(s.todos) + 1
 	s.todos[newId] = todo
-	return newId, nil
+	todo.Id, todo.Revision = newId, 1
+	return todo, nil
 }
 
-func (s *StubStore) update(ctx context.Context, todo store.Todo) (bool, error) {
+func (s *StubStore) Update(ctx context.Context, todo store.Todo) (bool, error) {
 	return true, nil
 }
 
-func (s *StubStore) delete(ctx context.Context, id int) (bool, error) {
+func (s *StubStore) Delete(ctx context.Context, ref store.Ref) (bool, error) {
 	return true, nil
 }
 
-func (s *StubStore) toggle(ctx context.Context, id int) (bool, error) {
+func (s *StubStore) Toggle(ctx context.Context, ref store.Ref) (bool, error) {
 	return true, nil
 }
 
+func (s *StubStore) Patch(ctx context.Context, ref store.Ref, patch store.Patch) (store.Todo, error) {
+	return s.todos[ref.Id], nil
+}
+
+func (s *StubStore) Move(ctx context.Context, ref store.Ref, move store.Move) (store.Todo, error) {
+	return s.todos[ref.Id], nil
+}
+
+func (s *StubStore) Batch(ctx context.Context, batch store.Batch) ([]store.OpResult, error) {
+	return make([]store.OpResult, len(batch.Ops)), nil
+}
+
+func (s *StubStore) CompleteAll(ctx context.Context) (int, error) {
+	return 0, nil
+}
+
+func (s *StubStore) DeleteCompleted(ctx context.Context) (int, error) {
+	return 0, nil
+}
+
+func (s *StubStore) Trash(ctx context.Context) ([]store.TrashedTodo, error) {
+	return []store.TrashedTodo{}, nil
+}
+
+func (s *StubStore) Restore(ctx context.Context, ref store.Ref) (store.Todo, error) {
+	return s.todos[ref.Id], nil
+}
+
+func (s *StubStore) Purge(ctx context.Context, before time.Time) (int, error) {
+	return 0, nil
+}
+
+func (s *StubStore) History(ctx context.Context, id int) ([]store.Event, error) {
+	return []store.Event{}, nil
+}
+
+func (s *StubStore) Events(ctx context.Context, q store.EventQuery) ([]store.Event, error) {
+	return []store.Event{}, nil
+}
+
+func (s *StubStore) LastEventId(ctx context.Context) (int, error) {
+	return 0, nil
+}
+
+func (s *StubStore) Search(ctx context.Context, q store.SearchQuery) ([]store.SearchResult, error) {
+	return []store.SearchResult{}, nil
+}
+
 func TestHealth(t *testing.T) {
 	server := server.NewTodoServer(&StubStore{})
 
@@ -149,8 +127,8 @@ func TestHealth(t *testing.T) {
 func TestCRUD(t *testing.T) {
 	stubStore := StubStore{
 		map[int]store.Todo{
-			1: {Id: 1, Time: "2024-01-01T00:00:00.000Z", Description: "Buy milk", Completed: false},
-			2: {Id: 2, Time: "2024-01-01T00:00:00.000Z", Description: "Buy bread", Completed: true},
+			1: {Id: 1, Time: due("2024-01-01T00:00:00.000Z"), Description: "Buy milk", Completed: false},
+			2: {Id: 2, Time: due("2024-01-01T00:00:00.000Z"), Description: "Buy bread", Completed: true},
 		},
 	}
 
@@ -210,7 +188,7 @@ func TestCRUD(t *testing.T) {
 	})
 
 	t.Run("Insert", func(t *testing.T) {
-		request := NewPostTodoRequest(store.Todo{Id: 3, Time: "2024-01-01T00:00:00.000Z", Description: "Buy butter", Completed: false})
+		request := NewPostTodoRequest(store.Todo{Time: due("2024-01-01T00:00:00.000Z"), Description: "Buy butter", Completed: false})
 		response := httptest.NewRecorder()
 
 		todoServer.ServeHTTP(response, request)
@@ -223,6 +201,661 @@ func TestCRUD(t *testing.T) {
 	})
 }
 
+func TestListTodos(t *testing.T) {
+	todoServer := server.NewTodoServer(store.NewMemoryTodoStore(
+		store.Todo{Id: 1, Time: due("2024-01-01T00:00:00Z"), Description: "Buy milk", Completed: false},
+		store.Todo{Id: 2, Time: due("2024-01-02T00:00:00Z"), Description: "Buy bread", Completed: true},
+		store.Todo{Id: 3, Time: due("2024-01-03T00:00:00Z"), Description: "Walk the dog", Completed: false},
+	))
+
+	t.Run("pages are linked", func(t *testing.T) {
+		request, _ := http.NewRequest("GET", "/api/todos?limit=2&sort=time&order=desc", nil)
+		response := httptest.NewRecorder()
+
+		todoServer.ServeHTTP(response, request)
+
+		var got []store.Todo
+		assertJson(t, response.Body, &got)
+		assertStatus(t, response.Code, http.StatusOK)
+		if len(got) != 2 || got[0].Id != 3 || got[1].Id != 2 {
+			t.Fatalf("unexpected first page %+v", got)
+		}
+
+		link := response.Header().Get("Link")
+		next, ok := strings.CutSuffix(strings.TrimPrefix(link, "<"), `>; rel="next"`)
+		if !ok {
+			t.Fatalf("expected a next link, got %q", link)
+		}
+
+		request, _ = http.NewRequest("GET", next, nil)
+		response = httptest.NewRecorder()
+		todoServer.ServeHTTP(response, request)
+
+		got = nil
+		assertJson(t, response.Body, &got)
+		if len(got) != 1 || got[0].Id != 1 {
+			t.Errorf("unexpected second page %+v", got)
+		}
+		if link := response.Header().Get("Link"); link != "" {
+			t.Errorf("expected no link on the last page, got %q", link)
+		}
+	})
+
+	t.Run("filters", func(t *testing.T) {
+		request, _ := http.NewRequest("GET", "/api/todos?completed=false&q=buy", nil)
+		response := httptest.NewRecorder()
+
+		todoServer.ServeHTTP(response, request)
+
+		var got []store.Todo
+		assertJson(t, response.Body, &got)
+		if len(got) != 1 || got[0].Id != 1 {
+			t.Errorf("unexpected todos %+v", got)
+		}
+	})
+
+	for _, query := range []string{"limit=0", "limit=abc", "sort=priority", "order=up", "completed=maybe", "due_before=tomorrow", "cursor=nope"} {
+		t.Run("rejects "+query, func(t *testing.T) {
+			request, _ := http.NewRequest("GET", "/api/todos?"+query, nil)
+			response := httptest.NewRecorder()
+
+			todoServer.ServeHTTP(response, request)
+
+			assertStatus(t, response.Code, http.StatusBadRequest)
+		})
+	}
+}
+
+func TestSearchTodos(t *testing.T) {
+	todoServer := server.NewTodoServer(store.NewMemoryTodoStore(
+		store.Todo{Id: 1, Description: "Buy milk"},
+		store.Todo{Id: 2, Description: "Walk the dog"},
+	))
+
+	t.Run("returns ranked json results", func(t *testing.T) {
+		request, _ := http.NewRequest("GET", "/api/todos/search?q=mil", nil)
+		response := httptest.NewRecorder()
+
+		todoServer.ServeHTTP(response, request)
+
+		var got []store.SearchResult
+		assertJson(t, response.Body, &got)
+		assertStatus(t, response.Code, http.StatusOK)
+		if len(got) != 1 || got[0].Id != 1 || got[0].Snippet != "Buy <mark>milk</mark>" {
+			t.Errorf("unexpected results %+v", got)
+		}
+	})
+
+	t.Run("returns an html partial to htmx", func(t *testing.T) {
+		request, _ := http.NewRequest("GET", "/api/todos/search?q=dog", nil)
+		request.Header.Set("HX-Request", "true")
+		response := httptest.NewRecorder()
+
+		todoServer.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, http.StatusOK)
+		body := response.Body.String()
+		if !strings.Contains(body, `<li id="search-result-2">`) || !strings.Contains(body, "Walk the <mark>dog</mark>") {
+			t.Errorf("unexpected partial %s", body)
+		}
+	})
+
+	t.Run("requires a query", func(t *testing.T) {
+		request, _ := http.NewRequest("GET", "/api/todos/search?q=", nil)
+		response := httptest.NewRecorder()
+
+		todoServer.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, http.StatusBadRequest)
+	})
+}
+
+func TestDueTimes(t *testing.T) {
+	todoServer := server.NewTodoServer(store.NewMemoryTodoStore(), server.WithTimezone(time.UTC))
+
+	t.Run("stores offsets as utc", func(t *testing.T) {
+		body := strings.NewReader(`{"Time": "2024-03-01T09:30:00+02:00", "Description": "Buy milk"}`)
+		request, _ := http.NewRequest(http.MethodPost, "/api/todo", body)
+		response := httptest.NewRecorder()
+
+		todoServer.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, http.StatusOK)
+		if !strings.Contains(response.Body.String(), "datetime=2024-03-01T07:30:00Z") {
+			t.Errorf("expected a utc datetime, got %s", response.Body.String())
+		}
+	})
+
+	t.Run("renders in the requested timezone", func(t *testing.T) {
+		body := strings.NewReader(`{"Time": "2024-03-01T23:30:00Z", "Description": "Walk the dog"}`)
+		request, _ := http.NewRequest(http.MethodPost, "/api/todo?tz=Asia/Tokyo", body)
+		response := httptest.NewRecorder()
+
+		todoServer.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, http.StatusOK)
+		if !strings.Contains(response.Body.String(), "Sat, 02 Mar 2024 08:30") {
+			t.Errorf("expected the time in Tokyo, got %s", response.Body.String())
+		}
+	})
+
+}
+
+func TestValidation(t *testing.T) {
+	todoServer := server.NewTodoServer(store.NewMemoryTodoStore(
+		store.Todo{Id: 1, Description: "Buy milk"},
+	))
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		fields []string
+	}{
+		{"every broken rule at once", http.MethodPost, "/api/todo", `{"Id": 4, "Time": "next tuesday", "Description": "  "}`, []string{"Id", "Description", "Time"}},
+		{"description too long", http.MethodPost, "/api/todo", fmt.Sprintf(`{"Description": %q}`, strings.Repeat("a", 501)), []string{"Description"}},
+		{"update with another id", http.MethodPut, "/api/todo/1", `{"Id": 2, "Description": "Buy bread"}`, []string{"Id"}},
+		{"update without a description", http.MethodPut, "/api/todo/1", `{"Time": "2024-01-01T00:00:00Z"}`, []string{"Description"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request, _ := http.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			response := httptest.NewRecorder()
+
+			todoServer.ServeHTTP(response, request)
+
+			assertStatus(t, response.Code, http.StatusUnprocessableEntity)
+			var got server.Problem
+			assertJson(t, response.Body, &got)
+			if got.Code != server.CodeValidationFailed {
+				t.Errorf("got code %q want %q", got.Code, server.CodeValidationFailed)
+			}
+			fields := make([]string, len(got.Errors))
+			for i, fe := range got.Errors {
+				fields[i] = fe.Field
+			}
+			if !reflect.DeepEqual(fields, tt.fields) {
+				t.Errorf("got invalid fields %v want %v", fields, tt.fields)
+			}
+		})
+	}
+
+	t.Run("update with the matching id", func(t *testing.T) {
+		request, _ := http.NewRequest(http.MethodPut, "/api/todo/1", strings.NewReader(`{"Id": 1, "Description": "Buy oat milk"}`))
+		response := httptest.NewRecorder()
+
+		todoServer.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, http.StatusOK)
+	})
+}
+
+func TestErrors(t *testing.T) {
+	todoServer := server.NewTodoServer(store.NewMemoryTodoStore(
+		store.Todo{Id: 1, Description: "Buy milk"},
+	))
+
+	tests := []struct {
+		name        string
+		method      string
+		path        string
+		contentType string
+		body        string
+		status      int
+		code        server.ErrorCode
+	}{
+		{"missing todo", http.MethodGet, "/api/todo/7", "", "", http.StatusNotFound, server.CodeNotFound},
+		{"updating a missing todo", http.MethodPut, "/api/todo/7", "", `{"Description": "Buy bread"}`, http.StatusNotFound, server.CodeNotFound},
+		{"deleting a missing todo", http.MethodDelete, "/api/todo/7", "", "", http.StatusNotFound, server.CodeNotFound},
+		{"toggling a missing todo", http.MethodPost, "/api/todo/toggle/7", "", "", http.StatusNotFound, server.CodeNotFound},
+		{"id is not a number", http.MethodGet, "/api/todo/one", "", "", http.StatusBadRequest, server.CodeInvalidParameter},
+		{"bad json", http.MethodPost, "/api/todo", "", `{"Description":`, http.StatusBadRequest, server.CodeMalformedRequest},
+		{"unknown field", http.MethodPost, "/api/todo", "", `{"Title": "Buy milk"}`, http.StatusBadRequest, server.CodeMalformedRequest},
+		{"not json", http.MethodPost, "/api/todo", "text/plain", "Buy milk", http.StatusUnsupportedMediaType, server.CodeUnsupportedMediaType},
+		{"bad cursor", http.MethodGet, "/api/todos?cursor=nope", "", "", http.StatusBadRequest, server.CodeInvalidCursor},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request, _ := http.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			if tt.contentType != "" {
+				request.Header.Set("Content-Type", tt.contentType)
+			}
+			response := httptest.NewRecorder()
+
+			todoServer.ServeHTTP(response, request)
+
+			assertStatus(t, response.Code, tt.status)
+			if ct := response.Header().Get("Content-Type"); ct != "application/problem+json" {
+				t.Errorf("got content type %q want application/problem+json", ct)
+			}
+			var got server.Problem
+			assertJson(t, response.Body, &got)
+			if got.Code != tt.code || got.Status != tt.status || got.Instance != request.URL.Path {
+				t.Errorf("unexpected problem %+v", got)
+			}
+		})
+	}
+}
+
+func TestPatchTodo(t *testing.T) {
+	todoServer := server.NewTodoServer(store.NewMemoryTodoStore(
+		store.Todo{Id: 1, Time: due("2024-01-01T00:00:00Z"), Description: "Buy milk"},
+	))
+
+	patch := func(contentType, body string) *httptest.ResponseRecorder {
+		request, _ := http.NewRequest(http.MethodPatch, "/api/todo/1", strings.NewReader(body))
+		request.Header.Set("Content-Type", contentType)
+		response := httptest.NewRecorder()
+		todoServer.ServeHTTP(response, request)
+		return response
+	}
+
+	t.Run("merge patch returns the updated todo", func(t *testing.T) {
+		response := patch("application/merge-patch+json", `{"Description": "Buy oat milk"}`)
+
+		assertStatus(t, response.Code, http.StatusOK)
+		var got store.Todo
+		assertJson(t, response.Body, &got)
+		if got.Description != "Buy oat milk" || got.Time != due("2024-01-01T00:00:00Z") {
+			t.Errorf("unexpected todo %+v", got)
+		}
+	})
+
+	t.Run("json patch", func(t *testing.T) {
+		response := patch("application/json-patch+json", `[{"op": "replace", "path": "/Completed", "value": true}]`)
+
+		assertStatus(t, response.Code, http.StatusOK)
+		var got store.Todo
+		assertJson(t, response.Body, &got)
+		if !got.Completed || got.Description != "Buy oat milk" {
+			t.Errorf("unexpected todo %+v", got)
+		}
+	})
+
+	failures := []struct {
+		name        string
+		contentType string
+		body        string
+		status      int
+		code        server.ErrorCode
+	}{
+		{"unsupported content type", "text/plain", "done", http.StatusUnsupportedMediaType, server.CodeUnsupportedMediaType},
+		{"not an object", "application/merge-patch+json", `["Description"]`, http.StatusBadRequest, server.CodeInvalidPatch},
+		{"failed test", "application/json-patch+json", `[{"op": "test", "path": "/Completed", "value": false}]`, http.StatusConflict, server.CodeConflict},
+		{"invalid result", "application/merge-patch+json", `{"Description": ""}`, http.StatusUnprocessableEntity, server.CodeValidationFailed},
+	}
+	for _, tt := range failures {
+		t.Run("rejects "+tt.name, func(t *testing.T) {
+			response := patch(tt.contentType, tt.body)
+
+			assertStatus(t, response.Code, tt.status)
+			var got server.Problem
+			assertJson(t, response.Body, &got)
+			if got.Code != tt.code {
+				t.Errorf("got code %q want %q", got.Code, tt.code)
+			}
+		})
+	}
+}
+
+func TestConditionalRequests(t *testing.T) {
+	todoServer := server.NewTodoServer(store.NewMemoryTodoStore(
+		store.Todo{Id: 1, Description: "Buy milk"},
+		store.Todo{Id: 2, Description: "Buy bread"},
+	))
+
+	send := func(method, path, header, value string) *httptest.ResponseRecorder {
+		var body io.Reader
+		if method == http.MethodPut {
+			body = strings.NewReader(`{"Description": "Buy oat milk"}`)
+		}
+		request, _ := http.NewRequest(method, path, body)
+		if header != "" {
+			request.Header.Set(header, value)
+		}
+		response := httptest.NewRecorder()
+		todoServer.ServeHTTP(response, request)
+		return response
+	}
+
+	t.Run("reads are not modified while the etag matches", func(t *testing.T) {
+		for _, path := range []string{"/api/todo/1", "/api/todos"} {
+			response := send(http.MethodGet, path, "", "")
+			etag := response.Header().Get("ETag")
+			if etag == "" {
+				t.Fatalf("expected an etag on %s", path)
+			}
+
+			response = send(http.MethodGet, path, "If-None-Match", etag)
+			assertStatus(t, response.Code, http.StatusNotModified)
+			if response.Body.Len() != 0 {
+				t.Errorf("expected no body on %s, got %q", path, response.Body.String())
+			}
+
+			response = send(http.MethodGet, path, "If-None-Match", `"stale"`)
+			assertStatus(t, response.Code, http.StatusOK)
+		}
+	})
+
+	t.Run("writes need the current revision", func(t *testing.T) {
+		assertStatus(t, send(http.MethodPut, "/api/todo/1", "If-Match", `"1-1"`).Code, http.StatusOK)
+		assertStatus(t, send(http.MethodPost, "/api/todo/toggle/1", "If-Match", `"1-2"`).Code, http.StatusOK)
+
+		for _, method := range []string{http.MethodPut, http.MethodDelete} {
+			response := send(method, "/api/todo/1", "If-Match", `"1-2"`)
+			assertStatus(t, response.Code, http.StatusPreconditionFailed)
+			var got server.Problem
+			assertJson(t, response.Body, &got)
+			if got.Code != server.CodePreconditionFailed {
+				t.Errorf("got code %q want %q", got.Code, server.CodePreconditionFailed)
+			}
+		}
+
+		response := send(http.MethodGet, "/api/todo/1", "", "")
+		if etag := response.Header().Get("ETag"); etag != `"1-3"` {
+			t.Errorf("got etag %s want \"1-3\"", etag)
+		}
+		assertStatus(t, send(http.MethodDelete, "/api/todo/1", "If-Match", `"1-3"`).Code, http.StatusOK)
+	})
+
+	t.Run("rejects etags of another todo", func(t *testing.T) {
+		assertStatus(t, send(http.MethodDelete, "/api/todo/2", "If-Match", `"1-1"`).Code, http.StatusPreconditionFailed)
+		assertStatus(t, send(http.MethodDelete, "/api/todo/2", "If-Match", `W/"2-1"`).Code, http.StatusPreconditionFailed)
+		assertStatus(t, send(http.MethodDelete, "/api/todo/2", "If-Match", "*").Code, http.StatusOK)
+	})
+}
+
+func TestBatch(t *testing.T) {
+	newServer := func() *server.TodoServer {
+		return server.NewTodoServer(store.NewMemoryTodoStore(
+			store.Todo{Id: 1, Description: "Buy milk"},
+			store.Todo{Id: 2, Description: "Buy bread", Completed: true},
+		))
+	}
+	send := func(s *server.TodoServer, method, path, body string) *httptest.ResponseRecorder {
+		request, _ := http.NewRequest(method, path, strings.NewReader(body))
+		response := httptest.NewRecorder()
+		s.ServeHTTP(response, request)
+		return response
+	}
+	type result struct {
+		Status int
+		Todo   *store.Todo
+		Error  *server.Problem
+	}
+
+	t.Run("applies every operation", func(t *testing.T) {
+		s := newServer()
+		response := send(s, http.MethodPost, "/api/todos/batch", `{"operations": [
+			{"op": "create", "todo": {"Description": "Buy eggs"}},
+			{"op": "update", "id": 1, "revision": 1, "todo": {"Description": "Buy oat milk"}},
+			{"op": "toggle", "id": 1},
+			{"op": "delete", "id": 2}
+		]}`)
+
+		assertStatus(t, response.Code, http.StatusOK)
+		var got struct{ Results []result }
+		assertJson(t, response.Body, &got)
+		want := []result{
+			{Status: http.StatusCreated, Todo: &store.Todo{Id: 3, Description: "Buy eggs", Revision: 1, Position: "00000002W"}},
+			{Status: http.StatusOK, Todo: &store.Todo{Id: 1, Description: "Buy oat milk", Revision: 2, Position: "00000001V"}},
+			{Status: http.StatusOK, Todo: &store.Todo{Id: 1, Description: "Buy oat milk", Completed: true, Revision: 3, Position: "00000001V"}},
+			{Status: http.StatusNoContent},
+		}
+		if !reflect.DeepEqual(got.Results, want) {
+			t.Errorf("got %+v want %+v", got.Results, want)
+		}
+	})
+
+	t.Run("fails the whole batch on the first error", func(t *testing.T) {
+		s := newServer()
+		response := send(s, http.MethodPost, "/api/todos/batch", `{"operations": [
+			{"op": "toggle", "id": 1},
+			{"op": "delete", "id": 7}
+		]}`)
+
+		assertStatus(t, response.Code, http.StatusNotFound)
+		var got server.Problem
+		assertJson(t, response.Body, &got)
+		if got.Code != server.CodeNotFound || got.Operation == nil || *got.Operation != 1 {
+			t.Errorf("unexpected problem %+v", got)
+		}
+
+		response = send(s, http.MethodGet, "/api/todo/1", "")
+		var todo store.Todo
+		assertJson(t, response.Body, &todo)
+		if todo.Completed {
+			t.Errorf("expected the toggle to be rolled back, got %+v", todo)
+		}
+	})
+
+	t.Run("reports each failure when continuing on error", func(t *testing.T) {
+		s := newServer()
+		response := send(s, http.MethodPost, "/api/todos/batch", `{"continueOnError": true, "operations": [
+			{"op": "create", "todo": {"Description": ""}},
+			{"op": "toggle", "id": 1, "revision": 4},
+			{"op": "toggle", "id": 1}
+		]}`)
+
+		assertStatus(t, response.Code, http.StatusOK)
+		var got struct{ Results []result }
+		assertJson(t, response.Body, &got)
+		if len(got.Results) != 3 {
+			t.Fatalf("got %d results want 3", len(got.Results))
+		}
+		if r := got.Results[0]; r.Status != http.StatusUnprocessableEntity || r.Error == nil || r.Error.Code != server.CodeValidationFailed {
+			t.Errorf("unexpected result %+v", r)
+		}
+		if r := got.Results[1]; r.Status != http.StatusPreconditionFailed || r.Error == nil || r.Error.Code != server.CodePreconditionFailed {
+			t.Errorf("unexpected result %+v", r)
+		}
+		if r := got.Results[2]; r.Status != http.StatusOK || r.Todo == nil || !r.Todo.Completed {
+			t.Errorf("unexpected result %+v", r)
+		}
+	})
+
+	t.Run("rejects malformed operations", func(t *testing.T) {
+		response := send(newServer(), http.MethodPost, "/api/todos/batch", `{"operations": [{"op": "archive", "id": 1}]}`)
+
+		assertStatus(t, response.Code, http.StatusBadRequest)
+		var got server.Problem
+		assertJson(t, response.Body, &got)
+		if got.Code != server.CodeMalformedRequest || got.Operation == nil || *got.Operation != 0 {
+			t.Errorf("unexpected problem %+v", got)
+		}
+	})
+
+	t.Run("completes all and clears completed", func(t *testing.T) {
+		s := newServer()
+
+		response := send(s, http.MethodPost, "/api/todos/complete-all", "")
+		assertStatus(t, response.Code, http.StatusOK)
+		var updated map[string]int
+		assertJson(t, response.Body, &updated)
+		if updated["updated"] != 1 {
+			t.Errorf("got %v want 1 updated", updated)
+		}
+
+		response = send(s, http.MethodDelete, "/api/todos/completed", "")
+		assertStatus(t, response.Code, http.StatusOK)
+		var deleted map[string]int
+		assertJson(t, response.Body, &deleted)
+		if deleted["deleted"] != 2 {
+			t.Errorf("got %v want 2 deleted", deleted)
+		}
+	})
+}
+
+func TestTrash(t *testing.T) {
+	todoServer := server.NewTodoServer(store.NewMemoryTodoStore(
+		store.Todo{Id: 1, Description: "Buy milk"},
+	))
+
+	send := func(method, path string, htmx bool) *httptest.ResponseRecorder {
+		request, _ := http.NewRequest(method, path, nil)
+		if htmx {
+			request.Header.Set("HX-Request", "true")
+		}
+		response := httptest.NewRecorder()
+		todoServer.ServeHTTP(response, request)
+		return response
+	}
+
+	t.Run("htmx deletes get an undo partial", func(t *testing.T) {
+		response := send(http.MethodDelete, "/api/todo/1", true)
+
+		assertStatus(t, response.Code, http.StatusOK)
+		if body := response.Body.String(); !strings.Contains(body, `hx-post="/api/todo/1/restore"`) {
+			t.Errorf("expected an undo button, got %q", body)
+		}
+		assertStatus(t, send(http.MethodGet, "/api/todo/1", false).Code, http.StatusNotFound)
+	})
+
+	t.Run("lists the trash", func(t *testing.T) {
+		response := send(http.MethodGet, "/api/trash", false)
+
+		assertStatus(t, response.Code, http.StatusOK)
+		var got []store.TrashedTodo
+		assertJson(t, response.Body, &got)
+		if len(got) != 1 || got[0].Id != 1 || got[0].DeletedAt.IsZero() {
+			t.Errorf("unexpected trash %+v", got)
+		}
+	})
+
+	t.Run("restores into the list", func(t *testing.T) {
+		response := send(http.MethodPost, "/api/todo/1/restore", true)
+
+		assertStatus(t, response.Code, http.StatusOK)
+		if body := response.Body.String(); !strings.Contains(body, `<li id="todo-1">`) || !strings.Contains(body, "Buy milk") {
+			t.Errorf("expected the restored todo, got %q", body)
+		}
+		if etag := response.Header().Get("ETag"); etag != `"1-3"` {
+			t.Errorf("got etag %s want \"1-3\"", etag)
+		}
+		assertStatus(t, send(http.MethodGet, "/api/todo/1", false).Code, http.StatusOK)
+		assertStatus(t, send(http.MethodPost, "/api/todo/1/restore", false).Code, http.StatusNotFound)
+	})
+
+	t.Run("rejects unknown actions", func(t *testing.T) {
+		assertStatus(t, send(http.MethodPost, "/api/todo/1/archive", false).Code, http.StatusNotFound)
+	})
+}
+
+func TestPurgeTrash(t *testing.T) {
+	s := store.NewMemoryTodoStore(store.Todo{Id: 1, Description: "Buy milk"})
+	todoServer := server.NewTodoServer(s, server.WithTrashRetention(time.Nanosecond))
+	request, _ := http.NewRequest(http.MethodDelete, "/api/todo/1", nil)
+	todoServer.ServeHTTP(httptest.NewRecorder(), request)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		todoServer.PurgeTrash(ctx, time.Millisecond)
+		close(stopped)
+	}()
+
+	deadline := time.Now().Add(time.Second)
+	for trash, _ := s.Trash(context.Background()); len(trash) != 0; trash, _ = s.Trash(context.Background()) {
+		if time.Now().After(deadline) {
+			t.Fatalf("want the trash purged, got %+v", trash)
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	cancel()
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Error("want PurgeTrash to return once the context is done")
+	}
+
+	t.Run("is off without a retention period", func(t *testing.T) {
+		done := make(chan struct{})
+		go func() {
+			server.NewTodoServer(store.NewMemoryTodoStore()).PurgeTrash(context.Background(), time.Millisecond)
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Error("want PurgeTrash to return straight away")
+		}
+	})
+}
+
+func TestHistory(t *testing.T) {
+	todoServer := server.NewTodoServer(store.NewMemoryTodoStore(
+		store.Todo{Id: 1, Description: "Buy milk"},
+	))
+
+	send := func(method, path, actor string) *httptest.ResponseRecorder {
+		request, _ := http.NewRequest(method, path, nil)
+		if actor != "" {
+			request.Header.Set("X-Actor", actor)
+		}
+		response := httptest.NewRecorder()
+		todoServer.ServeHTTP(response, request)
+		return response
+	}
+
+	send(http.MethodPost, "/api/todo/toggle/1", "bob")
+	send(http.MethodPost, "/api/todo/toggle/1", "")
+
+	t.Run("lists who changed a todo", func(t *testing.T) {
+		response := send(http.MethodGet, "/api/todo/1/history", "")
+
+		assertStatus(t, response.Code, http.StatusOK)
+		var got []store.Event
+		assertJson(t, response.Body, &got)
+		if len(got) != 2 {
+			t.Fatalf("got %+v want 2 events", got)
+		}
+		if got[0].Op != store.EventToggle || got[0].Actor != "bob" || got[0].Before.Completed || !got[0].After.Completed {
+			t.Errorf("unexpected event %+v", got[0])
+		}
+		if got[1].Actor != server.AnonymousActor {
+			t.Errorf("got actor %q want %q", got[1].Actor, server.AnonymousActor)
+		}
+
+		assertStatus(t, send(http.MethodGet, "/api/todo/2/history", "").Code, http.StatusNotFound)
+	})
+
+	t.Run("pages through the feed", func(t *testing.T) {
+		response := send(http.MethodGet, "/api/events?limit=1", "")
+
+		assertStatus(t, response.Code, http.StatusOK)
+		var got []store.Event
+		assertJson(t, response.Body, &got)
+		if len(got) != 1 || got[0].Actor != "bob" {
+			t.Fatalf("unexpected events %+v", got)
+		}
+		link := response.Header().Get("Link")
+		if link != fmt.Sprintf(`</api/events?limit=1&since=%d>; rel="next"`, got[0].Id) {
+			t.Errorf("unexpected link %q", link)
+		}
+
+		response = send(http.MethodGet, fmt.Sprintf("/api/events?since=%d", got[0].Id), "")
+		assertJson(t, response.Body, &got)
+		if len(got) != 1 || got[0].Actor != server.AnonymousActor {
+			t.Errorf("unexpected events %+v", got)
+		}
+		if link := response.Header().Get("Link"); link != "" {
+			t.Errorf("expected no link on the last page, got %q", link)
+		}
+
+		response = send(http.MethodGet, "/api/events?since=2999-01-01T00:00:00Z", "")
+		assertJson(t, response.Body, &got)
+		if len(got) != 0 {
+			t.Errorf("expected no events in the future, got %+v", got)
+		}
+
+		assertStatus(t, send(http.MethodGet, "/api/events?since=yesterday", "").Code, http.StatusBadRequest)
+	})
+}
+
 func NewPostTodoRequest(todo store.Todo) *http.Request {
 	buff := bytes.Buffer{}
 	json.NewEncoder(&buff).Encode(todo)
@@ -256,8 +889,8 @@ func assertJson[T any](t testing.TB, j *bytes.Buffer, got T) {
 func BenchmarkGet(b *testing.B) {
 	stubStore := StubStore{
 		map[int]store.Todo{
-			1: {Id: 1, Time: "2024-01-01T00:00:00.000Z", Description: "Buy milk", Completed: false},
-			2: {Id: 2, Time: "2024-01-01T00:00:00.000Z", Description: "Buy bread", Completed: true},
+			1: {Id: 1, Time: due("2024-01-01T00:00:00.000Z"), Description: "Buy milk", Completed: false},
+			2: {Id: 2, Time: due("2024-01-01T00:00:00.000Z"), Description: "Buy bread", Completed: true},
 		},
 	}
 
@@ -271,3 +904,11 @@ func BenchmarkGet(b *testing.B) {
 		todoServer.ServeHTTP(response, request)
 	}
 }
+
+func due(s string) store.Timestamp {
+	ts, err := store.ParseTimestamp(s)
+	if err != nil {
+		panic(err)
+	}
+	return ts
+}
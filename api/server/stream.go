@@ -0,0 +1,178 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mcadenas-bjss/go-do-it/store"
+	"github.com/pkg/errors"
+)
+
+// streamBuffer is how many events a stream may fall behind by before it is
+// closed. The client reconnects with Last-Event-ID and catches up from the
+// audit log.
+const streamBuffer = 64
+
+// heartbeatInterval is how often an idle stream sends a comment so proxies
+// keep the connection open.
+const heartbeatInterval = 30 * time.Second
+
+// handleEventStream serves every change as Server-Sent Events, each with the
+// audit log id so a reconnecting client resumes after the last event it saw.
+// With format=html the data is the list item HTMX swaps in instead of JSON.
+func (t *TodoServer) handleEventStream(w http.ResponseWriter, r *http.Request) {
+	log.Printf("%s %s", r.Method, r.URL.Path)
+
+	var html bool
+	switch r.URL.Query().Get("format") {
+	case "", "json":
+	case "html":
+		html = true
+	default:
+		writeError(w, r, badParameter("format must be json or html"))
+		return
+	}
+
+	var lastId int
+	if v := r.Header.Get("Last-Event-ID"); v != "" {
+		id, err := strconv.Atoi(v)
+		if err != nil || id < 0 {
+			writeError(w, r, badParameter("Last-Event-ID must be an event id"))
+			return
+		}
+		lastId = id
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, r, errors.New("streaming is not supported"))
+		return
+	}
+
+	// Subscribe before catching up so no event falls between the two.
+	events, unsubscribe := t.hub.Subscribe(streamBuffer)
+	defer unsubscribe()
+
+	w.Header().Set("content-type", eventStreamContentType)
+	w.Header().Set("cache-control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	loc := requestLocation(r, t.location)
+	send := func(e store.Event) error {
+		if e.Id <= lastId || !visibleTo(r.Context(), e) {
+			return nil
+		}
+		lastId = e.Id
+		if html {
+			return t.writeHTMLEvent(w, e, todoBase(r), loc)
+		}
+		return writeJSONEvent(w, e)
+	}
+
+	if r.Header.Get("Last-Event-ID") != "" {
+		if err := t.replayEvents(r.Context(), lastId, send); err != nil {
+			log.Printf("catching up event stream failed: %s", err)
+			return
+		}
+		flusher.Flush()
+	}
+
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case e, ok := <-events:
+			if !ok {
+				return
+			}
+			if err := send(e); err != nil {
+				log.Printf("writing event %d failed: %s", e.Id, err)
+				return
+			}
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": heartbeat\n\n")
+		}
+		flusher.Flush()
+	}
+}
+
+// replayEvents sends the events logged after the given id from the audit log,
+// for clients resuming a stream.
+func (t *TodoServer) replayEvents(ctx context.Context, after int, send func(store.Event) error) error {
+	for {
+		cmd := store.NewEventsCommand(ctx, store.EventQuery{AfterId: after, Limit: maxPageSize})
+		t.cmds <- cmd
+
+		missed, err := cmd.Wait()
+		if err != nil {
+			return err
+		}
+		for _, e := range missed {
+			if err := send(e); err != nil {
+				return errors.Wrapf(err, "sending event %d failed", e.Id)
+			}
+			after = e.Id
+		}
+		if len(missed) < maxPageSize {
+			return nil
+		}
+	}
+}
+
+// writeJSONEvent writes an event named after its op with the event as data.
+func writeJSONEvent(w http.ResponseWriter, e store.Event) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	return writeSSE(w, e.Id, string(e.Op), string(data))
+}
+
+// writeHTMLEvent writes the fragment the HTMX SSE extension swaps in. New
+// todos are named todo-created, to be appended to the list. Every other
+// change is named todo-{id} and replaces that todo's list item: with the todo
+// itself, or with the Undo item once it is deleted. Purges have nothing on
+// the page to replace and are skipped.
+func (t *TodoServer) writeHTMLEvent(w http.ResponseWriter, e store.Event, base string, loc *time.Location) error {
+	name := fmt.Sprintf("todo-%d", e.TodoId)
+	var buf bytes.Buffer
+	var err error
+	switch e.Op {
+	case store.EventPurge:
+		return nil
+	case store.EventDelete:
+		err = t.renderer.RenderUndo(&buf, e.TodoId, base)
+	case store.EventCreate:
+		name = "todo-created"
+		fallthrough
+	default:
+		err = t.renderer.RenderTodo(&buf, *e.After, base, loc)
+	}
+	if err != nil {
+		return errors.Wrap(err, "failed to render todo")
+	}
+	return writeSSE(w, e.Id, name, buf.String())
+}
+
+// writeSSE writes one event, with a data line per line of data.
+func writeSSE(w http.ResponseWriter, id int, name, data string) error {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "id: %d\nevent: %s\n", id, name)
+	for _, line := range strings.Split(data, "\n") {
+		fmt.Fprintf(&buf, "data: %s\n", line)
+	}
+	buf.WriteString("\n")
+	_, err := buf.WriteTo(w)
+	return err
+}
@@ -0,0 +1,138 @@
+package server_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mcadenas-bjss/go-do-it/server"
+	"github.com/mcadenas-bjss/go-do-it/store"
+)
+
+type sseEvent struct {
+	id, name, data string
+}
+
+func TestEventStream(t *testing.T) {
+	todoServer := server.NewTodoServer(store.NewMemoryTodoStore(
+		store.Todo{Id: 1, Description: "Buy milk"},
+	))
+	ts := httptest.NewServer(todoServer)
+	defer ts.Close()
+
+	toggle := func() {
+		t.Helper()
+		response, err := http.Post(ts.URL+"/api/todo/toggle/1", "", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		response.Body.Close()
+		assertStatus(t, response.StatusCode, http.StatusOK)
+	}
+
+	toggle()
+
+	// Every stream passes the id of the last event the test has seen, as the
+	// previous write may still be on its way to the hub.
+	t.Run("streams changes as JSON", func(t *testing.T) {
+		events := openStream(t, ts.URL+"/api/events/stream", "1")
+		toggle()
+
+		got := events()
+		if got.id != "2" || got.name != "toggle" {
+			t.Errorf("unexpected event %+v", got)
+		}
+		var e store.Event
+		if err := json.Unmarshal([]byte(got.data), &e); err != nil {
+			t.Fatal(err)
+		}
+		if e.Id != 2 || e.TodoId != 1 || e.Before.Completed == e.After.Completed {
+			t.Errorf("unexpected event data %+v", e)
+		}
+	})
+
+	t.Run("resumes after Last-Event-ID", func(t *testing.T) {
+		events := openStream(t, ts.URL+"/api/events/stream", "0")
+
+		for _, id := range []string{"1", "2"} {
+			if got := events(); got.id != id {
+				t.Errorf("got event %+v want %s", got, id)
+			}
+		}
+		toggle()
+		if got := events(); got.id != "3" {
+			t.Errorf("got event %+v want the new one", got)
+		}
+	})
+
+	t.Run("streams list items for HTMX", func(t *testing.T) {
+		events := openStream(t, ts.URL+"/api/events/stream?format=html", "3")
+		toggle()
+
+		got := events()
+		if got.name != "todo-1" || !strings.HasPrefix(got.data, `<li id="todo-1">`) {
+			t.Errorf("unexpected event %+v", got)
+		}
+	})
+
+	t.Run("rejects unknown formats", func(t *testing.T) {
+		response, err := http.Get(ts.URL + "/api/events/stream?format=xml")
+		if err != nil {
+			t.Fatal(err)
+		}
+		response.Body.Close()
+		assertStatus(t, response.StatusCode, http.StatusBadRequest)
+	})
+}
+
+// openStream connects to an event stream and returns a function reading its
+// next event. The connection is closed when the test ends.
+func openStream(t *testing.T, url, lastEventId string) func() sseEvent {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	t.Cleanup(cancel)
+
+	request, _ := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if lastEventId != "" {
+		request.Header.Set("Last-Event-ID", lastEventId)
+	}
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { response.Body.Close() })
+	assertStatus(t, response.StatusCode, http.StatusOK)
+	if ct := response.Header.Get("content-type"); ct != "text/event-stream" {
+		t.Fatalf("got content-type %q", ct)
+	}
+
+	reader := bufio.NewReader(response.Body)
+	return func() sseEvent {
+		t.Helper()
+		var e sseEvent
+		var data []string
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				t.Fatalf("reading stream failed: %v", err)
+			}
+			line = strings.TrimSuffix(line, "\n")
+			switch {
+			case line == "":
+				e.data = strings.Join(data, "\n")
+				return e
+			case strings.HasPrefix(line, "id: "):
+				e.id = strings.TrimPrefix(line, "id: ")
+			case strings.HasPrefix(line, "event: "):
+				e.name = strings.TrimPrefix(line, "event: ")
+			case strings.HasPrefix(line, "data: "):
+				data = append(data, strings.TrimPrefix(line, "data: "))
+			}
+		}
+	}
+}
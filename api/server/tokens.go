@@ -0,0 +1,156 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/mcadenas-bjss/go-do-it/store"
+)
+
+const (
+	TOKENS_PATH   = "/api/tokens"
+	TOKEN_ID_PATH = "DELETE /api/tokens/{id}"
+)
+
+// apiTokenPrefix marks API tokens so they are easy to spot, for example by
+// secret scanners.
+const apiTokenPrefix = "gdi_"
+
+// defaultScopes are given to tokens created without naming any, which is
+// enough for the desktop app and the command line.
+var defaultScopes = []store.Scope{store.ScopeTodosRead, store.ScopeTodosWrite}
+
+// TokenRequest is the body of a request creating an API token. Scopes
+// default to todos:read and todos:write, and ExpiresAt to never.
+type TokenRequest struct {
+	Name      string
+	Scopes    []store.Scope
+	ExpiresAt store.Timestamp
+}
+
+// NewToken is the response to creating an API token, which is the only time
+// its secret Token is shown.
+type NewToken struct {
+	store.APIToken
+	Token string `json:",omitempty"`
+}
+
+type tokenKey struct{}
+
+// requireScope only lets requests made with an API token through when the
+// token has the scope. Requests signed in with a session, or to a server
+// without auth, may do anything.
+func requireScope(scope store.Scope, next http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if token, ok := r.Context().Value(tokenKey{}).(store.APIToken); ok && !grants(token.Scopes, scope) {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="go-do-it", error="insufficient_scope", scope="%s"`, scope))
+			msg := fmt.Sprintf("the API token needs the %s scope", scope)
+			writeError(w, r, &malformedRequest{status: http.StatusForbidden, code: CodeInsufficientScope, msg: msg})
+			return
+		}
+		next(w, r)
+	})
+}
+
+// grants reports whether a token with the given scopes may use a route
+// requiring scope. Writing todos implies reading them, and admin implies
+// everything.
+func grants(scopes []store.Scope, scope store.Scope) bool {
+	return slices.Contains(scopes, scope) || slices.Contains(scopes, store.ScopeAdmin) ||
+		scope == store.ScopeTodosRead && slices.Contains(scopes, store.ScopeTodosWrite)
+}
+
+func (t *TodoServer) handleTokens(router *http.ServeMux) {
+	router.Handle(fmt.Sprintf("GET %s", TOKENS_PATH), requireScope(store.ScopeAdmin, t.handleGetTokens))
+	router.Handle(fmt.Sprintf("POST %s", TOKENS_PATH), requireScope(store.ScopeAdmin, t.handlePostToken))
+	router.Handle(TOKEN_ID_PATH, requireScope(store.ScopeAdmin, t.handleDeleteToken))
+}
+
+func (t *TodoServer) handleGetTokens(w http.ResponseWriter, r *http.Request) {
+	log.Printf("%s %s", r.Method, r.URL.Path)
+
+	user, _ := requestUser(r)
+	tokens, err := t.users.Tokens(r.Context(), user.Id)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.Header().Set("content-type", jsonContentType)
+	json.NewEncoder(w).Encode(tokens)
+}
+
+func (t *TodoServer) handlePostToken(w http.ResponseWriter, r *http.Request) {
+	log.Printf("%s %s", r.Method, r.URL.Path)
+
+	var input TokenRequest
+	if err := decodeJSONBody(w, r, &input); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if err := input.check(); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	secret, err := newToken()
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	secret = apiTokenPrefix + secret
+	user, _ := requestUser(r)
+	token, err := t.users.CreateToken(r.Context(), user.Id, store.APIToken{Name: input.Name, Scopes: input.Scopes, ExpiresAt: input.ExpiresAt}, hashToken(secret))
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.Header().Set("content-type", jsonContentType)
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(NewToken{APIToken: token, Token: secret})
+}
+
+// check validates a new token, filling in the default scopes.
+func (input *TokenRequest) check() error {
+	input.Name = strings.TrimSpace(input.Name)
+	if len(input.Scopes) == 0 {
+		input.Scopes = defaultScopes
+	}
+	input.Scopes = slices.Clone(input.Scopes)
+	slices.Sort(input.Scopes)
+	input.Scopes = slices.Compact(input.Scopes)
+
+	var msg string
+	unknown := slices.IndexFunc(input.Scopes, func(s store.Scope) bool { return !slices.Contains(store.Scopes, s) })
+	switch {
+	case input.Name == "":
+		msg = "Name must not be empty"
+	case unknown >= 0:
+		msg = fmt.Sprintf("Scopes has the unknown scope %q, want some of %v", input.Scopes[unknown], store.Scopes)
+	case !input.ExpiresAt.IsZero() && !input.ExpiresAt.After(time.Now()):
+		msg = "ExpiresAt must be in the future"
+	default:
+		return nil
+	}
+	return &malformedRequest{status: http.StatusUnprocessableEntity, code: CodeValidationFailed, msg: msg}
+}
+
+func (t *TodoServer) handleDeleteToken(w http.ResponseWriter, r *http.Request) {
+	log.Printf("%s %s", r.Method, r.URL.Path)
+
+	id, err := pathId(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	user, _ := requestUser(r)
+	if err := t.users.DeleteToken(r.Context(), user.Id, id); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
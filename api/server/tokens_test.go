@@ -0,0 +1,92 @@
+package server_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mcadenas-bjss/go-do-it/server"
+	"github.com/mcadenas-bjss/go-do-it/store"
+)
+
+func TestTokenScopes(t *testing.T) {
+	s := store.NewMemoryTodoStore()
+	ts := httptest.NewServer(server.NewTodoServer(s, server.WithAuth(s)))
+	defer ts.Close()
+
+	alice := newAuthClient(t, ts.URL)
+	alice.do(http.MethodPost, "/api/auth/register", server.Credentials{Username: "alice", Password: "correct horse"}, http.StatusCreated)
+	alice.do(http.MethodPost, "/api/todo", store.Todo{Description: "Buy milk"}, http.StatusCreated)
+
+	// withToken returns a client using a new token of alice's.
+	withToken := func(request server.TokenRequest) (*authClient, server.NewToken) {
+		var token server.NewToken
+		alice.decode(alice.do(http.MethodPost, "/api/tokens", request, http.StatusCreated), &token)
+		c := newAuthClient(t, ts.URL)
+		c.token = token.Token
+		return c, token
+	}
+
+	t.Run("defaults to reading and writing todos", func(t *testing.T) {
+		script, token := withToken(server.TokenRequest{Name: "laptop"})
+		if len(token.Scopes) != 2 || token.Scopes[0] != store.ScopeTodosRead || token.Scopes[1] != store.ScopeTodosWrite || !token.ExpiresAt.IsZero() {
+			t.Errorf("unexpected token %+v", token)
+		}
+		script.do(http.MethodGet, "/api/todos", nil, http.StatusOK)
+		script.do(http.MethodPost, "/api/todo/toggle/1", nil, http.StatusOK)
+
+		response := script.do(http.MethodGet, "/api/tokens", nil, http.StatusForbidden)
+		var p server.Problem
+		script.decode(response, &p)
+		if p.Code != server.CodeInsufficientScope || !strings.Contains(response.Header.Get("WWW-Authenticate"), `scope="admin"`) {
+			t.Errorf("unexpected problem %+v", p)
+		}
+	})
+
+	t.Run("limits read only tokens", func(t *testing.T) {
+		ci, _ := withToken(server.TokenRequest{Name: "ci", Scopes: []store.Scope{store.ScopeTodosRead}})
+		ci.do(http.MethodGet, "/api/todos", nil, http.StatusOK)
+		ci.do(http.MethodGet, "/api/todo/1/history", nil, http.StatusOK)
+		if snapshot := ci.sync("/api/sync"); snapshot.Type != server.SyncSnapshot || len(snapshot.Todos) != 1 {
+			t.Errorf("unexpected snapshot %+v", snapshot)
+		}
+		ci.do(http.MethodPost, "/api/todo", store.Todo{Description: "Buy bread"}, http.StatusForbidden)
+		ci.do(http.MethodDelete, "/api/todo/1", nil, http.StatusForbidden)
+		ci.do(http.MethodPost, "/api/todo/toggle/1", nil, http.StatusForbidden)
+		ci.do(http.MethodPost, "/api/tokens", server.TokenRequest{Name: "escalated", Scopes: []store.Scope{store.ScopeAdmin}}, http.StatusForbidden)
+	})
+
+	t.Run("lets admin tokens manage tokens", func(t *testing.T) {
+		admin, _ := withToken(server.TokenRequest{Name: "admin", Scopes: []store.Scope{store.ScopeAdmin}})
+		admin.do(http.MethodGet, "/api/todos", nil, http.StatusOK)
+		var tokens []store.APIToken
+		admin.decode(admin.do(http.MethodGet, "/api/tokens", nil, http.StatusOK), &tokens)
+		if len(tokens) != 3 || tokens[2].Name != "admin" {
+			t.Fatalf("unexpected tokens %+v", tokens)
+		}
+		for _, token := range tokens {
+			if token.LastUsedAt.IsZero() {
+				t.Errorf("want the use of %+v recorded", token)
+			}
+		}
+		admin.do(http.MethodDelete, "/api/tokens/1", nil, http.StatusNoContent)
+	})
+
+	t.Run("rejects invalid tokens", func(t *testing.T) {
+		alice.do(http.MethodPost, "/api/tokens", server.TokenRequest{Name: "bad", Scopes: []store.Scope{"todos:delete"}}, http.StatusUnprocessableEntity)
+		alice.do(http.MethodPost, "/api/tokens", server.TokenRequest{Name: "bad", ExpiresAt: store.NewTimestamp(time.Now().Add(-time.Hour))}, http.StatusUnprocessableEntity)
+		alice.do(http.MethodPost, "/api/tokens", server.TokenRequest{Name: " "}, http.StatusUnprocessableEntity)
+	})
+
+	t.Run("expires tokens", func(t *testing.T) {
+		expiring, token := withToken(server.TokenRequest{Name: "soon", ExpiresAt: store.NewTimestamp(time.Now().Add(2 * time.Second))})
+		if token.ExpiresAt.IsZero() {
+			t.Errorf("unexpected token %+v", token)
+		}
+		expiring.do(http.MethodGet, "/api/todos", nil, http.StatusOK)
+		time.Sleep(time.Until(token.ExpiresAt.Time))
+		expiring.do(http.MethodGet, "/api/todos", nil, http.StatusUnauthorized)
+	})
+}
@@ -0,0 +1,126 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/mcadenas-bjss/go-do-it/store"
+	"github.com/pkg/errors"
+)
+
+// DefaultTrashRetention is the default of the -trashRetention flag.
+const DefaultTrashRetention = 30 * 24 * time.Hour
+
+// PurgeInterval is how often the server checks the trash for expired todos.
+const PurgeInterval = time.Hour
+
+// WithTrashRetention sets how long deleted todos stay in the trash before
+// PurgeTrash deletes them. Without it, or with zero or less, they are kept
+// forever.
+func WithTrashRetention(d time.Duration) Option {
+	return func(t *TodoServer) {
+		t.trashRetention = d
+	}
+}
+
+// PurgeTrash permanently deletes todos that have been in the trash longer
+// than the retention period, once on start and then every interval, until
+// ctx is done. It returns straight away when there is no retention period.
+func (t *TodoServer) PurgeTrash(ctx context.Context, interval time.Duration) {
+	if t.trashRetention <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		cmd := store.NewPurgeCommand(ctx, time.Now().Add(-t.trashRetention))
+		t.cmds <- cmd
+		if n, err := cmd.Wait(); err != nil && ctx.Err() == nil {
+			log.Printf("purging the trash failed: %s", err)
+		} else if n > 0 {
+			log.Printf("purged %d todos from the trash", n)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (t *TodoServer) handleGetTrash(w http.ResponseWriter, r *http.Request) {
+	log.Printf("%s %s", r.Method, r.URL.Path)
+
+	cmd := store.NewTrashCommand(r.Context())
+	t.cmds <- cmd
+
+	trash, err := cmd.Wait()
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.Header().Set("content-type", jsonContentType)
+	json.NewEncoder(w).Encode(trash)
+}
+
+// handleTodoAction serves POST /api/todo/{id}/{action}. The action is a
+// wildcard because a literal /api/todo/{id}/restore would conflict with
+// /api/todo/toggle/{id} in the router.
+func (t *TodoServer) handleTodoAction(w http.ResponseWriter, r *http.Request) {
+	switch r.PathValue("action") {
+	case "restore":
+		t.handleRestoreTodo(w, r)
+	case "move":
+		t.handleMoveTodo(w, r)
+	default:
+		log.Printf("%s %s", r.Method, r.URL.Path)
+		writeError(w, r, &malformedRequest{status: http.StatusNotFound, code: CodeNotFound, msg: "unknown todo action " + r.PathValue("action")})
+	}
+}
+
+// handleRestoreTodo moves a todo out of the trash and returns it, or its list
+// item when the Undo partial asked for it.
+func (t *TodoServer) handleRestoreTodo(w http.ResponseWriter, r *http.Request) {
+	log.Printf("%s %s", r.Method, r.URL.Path)
+
+	id, err := pathId(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	revision, err := ifMatchRevision(r, id)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	cmd := store.NewRestoreCommand(r.Context(), store.Ref{Id: id, Revision: revision})
+	t.cmds <- cmd
+
+	todo, err := cmd.Wait()
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.Header().Set("ETag", todoETag(todo))
+
+	if wantsHTML(r) {
+		var buf bytes.Buffer
+		if err := t.renderer.RenderTodo(&buf, todo, todoBase(r), requestLocation(r, t.location)); err != nil {
+			writeError(w, r, errors.Wrap(err, "failed to render todo"))
+			return
+		}
+		w.Header().Set("content-type", htmlContentType)
+		buf.WriteTo(w)
+		return
+	}
+	w.Header().Set("content-type", jsonContentType)
+	json.NewEncoder(w).Encode(todo)
+}
@@ -1,16 +1,28 @@
 package server
 
 import (
+	"crypto/sha256"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
+	"strconv"
 	"strings"
+	"time"
+
+	"github.com/mcadenas-bjss/go-do-it/store"
 )
 
+// maxPageSize caps the limit query parameter on list endpoints.
+const maxPageSize = 1000
+
+// malformedRequest is a client error detected before the request reaches the
+// store.
 type malformedRequest struct {
 	status int
+	code   ErrorCode
 	msg    string
 }
 
@@ -18,16 +30,41 @@ func (mr *malformedRequest) Error() string {
 	return mr.msg
 }
 
+func badParameter(msg string) *malformedRequest {
+	return &malformedRequest{status: http.StatusBadRequest, code: CodeInvalidParameter, msg: msg}
+}
+
+// pathId reads the {id} path segment.
+func pathId(r *http.Request) (int, error) {
+	return pathNumber(r, "id")
+}
+
+// pathNumber reads a numeric path segment, such as {listId}.
+func pathNumber(r *http.Request, name string) (int, error) {
+	n, err := strconv.Atoi(r.PathValue(name))
+	if err != nil {
+		return 0, badParameter(name + " must be a number")
+	}
+	return n, nil
+}
+
 func decodeJSONBody(w http.ResponseWriter, r *http.Request, dst interface{}) error {
-	ct := r.Header.Get("Content-Type")
-	if ct != "" {
-		mediaType := strings.ToLower(strings.TrimSpace(strings.Split(ct, ";")[0]))
-		if mediaType != "application/json" {
-			msg := "Content-Type header is not application/json"
-			return &malformedRequest{status: http.StatusUnsupportedMediaType, msg: msg}
-		}
+	if ct := mediaType(r); ct != "" && ct != jsonContentType {
+		msg := "Content-Type header is not application/json"
+		return &malformedRequest{status: http.StatusUnsupportedMediaType, code: CodeUnsupportedMediaType, msg: msg}
 	}
+	return decodeBody(w, r, dst)
+}
 
+// mediaType is the lower cased Content-Type of the request without
+// parameters.
+func mediaType(r *http.Request) string {
+	return strings.ToLower(strings.TrimSpace(strings.Split(r.Header.Get("Content-Type"), ";")[0]))
+}
+
+// decodeBody decodes a single JSON value from the request body, whatever its
+// Content-Type.
+func decodeBody(w http.ResponseWriter, r *http.Request, dst interface{}) error {
 	r.Body = http.MaxBytesReader(w, r.Body, 1048576)
 
 	dec := json.NewDecoder(r.Body)
@@ -37,32 +74,37 @@ func decodeJSONBody(w http.ResponseWriter, r *http.Request, dst interface{}) err
 	if err != nil {
 		var syntaxError *json.SyntaxError
 		var unmarshalTypeError *json.UnmarshalTypeError
+		var parseError *time.ParseError
 
 		switch {
 		case errors.As(err, &syntaxError):
 			msg := fmt.Sprintf("Request body contains badly-formed JSON (at position %d)", syntaxError.Offset)
-			return &malformedRequest{status: http.StatusBadRequest, msg: msg}
+			return &malformedRequest{status: http.StatusBadRequest, code: CodeMalformedRequest, msg: msg}
 
 		case errors.Is(err, io.ErrUnexpectedEOF):
 			msg := fmt.Sprintf("Request body contains badly-formed JSON")
-			return &malformedRequest{status: http.StatusBadRequest, msg: msg}
+			return &malformedRequest{status: http.StatusBadRequest, code: CodeMalformedRequest, msg: msg}
+
+		case errors.As(err, &parseError):
+			msg := fmt.Sprintf("Request body contains an invalid time %q, expected RFC 3339 such as 2006-01-02T15:04:05Z", parseError.Value)
+			return &malformedRequest{status: http.StatusBadRequest, code: CodeMalformedRequest, msg: msg}
 
 		case errors.As(err, &unmarshalTypeError):
 			msg := fmt.Sprintf("Request body contains an invalid value for the %q field (at position %d)", unmarshalTypeError.Field, unmarshalTypeError.Offset)
-			return &malformedRequest{status: http.StatusBadRequest, msg: msg}
+			return &malformedRequest{status: http.StatusBadRequest, code: CodeMalformedRequest, msg: msg}
 
 		case strings.HasPrefix(err.Error(), "json: unknown field "):
 			fieldName := strings.TrimPrefix(err.Error(), "json: unknown field ")
 			msg := fmt.Sprintf("Request body contains unknown field %s", fieldName)
-			return &malformedRequest{status: http.StatusBadRequest, msg: msg}
+			return &malformedRequest{status: http.StatusBadRequest, code: CodeMalformedRequest, msg: msg}
 
 		case errors.Is(err, io.EOF):
 			msg := "Request body must not be empty"
-			return &malformedRequest{status: http.StatusBadRequest, msg: msg}
+			return &malformedRequest{status: http.StatusBadRequest, code: CodeMalformedRequest, msg: msg}
 
 		case err.Error() == "http: request body too large":
 			msg := "Request body must not be larger than 1MB"
-			return &malformedRequest{status: http.StatusRequestEntityTooLarge, msg: msg}
+			return &malformedRequest{status: http.StatusRequestEntityTooLarge, code: CodePayloadTooLarge, msg: msg}
 
 		default:
 			return err
@@ -72,8 +114,139 @@ func decodeJSONBody(w http.ResponseWriter, r *http.Request, dst interface{}) err
 	err = dec.Decode(&struct{}{})
 	if !errors.Is(err, io.EOF) {
 		msg := "Request body must only contain a single JSON object"
-		return &malformedRequest{status: http.StatusBadRequest, msg: msg}
+		return &malformedRequest{status: http.StatusBadRequest, code: CodeMalformedRequest, msg: msg}
 	}
 
 	return nil
 }
+
+// todoETag is the strong validator of a single todo. It changes with every
+// write because the revision does.
+func todoETag(todo store.Todo) string {
+	return fmt.Sprintf(`"%d-%d"`, todo.Id, todo.Revision)
+}
+
+// bodyETag is the validator of a generated response body.
+func bodyETag(body []byte) string {
+	sum := sha256.Sum256(body)
+	return fmt.Sprintf(`"%x"`, sum[:16])
+}
+
+// etagMatches implements the weak comparison If-None-Match uses against a
+// list of entity tags or *.
+func etagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
+
+// ifMatchRevision reads the revision a write to todo id is conditional on
+// from the If-Match header. Zero means the write is unconditional. Entity
+// tags that can never match, such as weak ones or another todo's, fail the
+// precondition straight away.
+func ifMatchRevision(r *http.Request, id int) (int, error) {
+	header := strings.TrimSpace(r.Header.Get("If-Match"))
+	if header == "" || header == "*" {
+		return 0, nil
+	}
+
+	var etagId, revision int
+	if _, err := fmt.Sscanf(header, `"%d-%d"`, &etagId, &revision); err != nil || etagId != id || todoETag(store.Todo{Id: id, Revision: revision}) != header {
+		msg := fmt.Sprintf("If-Match %s does not match any revision of todo %d", header, id)
+		return 0, &malformedRequest{status: http.StatusPreconditionFailed, code: CodePreconditionFailed, msg: msg}
+	}
+	return revision, nil
+}
+
+// wantsHTML reports whether the request came from HTMX or asked for HTML, in
+// which case endpoints with a partial respond with it instead of JSON.
+func wantsHTML(r *http.Request) bool {
+	return r.Header.Get("HX-Request") == "true" || strings.Contains(r.Header.Get("Accept"), "text/html")
+}
+
+// wantsJSON reports whether the request asked for JSON only, for endpoints
+// that answer with HTML by default.
+func wantsJSON(r *http.Request) bool {
+	return !wantsHTML(r) && strings.Contains(r.Header.Get("Accept"), jsonContentType)
+}
+
+// requestLocation picks the timezone relative dates are rendered in: the tz
+// query parameter, then the X-Timezone header, then the tz cookie. Unknown
+// names fall back to def.
+func requestLocation(r *http.Request, def *time.Location) *time.Location {
+	name := r.URL.Query().Get("tz")
+	if name == "" {
+		name = r.Header.Get("X-Timezone")
+	}
+	if name == "" {
+		if cookie, err := r.Cookie("tz"); err == nil {
+			name = cookie.Value
+		}
+	}
+	if name == "" {
+		return def
+	}
+
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return def
+	}
+	return loc
+}
+
+// parseListOptions reads the pagination, sorting and filtering query
+// parameters of GET /api/todos.
+func parseListOptions(query url.Values) (store.ListOptions, error) {
+	var opts store.ListOptions
+
+	if v := query.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > maxPageSize {
+			msg := fmt.Sprintf("limit must be a number between 1 and %d", maxPageSize)
+			return opts, badParameter(msg)
+		}
+		opts.Limit = limit
+	}
+	opts.Cursor = query.Get("cursor")
+
+	sort, err := store.ParseSortField(query.Get("sort"))
+	if err != nil {
+		msg := "sort must be one of position, time, id or description"
+		return opts, badParameter(msg)
+	}
+	opts.Sort = sort
+
+	switch query.Get("order") {
+	case "", "asc":
+	case "desc":
+		opts.Desc = true
+	default:
+		msg := "order must be asc or desc"
+		return opts, badParameter(msg)
+	}
+
+	if v := query.Get("completed"); v != "" {
+		completed, err := strconv.ParseBool(v)
+		if err != nil {
+			msg := "completed must be true or false"
+			return opts, badParameter(msg)
+		}
+		opts.Completed = &completed
+	}
+
+	for param, dst := range map[string]*store.Timestamp{"due_before": &opts.DueBefore, "due_after": &opts.DueAfter} {
+		ts, err := store.ParseTimestamp(query.Get(param))
+		if err != nil {
+			msg := fmt.Sprintf("%s must be an RFC 3339 timestamp", param)
+			return opts, badParameter(msg)
+		}
+		*dst = ts
+	}
+
+	opts.Query = query.Get("q")
+	return opts, nil
+}
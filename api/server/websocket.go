@@ -0,0 +1,177 @@
+package server
+
+import (
+	"context"
+	"log"
+	"net/http"
+
+	"github.com/mcadenas-bjss/go-do-it/store"
+	"github.com/pkg/errors"
+	"golang.org/x/net/websocket"
+)
+
+// Sync message types. A client opens the socket and sends subscribe, with
+// since set to the last event it applied when it is resuming. Otherwise the
+// server first sends a snapshot of every todo. Either way every change is
+// then sent as a delta, which the client acknowledges with an ack naming the
+// event id once it is applied.
+const (
+	SyncSubscribe = "subscribe"
+	SyncSnapshot  = "snapshot"
+	SyncDelta     = "delta"
+	SyncAck       = "ack"
+	SyncError     = "error"
+)
+
+// SyncMessage is one message of the WebSocket sync protocol. Which fields are
+// set depends on the type.
+type SyncMessage struct {
+	Type  string       `json:"type"`
+	Since int          `json:"since,omitempty"`
+	Todos []store.Todo `json:"todos,omitempty"`
+	Event *store.Event `json:"event,omitempty"`
+	Id    int          `json:"id,omitempty"`
+	Error *Problem     `json:"error,omitempty"`
+}
+
+// syncWindow is how many deltas may be sent without being acknowledged. A
+// client that stops acknowledging falls behind the hub and is disconnected.
+const syncWindow = 64
+
+var errSocketClosed = errors.New("socket closed")
+
+// handleSync upgrades the request to a WebSocket speaking the sync protocol.
+func (t *TodoServer) handleSync(w http.ResponseWriter, r *http.Request) {
+	log.Printf("%s %s", r.Method, r.URL.Path)
+	websocket.Handler(func(ws *websocket.Conn) {
+		defer ws.Close()
+		if err := t.sync(r.Context(), ws); err != nil && !errors.Is(err, errSocketClosed) {
+			log.Printf("sync connection closed: %s", err)
+		}
+	}).ServeHTTP(w, r)
+}
+
+// syncConn tracks the deltas a client has not acknowledged yet.
+type syncConn struct {
+	ws       *websocket.Conn
+	acks     <-chan int
+	inflight []int
+}
+
+func (c *syncConn) ack(id int) {
+	i := 0
+	for i < len(c.inflight) && c.inflight[i] <= id {
+		i++
+	}
+	c.inflight = c.inflight[i:]
+}
+
+// sendDelta waits for room in the window before sending an event.
+func (c *syncConn) sendDelta(ctx context.Context, e store.Event) error {
+	for len(c.inflight) >= syncWindow {
+		select {
+		case id, ok := <-c.acks:
+			if !ok {
+				return errSocketClosed
+			}
+			c.ack(id)
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	if err := websocket.JSON.Send(c.ws, SyncMessage{Type: SyncDelta, Event: &e, Id: e.Id}); err != nil {
+		return err
+	}
+	c.inflight = append(c.inflight, e.Id)
+	return nil
+}
+
+func (t *TodoServer) sync(ctx context.Context, ws *websocket.Conn) error {
+	var subscribe SyncMessage
+	if err := websocket.JSON.Receive(ws, &subscribe); err != nil {
+		return err
+	}
+	if subscribe.Type != SyncSubscribe || subscribe.Since < 0 {
+		err := &malformedRequest{status: http.StatusBadRequest, code: CodeMalformedRequest, msg: "the first message must be a subscribe with a since of 0 or more"}
+		p := problemFor(err)
+		websocket.JSON.Send(ws, SyncMessage{Type: SyncError, Error: &p})
+		return err
+	}
+
+	// Subscribe before reading the store so no change falls between the two.
+	events, unsubscribe := t.hub.Subscribe(syncWindow)
+	defer unsubscribe()
+
+	done := make(chan struct{})
+	defer close(done)
+	acks := make(chan int)
+	go readAcks(ws, acks, done)
+	conn := &syncConn{ws: ws, acks: acks}
+
+	lastId := subscribe.Since
+	send := func(e store.Event) error {
+		if e.Id <= lastId || !visibleTo(ctx, e) {
+			return nil
+		}
+		lastId = e.Id
+		return conn.sendDelta(ctx, e)
+	}
+
+	if subscribe.Since > 0 {
+		if err := t.replayEvents(ctx, lastId, send); err != nil {
+			return err
+		}
+	} else {
+		cmd := store.NewGetAllCommand(ctx, store.ListOptions{})
+		t.cmds <- cmd
+
+		page, err := cmd.Wait()
+		if err != nil {
+			return err
+		}
+		// Deltas racing the snapshot may already be part of it. Clients
+		// skip those by revision.
+		if err := websocket.JSON.Send(ws, SyncMessage{Type: SyncSnapshot, Todos: page.Todos}); err != nil {
+			return err
+		}
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case id, ok := <-acks:
+			if !ok {
+				return errSocketClosed
+			}
+			conn.ack(id)
+		case e, ok := <-events:
+			if !ok {
+				return errors.New("client fell behind")
+			}
+			if err := send(e); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// readAcks forwards the event ids the client acknowledges until the socket
+// is closed or done. Other messages are ignored.
+func readAcks(ws *websocket.Conn, acks chan<- int, done <-chan struct{}) {
+	defer close(acks)
+	for {
+		var msg SyncMessage
+		if err := websocket.JSON.Receive(ws, &msg); err != nil {
+			return
+		}
+		if msg.Type != SyncAck {
+			continue
+		}
+		select {
+		case acks <- msg.Id:
+		case <-done:
+			return
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package server_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mcadenas-bjss/go-do-it/server"
+	"github.com/mcadenas-bjss/go-do-it/store"
+	"golang.org/x/net/websocket"
+)
+
+func TestSync(t *testing.T) {
+	todoServer := server.NewTodoServer(store.NewMemoryTodoStore(
+		store.Todo{Id: 1, Description: "Buy milk"},
+	))
+	ts := httptest.NewServer(todoServer)
+	defer ts.Close()
+
+	toggle := func() {
+		t.Helper()
+		response, err := http.Post(ts.URL+"/api/todo/toggle/1", "", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		response.Body.Close()
+		assertStatus(t, response.StatusCode, http.StatusOK)
+	}
+
+	dial := func(t *testing.T, subscribe server.SyncMessage) *websocket.Conn {
+		t.Helper()
+		ws, err := websocket.Dial("ws"+strings.TrimPrefix(ts.URL, "http")+"/api/sync", "", ts.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { ws.Close() })
+		ws.SetDeadline(time.Now().Add(5 * time.Second))
+		if err := websocket.JSON.Send(ws, subscribe); err != nil {
+			t.Fatal(err)
+		}
+		return ws
+	}
+
+	receive := func(t *testing.T, ws *websocket.Conn) server.SyncMessage {
+		t.Helper()
+		var msg server.SyncMessage
+		if err := websocket.JSON.Receive(ws, &msg); err != nil {
+			t.Fatal(err)
+		}
+		return msg
+	}
+
+	t.Run("sends a snapshot then deltas", func(t *testing.T) {
+		ws := dial(t, server.SyncMessage{Type: server.SyncSubscribe})
+
+		snapshot := receive(t, ws)
+		if snapshot.Type != server.SyncSnapshot || len(snapshot.Todos) != 1 || snapshot.Todos[0].Description != "Buy milk" {
+			t.Fatalf("unexpected snapshot %+v", snapshot)
+		}
+
+		toggle()
+		delta := receive(t, ws)
+		if delta.Type != server.SyncDelta || delta.Id != 1 || delta.Event.Op != store.EventToggle || !delta.Event.After.Completed {
+			t.Errorf("unexpected delta %+v", delta)
+		}
+		websocket.JSON.Send(ws, server.SyncMessage{Type: server.SyncAck, Id: delta.Id})
+	})
+
+	t.Run("resumes after since", func(t *testing.T) {
+		toggle()
+		ws := dial(t, server.SyncMessage{Type: server.SyncSubscribe, Since: 1})
+
+		if delta := receive(t, ws); delta.Type != server.SyncDelta || delta.Id != 2 {
+			t.Errorf("got %+v want the delta after 1", delta)
+		}
+	})
+
+	t.Run("rejects other first messages", func(t *testing.T) {
+		ws := dial(t, server.SyncMessage{Type: server.SyncAck})
+
+		msg := receive(t, ws)
+		if msg.Type != server.SyncError || msg.Error.Code != server.CodeMalformedRequest {
+			t.Errorf("unexpected reply %+v", msg)
+		}
+	})
+}
+
+// sync opens the sync socket at path as c and returns the snapshot it sends.
+func (c *authClient) sync(path string) server.SyncMessage {
+	c.t.Helper()
+	config, err := websocket.NewConfig("ws"+strings.TrimPrefix(c.url, "http")+path, c.url)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	if c.token != "" {
+		config.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	u, _ := url.Parse(c.url)
+	for _, cookie := range c.http.Jar.Cookies(u) {
+		config.Header.Add("Cookie", cookie.String())
+	}
+	ws, err := websocket.DialConfig(config)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	defer ws.Close()
+	ws.SetDeadline(time.Now().Add(5 * time.Second))
+
+	var msg server.SyncMessage
+	if err := websocket.JSON.Send(ws, server.SyncMessage{Type: server.SyncSubscribe}); err != nil {
+		c.t.Fatal(err)
+	}
+	if err := websocket.JSON.Receive(ws, &msg); err != nil {
+		c.t.Fatal(err)
+	}
+	return msg
+}
@@ -0,0 +1,58 @@
+package store
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+)
+
+// OpKind names the write an Op performs.
+type OpKind string
+
+const (
+	OpCreate OpKind = "create"
+	OpUpdate OpKind = "update"
+	OpDelete OpKind = "delete"
+	OpToggle OpKind = "toggle"
+)
+
+// Op is a single write of a Batch. Ref names the todo updated, deleted or
+// toggled and Todo holds the fields of a created or updated todo.
+type Op struct {
+	Kind OpKind
+	Ref  Ref
+	Todo Todo
+}
+
+// Batch is a list of writes applied in one transaction. Unless
+// ContinueOnError is set the first failing op rolls back the whole batch.
+type Batch struct {
+	Ops             []Op
+	ContinueOnError bool
+}
+
+// OpResult is the outcome of one Op: the todo as written, with only its Id
+// set after a delete, or the error the op failed with.
+type OpResult struct {
+	Todo Todo
+	Err  error
+}
+
+// BatchError is returned when an op of an all-or-nothing batch fails. Nothing
+// in the batch was written.
+type BatchError struct {
+	Index int
+	Err   error
+}
+
+func (e *BatchError) Error() string {
+	return fmt.Sprintf("operation %d failed: %s", e.Index, e.Err)
+}
+
+func (e *BatchError) Unwrap() error {
+	return e.Err
+}
+
+func unknownOp(kind OpKind) error {
+	return errors.Wrapf(ErrValidation, "unknown operation %q", kind)
+}
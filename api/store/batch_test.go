@@ -0,0 +1,105 @@
+package store_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/mcadenas-bjss/go-do-it/store"
+)
+
+func TestBatch(t *testing.T) {
+	ctx := context.Background()
+
+	for name, s := range newStores(t) {
+		t.Run(name, func(t *testing.T) {
+			milk, _ := s.Insert(ctx, store.Todo{Description: "Buy milk"})
+			bread, _ := s.Insert(ctx, store.Todo{Description: "Buy bread"})
+
+			t.Run("rolls back every op when one fails", func(t *testing.T) {
+				_, err := s.Batch(ctx, store.Batch{Ops: []store.Op{
+					{Kind: store.OpCreate, Todo: store.Todo{Description: "Buy eggs"}},
+					{Kind: store.OpToggle, Ref: store.Ref{Id: milk.Id}},
+					{Kind: store.OpDelete, Ref: store.Ref{Id: 99}},
+				}})
+
+				var batchErr *store.BatchError
+				if !errors.As(err, &batchErr) || batchErr.Index != 2 || !errors.Is(err, store.ErrNotFound) {
+					t.Fatalf("got %v want operation 2 to fail with %v", err, store.ErrNotFound)
+				}
+				assertTodos(t, s, []store.Todo{
+					{Id: milk.Id, Description: "Buy milk", Revision: 1},
+					{Id: bread.Id, Description: "Buy bread", Revision: 1},
+				})
+			})
+
+			t.Run("applies the rest when asked to continue on error", func(t *testing.T) {
+				results, err := s.Batch(ctx, store.Batch{ContinueOnError: true, Ops: []store.Op{
+					{Kind: store.OpUpdate, Ref: store.Ref{Id: milk.Id, Revision: 1}, Todo: store.Todo{Description: "Buy oat milk"}},
+					{Kind: store.OpToggle, Ref: store.Ref{Id: bread.Id, Revision: 5}},
+					{Kind: store.OpToggle, Ref: store.Ref{Id: milk.Id}},
+				}})
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if len(results) != 3 {
+					t.Fatalf("got %d results want 3", len(results))
+				}
+				assertTodo(t, results[0].Todo, store.Todo{Id: milk.Id, Description: "Buy oat milk", Revision: 2})
+				if !errors.Is(results[1].Err, store.ErrRevisionMismatch) {
+					t.Errorf("got %v want %v", results[1].Err, store.ErrRevisionMismatch)
+				}
+				assertTodo(t, results[2].Todo, store.Todo{Id: milk.Id, Description: "Buy oat milk", Completed: true, Revision: 3})
+			})
+
+			t.Run("completes every todo", func(t *testing.T) {
+				n, err := s.CompleteAll(ctx)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if n != 1 {
+					t.Errorf("completed %d todos want 1", n)
+				}
+				assertTodos(t, s, []store.Todo{
+					{Id: milk.Id, Description: "Buy oat milk", Completed: true, Revision: 3},
+					{Id: bread.Id, Description: "Buy bread", Completed: true, Revision: 2},
+				})
+			})
+
+			t.Run("deletes completed todos", func(t *testing.T) {
+				if _, err := s.Insert(ctx, store.Todo{Description: "Buy eggs"}); err != nil {
+					t.Fatal(err)
+				}
+				n, err := s.DeleteCompleted(ctx)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if n != 2 {
+					t.Errorf("deleted %d todos want 2", n)
+				}
+				page, err := s.List(ctx, store.ListOptions{})
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(page.Todos) != 1 || page.Todos[0].Description != "Buy eggs" {
+					t.Errorf("got %+v want only the open todo", page.Todos)
+				}
+			})
+		})
+	}
+}
+
+func assertTodos(t testing.TB, s store.TodoStore, want []store.Todo) {
+	t.Helper()
+	page, err := s.List(context.Background(), store.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Todos) != len(want) {
+		t.Fatalf("got %+v want %+v", page.Todos, want)
+	}
+	for i := range want {
+		assertTodo(t, page.Todos[i], want[i])
+	}
+}
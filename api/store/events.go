@@ -0,0 +1,267 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// EventOp names the change an Event records.
+type EventOp string
+
+const (
+	EventCreate   EventOp = "create"
+	EventUpdate   EventOp = "update"
+	EventToggle   EventOp = "toggle"
+	EventPatch    EventOp = "patch"
+	EventMove     EventOp = "move"
+	EventComplete EventOp = "complete"
+	EventDelete   EventOp = "delete"
+	EventRestore  EventOp = "restore"
+	EventPurge    EventOp = "purge"
+)
+
+// SystemActor is recorded for changes made without an actor in the context,
+// such as purging the trash.
+const SystemActor = "system"
+
+// Event is one entry of the append-only audit log, written in the same
+// transaction as the change it records. Before is nil for creates and
+// restores, After for deletes and purges.
+type Event struct {
+	Id     int
+	TodoId int
+	Op     EventOp
+	Before *Todo
+	After  *Todo
+	At     Timestamp
+	Actor  string
+	// Owner and List are the user owning the todo and the list it is in, for
+	// routing events to the clients they are visible to. They are not part
+	// of the API.
+	Owner int `json:"-"`
+	List  int `json:"-"`
+}
+
+// DefaultEventLimit is the number of events returned when an EventQuery does
+// not ask for a specific amount.
+const DefaultEventLimit = 100
+
+// EventQuery selects events for the global feed, oldest first.
+type EventQuery struct {
+	// AfterId skips events up to and including this id.
+	AfterId int
+	// Since skips events that happened before it.
+	Since Timestamp
+	Limit int
+}
+
+func (q EventQuery) limit() int {
+	if q.Limit < 1 {
+		return DefaultEventLimit
+	}
+	return q.Limit
+}
+
+func (q EventQuery) matches(e Event) bool {
+	return e.Id > q.AfterId && (q.Since.IsZero() || !e.At.Before(q.Since.Time))
+}
+
+type actorKey struct{}
+
+// WithActor returns a context whose writes are recorded as made by actor.
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+func actorFrom(ctx context.Context) string {
+	if actor, ok := ctx.Value(actorKey{}).(string); ok && actor != "" {
+		return actor
+	}
+	return SystemActor
+}
+
+// newEvent records a change from before to after. Either may be nil.
+func newEvent(ctx context.Context, op EventOp, before, after *Todo) Event {
+	e := Event{Op: op, Before: before, After: after, At: NewTimestamp(time.Now()), Actor: actorFrom(ctx)}
+	if before != nil {
+		e.TodoId = before.Id
+	} else if after != nil {
+		e.TodoId = after.Id
+	}
+	return e
+}
+
+// eventColumns are the columns scanEvent expects, in order.
+const eventColumns = "id, todo_id, op, before, after, at, actor, owner_id, list_id"
+
+// recordTx appends an event to todo_events in the transaction of the change
+// it records. The event belongs to the owner and list of its todo, found in
+// the audit log once the todo has been purged.
+func recordTx(ctx context.Context, tx *sql.Tx, e Event) error {
+	before, err := marshalEventTodo(e.Before)
+	if err != nil {
+		return err
+	}
+	after, err := marshalEventTodo(e.After)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `INSERT INTO todo_events(todo_id, op, before, after, at, actor, owner_id, list_id)
+		VALUES(?,?,?,?,?,?, COALESCE(
+		  (SELECT owner_id FROM todo WHERE id=?),
+		  (SELECT owner_id FROM todo_events WHERE todo_id=? ORDER BY id DESC LIMIT 1),
+		  0), COALESCE(
+		  (SELECT list_id FROM todo WHERE id=?),
+		  (SELECT list_id FROM todo_events WHERE todo_id=? ORDER BY id DESC LIMIT 1),
+		  0))`,
+		e.TodoId, e.Op, before, after, e.At, e.Actor, e.TodoId, e.TodoId, e.TodoId, e.TodoId)
+	return errors.Wrap(err, "Recording event failed")
+}
+
+// marshalEventTodo stores one side of an event as JSON, or NULL when there
+// is none.
+func marshalEventTodo(todo *Todo) (any, error) {
+	if todo == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(todo)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+func scanEvent(row interface{ Scan(dest ...any) error }) (Event, error) {
+	var e Event
+	var before, after sql.NullString
+	if err := row.Scan(&e.Id, &e.TodoId, &e.Op, &before, &after, &e.At, &e.Actor, &e.Owner, &e.List); err != nil {
+		return Event{}, err
+	}
+	for _, side := range []struct {
+		data sql.NullString
+		todo **Todo
+	}{{before, &e.Before}, {after, &e.After}} {
+		if !side.data.Valid {
+			continue
+		}
+		*side.todo = new(Todo)
+		if err := json.Unmarshal([]byte(side.data.String), *side.todo); err != nil {
+			return Event{}, errors.Wrapf(err, "Reading event %d failed", e.Id)
+		}
+	}
+	return e, nil
+}
+
+func (d *DbTodoStore) History(ctx context.Context, id int) ([]Event, error) {
+	log.Info(fmt.Sprintf("Getting history of todo %d", id))
+
+	scope, scopeArgs := scopeFilter(ctx, "")
+	events, err := d.queryEvents(ctx, "SELECT "+eventColumns+" FROM todo_events WHERE todo_id=?"+scope+" ORDER BY id", append([]any{id}, scopeArgs...)...)
+	if err != nil {
+		return nil, err
+	}
+	if len(events) == 0 {
+		return nil, errors.Wrapf(ErrNotFound, "Id %d", id)
+	}
+	return events, nil
+}
+
+func (d *DbTodoStore) Events(ctx context.Context, q EventQuery) ([]Event, error) {
+	log.Info(fmt.Sprintf("Getting events %+v", q))
+
+	scope, args := scopeFilter(ctx, "")
+	query := "SELECT " + eventColumns + " FROM todo_events WHERE id > ?" + scope
+	args = append([]any{q.AfterId}, args...)
+	if !q.Since.IsZero() {
+		query += " AND at >= ?"
+		args = append(args, q.Since)
+	}
+	query += " ORDER BY id LIMIT ?"
+	args = append(args, q.limit())
+	return d.queryEvents(ctx, query, args...)
+}
+
+func (d *DbTodoStore) LastEventId(ctx context.Context) (int, error) {
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+
+	var id int
+	err := d.db.QueryRowContext(ctx, "SELECT COALESCE(MAX(id), 0) FROM todo_events").Scan(&id)
+	return id, err
+}
+
+func (d *DbTodoStore) queryEvents(ctx context.Context, query string, args ...any) ([]Event, error) {
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+
+	return withContext(ctx, func() ([]Event, error) {
+		rows, err := d.db.QueryContext(ctx, query, args...)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+
+		events := []Event{}
+		for rows.Next() {
+			e, err := scanEvent(rows)
+			if err != nil {
+				return nil, err
+			}
+			events = append(events, e)
+		}
+		return events, rows.Err()
+	})
+}
+
+func (m *MemoryTodoStore) History(ctx context.Context, id int) ([]Event, error) {
+	log.Info(fmt.Sprintf("Getting history of todo %d", id))
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	events := []Event{}
+	for _, e := range m.events {
+		if e.TodoId == id && m.owns(ctx, id) {
+			events = append(events, m.withOwner(e))
+		}
+	}
+	if len(events) == 0 {
+		return nil, errors.Wrapf(ErrNotFound, "Id %d", id)
+	}
+	return events, nil
+}
+
+func (m *MemoryTodoStore) Events(ctx context.Context, q EventQuery) ([]Event, error) {
+	log.Info(fmt.Sprintf("Getting events %+v", q))
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	events := []Event{}
+	for _, e := range m.events[min(max(q.AfterId, 0), len(m.events)):] {
+		if len(events) == q.limit() {
+			break
+		}
+		if q.matches(e) && m.owns(ctx, e.TodoId) {
+			events = append(events, m.withOwner(e))
+		}
+	}
+	return events, nil
+}
+
+func (m *MemoryTodoStore) LastEventId(ctx context.Context) (int, error) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	return len(m.events), nil
+}
+
+// withOwner sets the owner and list of an event from its todo. The lock must
+// be held.
+func (m *MemoryTodoStore) withOwner(e Event) Event {
+	e.Owner, e.List = m.owners[e.TodoId], m.todoLists[e.TodoId]
+	return e
+}
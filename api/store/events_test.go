@@ -0,0 +1,128 @@
+package store_test
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/mcadenas-bjss/go-do-it/store"
+)
+
+func TestEvents(t *testing.T) {
+	ctx := store.WithActor(context.Background(), "alice")
+
+	for name, s := range newStores(t) {
+		t.Run(name, func(t *testing.T) {
+			todo, _ := s.Insert(ctx, store.Todo{Description: "Buy milk"})
+			s.Update(ctx, store.Todo{Id: todo.Id, Description: "Buy oat milk"})
+			s.Toggle(ctx, store.Ref{Id: todo.Id})
+			s.Patch(ctx, store.Ref{Id: todo.Id}, store.MergePatch(`{"Completed": false}`))
+			s.Delete(ctx, store.Ref{Id: todo.Id})
+			s.Restore(context.Background(), store.Ref{Id: todo.Id})
+
+			history, err := s.History(ctx, todo.Id)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			milk := store.Todo{Id: todo.Id, Description: "Buy milk", Revision: 1}
+			oat := store.Todo{Id: todo.Id, Description: "Buy oat milk", Revision: 2}
+			done := store.Todo{Id: todo.Id, Description: "Buy oat milk", Completed: true, Revision: 3}
+			open := store.Todo{Id: todo.Id, Description: "Buy oat milk", Revision: 4}
+			restored := store.Todo{Id: todo.Id, Description: "Buy oat milk", Revision: 6}
+			want := []store.Event{
+				{Op: store.EventCreate, After: &milk, Actor: "alice"},
+				{Op: store.EventUpdate, Before: &milk, After: &oat, Actor: "alice"},
+				{Op: store.EventToggle, Before: &oat, After: &done, Actor: "alice"},
+				{Op: store.EventPatch, Before: &done, After: &open, Actor: "alice"},
+				{Op: store.EventDelete, Before: &open, Actor: "alice"},
+				{Op: store.EventRestore, After: &restored, Actor: store.SystemActor},
+			}
+			assertEvents(t, history, want)
+
+			if _, err := s.History(ctx, 99); !errors.Is(err, store.ErrNotFound) {
+				t.Errorf("got %v want %v", err, store.ErrNotFound)
+			}
+
+			t.Run("feed pages by event id", func(t *testing.T) {
+				first, err := s.Events(ctx, store.EventQuery{Limit: 4})
+				if err != nil {
+					t.Fatal(err)
+				}
+				assertEvents(t, first, want[:4])
+
+				rest, err := s.Events(ctx, store.EventQuery{AfterId: first[3].Id})
+				if err != nil {
+					t.Fatal(err)
+				}
+				assertEvents(t, rest, want[4:])
+
+				future, err := s.Events(ctx, store.EventQuery{Since: store.NewTimestamp(time.Now().Add(time.Hour))})
+				if err != nil || len(future) != 0 {
+					t.Errorf("got %+v, %v for events in the future", future, err)
+				}
+			})
+
+			t.Run("rolled back writes leave no events", func(t *testing.T) {
+				s.Batch(ctx, store.Batch{Ops: []store.Op{
+					{Kind: store.OpToggle, Ref: store.Ref{Id: todo.Id}},
+					{Kind: store.OpDelete, Ref: store.Ref{Id: 99}},
+				}})
+
+				events, err := s.Events(ctx, store.EventQuery{})
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(events) != len(want) {
+					t.Errorf("got %d events want %d", len(events), len(want))
+				}
+			})
+
+			t.Run("knows the last event id", func(t *testing.T) {
+				events, _ := s.Events(ctx, store.EventQuery{})
+				last, err := s.LastEventId(ctx)
+				if err != nil || last != events[len(events)-1].Id {
+					t.Errorf("got %d, %v want %d", last, err, events[len(events)-1].Id)
+				}
+				if past, _ := s.Events(ctx, store.EventQuery{AfterId: last + 10}); len(past) != 0 {
+					t.Errorf("got %+v after the last event", past)
+				}
+			})
+		})
+	}
+}
+
+// withoutPosition copies todo without its position, which assertEvents does
+// not compare.
+func withoutPosition(todo *store.Todo) *store.Todo {
+	if todo == nil {
+		return nil
+	}
+	copied := *todo
+	copied.Position = ""
+	return &copied
+}
+
+// assertEvents compares events ignoring their ids, times and positions.
+func assertEvents(t testing.TB, got, want []store.Event) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("got %d events want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i].At.IsZero() || got[i].Id == 0 {
+			t.Errorf("event %d has no id or time: %+v", i, got[i])
+		}
+		if got[i].TodoId == 0 {
+			t.Errorf("event %d has no todo id", i)
+		}
+		g := got[i]
+		g.Id, g.TodoId, g.At = 0, 0, store.Timestamp{}
+		g.Before, g.After = withoutPosition(g.Before), withoutPosition(g.After)
+		if !reflect.DeepEqual(g, want[i]) {
+			t.Errorf("event %d: got %+v (before %+v, after %+v) want %+v", i, g, g.Before, g.After, want[i])
+		}
+	}
+}
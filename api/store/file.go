@@ -0,0 +1,173 @@
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// FileTodoStore is a MemoryTodoStore that writes its contents to a JSON file
+// after every change and reloads them on start.
+type FileTodoStore struct {
+	*MemoryTodoStore
+	path string
+}
+
+type fileContents struct {
+	NextId int
+	Todos  []Todo
+	Trash  []TrashedTodo `json:",omitempty"`
+	Events []Event       `json:",omitempty"`
+
+	Owners   map[int]int              `json:",omitempty"`
+	Users    []memoryUser             `json:",omitempty"`
+	Sessions map[string]memorySession `json:",omitempty"`
+	Tokens   []memoryToken            `json:",omitempty"`
+
+	TodoLists   map[int]int          `json:",omitempty"`
+	Lists       []List               `json:",omitempty"`
+	Members     map[int]map[int]Role `json:",omitempty"`
+	Invitations []memoryInvitation   `json:",omitempty"`
+
+	Sections []memorySection `json:",omitempty"`
+}
+
+func NewFileTodoStore(path string) (*FileTodoStore, error) {
+	log.Info(fmt.Sprintf("Opening json file at %s", path))
+	f := &FileTodoStore{MemoryTodoStore: NewMemoryTodoStore(), path: path}
+
+	data, err := os.ReadFile(path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+	case err != nil:
+		return nil, err
+	default:
+		var contents fileContents
+		if err := json.Unmarshal(data, &contents); err != nil {
+			return nil, errors.Wrapf(err, "Reading %s failed", path)
+		}
+		f.MemoryTodoStore = NewMemoryTodoStore(contents.Todos...)
+		f.events = contents.Events
+		for _, trashed := range contents.Trash {
+			if trashed.Position == "" {
+				trashed.Position = legacyPosition(trashed.Id)
+			}
+			f.trash[trashed.Id] = trashed
+			if trashed.Id >= f.nextId {
+				f.nextId = trashed.Id + 1
+			}
+		}
+		if contents.NextId > f.nextId {
+			f.nextId = contents.NextId
+		}
+		for id, owner := range contents.Owners {
+			f.owners[id] = owner
+		}
+		for _, user := range contents.Users {
+			f.users[user.Id] = user
+			f.nextUserId = max(f.nextUserId, user.Id+1)
+		}
+		for hash, session := range contents.Sessions {
+			f.sessions[hash] = session
+		}
+		for _, token := range contents.Tokens {
+			if token.Scopes == nil {
+				// Saved before tokens had scopes, as in the 0008 migration.
+				token.Scopes = []Scope{ScopeTodosRead, ScopeTodosWrite}
+			}
+			f.tokens[token.Hash] = token
+			f.nextTokenId = max(f.nextTokenId, token.Id+1)
+		}
+		for id, list := range contents.TodoLists {
+			f.todoLists[id] = list
+		}
+		for _, list := range contents.Lists {
+			f.lists[list.Id] = list
+			f.nextListId = max(f.nextListId, list.Id+1)
+		}
+		for id, roles := range contents.Members {
+			f.members[id] = roles
+		}
+		for _, invitation := range contents.Invitations {
+			f.invitations[invitation.Id] = invitation
+			f.nextInvitationId = max(f.nextInvitationId, invitation.Id+1)
+		}
+		for _, section := range contents.Sections {
+			f.sections[section.Id] = section
+			f.nextSectionId = max(f.nextSectionId, section.Id+1)
+		}
+	}
+
+	f.persist = f.save
+	return f, nil
+}
+
+// save writes the store to a temporary file and renames it over the old one
+// so a crash mid-write never leaves a truncated file behind.
+func (f *FileTodoStore) save() error {
+	contents := fileContents{
+		NextId:   f.nextId,
+		Todos:    f.sorted(),
+		Trash:    f.sortedTrash(),
+		Events:   f.events,
+		Owners:   f.owners,
+		Sessions: f.sessions,
+
+		TodoLists: f.todoLists,
+		Members:   f.members,
+	}
+	for _, user := range f.users {
+		contents.Users = append(contents.Users, user)
+	}
+	sort.Slice(contents.Users, func(i, j int) bool {
+		return contents.Users[i].Id < contents.Users[j].Id
+	})
+	for _, token := range f.tokens {
+		contents.Tokens = append(contents.Tokens, token)
+	}
+	sort.Slice(contents.Tokens, func(i, j int) bool {
+		return contents.Tokens[i].Id < contents.Tokens[j].Id
+	})
+	for _, list := range f.lists {
+		contents.Lists = append(contents.Lists, list)
+	}
+	sort.Slice(contents.Lists, func(i, j int) bool {
+		return contents.Lists[i].Id < contents.Lists[j].Id
+	})
+	for _, invitation := range f.invitations {
+		contents.Invitations = append(contents.Invitations, invitation)
+	}
+	sort.Slice(contents.Invitations, func(i, j int) bool {
+		return contents.Invitations[i].Id < contents.Invitations[j].Id
+	})
+	for _, section := range f.sections {
+		contents.Sections = append(contents.Sections, section)
+	}
+	sort.Slice(contents.Sections, func(i, j int) bool {
+		return contents.Sections[i].Id < contents.Sections[j].Id
+	})
+
+	data, err := json.MarshalIndent(contents, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(f.path), filepath.Base(f.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), f.path)
+}
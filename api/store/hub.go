@@ -0,0 +1,78 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// Hub fans out the events of every write to its subscribers. The manager
+// publishes to it once a write has been committed, so subscribers see events
+// in the order of the audit log.
+type Hub struct {
+	lock sync.Mutex
+	subs map[chan Event]struct{}
+}
+
+func NewHub() *Hub {
+	return &Hub{subs: map[chan Event]struct{}{}}
+}
+
+// Subscribe returns a channel receiving every event published from now on and
+// a function to stop receiving them. Publishing never waits for a slow
+// subscriber: once buffer events are queued the channel is closed and the
+// subscriber is expected to catch up from the audit log.
+func (h *Hub) Subscribe(buffer int) (<-chan Event, func()) {
+	ch := make(chan Event, buffer)
+
+	h.lock.Lock()
+	h.subs[ch] = struct{}{}
+	h.lock.Unlock()
+
+	return ch, func() {
+		h.lock.Lock()
+		defer h.lock.Unlock()
+		if _, ok := h.subs[ch]; ok {
+			delete(h.subs, ch)
+			close(ch)
+		}
+	}
+}
+
+func (h *Hub) Publish(e Event) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	for ch := range h.subs {
+		select {
+		case ch <- e:
+		default:
+			log.Info(fmt.Sprintf("Dropping subscriber that fell behind at event %d", e.Id))
+			delete(h.subs, ch)
+			close(ch)
+		}
+	}
+}
+
+// publishPageSize is how many events are read from the store at a time when
+// catching the hub up.
+const publishPageSize = 1000
+
+// publishAfter publishes the events logged after the given id and returns the
+// id of the last one, or after when there are none.
+func publishAfter(ctx context.Context, s TodoStore, h *Hub, after int) int {
+	for {
+		events, err := s.Events(ctx, EventQuery{AfterId: after, Limit: publishPageSize})
+		if err != nil {
+			log.Error(fmt.Sprintf("Reading events after %d failed: %s", after, err))
+			return after
+		}
+		for _, e := range events {
+			h.Publish(e)
+			after = e.Id
+		}
+		if len(events) < publishPageSize {
+			return after
+		}
+	}
+}
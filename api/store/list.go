@@ -0,0 +1,173 @@
+package store
+
+import (
+	"cmp"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+type SortField string
+
+const (
+	SortByPosition    SortField = "position"
+	SortById          SortField = "id"
+	SortByTime        SortField = "time"
+	SortByDescription SortField = "description"
+)
+
+// ListOptions narrows and orders the todos returned by TodoStore.List. The
+// zero value returns every todo in the order they were moved to.
+type ListOptions struct {
+	// Limit caps the number of todos in a page. Zero means no limit.
+	Limit int
+	// Cursor is the NextCursor of the previous page.
+	Cursor string
+	Sort   SortField
+	Desc   bool
+
+	Completed *bool
+	DueBefore Timestamp
+	DueAfter  Timestamp
+	// Query matches todos whose description contains it, ignoring case.
+	Query string
+}
+
+type Page struct {
+	Todos []Todo
+	// NextCursor is empty on the last page.
+	NextCursor string
+}
+
+// cursor is the position of the last todo on a page: its value for the sort
+// field and its id to break ties.
+type cursor struct {
+	Value string `json:"v"`
+	Id    int    `json:"id"`
+}
+
+func encodeCursor(opts ListOptions, todo Todo) string {
+	data, _ := json.Marshal(cursor{Value: sortValue(opts.sortField(), todo), Id: todo.Id})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(s string) (cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return cursor{}, errors.Wrap(ErrInvalidCursor, err.Error())
+	}
+	var c cursor
+	if err := json.Unmarshal(data, &c); err != nil {
+		return cursor{}, errors.Wrap(ErrInvalidCursor, err.Error())
+	}
+	return c, nil
+}
+
+func (opts ListOptions) sortField() SortField {
+	switch opts.Sort {
+	case SortById, SortByTime, SortByDescription:
+		return opts.Sort
+	default:
+		return SortByPosition
+	}
+}
+
+func ParseSortField(s string) (SortField, error) {
+	switch f := SortField(s); f {
+	case "", SortByPosition, SortById, SortByTime, SortByDescription:
+		return f, nil
+	default:
+		return "", fmt.Errorf("unknown sort field %q", s)
+	}
+}
+
+func sortValue(field SortField, todo Todo) string {
+	switch field {
+	case SortByPosition:
+		return todo.Position
+	case SortByTime:
+		return todo.Time.String()
+	case SortByDescription:
+		return todo.Description
+	default:
+		return strconv.Itoa(todo.Id)
+	}
+}
+
+// compare orders todos by the sort field, breaking ties by id.
+func (opts ListOptions) compare(a, b Todo) int {
+	c := 0
+	if field := opts.sortField(); field != SortById {
+		c = strings.Compare(sortValue(field, a), sortValue(field, b))
+	}
+	if c == 0 {
+		c = cmp.Compare(a.Id, b.Id)
+	}
+	if opts.Desc {
+		return -c
+	}
+	return c
+}
+
+func (opts ListOptions) matches(todo Todo) bool {
+	if opts.Completed != nil && todo.Completed != *opts.Completed {
+		return false
+	}
+	if !opts.DueBefore.IsZero() && (todo.Time.IsZero() || !todo.Time.Before(opts.DueBefore.Time)) {
+		return false
+	}
+	if !opts.DueAfter.IsZero() && (todo.Time.IsZero() || !todo.Time.After(opts.DueAfter.Time)) {
+		return false
+	}
+	if opts.Query != "" && !strings.Contains(strings.ToLower(todo.Description), strings.ToLower(opts.Query)) {
+		return false
+	}
+	return true
+}
+
+// paginate filters, sorts and pages todos in memory, for backends that cannot
+// push the options down into a query.
+func paginate(todos []Todo, opts ListOptions) (Page, error) {
+	var after *Todo
+	if opts.Cursor != "" {
+		c, err := decodeCursor(opts.Cursor)
+		if err != nil {
+			return Page{}, err
+		}
+		after = &Todo{Id: c.Id}
+		switch opts.sortField() {
+		case SortByTime:
+			if after.Time, err = parseStoredTime(c.Value); err != nil {
+				return Page{}, errors.Wrap(ErrInvalidCursor, err.Error())
+			}
+		case SortByDescription:
+			after.Description = c.Value
+		case SortByPosition:
+			after.Position = c.Value
+		}
+	}
+
+	matched := []Todo{}
+	for _, todo := range todos {
+		if opts.matches(todo) && (after == nil || opts.compare(*after, todo) < 0) {
+			matched = append(matched, todo)
+		}
+	}
+	sort.Slice(matched, func(i, j int) bool {
+		return opts.compare(matched[i], matched[j]) < 0
+	})
+
+	page := Page{Todos: matched}
+	if opts.Limit > 0 && len(matched) > opts.Limit {
+		page.Todos = matched[:opts.Limit]
+		page.NextCursor = encodeCursor(opts, page.Todos[opts.Limit-1])
+	}
+	return page, nil
+}
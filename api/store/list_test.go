@@ -0,0 +1,101 @@
+package store_test
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/mcadenas-bjss/go-do-it/store"
+)
+
+func TestList(t *testing.T) {
+	ctx := context.Background()
+	yes, no := true, false
+
+	seed := []store.Todo{
+		{Time: due("2024-01-03T00:00:00Z"), Description: "Buy milk"},
+		{Time: due("2024-01-01T00:00:00Z"), Description: "Walk the dog", Completed: true},
+		{Description: "buy bread"},
+		{Time: due("2024-01-02T00:00:00Z"), Description: "Call 100% of the family", Completed: true},
+		{Time: due("2024-01-02T00:00:00Z"), Description: "Answer email"},
+	}
+
+	for name, s := range newStores(t) {
+		ids := make([]int, len(seed))
+		for i, todo := range seed {
+			inserted, err := s.Insert(ctx, todo)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ids[i] = inserted.Id
+		}
+
+		tests := []struct {
+			name string
+			opts store.ListOptions
+			want []int
+		}{
+			{"id order by default", store.ListOptions{}, []int{ids[0], ids[1], ids[2], ids[3], ids[4]}},
+			{"sort by time with id tie break", store.ListOptions{Sort: store.SortByTime}, []int{ids[2], ids[1], ids[3], ids[4], ids[0]}},
+			{"sort by description descending", store.ListOptions{Sort: store.SortByDescription, Desc: true}, []int{ids[2], ids[1], ids[3], ids[0], ids[4]}},
+			{"completed", store.ListOptions{Completed: &yes}, []int{ids[1], ids[3]}},
+			{"not completed", store.ListOptions{Completed: &no}, []int{ids[0], ids[2], ids[4]}},
+			{"due before", store.ListOptions{DueBefore: due("2024-01-02T12:00:00Z")}, []int{ids[1], ids[3], ids[4]}},
+			{"due after", store.ListOptions{DueAfter: due("2024-01-01T00:00:00Z")}, []int{ids[0], ids[3], ids[4]}},
+			{"query ignores case", store.ListOptions{Query: "BUY"}, []int{ids[0], ids[2]}},
+			{"query is not a pattern", store.ListOptions{Query: "100%"}, []int{ids[3]}},
+		}
+
+		for _, tt := range tests {
+			t.Run(name+"/"+tt.name, func(t *testing.T) {
+				page, err := s.List(ctx, tt.opts)
+				if err != nil {
+					t.Fatal(err)
+				}
+				assertIds(t, page.Todos, tt.want)
+				if page.NextCursor != "" {
+					t.Errorf("expected no next page, got cursor %q", page.NextCursor)
+				}
+			})
+		}
+
+		t.Run(name+"/pages follow the sort order", func(t *testing.T) {
+			opts := store.ListOptions{Limit: 2, Sort: store.SortByTime, Desc: true}
+			var got []store.Todo
+			for pages := 0; ; pages++ {
+				if pages > len(seed) {
+					t.Fatal("pagination did not terminate")
+				}
+				page, err := s.List(ctx, opts)
+				if err != nil {
+					t.Fatal(err)
+				}
+				got = append(got, page.Todos...)
+				if page.NextCursor == "" {
+					break
+				}
+				opts.Cursor = page.NextCursor
+			}
+			assertIds(t, got, []int{ids[0], ids[4], ids[3], ids[1], ids[2]})
+		})
+
+		t.Run(name+"/rejects a bad cursor", func(t *testing.T) {
+			_, err := s.List(ctx, store.ListOptions{Cursor: "not a cursor"})
+			if !errors.Is(err, store.ErrInvalidCursor) {
+				t.Errorf("got %v want %v", err, store.ErrInvalidCursor)
+			}
+		})
+	}
+}
+
+func assertIds(t testing.TB, todos []store.Todo, want []int) {
+	t.Helper()
+	got := make([]int, len(todos))
+	for i, todo := range todos {
+		got[i] = todo.Id
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got ids %v want %v", got, want)
+	}
+}
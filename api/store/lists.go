@@ -0,0 +1,729 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	// ErrListNotFound is also returned for lists the user is not a member
+	// of, so they cannot tell them from lists that do not exist.
+	ErrListNotFound       = errors.New("list not found")
+	ErrMemberNotFound     = errors.New("member not found")
+	ErrInvitationNotFound = errors.New("invitation not found")
+	ErrUserNotFound       = errors.New("user not found")
+	ErrAlreadyMember      = errors.New("already a member or invited")
+	ErrLastOwner          = errors.New("a list must keep an owner")
+	ErrListNotEmpty       = errors.New("list still has todos")
+)
+
+// Role is what a member may do in a shared list.
+type Role string
+
+const (
+	RoleViewer Role = "viewer"
+	RoleEditor Role = "editor"
+	RoleOwner  Role = "owner"
+)
+
+// Roles are every role, from the one allowed the least to the most.
+var Roles = []Role{RoleViewer, RoleEditor, RoleOwner}
+
+// Allows reports whether the role may do what needs the role want. Editors
+// may do everything viewers may, and owners everything editors may.
+func (r Role) Allows(want Role) bool {
+	have := slices.Index(Roles, r)
+	return have >= 0 && have >= slices.Index(Roles, want)
+}
+
+// List is a shared list of todos. Every user also has a personal list, which
+// is not a List and holds the todos created outside of one.
+type List struct {
+	Id        int
+	Name      string
+	CreatedAt Timestamp
+	// Role is the role of the user the list was read for.
+	Role Role `json:",omitempty"`
+}
+
+// Member is a user who can see a list.
+type Member struct {
+	UserId   int
+	Username string
+	Role     Role
+}
+
+// Invitation offers a user a role in a list until they accept or decline it.
+type Invitation struct {
+	Id        int
+	ListId    int
+	ListName  string
+	Username  string
+	Role      Role
+	InvitedBy string
+	CreatedAt Timestamp
+}
+
+// ListStore keeps shared lists and who may use them. It does not check
+// permissions: callers decide who may change a list, and scope todo reads and
+// writes to it with WithList.
+type ListStore interface {
+	// CreateList makes the user the owner of a new list.
+	CreateList(ctx context.Context, userId int, name string) (List, error)
+	// Lists returns the lists a user is a member of, oldest first.
+	Lists(ctx context.Context, userId int) ([]List, error)
+	// MemberList returns a list with the user's role in it.
+	MemberList(ctx context.Context, listId, userId int) (List, error)
+	RenameList(ctx context.Context, listId int, name string) error
+	// DeleteList fails with ErrListNotEmpty while the list has todos,
+	// including in the trash.
+	DeleteList(ctx context.Context, listId int) error
+	Members(ctx context.Context, listId int) ([]Member, error)
+	// SetRole and RemoveMember fail with ErrLastOwner when the list would be
+	// left without an owner.
+	SetRole(ctx context.Context, listId, userId int, role Role) error
+	RemoveMember(ctx context.Context, listId, userId int) error
+	// Invite fails with ErrUserNotFound for unknown usernames, and with
+	// ErrAlreadyMember when the user is a member or invited already.
+	Invite(ctx context.Context, listId int, username string, role Role, invitedBy int) (Invitation, error)
+	ListInvitations(ctx context.Context, listId int) ([]Invitation, error)
+	UserInvitations(ctx context.Context, userId int) ([]Invitation, error)
+	// AcceptInvitation makes the user a member with the role they were
+	// invited with, and returns the list.
+	AcceptInvitation(ctx context.Context, userId, invitationId int) (List, error)
+	// CancelInvitation withdraws an invitation to a list, DeclineInvitation
+	// one sent to the user.
+	CancelInvitation(ctx context.Context, listId, invitationId int) error
+	DeclineInvitation(ctx context.Context, userId, invitationId int) error
+}
+
+type listKey struct{}
+
+// WithList returns a context whose reads and writes only see the todos of a
+// shared list, whoever owns them, and whose new todos are added to it.
+func WithList(ctx context.Context, listId int) context.Context {
+	return context.WithValue(ctx, listKey{}, listId)
+}
+
+// ListFrom returns the list a context is scoped to.
+func ListFrom(ctx context.Context) (int, bool) {
+	list, ok := ctx.Value(listKey{}).(int)
+	return list, ok
+}
+
+// InScope reports whether a todo owned by owner in list is visible to a
+// context: it must be in the context's list, or be a personal todo of its
+// owner. Unscoped contexts see every todo.
+func InScope(ctx context.Context, owner, list int) bool {
+	if scoped, ok := ListFrom(ctx); ok {
+		return list == scoped
+	}
+	if scoped, ok := OwnerFrom(ctx); ok {
+		return owner == scoped && list == 0
+	}
+	return true
+}
+
+// scopeFilter returns the condition limiting a query to the todos InScope
+// allows, to be appended to its WHERE clause, and its arguments. prefix
+// qualifies the columns, such as "t.". Both are empty for unscoped contexts.
+func scopeFilter(ctx context.Context, prefix string) (string, []any) {
+	if list, ok := ListFrom(ctx); ok {
+		return " AND " + prefix + "list_id=?", []any{list}
+	}
+	if owner, ok := OwnerFrom(ctx); ok {
+		return " AND " + prefix + "owner_id=? AND " + prefix + "list_id=0", []any{owner}
+	}
+	return "", nil
+}
+
+func (d *DbTodoStore) CreateList(ctx context.Context, userId int, name string) (List, error) {
+	log.Info(fmt.Sprintf("Creating list %q for user %d", name, userId))
+
+	list := List{Name: name, CreatedAt: NewTimestamp(time.Now()), Role: RoleOwner}
+	err := d.WithTx(ctx, func(tx *sql.Tx) error {
+		if err := tx.QueryRowContext(ctx, "INSERT INTO lists(name, created_at) VALUES(?,?) RETURNING id", name, list.CreatedAt).Scan(&list.Id); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, "INSERT INTO list_members(list_id, user_id, role) VALUES(?,?,?)", list.Id, userId, RoleOwner)
+		return err
+	})
+	if err != nil {
+		log.Errorf("Error: %s", err)
+		return List{}, err
+	}
+	return list, nil
+}
+
+const memberListsQuery = "SELECT l.id, l.name, l.created_at, m.role FROM lists l JOIN list_members m ON m.list_id=l.id WHERE m.user_id=?"
+
+func (d *DbTodoStore) Lists(ctx context.Context, userId int) ([]List, error) {
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+
+	rows, err := d.db.QueryContext(ctx, memberListsQuery+" ORDER BY l.id", userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	lists := []List{}
+	for rows.Next() {
+		var list List
+		if err := rows.Scan(&list.Id, &list.Name, &list.CreatedAt, &list.Role); err != nil {
+			return nil, err
+		}
+		lists = append(lists, list)
+	}
+	return lists, rows.Err()
+}
+
+func (d *DbTodoStore) MemberList(ctx context.Context, listId, userId int) (List, error) {
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+
+	return memberListTx(ctx, d.db, listId, userId)
+}
+
+// querier is what *sql.DB and *sql.Tx have in common, for reads made inside
+// and outside of transactions.
+type querier interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+func memberListTx(ctx context.Context, db querier, listId, userId int) (List, error) {
+	var list List
+	err := db.QueryRowContext(ctx, memberListsQuery+" AND l.id=?", userId, listId).Scan(&list.Id, &list.Name, &list.CreatedAt, &list.Role)
+	if errors.Is(err, sql.ErrNoRows) {
+		return List{}, errors.Wrapf(ErrListNotFound, "Id %d", listId)
+	}
+	return list, err
+}
+
+func (d *DbTodoStore) RenameList(ctx context.Context, listId int, name string) error {
+	log.Info(fmt.Sprintf("Renaming list %d to %q", listId, name))
+
+	return d.WithTx(ctx, func(tx *sql.Tx) error {
+		result, err := tx.ExecContext(ctx, "UPDATE lists SET name=? WHERE id=?", name, listId)
+		if err != nil {
+			return err
+		}
+		return mustAffect(result, ErrListNotFound, listId)
+	})
+}
+
+func (d *DbTodoStore) DeleteList(ctx context.Context, listId int) error {
+	log.Info(fmt.Sprintf("Deleting list %d", listId))
+
+	return d.WithTx(ctx, func(tx *sql.Tx) error {
+		var todos bool
+		if err := tx.QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM todo WHERE list_id=?)", listId).Scan(&todos); err != nil {
+			return err
+		}
+		if todos {
+			return errors.Wrapf(ErrListNotEmpty, "Id %d", listId)
+		}
+		for _, table := range []string{"list_invitations", "list_members", "sections"} {
+			if _, err := tx.ExecContext(ctx, "DELETE FROM "+table+" WHERE list_id=?", listId); err != nil {
+				return err
+			}
+		}
+		result, err := tx.ExecContext(ctx, "DELETE FROM lists WHERE id=?", listId)
+		if err != nil {
+			return err
+		}
+		return mustAffect(result, ErrListNotFound, listId)
+	})
+}
+
+func (d *DbTodoStore) Members(ctx context.Context, listId int) ([]Member, error) {
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+
+	rows, err := d.db.QueryContext(ctx, "SELECT u.id, u.username, m.role FROM list_members m JOIN users u ON u.id=m.user_id WHERE m.list_id=? ORDER BY u.id", listId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	members := []Member{}
+	for rows.Next() {
+		var member Member
+		if err := rows.Scan(&member.UserId, &member.Username, &member.Role); err != nil {
+			return nil, err
+		}
+		members = append(members, member)
+	}
+	return members, rows.Err()
+}
+
+func (d *DbTodoStore) SetRole(ctx context.Context, listId, userId int, role Role) error {
+	log.Info(fmt.Sprintf("Making user %d %s of list %d", userId, role, listId))
+
+	return d.WithTx(ctx, func(tx *sql.Tx) error {
+		if err := keepOwnerTx(ctx, tx, listId, userId, role); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, "UPDATE list_members SET role=? WHERE list_id=? AND user_id=?", role, listId, userId)
+		return err
+	})
+}
+
+func (d *DbTodoStore) RemoveMember(ctx context.Context, listId, userId int) error {
+	log.Info(fmt.Sprintf("Removing user %d from list %d", userId, listId))
+
+	return d.WithTx(ctx, func(tx *sql.Tx) error {
+		if err := keepOwnerTx(ctx, tx, listId, userId, ""); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, "DELETE FROM list_members WHERE list_id=? AND user_id=?", listId, userId)
+		return err
+	})
+}
+
+// keepOwnerTx checks that a member of a list may be given the role, or be
+// removed when it is empty, without leaving the list without an owner.
+func keepOwnerTx(ctx context.Context, tx *sql.Tx, listId, userId int, role Role) error {
+	var current Role
+	var owners int
+	err := tx.QueryRowContext(ctx, "SELECT role, (SELECT COUNT(*) FROM list_members WHERE list_id=? AND role=?) FROM list_members WHERE list_id=? AND user_id=?",
+		listId, RoleOwner, listId, userId).Scan(&current, &owners)
+	if errors.Is(err, sql.ErrNoRows) {
+		return errors.Wrapf(ErrMemberNotFound, "user %d in list %d", userId, listId)
+	}
+	if err != nil {
+		return err
+	}
+	if current == RoleOwner && role != RoleOwner && owners == 1 {
+		return errors.Wrapf(ErrLastOwner, "user %d is the only owner of list %d", userId, listId)
+	}
+	return nil
+}
+
+func (d *DbTodoStore) Invite(ctx context.Context, listId int, username string, role Role, invitedBy int) (Invitation, error) {
+	log.Info(fmt.Sprintf("Inviting %s to list %d as %s", username, listId, role))
+
+	var invitation Invitation
+	err := d.WithTx(ctx, func(tx *sql.Tx) error {
+		var userId int
+		var taken bool
+		err := tx.QueryRowContext(ctx, `SELECT id,
+			  EXISTS(SELECT 1 FROM list_members WHERE list_id=? AND user_id=users.id) OR
+			  EXISTS(SELECT 1 FROM list_invitations WHERE list_id=? AND user_id=users.id)
+			FROM users WHERE username=?`, listId, listId, username).Scan(&userId, &taken)
+		if errors.Is(err, sql.ErrNoRows) {
+			return errors.Wrapf(ErrUserNotFound, "%q", username)
+		}
+		if err != nil {
+			return err
+		}
+		if taken {
+			return errors.Wrapf(ErrAlreadyMember, "%q in list %d", username, listId)
+		}
+
+		var id int
+		err = tx.QueryRowContext(ctx, "INSERT INTO list_invitations(list_id, user_id, role, invited_by, created_at) VALUES(?,?,?,?,?) RETURNING id",
+			listId, userId, role, invitedBy, NewTimestamp(time.Now())).Scan(&id)
+		if err != nil {
+			return err
+		}
+		invitations, err := queryInvitations(ctx, tx, "i.id=?", id)
+		if err != nil {
+			return err
+		}
+		invitation = invitations[0]
+		return nil
+	})
+	if err != nil {
+		log.Errorf("Error: %s", err)
+		return Invitation{}, err
+	}
+	return invitation, nil
+}
+
+func (d *DbTodoStore) ListInvitations(ctx context.Context, listId int) ([]Invitation, error) {
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+
+	return queryInvitations(ctx, d.db, "i.list_id=?", listId)
+}
+
+func (d *DbTodoStore) UserInvitations(ctx context.Context, userId int) ([]Invitation, error) {
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+
+	return queryInvitations(ctx, d.db, "i.user_id=?", userId)
+}
+
+// queryInvitations returns the invitations matching a condition, oldest
+// first.
+func queryInvitations(ctx context.Context, db querier, where string, args ...any) ([]Invitation, error) {
+	rows, err := db.QueryContext(ctx, `SELECT i.id, i.list_id, l.name, u.username, i.role, b.username, i.created_at
+		FROM list_invitations i
+		JOIN lists l ON l.id=i.list_id
+		JOIN users u ON u.id=i.user_id
+		JOIN users b ON b.id=i.invited_by
+		WHERE `+where+" ORDER BY i.id", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	invitations := []Invitation{}
+	for rows.Next() {
+		var i Invitation
+		if err := rows.Scan(&i.Id, &i.ListId, &i.ListName, &i.Username, &i.Role, &i.InvitedBy, &i.CreatedAt); err != nil {
+			return nil, err
+		}
+		invitations = append(invitations, i)
+	}
+	return invitations, rows.Err()
+}
+
+func (d *DbTodoStore) AcceptInvitation(ctx context.Context, userId, invitationId int) (List, error) {
+	log.Info(fmt.Sprintf("User %d accepting invitation %d", userId, invitationId))
+
+	var list List
+	err := d.WithTx(ctx, func(tx *sql.Tx) error {
+		var role Role
+		err := tx.QueryRowContext(ctx, "DELETE FROM list_invitations WHERE id=? AND user_id=? RETURNING list_id, role", invitationId, userId).Scan(&list.Id, &role)
+		if errors.Is(err, sql.ErrNoRows) {
+			return errors.Wrapf(ErrInvitationNotFound, "Id %d", invitationId)
+		}
+		if err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, "INSERT INTO list_members(list_id, user_id, role) VALUES(?,?,?)", list.Id, userId, role); err != nil {
+			return err
+		}
+		list, err = memberListTx(ctx, tx, list.Id, userId)
+		return err
+	})
+	if err != nil {
+		log.Errorf("Error: %s", err)
+		return List{}, err
+	}
+	return list, nil
+}
+
+func (d *DbTodoStore) CancelInvitation(ctx context.Context, listId, invitationId int) error {
+	log.Info(fmt.Sprintf("Cancelling invitation %d to list %d", invitationId, listId))
+
+	return d.WithTx(ctx, func(tx *sql.Tx) error {
+		result, err := tx.ExecContext(ctx, "DELETE FROM list_invitations WHERE id=? AND list_id=?", invitationId, listId)
+		if err != nil {
+			return err
+		}
+		return mustAffect(result, ErrInvitationNotFound, invitationId)
+	})
+}
+
+func (d *DbTodoStore) DeclineInvitation(ctx context.Context, userId, invitationId int) error {
+	log.Info(fmt.Sprintf("User %d declining invitation %d", userId, invitationId))
+
+	return d.WithTx(ctx, func(tx *sql.Tx) error {
+		result, err := tx.ExecContext(ctx, "DELETE FROM list_invitations WHERE id=? AND user_id=?", invitationId, userId)
+		if err != nil {
+			return err
+		}
+		return mustAffect(result, ErrInvitationNotFound, invitationId)
+	})
+}
+
+// mustAffect returns notFound for the id when a write changed no rows.
+func mustAffect(result sql.Result, notFound error, id int) error {
+	if n, err := result.RowsAffected(); err != nil || n == 0 {
+		return errors.Wrapf(notFound, "Id %d", id)
+	}
+	return nil
+}
+
+// memoryInvitation is how a MemoryTodoStore keeps an invitation, by user id.
+type memoryInvitation struct {
+	Id        int
+	ListId    int
+	UserId    int
+	Role      Role
+	InvitedBy int
+	CreatedAt Timestamp
+}
+
+func (m *MemoryTodoStore) CreateList(ctx context.Context, userId int, name string) (List, error) {
+	log.Info(fmt.Sprintf("Creating list %q for user %d", name, userId))
+
+	var list List
+	err := m.write(func() error {
+		list = List{Id: m.nextListId, Name: name, CreatedAt: NewTimestamp(time.Now())}
+		m.nextListId++
+		m.lists[list.Id] = list
+		m.members[list.Id] = map[int]Role{userId: RoleOwner}
+		return nil
+	})
+	if err != nil {
+		return List{}, err
+	}
+	list.Role = RoleOwner
+	return list, nil
+}
+
+func (m *MemoryTodoStore) Lists(ctx context.Context, userId int) ([]List, error) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	lists := []List{}
+	for id, list := range m.lists {
+		if role, ok := m.members[id][userId]; ok {
+			list.Role = role
+			lists = append(lists, list)
+		}
+	}
+	sort.Slice(lists, func(i, j int) bool {
+		return lists[i].Id < lists[j].Id
+	})
+	return lists, nil
+}
+
+func (m *MemoryTodoStore) MemberList(ctx context.Context, listId, userId int) (List, error) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	return m.memberList(listId, userId)
+}
+
+// memberList returns a list with the user's role. The lock must be held.
+func (m *MemoryTodoStore) memberList(listId, userId int) (List, error) {
+	role, ok := m.members[listId][userId]
+	if !ok {
+		return List{}, errors.Wrapf(ErrListNotFound, "Id %d", listId)
+	}
+	list := m.lists[listId]
+	list.Role = role
+	return list, nil
+}
+
+func (m *MemoryTodoStore) RenameList(ctx context.Context, listId int, name string) error {
+	log.Info(fmt.Sprintf("Renaming list %d to %q", listId, name))
+
+	return m.write(func() error {
+		list, ok := m.lists[listId]
+		if !ok {
+			return errors.Wrapf(ErrListNotFound, "Id %d", listId)
+		}
+		list.Name = name
+		m.lists[listId] = list
+		return nil
+	})
+}
+
+func (m *MemoryTodoStore) DeleteList(ctx context.Context, listId int) error {
+	log.Info(fmt.Sprintf("Deleting list %d", listId))
+
+	return m.write(func() error {
+		if _, ok := m.lists[listId]; !ok {
+			return errors.Wrapf(ErrListNotFound, "Id %d", listId)
+		}
+		for id := range m.todos {
+			if m.todoLists[id] == listId {
+				return errors.Wrapf(ErrListNotEmpty, "Id %d", listId)
+			}
+		}
+		for id := range m.trash {
+			if m.todoLists[id] == listId {
+				return errors.Wrapf(ErrListNotEmpty, "Id %d", listId)
+			}
+		}
+		for id, invitation := range m.invitations {
+			if invitation.ListId == listId {
+				delete(m.invitations, id)
+			}
+		}
+		for id, section := range m.sections {
+			if section.List == listId {
+				delete(m.sections, id)
+			}
+		}
+		delete(m.members, listId)
+		delete(m.lists, listId)
+		return nil
+	})
+}
+
+func (m *MemoryTodoStore) Members(ctx context.Context, listId int) ([]Member, error) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	members := []Member{}
+	for userId, role := range m.members[listId] {
+		members = append(members, Member{UserId: userId, Username: m.users[userId].Username, Role: role})
+	}
+	sort.Slice(members, func(i, j int) bool {
+		return members[i].UserId < members[j].UserId
+	})
+	return members, nil
+}
+
+func (m *MemoryTodoStore) SetRole(ctx context.Context, listId, userId int, role Role) error {
+	log.Info(fmt.Sprintf("Making user %d %s of list %d", userId, role, listId))
+
+	return m.write(func() error {
+		if err := m.keepOwner(listId, userId, role); err != nil {
+			return err
+		}
+		m.members[listId][userId] = role
+		return nil
+	})
+}
+
+func (m *MemoryTodoStore) RemoveMember(ctx context.Context, listId, userId int) error {
+	log.Info(fmt.Sprintf("Removing user %d from list %d", userId, listId))
+
+	return m.write(func() error {
+		if err := m.keepOwner(listId, userId, ""); err != nil {
+			return err
+		}
+		delete(m.members[listId], userId)
+		return nil
+	})
+}
+
+// keepOwner is keepOwnerTx for a MemoryTodoStore. The lock must be held.
+func (m *MemoryTodoStore) keepOwner(listId, userId int, role Role) error {
+	current, ok := m.members[listId][userId]
+	if !ok {
+		return errors.Wrapf(ErrMemberNotFound, "user %d in list %d", userId, listId)
+	}
+	owners := 0
+	for _, r := range m.members[listId] {
+		if r == RoleOwner {
+			owners++
+		}
+	}
+	if current == RoleOwner && role != RoleOwner && owners == 1 {
+		return errors.Wrapf(ErrLastOwner, "user %d is the only owner of list %d", userId, listId)
+	}
+	return nil
+}
+
+func (m *MemoryTodoStore) Invite(ctx context.Context, listId int, username string, role Role, invitedBy int) (Invitation, error) {
+	log.Info(fmt.Sprintf("Inviting %s to list %d as %s", username, listId, role))
+
+	var invitation Invitation
+	err := m.write(func() error {
+		var user User
+		for _, u := range m.users {
+			if strings.EqualFold(u.Username, username) {
+				user = u.User
+			}
+		}
+		if user.Id == 0 {
+			return errors.Wrapf(ErrUserNotFound, "%q", username)
+		}
+		_, taken := m.members[listId][user.Id]
+		for _, i := range m.invitations {
+			taken = taken || i.ListId == listId && i.UserId == user.Id
+		}
+		if taken {
+			return errors.Wrapf(ErrAlreadyMember, "%q in list %d", username, listId)
+		}
+
+		i := memoryInvitation{Id: m.nextInvitationId, ListId: listId, UserId: user.Id, Role: role, InvitedBy: invitedBy, CreatedAt: NewTimestamp(time.Now())}
+		m.nextInvitationId++
+		m.invitations[i.Id] = i
+		invitation = m.invitation(i)
+		return nil
+	})
+	if err != nil {
+		return Invitation{}, err
+	}
+	return invitation, nil
+}
+
+// invitation fills in the names of an invitation. The lock must be held.
+func (m *MemoryTodoStore) invitation(i memoryInvitation) Invitation {
+	return Invitation{
+		Id:        i.Id,
+		ListId:    i.ListId,
+		ListName:  m.lists[i.ListId].Name,
+		Username:  m.users[i.UserId].Username,
+		Role:      i.Role,
+		InvitedBy: m.users[i.InvitedBy].Username,
+		CreatedAt: i.CreatedAt,
+	}
+}
+
+func (m *MemoryTodoStore) ListInvitations(ctx context.Context, listId int) ([]Invitation, error) {
+	return m.invitationsWhere(func(i memoryInvitation) bool { return i.ListId == listId }), nil
+}
+
+func (m *MemoryTodoStore) UserInvitations(ctx context.Context, userId int) ([]Invitation, error) {
+	return m.invitationsWhere(func(i memoryInvitation) bool { return i.UserId == userId }), nil
+}
+
+// invitationsWhere returns the invitations matching a condition, oldest
+// first.
+func (m *MemoryTodoStore) invitationsWhere(matches func(memoryInvitation) bool) []Invitation {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	invitations := []Invitation{}
+	for _, i := range m.invitations {
+		if matches(i) {
+			invitations = append(invitations, m.invitation(i))
+		}
+	}
+	sort.Slice(invitations, func(i, j int) bool {
+		return invitations[i].Id < invitations[j].Id
+	})
+	return invitations
+}
+
+func (m *MemoryTodoStore) AcceptInvitation(ctx context.Context, userId, invitationId int) (List, error) {
+	log.Info(fmt.Sprintf("User %d accepting invitation %d", userId, invitationId))
+
+	var list List
+	err := m.write(func() (err error) {
+		i, ok := m.invitations[invitationId]
+		if !ok || i.UserId != userId {
+			return errors.Wrapf(ErrInvitationNotFound, "Id %d", invitationId)
+		}
+		delete(m.invitations, invitationId)
+		m.members[i.ListId][userId] = i.Role
+		list, err = m.memberList(i.ListId, userId)
+		return err
+	})
+	if err != nil {
+		return List{}, err
+	}
+	return list, nil
+}
+
+func (m *MemoryTodoStore) CancelInvitation(ctx context.Context, listId, invitationId int) error {
+	log.Info(fmt.Sprintf("Cancelling invitation %d to list %d", invitationId, listId))
+
+	return m.deleteInvitation(invitationId, func(i memoryInvitation) bool { return i.ListId == listId })
+}
+
+func (m *MemoryTodoStore) DeclineInvitation(ctx context.Context, userId, invitationId int) error {
+	log.Info(fmt.Sprintf("User %d declining invitation %d", userId, invitationId))
+
+	return m.deleteInvitation(invitationId, func(i memoryInvitation) bool { return i.UserId == userId })
+}
+
+func (m *MemoryTodoStore) deleteInvitation(invitationId int, matches func(memoryInvitation) bool) error {
+	return m.write(func() error {
+		i, ok := m.invitations[invitationId]
+		if !ok || !matches(i) {
+			return errors.Wrapf(ErrInvitationNotFound, "Id %d", invitationId)
+		}
+		delete(m.invitations, invitationId)
+		return nil
+	})
+}
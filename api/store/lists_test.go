@@ -0,0 +1,198 @@
+package store_test
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/mcadenas-bjss/go-do-it/store"
+)
+
+func TestLists(t *testing.T) {
+	ctx := context.Background()
+
+	for name, s := range newStores(t) {
+		users, lists := s.(store.UserStore), s.(store.ListStore)
+		t.Run(name, func(t *testing.T) {
+			alice, _ := users.CreateUser(ctx, "alice", []byte("hash"))
+			bob, _ := users.CreateUser(ctx, "bob", []byte("hash"))
+			carol, _ := users.CreateUser(ctx, "carol", []byte("hash"))
+			asAlice, asBob := store.WithOwner(ctx, alice.Id), store.WithOwner(ctx, bob.Id)
+
+			sprint, err := lists.CreateList(ctx, alice.Id, "Sprint chores")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if sprint.Role != store.RoleOwner {
+				t.Errorf("got %+v want alice to own the list", sprint)
+			}
+
+			t.Run("invites members", func(t *testing.T) {
+				if _, err := lists.Invite(ctx, sprint.Id, "dave", store.RoleEditor, alice.Id); !errors.Is(err, store.ErrUserNotFound) {
+					t.Errorf("got %v inviting an unknown user", err)
+				}
+				if _, err := lists.Invite(ctx, sprint.Id, "alice", store.RoleEditor, alice.Id); !errors.Is(err, store.ErrAlreadyMember) {
+					t.Errorf("got %v inviting a member", err)
+				}
+
+				invitation, err := lists.Invite(ctx, sprint.Id, "Bob", store.RoleEditor, alice.Id)
+				if err != nil {
+					t.Fatal(err)
+				}
+				want := store.Invitation{Id: invitation.Id, ListId: sprint.Id, ListName: "Sprint chores", Username: "bob", Role: store.RoleEditor, InvitedBy: "alice", CreatedAt: invitation.CreatedAt}
+				if invitation != want {
+					t.Errorf("got %+v want %+v", invitation, want)
+				}
+				if _, err := lists.Invite(ctx, sprint.Id, "bob", store.RoleViewer, alice.Id); !errors.Is(err, store.ErrAlreadyMember) {
+					t.Errorf("got %v inviting bob twice", err)
+				}
+				if pending, _ := lists.UserInvitations(ctx, bob.Id); len(pending) != 1 || pending[0] != want {
+					t.Errorf("got %+v want bob's invitation", pending)
+				}
+
+				if _, err := lists.AcceptInvitation(ctx, carol.Id, invitation.Id); !errors.Is(err, store.ErrInvitationNotFound) {
+					t.Errorf("got %v accepting someone else's invitation", err)
+				}
+				list, err := lists.AcceptInvitation(ctx, bob.Id, invitation.Id)
+				if err != nil || list.Id != sprint.Id || list.Role != store.RoleEditor {
+					t.Errorf("got %+v, %v", list, err)
+				}
+				if pending, _ := lists.ListInvitations(ctx, sprint.Id); len(pending) != 0 {
+					t.Errorf("got %+v want the invitation used up", pending)
+				}
+
+				declined, _ := lists.Invite(ctx, sprint.Id, "carol", store.RoleViewer, alice.Id)
+				if err := lists.CancelInvitation(ctx, sprint.Id+1, declined.Id); !errors.Is(err, store.ErrInvitationNotFound) {
+					t.Errorf("got %v cancelling from another list", err)
+				}
+				if err := lists.DeclineInvitation(ctx, carol.Id, declined.Id); err != nil {
+					t.Fatal(err)
+				}
+				if _, err := lists.MemberList(ctx, sprint.Id, carol.Id); !errors.Is(err, store.ErrListNotFound) {
+					t.Errorf("got %v want carol not to be a member", err)
+				}
+			})
+
+			t.Run("scopes todos by list", func(t *testing.T) {
+				milk, _ := s.Insert(asAlice, store.Todo{Description: "Buy milk"})
+				dishes, _ := s.Insert(store.WithList(asBob, sprint.Id), store.Todo{Description: "Do the dishes"})
+
+				inSprint := store.WithList(asAlice, sprint.Id)
+				if page, _ := s.List(inSprint, store.ListOptions{}); len(page.Todos) != 1 || page.Todos[0].Id != dishes.Id {
+					t.Errorf("got %+v want bob's todo in the list", page.Todos)
+				}
+				if page, _ := s.List(asAlice, store.ListOptions{}); len(page.Todos) != 1 || page.Todos[0].Id != milk.Id {
+					t.Errorf("got %+v want only alice's personal todo", page.Todos)
+				}
+				if page, _ := s.List(asBob, store.ListOptions{}); len(page.Todos) != 0 {
+					t.Errorf("got %+v want list todos kept out of bob's personal list", page.Todos)
+				}
+				if _, err := s.Toggle(inSprint, store.Ref{Id: dishes.Id}); err != nil {
+					t.Errorf("got %v toggling a todo of the list", err)
+				}
+				if _, err := s.Toggle(inSprint, store.Ref{Id: milk.Id}); !errors.Is(err, store.ErrNotFound) {
+					t.Errorf("got %v toggling a personal todo through a list", err)
+				}
+				if results, _ := s.Search(inSprint, store.SearchQuery{Query: "dishes"}); len(results) != 1 {
+					t.Errorf("got %+v searching the list", results)
+				}
+
+				events, err := s.Events(inSprint, store.EventQuery{})
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(events) != 2 || events[0].Op != store.EventCreate || events[1].Op != store.EventToggle {
+					t.Errorf("got %+v want the list's create and toggle", events)
+				}
+				for _, e := range events {
+					if e.List != sprint.Id || e.Owner != bob.Id {
+						t.Errorf("event %+v is not bob's in the list", e)
+					}
+				}
+
+				if err := lists.DeleteList(ctx, sprint.Id); !errors.Is(err, store.ErrListNotEmpty) {
+					t.Errorf("got %v deleting a list with todos", err)
+				}
+			})
+
+			t.Run("keeps an owner", func(t *testing.T) {
+				if err := lists.SetRole(ctx, sprint.Id, alice.Id, store.RoleEditor); !errors.Is(err, store.ErrLastOwner) {
+					t.Errorf("got %v demoting the only owner", err)
+				}
+				if err := lists.RemoveMember(ctx, sprint.Id, alice.Id); !errors.Is(err, store.ErrLastOwner) {
+					t.Errorf("got %v removing the only owner", err)
+				}
+				if err := lists.SetRole(ctx, sprint.Id, carol.Id, store.RoleEditor); !errors.Is(err, store.ErrMemberNotFound) {
+					t.Errorf("got %v changing the role of a non member", err)
+				}
+
+				if err := lists.SetRole(ctx, sprint.Id, bob.Id, store.RoleOwner); err != nil {
+					t.Fatal(err)
+				}
+				if err := lists.RemoveMember(ctx, sprint.Id, alice.Id); err != nil {
+					t.Fatal(err)
+				}
+				members, _ := lists.Members(ctx, sprint.Id)
+				if len(members) != 1 || members[0] != (store.Member{UserId: bob.Id, Username: "bob", Role: store.RoleOwner}) {
+					t.Errorf("got %+v want only bob", members)
+				}
+				if mine, _ := lists.Lists(ctx, alice.Id); len(mine) != 0 {
+					t.Errorf("got %+v want alice to have left", mine)
+				}
+			})
+
+			t.Run("renames and deletes lists", func(t *testing.T) {
+				empty, _ := lists.CreateList(ctx, carol.Id, "Empty")
+				lists.Invite(ctx, empty.Id, "alice", store.RoleViewer, carol.Id)
+				if err := lists.RenameList(ctx, empty.Id, "Still empty"); err != nil {
+					t.Fatal(err)
+				}
+				if mine, _ := lists.Lists(ctx, carol.Id); len(mine) != 1 || mine[0].Name != "Still empty" {
+					t.Errorf("got %+v", mine)
+				}
+				if err := lists.DeleteList(ctx, empty.Id); err != nil {
+					t.Fatal(err)
+				}
+				if pending, _ := lists.UserInvitations(ctx, alice.Id); len(pending) != 0 {
+					t.Errorf("got %+v want the invitation deleted with the list", pending)
+				}
+				if err := lists.RenameList(ctx, empty.Id, "Gone"); !errors.Is(err, store.ErrListNotFound) {
+					t.Errorf("got %v renaming a deleted list", err)
+				}
+			})
+		})
+	}
+}
+
+func TestFileStoreKeepsLists(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "todo.json")
+
+	s, err := store.NewFileTodoStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	alice, _ := s.CreateUser(ctx, "alice", []byte("hash"))
+	s.CreateUser(ctx, "bob", []byte("hash"))
+	list, _ := s.CreateList(ctx, alice.Id, "Sprint chores")
+	s.Invite(ctx, list.Id, "bob", store.RoleViewer, alice.Id)
+	s.Insert(store.WithList(store.WithOwner(ctx, alice.Id), list.Id), store.Todo{Description: "Do the dishes"})
+
+	reopened, err := store.NewFileTodoStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := reopened.MemberList(ctx, list.Id, alice.Id); err != nil || got != list {
+		t.Errorf("got %+v, %v want %+v", got, err, list)
+	}
+	if pending, _ := reopened.ListInvitations(ctx, list.Id); len(pending) != 1 || pending[0].Username != "bob" {
+		t.Errorf("got %+v want bob's invitation", pending)
+	}
+	if page, _ := reopened.List(store.WithList(ctx, list.Id), store.ListOptions{}); len(page.Todos) != 1 {
+		t.Errorf("got %+v want the todo to stay in the list", page.Todos)
+	}
+	if second, _ := reopened.CreateList(ctx, alice.Id, "Another"); second.Id == list.Id {
+		t.Errorf("got id %d again", second.Id)
+	}
+}
@@ -0,0 +1,330 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrUnknownCommand = errors.New("unknown command type")
+	ErrOverloaded     = errors.New("too many commands waiting")
+)
+
+// DefaultReadWorkers is the number of reads served in parallel when
+// StartManager is not given a positive worker count.
+const DefaultReadWorkers = 4
+
+// DefaultQueueLimit is the number of reads, and separately of writes, that
+// may wait for a worker before more are failed with ErrOverloaded.
+const DefaultQueueLimit = 1024
+
+// Result is the reply to a command: either a value or an error.
+type Result[T any] struct {
+	Value T
+	Err   error
+}
+
+// Command is anything that can be sent to the manager. Every command carries
+// its own typed reply channel, so even a command the manager does not know
+// how to serve can be failed back to the sender.
+type Command interface {
+	Fail(err error)
+}
+
+// Request holds the context, payload and reply channel shared by every
+// command. P is the payload type and R the type of a successful reply.
+type Request[P, R any] struct {
+	Ctx     context.Context
+	Payload P
+	Reply   chan Result[R]
+}
+
+func newRequest[P, R any](ctx context.Context, payload P) Request[P, R] {
+	return Request[P, R]{Ctx: ctx, Payload: payload, Reply: make(chan Result[R], 1)}
+}
+
+func (r Request[P, R]) Fail(err error) {
+	r.Reply <- Result[R]{Err: err}
+}
+
+func (r Request[P, R]) resolve(value R, err error) {
+	r.Reply <- Result[R]{Value: value, Err: err}
+}
+
+// Wait blocks until the manager replies or the request context is done.
+func (r Request[P, R]) Wait() (R, error) {
+	select {
+	case res := <-r.Reply:
+		return res.Value, res.Err
+	case <-r.Ctx.Done():
+		var zero R
+		return zero, r.Ctx.Err()
+	}
+}
+
+type GetCommand struct{ Request[int, Todo] }
+type GetAllCommand struct{ Request[ListOptions, Page] }
+type InsertCommand struct{ Request[Todo, Todo] }
+type UpdateCommand struct{ Request[Todo, bool] }
+type DeleteCommand struct{ Request[Ref, bool] }
+type ToggleCommand struct{ Request[Ref, bool] }
+type PatchCommand struct{ Request[PatchTodo, Todo] }
+type MoveCommand struct{ Request[MoveTodo, Todo] }
+type BatchCommand struct{ Request[Batch, []OpResult] }
+type CompleteAllCommand struct{ Request[struct{}, int] }
+type DeleteCompletedCommand struct{ Request[struct{}, int] }
+type TrashCommand struct {
+	Request[struct{}, []TrashedTodo]
+}
+type RestoreCommand struct{ Request[Ref, Todo] }
+type PurgeCommand struct{ Request[time.Time, int] }
+type HistoryCommand struct{ Request[int, []Event] }
+type EventsCommand struct{ Request[EventQuery, []Event] }
+type SearchCommand struct {
+	Request[SearchQuery, []SearchResult]
+}
+
+// readCommand is implemented by commands that never modify the store and can
+// therefore be served concurrently.
+type readCommand interface {
+	Command
+	readOnly()
+}
+
+func (GetCommand) readOnly()     {}
+func (GetAllCommand) readOnly()  {}
+func (SearchCommand) readOnly()  {}
+func (TrashCommand) readOnly()   {}
+func (HistoryCommand) readOnly() {}
+func (EventsCommand) readOnly()  {}
+
+func NewGetCommand(ctx context.Context, id int) GetCommand {
+	return GetCommand{newRequest[int, Todo](ctx, id)}
+}
+
+func NewGetAllCommand(ctx context.Context, opts ListOptions) GetAllCommand {
+	return GetAllCommand{newRequest[ListOptions, Page](ctx, opts)}
+}
+
+func NewInsertCommand(ctx context.Context, todo Todo) InsertCommand {
+	return InsertCommand{newRequest[Todo, Todo](ctx, todo)}
+}
+
+func NewUpdateCommand(ctx context.Context, todo Todo) UpdateCommand {
+	return UpdateCommand{newRequest[Todo, bool](ctx, todo)}
+}
+
+func NewDeleteCommand(ctx context.Context, ref Ref) DeleteCommand {
+	return DeleteCommand{newRequest[Ref, bool](ctx, ref)}
+}
+
+func NewToggleCommand(ctx context.Context, ref Ref) ToggleCommand {
+	return ToggleCommand{newRequest[Ref, bool](ctx, ref)}
+}
+
+func NewPatchCommand(ctx context.Context, ref Ref, patch Patch) PatchCommand {
+	return PatchCommand{newRequest[PatchTodo, Todo](ctx, PatchTodo{Ref: ref, Patch: patch})}
+}
+
+func NewMoveCommand(ctx context.Context, ref Ref, move Move) MoveCommand {
+	return MoveCommand{newRequest[MoveTodo, Todo](ctx, MoveTodo{Ref: ref, Move: move})}
+}
+
+func NewBatchCommand(ctx context.Context, batch Batch) BatchCommand {
+	return BatchCommand{newRequest[Batch, []OpResult](ctx, batch)}
+}
+
+func NewCompleteAllCommand(ctx context.Context) CompleteAllCommand {
+	return CompleteAllCommand{newRequest[struct{}, int](ctx, struct{}{})}
+}
+
+func NewDeleteCompletedCommand(ctx context.Context) DeleteCompletedCommand {
+	return DeleteCompletedCommand{newRequest[struct{}, int](ctx, struct{}{})}
+}
+
+func NewTrashCommand(ctx context.Context) TrashCommand {
+	return TrashCommand{newRequest[struct{}, []TrashedTodo](ctx, struct{}{})}
+}
+
+func NewRestoreCommand(ctx context.Context, ref Ref) RestoreCommand {
+	return RestoreCommand{newRequest[Ref, Todo](ctx, ref)}
+}
+
+// NewPurgeCommand purges todos deleted before the given time.
+func NewPurgeCommand(ctx context.Context, before time.Time) PurgeCommand {
+	return PurgeCommand{newRequest[time.Time, int](ctx, before)}
+}
+
+func NewHistoryCommand(ctx context.Context, id int) HistoryCommand {
+	return HistoryCommand{newRequest[int, []Event](ctx, id)}
+}
+
+func NewEventsCommand(ctx context.Context, q EventQuery) EventsCommand {
+	return EventsCommand{newRequest[EventQuery, []Event](ctx, q)}
+}
+
+func NewSearchCommand(ctx context.Context, q SearchQuery) SearchCommand {
+	return SearchCommand{newRequest[SearchQuery, []SearchResult](ctx, q)}
+}
+
+// ManagerOption configures optional StartManager settings.
+type ManagerOption func(*managerConfig)
+
+type managerConfig struct {
+	hub        *Hub
+	queueLimit int
+}
+
+// WithHub publishes the events of every write to h once it has been applied.
+func WithHub(h *Hub) ManagerOption {
+	return func(c *managerConfig) {
+		c.hub = h
+	}
+}
+
+// WithQueueLimit sets how many reads, and how many writes, may wait for a
+// worker. Once either queue is full its commands fail with ErrOverloaded.
+func WithQueueLimit(n int) ManagerOption {
+	return func(c *managerConfig) {
+		c.queueLimit = n
+	}
+}
+
+// StartManager starts the goroutines that serve commands against the given
+// store and returns the channel to send them on. Reads are served by up to
+// readers goroutines in parallel, writes are applied one at a time in the
+// order they were received.
+func StartManager(s TodoStore, readers int, opts ...ManagerOption) chan<- Command {
+	config := managerConfig{queueLimit: DefaultQueueLimit}
+	for _, opt := range opts {
+		opt(&config)
+	}
+	if readers < 1 {
+		readers = DefaultReadWorkers
+	}
+
+	cmds := make(chan Command)
+	reads := make(chan Command)
+	writes := make(chan Command)
+
+	for i := 0; i < readers; i++ {
+		go func() {
+			for cmd := range reads {
+				serve(s, cmd)
+			}
+		}()
+	}
+	go func() {
+		var published int
+		if config.hub != nil {
+			// Only events written from now on are published.
+			var err error
+			if published, err = s.LastEventId(context.Background()); err != nil {
+				log.Error(fmt.Sprintf("Reading the last event id failed: %s", err))
+			}
+		}
+		for cmd := range writes {
+			serve(s, cmd)
+			if config.hub != nil {
+				published = publishAfter(context.Background(), s, config.hub, published)
+			}
+		}
+	}()
+
+	// The dispatcher queues commands until a worker takes them, so neither
+	// busy readers nor a slow write keep it from taking the next command.
+	// Commands that find their queue full are failed rather than queued.
+	go func() {
+		var queuedReads, queuedWrites []Command
+		in := cmds
+		for in != nil || len(queuedReads) > 0 || len(queuedWrites) > 0 {
+			var toReads, toWrites chan<- Command
+			var nextRead, nextWrite Command
+			if len(queuedReads) > 0 {
+				toReads, nextRead = reads, queuedReads[0]
+			}
+			if len(queuedWrites) > 0 {
+				toWrites, nextWrite = writes, queuedWrites[0]
+			}
+
+			select {
+			case cmd, ok := <-in:
+				switch {
+				case !ok:
+					in = nil
+				case isRead(cmd):
+					queuedReads = enqueue(queuedReads, cmd, config.queueLimit)
+				default:
+					queuedWrites = enqueue(queuedWrites, cmd, config.queueLimit)
+				}
+			case toReads <- nextRead:
+				queuedReads = queuedReads[1:]
+			case toWrites <- nextWrite:
+				queuedWrites = queuedWrites[1:]
+			}
+		}
+		close(reads)
+		close(writes)
+	}()
+	return cmds
+}
+
+// enqueue appends cmd to queue, or fails it when the queue already holds
+// limit commands.
+func enqueue(queue []Command, cmd Command, limit int) []Command {
+	if len(queue) >= limit {
+		cmd.Fail(errors.Wrapf(ErrOverloaded, "%d queued", len(queue)))
+		return queue
+	}
+	return append(queue, cmd)
+}
+
+func isRead(cmd Command) bool {
+	_, ok := cmd.(readCommand)
+	return ok
+}
+
+func serve(s TodoStore, cmd Command) {
+	switch c := cmd.(type) {
+	case GetCommand:
+		c.resolve(s.Get(c.Ctx, c.Payload))
+	case GetAllCommand:
+		c.resolve(s.List(c.Ctx, c.Payload))
+	case InsertCommand:
+		c.resolve(s.Insert(c.Ctx, c.Payload))
+	case UpdateCommand:
+		c.resolve(s.Update(c.Ctx, c.Payload))
+	case DeleteCommand:
+		c.resolve(s.Delete(c.Ctx, c.Payload))
+	case ToggleCommand:
+		c.resolve(s.Toggle(c.Ctx, c.Payload))
+	case PatchCommand:
+		c.resolve(s.Patch(c.Ctx, c.Payload.Ref, c.Payload.Patch))
+	case MoveCommand:
+		c.resolve(s.Move(c.Ctx, c.Payload.Ref, c.Payload.Move))
+	case BatchCommand:
+		c.resolve(s.Batch(c.Ctx, c.Payload))
+	case CompleteAllCommand:
+		c.resolve(s.CompleteAll(c.Ctx))
+	case DeleteCompletedCommand:
+		c.resolve(s.DeleteCompleted(c.Ctx))
+	case TrashCommand:
+		c.resolve(s.Trash(c.Ctx))
+	case RestoreCommand:
+		c.resolve(s.Restore(c.Ctx, c.Payload))
+	case PurgeCommand:
+		c.resolve(s.Purge(c.Ctx, c.Payload))
+	case HistoryCommand:
+		c.resolve(s.History(c.Ctx, c.Payload))
+	case EventsCommand:
+		c.resolve(s.Events(c.Ctx, c.Payload))
+	case SearchCommand:
+		c.resolve(s.Search(c.Ctx, c.Payload))
+	default:
+		log.Error(fmt.Sprintf("unknown command type %T", cmd))
+		cmd.Fail(errors.Wrapf(ErrUnknownCommand, "%T", cmd))
+	}
+}
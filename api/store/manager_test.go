@@ -0,0 +1,293 @@
+package store_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/mcadenas-bjss/go-do-it/store"
+)
+
+type unknownCommand struct {
+	store.Request[string, string]
+}
+
+// slowStore simulates a backend whose calls take a fixed amount of time, such
+// as sqlite scanning a large table.
+type slowStore struct {
+	delay   time.Duration
+	release chan struct{}
+}
+
+func (s *slowStore) Get(ctx context.Context, id int) (store.Todo, error) {
+	time.Sleep(s.delay)
+	return store.Todo{Id: id}, nil
+}
+
+func (s *slowStore) List(ctx context.Context, opts store.ListOptions) (store.Page, error) {
+	time.Sleep(s.delay)
+	return store.Page{}, nil
+}
+
+func (s *slowStore) LastEventId(ctx context.Context) (int, error) {
+	time.Sleep(s.delay)
+	return 0, nil
+}
+
+func (s *slowStore) Search(ctx context.Context, q store.SearchQuery) ([]store.SearchResult, error) {
+	time.Sleep(s.delay)
+	return []store.SearchResult{}, nil
+}
+
+func (s *slowStore) Insert(ctx context.Context, todo store.Todo) (store.Todo, error) {
+	id, err := s.write()
+	return store.Todo{Id: id}, err
+}
+
+func (s *slowStore) Update(ctx context.Context, todo store.Todo) (bool, error) {
+	_, err := s.write()
+	return err == nil, err
+}
+
+func (s *slowStore) Delete(ctx context.Context, ref store.Ref) (bool, error) {
+	_, err := s.write()
+	return err == nil, err
+}
+
+func (s *slowStore) Toggle(ctx context.Context, ref store.Ref) (bool, error) {
+	_, err := s.write()
+	return err == nil, err
+}
+
+func (s *slowStore) Patch(ctx context.Context, ref store.Ref, patch store.Patch) (store.Todo, error) {
+	_, err := s.write()
+	return store.Todo{Id: ref.Id}, err
+}
+
+func (s *slowStore) Move(ctx context.Context, ref store.Ref, move store.Move) (store.Todo, error) {
+	_, err := s.write()
+	return store.Todo{Id: ref.Id}, err
+}
+
+func (s *slowStore) Batch(ctx context.Context, batch store.Batch) ([]store.OpResult, error) {
+	_, err := s.write()
+	return make([]store.OpResult, len(batch.Ops)), err
+}
+
+func (s *slowStore) CompleteAll(ctx context.Context) (int, error) {
+	return s.write()
+}
+
+func (s *slowStore) DeleteCompleted(ctx context.Context) (int, error) {
+	return s.write()
+}
+
+func (s *slowStore) Trash(ctx context.Context) ([]store.TrashedTodo, error) {
+	time.Sleep(s.delay)
+	return []store.TrashedTodo{}, nil
+}
+
+func (s *slowStore) Restore(ctx context.Context, ref store.Ref) (store.Todo, error) {
+	_, err := s.write()
+	return store.Todo{Id: ref.Id}, err
+}
+
+func (s *slowStore) Purge(ctx context.Context, before time.Time) (int, error) {
+	return s.write()
+}
+
+func (s *slowStore) History(ctx context.Context, id int) ([]store.Event, error) {
+	time.Sleep(s.delay)
+	return []store.Event{}, nil
+}
+
+func (s *slowStore) Events(ctx context.Context, q store.EventQuery) ([]store.Event, error) {
+	time.Sleep(s.delay)
+	return []store.Event{}, nil
+}
+
+func (s *slowStore) write() (int, error) {
+	if s.release != nil {
+		<-s.release
+	}
+	time.Sleep(s.delay)
+	return 1, nil
+}
+
+func TestManager(t *testing.T) {
+	ctx := context.Background()
+	cmds := store.StartManager(store.NewMemoryTodoStore(store.Todo{Id: 1, Description: "Buy milk"}), 2)
+
+	t.Run("replies with a typed value", func(t *testing.T) {
+		cmd := store.NewGetCommand(ctx, 1)
+		cmds <- cmd
+
+		todo, err := cmd.Wait()
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertTodo(t, todo, store.Todo{Id: 1, Description: "Buy milk", Revision: 1})
+	})
+
+	t.Run("fails unknown commands instead of exiting", func(t *testing.T) {
+		cmd := unknownCommand{store.Request[string, string]{Ctx: ctx, Reply: make(chan store.Result[string], 1)}}
+		cmds <- cmd
+
+		if _, err := cmd.Wait(); !errors.Is(err, store.ErrUnknownCommand) {
+			t.Errorf("got %v want %v", err, store.ErrUnknownCommand)
+		}
+	})
+
+	t.Run("serves reads while a write is in progress", func(t *testing.T) {
+		slow := &slowStore{release: make(chan struct{})}
+		cmds := store.StartManager(slow, 2)
+		defer close(slow.release)
+
+		write := store.NewToggleCommand(ctx, store.Ref{Id: 1})
+		cmds <- write
+
+		readCtx, cancel := context.WithTimeout(ctx, time.Second)
+		defer cancel()
+		read := store.NewGetCommand(readCtx, 1)
+		cmds <- read
+
+		if _, err := read.Wait(); err != nil {
+			t.Errorf("read blocked behind write: %v", err)
+		}
+	})
+
+	t.Run("serves reads while writes queue up", func(t *testing.T) {
+		slow := &slowStore{release: make(chan struct{})}
+		cmds := store.StartManager(slow, 2)
+		defer close(slow.release)
+
+		for i := 0; i < 10; i++ {
+			select {
+			case cmds <- store.NewToggleCommand(ctx, store.Ref{Id: 1}):
+			case <-time.After(time.Second):
+				t.Fatalf("write %d stalled the dispatcher", i)
+			}
+		}
+
+		readCtx, cancel := context.WithTimeout(ctx, time.Second)
+		defer cancel()
+		read := store.NewGetCommand(readCtx, 1)
+		cmds <- read
+
+		if _, err := read.Wait(); err != nil {
+			t.Errorf("read blocked behind queued writes: %v", err)
+		}
+	})
+
+	t.Run("fails commands once the queue is full", func(t *testing.T) {
+		slow := &slowStore{release: make(chan struct{})}
+		cmds := store.StartManager(slow, 2, store.WithQueueLimit(2))
+		defer close(slow.release)
+
+		// At most one write is in progress and two are queued, so one of
+		// the four cannot be.
+		errs := make(chan error, 4)
+		for i := 0; i < 4; i++ {
+			write := store.NewToggleCommand(ctx, store.Ref{Id: 1})
+			cmds <- write
+			go func() {
+				_, err := write.Wait()
+				errs <- err
+			}()
+		}
+		select {
+		case err := <-errs:
+			if !errors.Is(err, store.ErrOverloaded) {
+				t.Errorf("got %v want %v", err, store.ErrOverloaded)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("want a write failed instead of queued")
+		}
+
+		readCtx, cancel := context.WithTimeout(ctx, time.Second)
+		defer cancel()
+		read := store.NewGetCommand(readCtx, 1)
+		cmds <- read
+		if _, err := read.Wait(); err != nil {
+			t.Errorf("read failed with the write queue full: %v", err)
+		}
+	})
+}
+
+func TestManagerPublishes(t *testing.T) {
+	ctx := context.Background()
+	s := store.NewMemoryTodoStore()
+	s.Insert(ctx, store.Todo{Description: "Buy milk"})
+
+	hub := store.NewHub()
+	cmds := store.StartManager(s, 2, store.WithHub(hub))
+	events, unsubscribe := hub.Subscribe(1)
+	defer unsubscribe()
+
+	receive := func() (store.Event, bool) {
+		select {
+		case e, ok := <-events:
+			return e, ok
+		case <-time.After(time.Second):
+			t.Fatal("timed out waiting for an event")
+			return store.Event{}, false
+		}
+	}
+
+	t.Run("publishes committed writes only", func(t *testing.T) {
+		failed := store.NewToggleCommand(ctx, store.Ref{Id: 99})
+		cmds <- failed
+		failed.Wait()
+
+		toggle := store.NewToggleCommand(ctx, store.Ref{Id: 1})
+		cmds <- toggle
+		if _, err := toggle.Wait(); err != nil {
+			t.Fatal(err)
+		}
+
+		e, _ := receive()
+		if e.Id != 2 || e.Op != store.EventToggle || e.TodoId != 1 {
+			t.Errorf("unexpected event %+v", e)
+		}
+	})
+
+	t.Run("drops subscribers that fall behind", func(t *testing.T) {
+		for i := 0; i < 2; i++ {
+			cmd := store.NewToggleCommand(ctx, store.Ref{Id: 1})
+			cmds <- cmd
+			cmd.Wait()
+		}
+
+		if e, ok := receive(); !ok || e.Id != 3 {
+			t.Fatalf("got %+v, %v want the buffered event", e, ok)
+		}
+		if _, ok := receive(); ok {
+			t.Error("expected the channel to be closed")
+		}
+	})
+}
+
+func BenchmarkManagerReads(b *testing.B) {
+	ctx := context.Background()
+
+	for _, readers := range []int{1, store.DefaultReadWorkers, 16} {
+		b.Run(fmt.Sprintf("readers=%d", readers), func(b *testing.B) {
+			cmds := store.StartManager(&slowStore{delay: 100 * time.Microsecond}, readers)
+			defer close(cmds)
+
+			b.SetParallelism(4)
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					cmd := store.NewGetAllCommand(ctx, store.ListOptions{})
+					cmds <- cmd
+					if _, err := cmd.Wait(); err != nil {
+						b.Error(err)
+					}
+				}
+			})
+		})
+	}
+}
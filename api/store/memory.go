@@ -0,0 +1,472 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// MemoryTodoStore keeps todos in a map. It is lost on restart and is meant
+// for tests and demos, and as the base of FileTodoStore.
+type MemoryTodoStore struct {
+	lock  sync.RWMutex
+	todos map[int]Todo
+	trash map[int]TrashedTodo
+	// events are never removed, so the event with id n is events[n-1].
+	events []Event
+	nextId int
+	// owners maps todo ids to the user owning them. Entries outlive purged
+	// todos so their events stay visible to the owner only.
+	owners map[int]int
+	// todoLists maps todo ids to the shared list they are in, and is kept
+	// like owners.
+	todoLists map[int]int
+
+	users       map[int]memoryUser
+	sessions    map[string]memorySession
+	tokens      map[string]memoryToken
+	nextUserId  int
+	nextTokenId int
+
+	lists            map[int]List
+	members          map[int]map[int]Role
+	invitations      map[int]memoryInvitation
+	nextListId       int
+	nextInvitationId int
+
+	sections      map[int]memorySection
+	nextSectionId int
+
+	// persist is called with the write lock held after every successful
+	// mutation.
+	persist func() error
+}
+
+func NewMemoryTodoStore(todos ...Todo) *MemoryTodoStore {
+	m := &MemoryTodoStore{
+		todos:       make(map[int]Todo),
+		trash:       make(map[int]TrashedTodo),
+		nextId:      1,
+		owners:      make(map[int]int),
+		users:       make(map[int]memoryUser),
+		sessions:    make(map[string]memorySession),
+		tokens:      make(map[string]memoryToken),
+		nextUserId:  1,
+		nextTokenId: 1,
+
+		todoLists:        make(map[int]int),
+		lists:            make(map[int]List),
+		members:          make(map[int]map[int]Role),
+		invitations:      make(map[int]memoryInvitation),
+		nextListId:       1,
+		nextInvitationId: 1,
+
+		sections:      make(map[int]memorySection),
+		nextSectionId: 1,
+	}
+	for _, todo := range todos {
+		if todo.Revision < 1 {
+			todo.Revision = 1
+		}
+		if todo.Position == "" {
+			todo.Position = legacyPosition(todo.Id)
+		}
+		m.todos[todo.Id] = todo
+		if todo.Id >= m.nextId {
+			m.nextId = todo.Id + 1
+		}
+	}
+	return m
+}
+
+func (m *MemoryTodoStore) Get(ctx context.Context, id int) (Todo, error) {
+	log.Info(fmt.Sprintf("Getting todo item: %d", id))
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	return m.current(ctx, Ref{Id: id})
+}
+
+func (m *MemoryTodoStore) List(ctx context.Context, opts ListOptions) (Page, error) {
+	log.Info(fmt.Sprintf("Getting todos %+v", opts))
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	return paginate(m.owned(ctx), opts)
+}
+
+func (m *MemoryTodoStore) Insert(ctx context.Context, todo Todo) (Todo, error) {
+	log.Info("Inserting todo", todo)
+
+	err := m.write(func() error {
+		todo = m.insert(ctx, todo)
+		return nil
+	})
+	if err != nil {
+		return Todo{}, err
+	}
+	return todo, nil
+}
+
+func (m *MemoryTodoStore) Update(ctx context.Context, todo Todo) (bool, error) {
+	log.Info(fmt.Sprintf("Updating todo %+v", todo))
+
+	err := m.write(func() error {
+		_, err := m.update(ctx, Ref{Id: todo.Id, Revision: todo.Revision}, todo)
+		return err
+	})
+	return err == nil, err
+}
+
+func (m *MemoryTodoStore) Delete(ctx context.Context, ref Ref) (bool, error) {
+	log.Info(fmt.Sprintf("Deleting todo %d", ref.Id))
+
+	err := m.write(func() error {
+		return m.remove(ctx, ref)
+	})
+	return err == nil, err
+}
+
+func (m *MemoryTodoStore) Toggle(ctx context.Context, ref Ref) (bool, error) {
+	log.Info(fmt.Sprintf("Toggling complete status for todo %d", ref.Id))
+
+	err := m.write(func() error {
+		_, err := m.toggle(ctx, ref)
+		return err
+	})
+	return err == nil, err
+}
+
+func (m *MemoryTodoStore) Patch(ctx context.Context, ref Ref, patch Patch) (Todo, error) {
+	log.Info(fmt.Sprintf("Patching todo %d", ref.Id))
+
+	var patched Todo
+	err := m.write(func() error {
+		todo, err := m.current(ctx, ref)
+		if err != nil {
+			return err
+		}
+		if patched, err = patch.Apply(todo); err != nil {
+			return err
+		}
+		patched.Revision = todo.Revision + 1
+		m.todos[ref.Id] = patched
+		m.record(ctx, EventPatch, &todo, &patched)
+		return nil
+	})
+	if err != nil {
+		return Todo{}, err
+	}
+	return patched, nil
+}
+
+func (m *MemoryTodoStore) Batch(ctx context.Context, batch Batch) ([]OpResult, error) {
+	log.Info(fmt.Sprintf("Applying batch of %d operations", len(batch.Ops)))
+
+	results := make([]OpResult, len(batch.Ops))
+	err := m.write(func() error {
+		for i, op := range batch.Ops {
+			todo, err := m.apply(ctx, op)
+			if err != nil && !batch.ContinueOnError {
+				return &BatchError{Index: i, Err: err}
+			}
+			results[i] = OpResult{Todo: todo, Err: err}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+func (m *MemoryTodoStore) CompleteAll(ctx context.Context) (int, error) {
+	log.Info("Completing all todos")
+
+	n := 0
+	err := m.write(func() error {
+		for _, todo := range m.owned(ctx) {
+			if !todo.Completed {
+				completed := todo
+				completed.Completed = true
+				completed.Revision++
+				m.todos[todo.Id] = completed
+				m.record(ctx, EventComplete, &todo, &completed)
+				n++
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+func (m *MemoryTodoStore) DeleteCompleted(ctx context.Context) (int, error) {
+	log.Info("Deleting completed todos")
+
+	n := 0
+	err := m.write(func() error {
+		for _, todo := range m.owned(ctx) {
+			if todo.Completed {
+				m.moveToTrash(ctx, todo)
+				n++
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+func (m *MemoryTodoStore) Trash(ctx context.Context) ([]TrashedTodo, error) {
+	log.Info("Getting trash")
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	trash := []TrashedTodo{}
+	for _, trashed := range m.sortedTrash() {
+		if m.owns(ctx, trashed.Id) {
+			trash = append(trash, trashed)
+		}
+	}
+	return trash, nil
+}
+
+func (m *MemoryTodoStore) Restore(ctx context.Context, ref Ref) (Todo, error) {
+	log.Info(fmt.Sprintf("Restoring todo %d", ref.Id))
+
+	var todo Todo
+	err := m.write(func() error {
+		trashed, ok := m.trash[ref.Id]
+		if !ok || !m.owns(ctx, ref.Id) {
+			return errors.Wrapf(ErrNotFound, "Id %d is not in the trash", ref.Id)
+		}
+		if ref.Revision != 0 && ref.Revision != trashed.Revision {
+			return errors.Wrapf(ErrRevisionMismatch, "Id %d is at revision %d, not %d", ref.Id, trashed.Revision, ref.Revision)
+		}
+
+		todo = trashed.Todo
+		todo.Revision++
+		delete(m.trash, ref.Id)
+		m.todos[ref.Id] = todo
+		m.record(ctx, EventRestore, nil, &todo)
+		return nil
+	})
+	if err != nil {
+		return Todo{}, err
+	}
+	return todo, nil
+}
+
+func (m *MemoryTodoStore) Purge(ctx context.Context, before time.Time) (int, error) {
+	log.Info(fmt.Sprintf("Purging todos deleted before %s", before))
+
+	n := 0
+	err := m.write(func() error {
+		for _, trashed := range m.sortedTrash() {
+			if trashed.DeletedAt.Before(before) && m.owns(ctx, trashed.Id) {
+				delete(m.trash, trashed.Id)
+				m.record(ctx, EventPurge, &trashed.Todo, nil)
+				n++
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// write runs fn with the write lock held and saves the result. When fn or the
+// save fails the store is put back as it was.
+func (m *MemoryTodoStore) write(fn func() error) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	restore := m.snapshot()
+	err := fn()
+	if err == nil {
+		err = m.save()
+	}
+	if err != nil {
+		restore()
+	}
+	return err
+}
+
+// snapshot copies the contents of the store and returns a function putting
+// them back. The lock must be held.
+func (m *MemoryTodoStore) snapshot() (restore func()) {
+	todos, trash, events, nextId, owners := maps.Clone(m.todos), maps.Clone(m.trash), len(m.events), m.nextId, maps.Clone(m.owners)
+	users, sessions, tokens := maps.Clone(m.users), maps.Clone(m.sessions), maps.Clone(m.tokens)
+	nextUserId, nextTokenId := m.nextUserId, m.nextTokenId
+	todoLists, lists, invitations, nextListId, nextInvitationId := maps.Clone(m.todoLists), maps.Clone(m.lists), maps.Clone(m.invitations), m.nextListId, m.nextInvitationId
+	members := make(map[int]map[int]Role, len(m.members))
+	for id, roles := range m.members {
+		members[id] = maps.Clone(roles)
+	}
+	sections, nextSectionId := maps.Clone(m.sections), m.nextSectionId
+	return func() {
+		m.todos, m.trash, m.events, m.nextId, m.owners = todos, trash, m.events[:events], nextId, owners
+		m.users, m.sessions, m.tokens = users, sessions, tokens
+		m.nextUserId, m.nextTokenId = nextUserId, nextTokenId
+		m.todoLists, m.lists, m.invitations, m.nextListId, m.nextInvitationId = todoLists, lists, invitations, nextListId, nextInvitationId
+		m.members = members
+		m.sections, m.nextSectionId = sections, nextSectionId
+	}
+}
+
+// apply performs one op of a batch. The lock must be held.
+func (m *MemoryTodoStore) apply(ctx context.Context, op Op) (Todo, error) {
+	switch op.Kind {
+	case OpCreate:
+		return m.insert(ctx, op.Todo), nil
+	case OpUpdate:
+		return m.update(ctx, op.Ref, op.Todo)
+	case OpDelete:
+		return Todo{Id: op.Ref.Id}, m.remove(ctx, op.Ref)
+	case OpToggle:
+		return m.toggle(ctx, op.Ref)
+	default:
+		return Todo{}, unknownOp(op.Kind)
+	}
+}
+
+// insert, update, remove and toggle change the todos without saving them. The
+// lock must be held.
+func (m *MemoryTodoStore) insert(ctx context.Context, todo Todo) Todo {
+	todo.Id = m.nextId
+	todo.Revision = 1
+	todo.Position = m.lastPosition(ctx)
+	todo.Section = 0
+	m.nextId++
+	if owner, ok := OwnerFrom(ctx); ok {
+		m.owners[todo.Id] = owner
+	}
+	if list, ok := ListFrom(ctx); ok {
+		m.todoLists[todo.Id] = list
+	}
+	m.todos[todo.Id] = todo
+	m.record(ctx, EventCreate, nil, &todo)
+	return todo
+}
+
+func (m *MemoryTodoStore) update(ctx context.Context, ref Ref, todo Todo) (Todo, error) {
+	existing, err := m.current(ctx, ref)
+	if err != nil {
+		return Todo{}, err
+	}
+	updated := existing
+	updated.Time = todo.Time
+	updated.Description = todo.Description
+	updated.Revision++
+	m.todos[ref.Id] = updated
+	m.record(ctx, EventUpdate, &existing, &updated)
+	return updated, nil
+}
+
+func (m *MemoryTodoStore) remove(ctx context.Context, ref Ref) error {
+	todo, err := m.current(ctx, ref)
+	if err != nil {
+		return err
+	}
+	m.moveToTrash(ctx, todo)
+	return nil
+}
+
+func (m *MemoryTodoStore) moveToTrash(ctx context.Context, todo Todo) {
+	delete(m.todos, todo.Id)
+	trashed := todo
+	trashed.Revision++
+	m.trash[todo.Id] = TrashedTodo{Todo: trashed, DeletedAt: NewTimestamp(time.Now())}
+	m.record(ctx, EventDelete, &todo, nil)
+}
+
+func (m *MemoryTodoStore) toggle(ctx context.Context, ref Ref) (Todo, error) {
+	todo, err := m.current(ctx, ref)
+	if err != nil {
+		return Todo{}, err
+	}
+	toggled := todo
+	toggled.Completed = !todo.Completed
+	toggled.Revision++
+	m.todos[ref.Id] = toggled
+	m.record(ctx, EventToggle, &todo, &toggled)
+	return toggled, nil
+}
+
+// record appends an event. Events are never removed, so ids follow their
+// position. The lock must be held.
+func (m *MemoryTodoStore) record(ctx context.Context, op EventOp, before, after *Todo) {
+	e := newEvent(ctx, op, before, after)
+	e.Id = len(m.events) + 1
+	m.events = append(m.events, e)
+}
+
+// current returns the todo ref names, checking its revision and owner. The
+// lock must be held.
+func (m *MemoryTodoStore) current(ctx context.Context, ref Ref) (Todo, error) {
+	todo, ok := m.todos[ref.Id]
+	if !ok || !m.owns(ctx, ref.Id) {
+		return Todo{}, errors.Wrapf(ErrNotFound, "Id %d", ref.Id)
+	}
+	if ref.Revision != 0 && ref.Revision != todo.Revision {
+		return Todo{}, errors.Wrapf(ErrRevisionMismatch, "Id %d is at revision %d, not %d", ref.Id, todo.Revision, ref.Revision)
+	}
+	return todo, nil
+}
+
+func (m *MemoryTodoStore) sorted() []Todo {
+	todos := make([]Todo, 0, len(m.todos))
+	for _, todo := range m.todos {
+		todos = append(todos, todo)
+	}
+	sort.Slice(todos, func(i, j int) bool {
+		return todos[i].Id < todos[j].Id
+	})
+	return todos
+}
+
+// owns reports whether the todo is InScope of the context. The lock must be
+// held.
+func (m *MemoryTodoStore) owns(ctx context.Context, id int) bool {
+	return InScope(ctx, m.owners[id], m.todoLists[id])
+}
+
+// owned returns the todos the context owns in id order. The lock must be
+// held.
+func (m *MemoryTodoStore) owned(ctx context.Context) []Todo {
+	todos := []Todo{}
+	for _, todo := range m.sorted() {
+		if m.owns(ctx, todo.Id) {
+			todos = append(todos, todo)
+		}
+	}
+	return todos
+}
+
+func (m *MemoryTodoStore) sortedTrash() []TrashedTodo {
+	trash := make([]TrashedTodo, 0, len(m.trash))
+	for _, trashed := range m.trash {
+		trash = append(trash, trashed)
+	}
+	sortTrash(trash)
+	return trash
+}
+
+func (m *MemoryTodoStore) save() error {
+	if m.persist == nil {
+		return nil
+	}
+	return m.persist()
+}
@@ -0,0 +1,206 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	//go:embed "migrations/*.sql"
+	migrationFiles embed.FS
+)
+
+const createMigrationsTable string = `
+  CREATE TABLE IF NOT EXISTS schema_migrations (
+  version INTEGER NOT NULL PRIMARY KEY,
+  name TEXT NOT NULL,
+  applied_at TEXT NOT NULL
+  );`
+
+// ErrSchemaTooNew is returned when the database has been migrated by a newer
+// build than this one and we do not know how to read it.
+var ErrSchemaTooNew = errors.New("database schema is newer than this build supports")
+
+// Migration is a single schema change. Migrations are embedded from
+// migrations/<version>_<name>.sql, or listed in codeMigrations when they need
+// Go, and applied in ascending version order.
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+
+	// apply runs instead of Up for code migrations; Up then only describes
+	// the change for -migrate dry-run.
+	apply func(ctx context.Context, tx *sql.Tx) error
+}
+
+// codeMigrations are the migrations that cannot be written as plain SQL.
+var codeMigrations = []Migration{
+	{Version: 2, Name: "search_index", Up: "-- creates the todo_fts fts5 full-text index and its sync triggers", apply: createSearchIndex},
+	{Version: 3, Name: "utc_due_times", Up: "-- rewrites todo.time values as UTC RFC 3339 timestamps, clearing unparseable ones", apply: normalizeDueTimes},
+	{Version: 11, Name: "fts5_search_index", Up: "-- rebuilds a todo_fts index created with fts4 as fts5", apply: upgradeSearchIndex},
+}
+
+type MigrationStatus struct {
+	Current int
+	Latest  int
+	Pending []Migration
+}
+
+type Migrator struct {
+	db         *sql.DB
+	migrations []Migration
+}
+
+func NewMigrator(db *sql.DB) (*Migrator, error) {
+	migrations, err := loadMigrations(migrationFiles, codeMigrations...)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{db: db, migrations: migrations}, nil
+}
+
+// OpenMigrator opens the sqlite file without applying any migrations, for
+// inspecting the schema from the command line.
+func OpenMigrator(file string) (*Migrator, error) {
+	db, err := sql.Open("sqlite3", file)
+	if err != nil {
+		return nil, err
+	}
+	return NewMigrator(db)
+}
+
+func (m *Migrator) Close() {
+	m.db.Close()
+}
+
+// Status reports the applied and known schema versions without modifying
+// the database.
+func (m *Migrator) Status(ctx context.Context) (MigrationStatus, error) {
+	current, err := currentVersion(ctx, m.db)
+	if err != nil {
+		return MigrationStatus{}, err
+	}
+
+	status := MigrationStatus{Current: current}
+	for _, migration := range m.migrations {
+		status.Latest = migration.Version
+		if migration.Version > current {
+			status.Pending = append(status.Pending, migration)
+		}
+	}
+
+	if status.Current > status.Latest {
+		return status, errors.Wrapf(ErrSchemaTooNew, "database is at version %d, latest known is %d", status.Current, status.Latest)
+	}
+	return status, nil
+}
+
+// Up applies every pending migration inside a single transaction and returns
+// the migrations that were applied.
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	status, err := m.Status(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(status.Pending) == 0 {
+		return nil, nil
+	}
+
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, createMigrationsTable); err != nil {
+		return nil, errors.Wrap(err, "Creating schema_migrations failed")
+	}
+
+	for _, migration := range status.Pending {
+		log.Info(fmt.Sprintf("Applying migration %04d_%s", migration.Version, migration.Name))
+		if err := migration.run(ctx, tx); err != nil {
+			return nil, errors.Wrapf(err, "Migration %04d_%s failed", migration.Version, migration.Name)
+		}
+		if _, err := tx.ExecContext(ctx, "INSERT INTO schema_migrations VALUES(?,?,?)", migration.Version, migration.Name, time.Now().UTC().Format(time.RFC3339)); err != nil {
+			return nil, errors.Wrapf(err, "Recording migration %04d_%s failed", migration.Version, migration.Name)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return status.Pending, nil
+}
+
+func (m Migration) run(ctx context.Context, tx *sql.Tx) error {
+	if m.apply != nil {
+		return m.apply(ctx, tx)
+	}
+	_, err := tx.ExecContext(ctx, m.Up)
+	return err
+}
+
+func currentVersion(ctx context.Context, db *sql.DB) (int, error) {
+	var exists int
+	row := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM sqlite_master WHERE type='table' AND name='schema_migrations'")
+	if err := row.Scan(&exists); err != nil {
+		return 0, err
+	}
+	if exists == 0 {
+		return 0, nil
+	}
+
+	var version int
+	row = db.QueryRowContext(ctx, "SELECT COALESCE(MAX(version), 0) FROM schema_migrations")
+	if err := row.Scan(&version); err != nil {
+		return 0, err
+	}
+	return version, nil
+}
+
+func loadMigrations(fsys fs.FS, code ...Migration) ([]Migration, error) {
+	files, err := fs.Glob(fsys, "migrations/*.sql")
+	if err != nil {
+		return nil, err
+	}
+
+	migrations := append(make([]Migration, 0, len(files)+len(code)), code...)
+	for _, file := range files {
+		name := strings.TrimSuffix(path.Base(file), ".sql")
+		prefix, rest, ok := strings.Cut(name, "_")
+		if !ok {
+			return nil, fmt.Errorf("migration %s is not named <version>_<name>.sql", file)
+		}
+		version, err := strconv.Atoi(prefix)
+		if err != nil {
+			return nil, errors.Wrapf(err, "migration %s has an invalid version", file)
+		}
+		up, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return nil, err
+		}
+		migrations = append(migrations, Migration{Version: version, Name: rest, Up: string(up)})
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	for i := 1; i < len(migrations); i++ {
+		if migrations[i].Version == migrations[i-1].Version {
+			return nil, fmt.Errorf("duplicate migration version %d", migrations[i].Version)
+		}
+	}
+
+	return migrations, nil
+}
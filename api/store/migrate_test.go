@@ -0,0 +1,157 @@
+package store_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/mcadenas-bjss/go-do-it/store"
+)
+
+func TestMigrator(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("applies every migration to an empty database", func(t *testing.T) {
+		db := openTestDb(t, "file:migrate1?mode=memory&cache=shared")
+		migrator, err := store.NewMigrator(db)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		applied, err := migrator.Up(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(applied) == 0 {
+			t.Fatal("expected migrations to be applied")
+		}
+
+		status, err := migrator.Status(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if status.Current != status.Latest || len(status.Pending) != 0 {
+			t.Errorf("expected schema to be up to date, got %+v", status)
+		}
+
+		again, err := migrator.Up(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(again) != 0 {
+			t.Errorf("expected no migrations on second run, got %d", len(again))
+		}
+	})
+
+	t.Run("refuses a schema newer than the build", func(t *testing.T) {
+		db := openTestDb(t, "file:migrate2?mode=memory&cache=shared")
+		migrator, err := store.NewMigrator(db)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := migrator.Up(ctx); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := db.Exec("INSERT INTO schema_migrations VALUES(9999, 'from_the_future', '2030-01-01T00:00:00Z')"); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := migrator.Up(ctx); !errors.Is(err, store.ErrSchemaTooNew) {
+			t.Errorf("got %v want %v", err, store.ErrSchemaTooNew)
+		}
+	})
+
+	t.Run("rebuilds an fts4 search index as fts5", func(t *testing.T) {
+		db := openTestDb(t, "file:migrate4?mode=memory&cache=shared")
+		migrator, err := store.NewMigrator(db)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := migrator.Up(ctx); err != nil {
+			t.Fatal(err)
+		}
+		// Recreate the index the way builds without FTS5 used to.
+		if _, err := db.Exec(`DROP TRIGGER todo_fts_ai; DROP TRIGGER todo_fts_ad; DROP TRIGGER todo_fts_au; DROP TABLE todo_fts;
+			CREATE VIRTUAL TABLE todo_fts USING fts4(content="todo", description);
+			CREATE TRIGGER todo_fts_bd BEFORE DELETE ON todo BEGIN DELETE FROM todo_fts WHERE docid = old.id; END;
+			CREATE TRIGGER todo_fts_ai AFTER INSERT ON todo BEGIN INSERT INTO todo_fts(docid, description) VALUES (new.id, new.description); END;
+			INSERT INTO todo(description, position) VALUES ('Buy milk', '00000000V');
+			DELETE FROM schema_migrations WHERE version = 11;`); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := migrator.Up(ctx); err != nil {
+			t.Fatal(err)
+		}
+		var definition string
+		if err := db.QueryRow("SELECT sql FROM sqlite_master WHERE name = 'todo_fts'").Scan(&definition); err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(definition, "fts5") {
+			t.Errorf("want an fts5 index, got %s", definition)
+		}
+		var matches int
+		if err := db.QueryRow("SELECT COUNT(*) FROM todo_fts WHERE todo_fts MATCH 'milk'").Scan(&matches); err != nil || matches != 1 {
+			t.Errorf("got %d matches, %v want the existing todo indexed", matches, err)
+		}
+	})
+
+	t.Run("converts legacy due times to utc", func(t *testing.T) {
+		db := openTestDb(t, "file:migrate3?mode=memory&cache=shared")
+		if _, err := db.Exec(`CREATE TABLE schema_migrations (version INTEGER NOT NULL PRIMARY KEY, name TEXT NOT NULL, applied_at TEXT NOT NULL);
+			INSERT INTO schema_migrations VALUES (1, 'create_todo', '2024-01-01T00:00:00Z');
+			CREATE TABLE todo (id INTEGER NOT NULL PRIMARY KEY, time TEXT, description TEXT, completed BOOLEAN NOT NULL DEFAULT FALSE);
+			INSERT INTO todo VALUES (1, '2024-01-01T10:00:00.000Z', 'millis', FALSE);
+			INSERT INTO todo VALUES (2, '2024-01-01T10:00:00+02:00', 'offset', FALSE);
+			INSERT INTO todo VALUES (3, '2024-01-01T10:00', 'no zone', FALSE);
+			INSERT INTO todo VALUES (4, 'whenever', 'garbage', FALSE);`); err != nil {
+			t.Fatal(err)
+		}
+
+		migrator, err := store.NewMigrator(db)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := migrator.Up(ctx); err != nil {
+			t.Fatal(err)
+		}
+
+		want := map[int]sql.NullString{
+			1: {String: "2024-01-01T10:00:00Z", Valid: true},
+			2: {String: "2024-01-01T08:00:00Z", Valid: true},
+			3: {String: "2024-01-01T10:00:00Z", Valid: true},
+			4: {},
+		}
+		for id, w := range want {
+			var got sql.NullString
+			if err := db.QueryRow("SELECT time FROM todo WHERE id = ?", id).Scan(&got); err != nil {
+				t.Fatal(err)
+			}
+			if got != w {
+				t.Errorf("todo %d: got %+v want %+v", id, got, w)
+			}
+		}
+	})
+}
+
+// openTestDb opens a sqlite database, skipping the test when the driver was
+// built without FTS5 as the migrations need it.
+func openTestDb(t testing.TB, dsn string) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite3", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	var fts5 bool
+	if err := db.QueryRow("SELECT sqlite_compileoption_used('ENABLE_FTS5')").Scan(&fts5); err != nil {
+		t.Fatal(err)
+	}
+	if !fts5 {
+		t.Skip(store.ErrNoFTS5)
+	}
+	return db
+}
@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS todo (
+  id INTEGER NOT NULL PRIMARY KEY,
+  time TEXT,
+  description TEXT,
+  completed BOOLEAN NOT NULL DEFAULT FALSE
+);
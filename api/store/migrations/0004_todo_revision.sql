@@ -0,0 +1 @@
+ALTER TABLE todo ADD COLUMN revision INTEGER NOT NULL DEFAULT 1;
@@ -0,0 +1,2 @@
+ALTER TABLE todo ADD COLUMN deleted_at TEXT;
+CREATE INDEX todo_deleted_at ON todo(deleted_at);
@@ -0,0 +1,17 @@
+CREATE TABLE todo_events (
+  id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+  todo_id INTEGER NOT NULL,
+  op TEXT NOT NULL,
+  before TEXT,
+  after TEXT,
+  at TEXT NOT NULL,
+  actor TEXT NOT NULL
+);
+CREATE INDEX todo_events_todo_id ON todo_events(todo_id, id);
+CREATE INDEX todo_events_at ON todo_events(at);
+CREATE TRIGGER todo_events_no_update BEFORE UPDATE ON todo_events BEGIN
+  SELECT RAISE(ABORT, 'todo_events is append-only');
+END;
+CREATE TRIGGER todo_events_no_delete BEFORE DELETE ON todo_events BEGIN
+  SELECT RAISE(ABORT, 'todo_events is append-only');
+END;
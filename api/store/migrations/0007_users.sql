@@ -0,0 +1,32 @@
+CREATE TABLE users (
+  id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+  username TEXT NOT NULL UNIQUE COLLATE NOCASE,
+  password_hash BLOB NOT NULL,
+  created_at TEXT NOT NULL
+);
+CREATE TABLE sessions (
+  token_hash TEXT NOT NULL PRIMARY KEY,
+  user_id INTEGER NOT NULL REFERENCES users(id),
+  expires_at TEXT NOT NULL
+);
+CREATE INDEX sessions_user_id ON sessions(user_id);
+CREATE TABLE api_tokens (
+  id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+  user_id INTEGER NOT NULL REFERENCES users(id),
+  name TEXT NOT NULL,
+  token_hash TEXT NOT NULL UNIQUE,
+  created_at TEXT NOT NULL
+);
+CREATE INDEX api_tokens_user_id ON api_tokens(user_id);
+-- Todos created before there were any users have owner 0 until the first
+-- user signs up and takes them over.
+ALTER TABLE todo ADD COLUMN owner_id INTEGER NOT NULL DEFAULT 0;
+CREATE INDEX todo_owner_id ON todo(owner_id, id);
+ALTER TABLE todo_events ADD COLUMN owner_id INTEGER NOT NULL DEFAULT 0;
+CREATE INDEX todo_events_owner_id ON todo_events(owner_id, id);
+-- Only the owner of existing events may be assigned, when the first user
+-- takes them over.
+DROP TRIGGER todo_events_no_update;
+CREATE TRIGGER todo_events_no_update BEFORE UPDATE OF id, todo_id, op, before, after, at, actor ON todo_events BEGIN
+  SELECT RAISE(ABORT, 'todo_events is append-only');
+END;
@@ -0,0 +1,5 @@
+-- Tokens created before scopes existed keep working with todos but can no
+-- longer manage tokens.
+ALTER TABLE api_tokens ADD COLUMN scopes TEXT NOT NULL DEFAULT 'todos:read todos:write';
+ALTER TABLE api_tokens ADD COLUMN expires_at TEXT;
+ALTER TABLE api_tokens ADD COLUMN last_used_at TEXT;
@@ -0,0 +1,27 @@
+CREATE TABLE lists (
+  id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+  name TEXT NOT NULL,
+  created_at TEXT NOT NULL
+);
+CREATE TABLE list_members (
+  list_id INTEGER NOT NULL REFERENCES lists(id),
+  user_id INTEGER NOT NULL REFERENCES users(id),
+  role TEXT NOT NULL,
+  PRIMARY KEY (list_id, user_id)
+);
+CREATE INDEX list_members_user_id ON list_members(user_id);
+CREATE TABLE list_invitations (
+  id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+  list_id INTEGER NOT NULL REFERENCES lists(id),
+  user_id INTEGER NOT NULL REFERENCES users(id),
+  role TEXT NOT NULL,
+  invited_by INTEGER NOT NULL REFERENCES users(id),
+  created_at TEXT NOT NULL,
+  UNIQUE (list_id, user_id)
+);
+CREATE INDEX list_invitations_user_id ON list_invitations(user_id);
+-- Todos with list 0 are in their owner's personal list.
+ALTER TABLE todo ADD COLUMN list_id INTEGER NOT NULL DEFAULT 0;
+CREATE INDEX todo_list_id ON todo(list_id, id);
+ALTER TABLE todo_events ADD COLUMN list_id INTEGER NOT NULL DEFAULT 0;
+CREATE INDEX todo_events_list_id ON todo_events(list_id, id);
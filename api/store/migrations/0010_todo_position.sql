@@ -0,0 +1,16 @@
+-- Positions are strings that sort in the order the user gave the todos.
+-- Existing todos keep their id order. A position never ends in its lowest
+-- digit, 0, so the padded id is followed by one.
+ALTER TABLE todo ADD COLUMN position TEXT NOT NULL DEFAULT '';
+UPDATE todo SET position = printf('%08dV', id);
+CREATE INDEX todo_position ON todo(owner_id, list_id, position);
+CREATE TABLE sections (
+  id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+  name TEXT NOT NULL,
+  owner_id INTEGER NOT NULL DEFAULT 0,
+  list_id INTEGER NOT NULL DEFAULT 0,
+  created_at TEXT NOT NULL
+);
+CREATE INDEX sections_scope ON sections(owner_id, list_id);
+-- Todos with section 0 are not in a section.
+ALTER TABLE todo ADD COLUMN section_id INTEGER NOT NULL DEFAULT 0;
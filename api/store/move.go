@@ -0,0 +1,279 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Move places a todo between two others of its list, named by id. With only
+// After or Before the todo goes right next to that todo, and with neither it
+// keeps its position. Section moves it to another section when set, 0 taking
+// it out of its section.
+type Move struct {
+	After   int
+	Before  int
+	Section *int
+}
+
+// MoveTodo is the payload of a MoveCommand.
+type MoveTodo struct {
+	Ref  Ref
+	Move Move
+}
+
+// positionDigits are the digits of a position, in ascending byte order so
+// positions compare the same as strings in Go and in sqlite.
+const positionDigits = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// legacyPosition is the position of a todo created before todos had one,
+// which keeps them in id order. It matches the 0010_todo_position migration.
+func legacyPosition(id int) string {
+	return fmt.Sprintf("%08dV", id)
+}
+
+// firstPosition is the position of the first todo of a list. It has as many
+// digits as a legacyPosition so appending, which keeps the length, has room.
+const firstPosition = "00000000V"
+
+// positionBetween returns a position sorting after lo and before hi, where
+// an empty lo or hi means there is no todo on that side. Only the moved todo
+// changes, however often the same gap is used.
+func positionBetween(lo, hi string) (string, error) {
+	if hi != "" && lo >= hi {
+		return "", errors.Wrapf(ErrValidation, "After must come before Before, not after it")
+	}
+	switch {
+	case lo == "" && hi == "":
+		return firstPosition, nil
+	case hi == "":
+		return increment(lo), nil
+	}
+	return midpoint(lo, hi), nil
+}
+
+// increment returns the next position after p of the same length, so that
+// appending, the common case, does not make positions grow. It carries into
+// the digit before a z, restarting the digits after it at 1 rather than 0 to
+// keep midpoint working, and only grows p once every digit is z.
+func increment(p string) string {
+	b := []byte(p)
+	for i := len(b) - 1; i >= 0; i-- {
+		if d := strings.IndexByte(positionDigits, b[i]); d < len(positionDigits)-1 {
+			b[i] = positionDigits[d+1]
+			for j := i + 1; j < len(b); j++ {
+				b[j] = positionDigits[1]
+			}
+			return string(b)
+		}
+	}
+	return p + positionDigits[len(positionDigits)/2:len(positionDigits)/2+1]
+}
+
+// midpoint returns a position between lo and hi without a trailing 0, given
+// that neither has one. It keeps the prefix they share, reading missing
+// digits of lo as 0, and picks a digit between the first ones that differ.
+func midpoint(lo, hi string) string {
+	digit := func(s string, i int) int {
+		if i < len(s) {
+			return strings.IndexByte(positionDigits, s[i])
+		}
+		return 0
+	}
+	rest := func(s string, i int) string {
+		if i < len(s) {
+			return s[i:]
+		}
+		return ""
+	}
+
+	if hi != "" {
+		n := 0
+		for n < len(hi) && digit(lo, n) == digit(hi, n) {
+			n++
+		}
+		if n > 0 {
+			return hi[:n] + midpoint(rest(lo, n), hi[n:])
+		}
+	}
+
+	dlo, dhi := digit(lo, 0), len(positionDigits)
+	if hi != "" {
+		dhi = digit(hi, 0)
+	}
+	if dhi-dlo > 1 {
+		mid := (dlo + dhi + 1) / 2
+		return positionDigits[mid : mid+1]
+	}
+	if len(hi) > 1 {
+		return hi[:1]
+	}
+	return positionDigits[dlo:dlo+1] + midpoint(rest(lo, 1), "")
+}
+
+func (d *DbTodoStore) Move(ctx context.Context, ref Ref, move Move) (Todo, error) {
+	log.Info(fmt.Sprintf("Moving todo %d %+v", ref.Id, move))
+
+	var moved Todo
+	err := d.WithTx(ctx, func(tx *sql.Tx) error {
+		where, args := refMatches(ctx, ref)
+		todo, err := scanTodo(tx.QueryRowContext(ctx, "SELECT "+todoColumns+" FROM todo WHERE "+where, args...))
+		if err != nil {
+			return checkWritten(ctx, tx, err, ref)
+		}
+
+		position, section := todo.Position, todo.Section
+		if move.After != 0 || move.Before != 0 {
+			lo, hi, err := anchorsTx(ctx, tx, ref.Id, move)
+			if err != nil {
+				return err
+			}
+			if position, err = positionBetween(lo, hi); err != nil {
+				return err
+			}
+		}
+		if move.Section != nil {
+			if err := sectionExistsTx(ctx, tx, *move.Section); err != nil {
+				return err
+			}
+			section = *move.Section
+		}
+
+		row := tx.QueryRowContext(ctx, "UPDATE todo SET position=?, section_id=?, revision=revision+1 WHERE id=? RETURNING "+todoColumns,
+			position, section, ref.Id)
+		if moved, err = scanTodo(row); err != nil {
+			return err
+		}
+		return recordTx(ctx, tx, newEvent(ctx, EventMove, &todo, &moved))
+	})
+	if err != nil {
+		log.Errorf("Error: %s", err)
+		return Todo{}, err
+	}
+	return moved, nil
+}
+
+// anchorsTx returns the positions a todo is moved between. A missing anchor
+// is the todo next to the other one, other than the todo moved.
+func anchorsTx(ctx context.Context, tx *sql.Tx, id int, move Move) (lo, hi string, err error) {
+	scope, scopeArgs := scopeFilter(ctx, "")
+	position := func(field string, anchor int) (string, error) {
+		var p string
+		err := tx.QueryRowContext(ctx, "SELECT position FROM todo WHERE id=? AND "+notDeleted+scope, append([]any{anchor}, scopeArgs...)...).Scan(&p)
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", errors.Wrapf(ErrValidation, "%s: todo %d not found", field, anchor)
+		}
+		return p, err
+	}
+	if move.After != 0 {
+		if lo, err = position("After", move.After); err != nil {
+			return "", "", err
+		}
+	}
+	if move.Before != 0 {
+		if hi, err = position("Before", move.Before); err != nil {
+			return "", "", err
+		}
+	}
+
+	next := "SELECT COALESCE(%s(position), '') FROM todo WHERE position %s ? AND id<>? AND " + notDeleted + scope
+	switch {
+	case move.Before == 0:
+		err = tx.QueryRowContext(ctx, fmt.Sprintf(next, "MIN", ">"), append([]any{lo, id}, scopeArgs...)...).Scan(&hi)
+	case move.After == 0:
+		err = tx.QueryRowContext(ctx, fmt.Sprintf(next, "MAX", "<"), append([]any{hi, id}, scopeArgs...)...).Scan(&lo)
+	}
+	return lo, hi, err
+}
+
+func (m *MemoryTodoStore) Move(ctx context.Context, ref Ref, move Move) (Todo, error) {
+	log.Info(fmt.Sprintf("Moving todo %d %+v", ref.Id, move))
+
+	var moved Todo
+	err := m.write(func() error {
+		todo, err := m.current(ctx, ref)
+		if err != nil {
+			return err
+		}
+
+		moved = todo
+		if move.After != 0 || move.Before != 0 {
+			lo, hi, err := m.anchors(ctx, ref.Id, move)
+			if err != nil {
+				return err
+			}
+			if moved.Position, err = positionBetween(lo, hi); err != nil {
+				return err
+			}
+		}
+		if move.Section != nil {
+			if err := m.sectionExists(ctx, *move.Section); err != nil {
+				return err
+			}
+			moved.Section = *move.Section
+		}
+
+		moved.Revision++
+		m.todos[ref.Id] = moved
+		m.record(ctx, EventMove, &todo, &moved)
+		return nil
+	})
+	if err != nil {
+		return Todo{}, err
+	}
+	return moved, nil
+}
+
+// anchors is anchorsTx for the memory store. The lock must be held.
+func (m *MemoryTodoStore) anchors(ctx context.Context, id int, move Move) (lo, hi string, err error) {
+	position := func(field string, anchor int) (string, error) {
+		todo, ok := m.todos[anchor]
+		if !ok || !m.owns(ctx, anchor) {
+			return "", errors.Wrapf(ErrValidation, "%s: todo %d not found", field, anchor)
+		}
+		return todo.Position, nil
+	}
+	if move.After != 0 {
+		if lo, err = position("After", move.After); err != nil {
+			return "", "", err
+		}
+	}
+	if move.Before != 0 {
+		if hi, err = position("Before", move.Before); err != nil {
+			return "", "", err
+		}
+	}
+
+	for _, todo := range m.owned(ctx) {
+		switch {
+		case todo.Id == id:
+		case move.Before == 0 && todo.Position > lo && (hi == "" || todo.Position < hi):
+			hi = todo.Position
+		case move.After == 0 && todo.Position < hi && todo.Position > lo:
+			lo = todo.Position
+		}
+	}
+	return lo, hi, nil
+}
+
+// lastPosition is the position after every todo the context sees, including
+// those in the trash so restored todos keep a position of their own. The
+// lock must be held.
+func (m *MemoryTodoStore) lastPosition(ctx context.Context) string {
+	last := ""
+	for id, todo := range m.todos {
+		if m.owns(ctx, id) && todo.Position > last {
+			last = todo.Position
+		}
+	}
+	for id, trashed := range m.trash {
+		if m.owns(ctx, id) && trashed.Position > last {
+			last = trashed.Position
+		}
+	}
+	position, _ := positionBetween(last, "")
+	return position
+}
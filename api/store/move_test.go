@@ -0,0 +1,192 @@
+package store_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/mcadenas-bjss/go-do-it/store"
+)
+
+func TestMove(t *testing.T) {
+	ctx := context.Background()
+
+	for name, s := range newStores(t) {
+		t.Run(name, func(t *testing.T) {
+			var order []int
+			revisions := map[int]int{}
+			for i := 0; i < 8; i++ {
+				todo, err := s.Insert(ctx, store.Todo{Description: fmt.Sprintf("Todo %d", i)})
+				if err != nil {
+					t.Fatal(err)
+				}
+				order = append(order, todo.Id)
+				revisions[todo.Id] = 1
+			}
+
+			t.Run("keeps the order of every move", func(t *testing.T) {
+				r := rand.New(rand.NewSource(1))
+				for i := 0; i < 200; i++ {
+					from := r.Intn(len(order))
+					id := order[from]
+					order = append(order[:from:from], order[from+1:]...)
+					to := r.Intn(len(order) + 1)
+					order = append(order[:to], append([]int{id}, order[to:]...)...)
+
+					var move store.Move
+					if to > 0 && (to == len(order)-1 || r.Intn(2) == 0) {
+						move.After = order[to-1]
+					}
+					if to < len(order)-1 && (move.After == 0 || r.Intn(2) == 0) {
+						move.Before = order[to+1]
+					}
+
+					moved, err := s.Move(ctx, store.Ref{Id: id, Revision: revisions[id]}, move)
+					if err != nil {
+						t.Fatalf("move %d of todo %d %+v: %v", i, id, move, err)
+					}
+					revisions[id]++
+					if moved.Revision != revisions[id] {
+						t.Fatalf("got revision %d want %d", moved.Revision, revisions[id])
+					}
+					assertOrder(t, s, order)
+				}
+			})
+
+			t.Run("leaves the other todos alone", func(t *testing.T) {
+				page, _ := s.List(ctx, store.ListOptions{})
+				for _, todo := range page.Todos {
+					if todo.Revision != revisions[todo.Id] {
+						t.Errorf("todo %d is at revision %d want %d", todo.Id, todo.Revision, revisions[todo.Id])
+					}
+				}
+			})
+
+			t.Run("appends new todos", func(t *testing.T) {
+				if _, err := s.Move(ctx, store.Ref{Id: order[len(order)-1]}, store.Move{Before: order[0]}); err != nil {
+					t.Fatal(err)
+				}
+				order = append(order[len(order)-1:], order[:len(order)-1]...)
+				milk, _ := s.Insert(ctx, store.Todo{Description: "Buy milk"})
+				order = append(order, milk.Id)
+				assertOrder(t, s, order)
+			})
+
+			t.Run("rejects bad anchors", func(t *testing.T) {
+				for _, move := range []store.Move{
+					{After: order[1], Before: order[0]},
+					{After: 99},
+					{Before: 99},
+				} {
+					if _, err := s.Move(ctx, store.Ref{Id: order[2]}, move); !errors.Is(err, store.ErrValidation) {
+						t.Errorf("got %v moving %+v want %v", err, move, store.ErrValidation)
+					}
+				}
+				if _, err := s.Move(ctx, store.Ref{Id: 99}, store.Move{After: order[0]}); !errors.Is(err, store.ErrNotFound) {
+					t.Errorf("got %v want %v", err, store.ErrNotFound)
+				}
+			})
+
+			t.Run("restores todos in place", func(t *testing.T) {
+				if _, err := s.Delete(ctx, store.Ref{Id: order[1]}); err != nil {
+					t.Fatal(err)
+				}
+				if _, err := s.Restore(ctx, store.Ref{Id: order[1]}); err != nil {
+					t.Fatal(err)
+				}
+				assertOrder(t, s, order)
+			})
+		})
+	}
+}
+
+func TestSections(t *testing.T) {
+	ctx := context.Background()
+
+	for name, s := range newStores(t) {
+		sections := s.(store.SectionStore)
+		t.Run(name, func(t *testing.T) {
+			asAlice, asBob := store.WithOwner(ctx, 1), store.WithOwner(ctx, 2)
+			milk, _ := s.Insert(asAlice, store.Todo{Description: "Buy milk"})
+
+			shopping, err := sections.CreateSection(asAlice, "Shopping")
+			if err != nil {
+				t.Fatal(err)
+			}
+			renamed, err := sections.RenameSection(asAlice, shopping.Id, "Groceries")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if renamed.Name != "Groceries" || renamed.CreatedAt != shopping.CreatedAt {
+				t.Errorf("unexpected section %+v", renamed)
+			}
+			if _, err := sections.RenameSection(asBob, shopping.Id, "Mine"); !errors.Is(err, store.ErrSectionNotFound) {
+				t.Errorf("got %v renaming another user's section", err)
+			}
+
+			got, _ := sections.Sections(asAlice)
+			if len(got) != 1 || got[0].Name != "Groceries" || got[0].CreatedAt.IsZero() {
+				t.Errorf("unexpected sections %+v", got)
+			}
+			if got, _ := sections.Sections(asBob); len(got) != 0 {
+				t.Errorf("want alice's sections hidden from bob, got %+v", got)
+			}
+
+			t.Run("moves todos into sections", func(t *testing.T) {
+				section := shopping.Id
+				todo, err := s.Move(asAlice, store.Ref{Id: milk.Id}, store.Move{Section: &section})
+				if err != nil {
+					t.Fatal(err)
+				}
+				if todo.Section != section || todo.Revision != 2 {
+					t.Errorf("unexpected todo %+v", todo)
+				}
+				if _, err := s.Move(asBob, store.Ref{Id: milk.Id}, store.Move{Section: &section}); !errors.Is(err, store.ErrNotFound) {
+					t.Errorf("got %v moving another user's todo", err)
+				}
+
+				bread, _ := s.Insert(asBob, store.Todo{Description: "Buy bread"})
+				if _, err := s.Move(asBob, store.Ref{Id: bread.Id}, store.Move{Section: &section}); !errors.Is(err, store.ErrValidation) {
+					t.Errorf("got %v moving to another user's section", err)
+				}
+			})
+
+			t.Run("deletes empty sections only", func(t *testing.T) {
+				if err := sections.DeleteSection(asBob, shopping.Id); !errors.Is(err, store.ErrSectionNotFound) {
+					t.Errorf("got %v deleting another user's section", err)
+				}
+				if err := sections.DeleteSection(asAlice, shopping.Id); !errors.Is(err, store.ErrSectionNotEmpty) {
+					t.Errorf("got %v want %v", err, store.ErrSectionNotEmpty)
+				}
+				none := 0
+				if _, err := s.Move(asAlice, store.Ref{Id: milk.Id}, store.Move{Section: &none}); err != nil {
+					t.Fatal(err)
+				}
+				if err := sections.DeleteSection(asAlice, shopping.Id); err != nil {
+					t.Fatal(err)
+				}
+				if err := sections.DeleteSection(asAlice, shopping.Id); !errors.Is(err, store.ErrSectionNotFound) {
+					t.Errorf("got %v want %v", err, store.ErrSectionNotFound)
+				}
+			})
+		})
+	}
+}
+
+// assertOrder checks the todos are listed in the order of ids.
+func assertOrder(t testing.TB, s store.TodoStore, ids []int) {
+	t.Helper()
+	page, err := s.List(context.Background(), store.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make([]int, len(page.Todos))
+	for i, todo := range page.Todos {
+		got[i] = todo.Id
+	}
+	if fmt.Sprint(got) != fmt.Sprint(ids) {
+		t.Fatalf("got order %v want %v", got, ids)
+	}
+}
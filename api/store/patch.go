@@ -0,0 +1,173 @@
+package store
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+
+	"github.com/mcadenas-bjss/go-do-it/validate"
+	"github.com/pkg/errors"
+)
+
+// ErrInvalidPatch is returned for patch documents that are malformed or
+// refer to fields a todo does not have.
+var ErrInvalidPatch = errors.New("invalid patch")
+
+// Patch changes part of a todo. TodoStore.Patch applies it to the current
+// version of the todo inside a single transaction.
+type Patch interface {
+	// Apply returns the patched version of todo, which is not yet validated.
+	Apply(todo Todo) (Todo, error)
+}
+
+// MergePatch is a JSON Merge Patch (RFC 7396) document: the fields it sets
+// are replaced and fields set to null are cleared.
+type MergePatch json.RawMessage
+
+// JSONPatch is a JSON Patch (RFC 6902) document.
+type JSONPatch []PatchOperation
+
+type PatchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// PatchTodo is the payload of a PatchCommand.
+type PatchTodo struct {
+	Ref   Ref
+	Patch Patch
+}
+
+// TodoFromInput converts a todo submitted by a client, after it has been
+// validated, to the stored type.
+func TodoFromInput(input validate.Todo) (Todo, error) {
+	due, err := ParseTimestamp(input.Time)
+	if err != nil {
+		return Todo{}, err
+	}
+	return Todo{Id: input.Id, Time: due, Description: strings.TrimSpace(input.Description), Completed: input.Completed}, nil
+}
+
+func (p MergePatch) Apply(todo Todo) (Todo, error) {
+	var changes map[string]json.RawMessage
+	if err := json.Unmarshal(p, &changes); err != nil || changes == nil {
+		return Todo{}, errors.Wrap(ErrInvalidPatch, "a merge patch must be a JSON object")
+	}
+
+	doc, err := patchDocument(todo)
+	if err != nil {
+		return Todo{}, err
+	}
+	for field, value := range changes {
+		if bytes.Equal(bytes.TrimSpace(value), []byte("null")) {
+			delete(doc, field)
+		} else {
+			doc[field] = value
+		}
+	}
+	return patchedTodo(todo, doc)
+}
+
+func (p JSONPatch) Apply(todo Todo) (Todo, error) {
+	doc, err := patchDocument(todo)
+	if err != nil {
+		return Todo{}, err
+	}
+
+	for i, op := range p {
+		field, err := patchField(op.Path)
+		if err != nil {
+			return Todo{}, errors.Wrapf(err, "operation %d", i)
+		}
+		current, exists := doc[field]
+
+		switch op.Op {
+		case "add", "replace":
+			if op.Value == nil {
+				return Todo{}, errors.Wrapf(ErrInvalidPatch, "operation %d: %s needs a value", i, op.Op)
+			}
+			if op.Op == "replace" && !exists {
+				return Todo{}, errors.Wrapf(ErrInvalidPatch, "operation %d: %s does not exist", i, op.Path)
+			}
+			doc[field] = op.Value
+		case "remove":
+			if !exists {
+				return Todo{}, errors.Wrapf(ErrInvalidPatch, "operation %d: %s does not exist", i, op.Path)
+			}
+			delete(doc, field)
+		case "move", "copy":
+			from, err := patchField(op.From)
+			if err != nil {
+				return Todo{}, errors.Wrapf(err, "operation %d", i)
+			}
+			value, ok := doc[from]
+			if !ok {
+				return Todo{}, errors.Wrapf(ErrInvalidPatch, "operation %d: %s does not exist", i, op.From)
+			}
+			if op.Op == "move" {
+				delete(doc, from)
+			}
+			doc[field] = value
+		case "test":
+			if !exists || !jsonEqual(current, op.Value) {
+				return Todo{}, errors.Wrapf(ErrConflict, "operation %d: %s is not %s", i, op.Path, op.Value)
+			}
+		default:
+			return Todo{}, errors.Wrapf(ErrInvalidPatch, "operation %d: unknown op %q", i, op.Op)
+		}
+	}
+	return patchedTodo(todo, doc)
+}
+
+// patchDocument is the JSON object a patch is applied to.
+func patchDocument(todo Todo) (map[string]json.RawMessage, error) {
+	data, err := json.Marshal(todo)
+	if err != nil {
+		return nil, err
+	}
+	var doc map[string]json.RawMessage
+	return doc, json.Unmarshal(data, &doc)
+}
+
+// patchedTodo decodes and validates the result of a patch to original. Like
+// an update, a patch leaves the position and section to Move.
+func patchedTodo(original Todo, doc map[string]json.RawMessage) (Todo, error) {
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return Todo{}, err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	var input validate.Todo
+	if err := dec.Decode(&input); err != nil {
+		return Todo{}, errors.Wrap(ErrInvalidPatch, err.Error())
+	}
+	if err := input.Update(original.Id); err != nil {
+		return Todo{}, err
+	}
+	todo, err := TodoFromInput(input)
+	todo.Id, todo.Position, todo.Section = original.Id, original.Position, original.Section
+	return todo, err
+}
+
+// patchField resolves a JSON Pointer to the todo field it names. Todos are
+// flat, so only top level pointers are valid.
+func patchField(pointer string) (string, error) {
+	field, ok := strings.CutPrefix(pointer, "/")
+	if !ok || field == "" || strings.Contains(field, "/") {
+		return "", errors.Wrapf(ErrInvalidPatch, "%q is not a todo field", pointer)
+	}
+	return strings.NewReplacer("~1", "/", "~0", "~").Replace(field), nil
+}
+
+func jsonEqual(a, b json.RawMessage) bool {
+	var x, y any
+	if json.Unmarshal(a, &x) != nil || json.Unmarshal(b, &y) != nil {
+		return false
+	}
+	return reflect.DeepEqual(x, y)
+}
@@ -0,0 +1,81 @@
+package store_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/mcadenas-bjss/go-do-it/store"
+	"github.com/mcadenas-bjss/go-do-it/validate"
+)
+
+func TestPatch(t *testing.T) {
+	ctx := context.Background()
+
+	jsonPatch := func(doc string) store.Patch {
+		var p store.JSONPatch
+		if err := json.Unmarshal([]byte(doc), &p); err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+
+	for name, s := range newStores(t) {
+		t.Run(name, func(t *testing.T) {
+			milk, err := s.Insert(ctx, store.Todo{Time: due("2024-01-01T00:00:00Z"), Description: "Buy milk"})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			tests := []struct {
+				name  string
+				patch store.Patch
+				want  store.Todo
+			}{
+				{"merge patch renames", store.MergePatch(`{"Description": "Buy oat milk"}`), store.Todo{Id: milk.Id, Time: due("2024-01-01T00:00:00Z"), Description: "Buy oat milk", Revision: 2}},
+				{"merge patch completes and clears the time", store.MergePatch(`{"Completed": true, "Time": null}`), store.Todo{Id: milk.Id, Description: "Buy oat milk", Completed: true, Revision: 3}},
+				{"json patch", jsonPatch(`[
+					{"op": "test", "path": "/Completed", "value": true},
+					{"op": "replace", "path": "/Completed", "value": false},
+					{"op": "add", "path": "/Time", "value": "2024-02-01T10:00:00+01:00"}
+				]`), store.Todo{Id: milk.Id, Time: due("2024-02-01T09:00:00Z"), Description: "Buy oat milk", Revision: 4}},
+			}
+			for _, tt := range tests {
+				got, err := s.Patch(ctx, store.Ref{Id: milk.Id}, tt.patch)
+				if err != nil {
+					t.Fatalf("%s: %v", tt.name, err)
+				}
+				assertTodo(t, got, tt.want)
+				stored, _ := s.Get(ctx, milk.Id)
+				assertTodo(t, stored, tt.want)
+			}
+
+			failures := []struct {
+				name  string
+				patch store.Patch
+				want  error
+			}{
+				{"missing todo", store.MergePatch(`{}`), store.ErrNotFound},
+				{"failed test", jsonPatch(`[{"op": "test", "path": "/Description", "value": "Buy milk"}, {"op": "remove", "path": "/Time"}]`), store.ErrConflict},
+				{"unknown field", store.MergePatch(`{"Priority": 1}`), store.ErrInvalidPatch},
+				{"nested path", jsonPatch(`[{"op": "add", "path": "/Time/zone", "value": "UTC"}]`), store.ErrInvalidPatch},
+				{"unknown op", jsonPatch(`[{"op": "increment", "path": "/Id"}]`), store.ErrInvalidPatch},
+				{"invalid result", jsonPatch(`[{"op": "remove", "path": "/Description"}]`), validate.ErrInvalid},
+				{"changed id", store.MergePatch(`{"Id": 99}`), store.ErrValidation},
+			}
+			for _, tt := range failures {
+				target := milk.Id
+				if tt.want == store.ErrNotFound {
+					target = milk.Id + 100
+				}
+				if _, err := s.Patch(ctx, store.Ref{Id: target}, tt.patch); !errors.Is(err, tt.want) {
+					t.Errorf("%s: got %v want %v", tt.name, err, tt.want)
+				}
+			}
+
+			stored, _ := s.Get(ctx, milk.Id)
+			assertTodo(t, stored, store.Todo{Id: milk.Id, Time: due("2024-02-01T09:00:00Z"), Description: "Buy oat milk", Revision: 4})
+		})
+	}
+}
@@ -0,0 +1,262 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"html"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/pkg/errors"
+)
+
+// ErrNoFTS5 is returned when the sqlite driver was built without FTS5.
+var ErrNoFTS5 = errors.New("sqlite was built without FTS5, build with -tags sqlite_fts5")
+
+// DefaultSearchLimit is the number of results returned when a search does
+// not ask for a specific amount.
+const DefaultSearchLimit = 20
+
+// Snippets mark matched terms with these control characters so the
+// description can be HTML escaped before they are turned into <mark> tags.
+const (
+	markStart = "\x02"
+	markEnd   = "\x03"
+)
+
+var highlighter = strings.NewReplacer(markStart, "<mark>", markEnd, "</mark>")
+
+type SearchQuery struct {
+	Query string
+	Limit int
+}
+
+// SearchResult is a todo matching a search. Higher ranks are better matches.
+// Snippet is the matching part of the description as HTML, with matched terms
+// wrapped in <mark>.
+type SearchResult struct {
+	Todo
+	Rank    float64
+	Snippet string
+}
+
+// searchTerms splits a free text query into lower case words, dropping
+// anything that would be interpreted as full-text query syntax.
+func searchTerms(query string) []string {
+	return strings.FieldsFunc(strings.ToLower(query), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// matchExpression builds a MATCH expression requiring every term, each as a
+// prefix so results show up while the user is still typing.
+func matchExpression(terms []string) string {
+	parts := make([]string, len(terms))
+	for i, term := range terms {
+		parts[i] = term + "*"
+	}
+	return strings.Join(parts, " ")
+}
+
+func highlight(snippet string) string {
+	return highlighter.Replace(html.EscapeString(snippet))
+}
+
+func (q SearchQuery) limit() int {
+	if q.Limit < 1 {
+		return DefaultSearchLimit
+	}
+	return q.Limit
+}
+
+// requireFTS5 fails with ErrNoFTS5 unless the sqlite driver was built with
+// FTS5, which the search index needs on every write to the todo table.
+func requireFTS5(ctx context.Context, db interface {
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}) error {
+	var fts5 bool
+	if err := db.QueryRowContext(ctx, "SELECT sqlite_compileoption_used('ENABLE_FTS5')").Scan(&fts5); err != nil {
+		return err
+	}
+	if !fts5 {
+		return ErrNoFTS5
+	}
+	return nil
+}
+
+func createSearchIndex(ctx context.Context, tx *sql.Tx) error {
+	if err := requireFTS5(ctx, tx); err != nil {
+		return err
+	}
+
+	statements := []string{
+		`CREATE VIRTUAL TABLE todo_fts USING fts5(description, content='todo', content_rowid='id')`,
+		`CREATE TRIGGER todo_fts_ai AFTER INSERT ON todo BEGIN
+		   INSERT INTO todo_fts(rowid, description) VALUES (new.id, new.description);
+		 END`,
+		`CREATE TRIGGER todo_fts_ad AFTER DELETE ON todo BEGIN
+		   INSERT INTO todo_fts(todo_fts, rowid, description) VALUES ('delete', old.id, old.description);
+		 END`,
+		`CREATE TRIGGER todo_fts_au AFTER UPDATE OF description ON todo BEGIN
+		   INSERT INTO todo_fts(todo_fts, rowid, description) VALUES ('delete', old.id, old.description);
+		   INSERT INTO todo_fts(rowid, description) VALUES (new.id, new.description);
+		 END`,
+		`INSERT INTO todo_fts(todo_fts) VALUES ('rebuild')`,
+	}
+	for _, statement := range statements {
+		if _, err := tx.ExecContext(ctx, statement); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// upgradeSearchIndex replaces the fts4 index that builds without FTS5 used to
+// create with an fts5 one.
+func upgradeSearchIndex(ctx context.Context, tx *sql.Tx) error {
+	var definition string
+	if err := tx.QueryRowContext(ctx, "SELECT sql FROM sqlite_master WHERE name = 'todo_fts'").Scan(&definition); err != nil {
+		return err
+	}
+	if strings.Contains(strings.ToLower(definition), "fts5") {
+		return nil
+	}
+	for _, statement := range []string{
+		"DROP TRIGGER IF EXISTS todo_fts_bu",
+		"DROP TRIGGER IF EXISTS todo_fts_bd",
+		"DROP TRIGGER IF EXISTS todo_fts_au",
+		"DROP TRIGGER IF EXISTS todo_fts_ai",
+		"DROP TABLE todo_fts",
+	} {
+		if _, err := tx.ExecContext(ctx, statement); err != nil {
+			return err
+		}
+	}
+	return createSearchIndex(ctx, tx)
+}
+
+func (dts *DbTodoStore) Search(ctx context.Context, q SearchQuery) ([]SearchResult, error) {
+	log.Info(fmt.Sprintf("Searching todos for %q", q.Query))
+
+	terms := searchTerms(q.Query)
+	if len(terms) == 0 {
+		return []SearchResult{}, nil
+	}
+
+	scope, scopeArgs := scopeFilter(ctx, "t.")
+	args := append(append([]any{matchExpression(terms)}, scopeArgs...), q.limit())
+
+	query := fmt.Sprintf(`SELECT t.id, t.time, t.description, t.completed, t.revision, t.position, t.section_id,
+		  -bm25(todo_fts),
+		  snippet(todo_fts, 0, '%s', '%s', '…', 12)
+		FROM todo_fts JOIN todo t ON t.id = todo_fts.rowid
+		WHERE todo_fts MATCH ? AND t.deleted_at IS NULL%s
+		ORDER BY bm25(todo_fts), t.id
+		LIMIT ?`, markStart, markEnd, scope)
+
+	dts.lock.RLock()
+	defer dts.lock.RUnlock()
+	return withContext(ctx, func() ([]SearchResult, error) {
+		rows, err := dts.db.QueryContext(ctx, query, args...)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+
+		results := []SearchResult{}
+		for rows.Next() {
+			var r SearchResult
+			if err := rows.Scan(&r.Id, &r.Time, &r.Description, &r.Completed, &r.Revision, &r.Position, &r.Section, &r.Rank, &r.Snippet); err != nil {
+				return nil, err
+			}
+			r.Snippet = highlight(r.Snippet)
+			results = append(results, r)
+		}
+		return results, rows.Err()
+	})
+}
+
+func (m *MemoryTodoStore) Search(ctx context.Context, q SearchQuery) ([]SearchResult, error) {
+	log.Info(fmt.Sprintf("Searching todos for %q", q.Query))
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	terms := searchTerms(q.Query)
+	if len(terms) == 0 {
+		return []SearchResult{}, nil
+	}
+
+	results := []SearchResult{}
+	for _, todo := range m.owned(ctx) {
+		if r, ok := matchTodo(todo, terms); ok {
+			results = append(results, r)
+		}
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Rank > results[j].Rank
+	})
+	if len(results) > q.limit() {
+		results = results[:q.limit()]
+	}
+	return results, nil
+}
+
+// matchTodo mirrors the full-text index for backends without one: every term
+// must prefix a word of the description, and the rank is the number of words
+// matched.
+func matchTodo(todo Todo, terms []string) (SearchResult, bool) {
+	var snippet strings.Builder
+	matchedTerms := make(map[string]bool)
+	words := 0
+
+	rest := todo.Description
+	for rest != "" {
+		start := strings.IndexFunc(rest, isWordRune)
+		if start < 0 {
+			snippet.WriteString(rest)
+			break
+		}
+		end := strings.IndexFunc(rest[start:], func(r rune) bool { return !isWordRune(r) })
+		if end < 0 {
+			end = len(rest)
+		} else {
+			end += start
+		}
+
+		word := rest[start:end]
+		snippet.WriteString(rest[:start])
+		matched := false
+		for _, term := range terms {
+			if strings.HasPrefix(strings.ToLower(word), term) {
+				matchedTerms[term] = true
+				matched = true
+			}
+		}
+		if matched {
+			words++
+			snippet.WriteString(markStart + word + markEnd)
+		} else {
+			snippet.WriteString(word)
+		}
+		rest = rest[end:]
+	}
+
+	if len(matchedTerms) != len(uniqueTerms(terms)) {
+		return SearchResult{}, false
+	}
+	return SearchResult{Todo: todo, Rank: float64(words), Snippet: highlight(snippet.String())}, true
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+func uniqueTerms(terms []string) map[string]bool {
+	unique := make(map[string]bool, len(terms))
+	for _, term := range terms {
+		unique[term] = true
+	}
+	return unique
+}
@@ -0,0 +1,74 @@
+package store_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/mcadenas-bjss/go-do-it/store"
+)
+
+func TestSearch(t *testing.T) {
+	ctx := context.Background()
+
+	for name, s := range newStores(t) {
+		t.Run(name, func(t *testing.T) {
+			milk, _ := s.Insert(ctx, store.Todo{Description: "Buy milk and more milk"})
+			bread, _ := s.Insert(ctx, store.Todo{Description: "Buy bread"})
+			html, _ := s.Insert(ctx, store.Todo{Description: "<b>Buy</b> a milkshake"})
+			s.Insert(ctx, store.Todo{Description: "Walk the dog"})
+
+			results, err := s.Search(ctx, store.SearchQuery{Query: "milk"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			assertIds(t, todosOf(results), []int{milk.Id, html.Id})
+			if !strings.Contains(results[0].Snippet, "<mark>milk</mark>") {
+				t.Errorf("expected highlighted snippet, got %q", results[0].Snippet)
+			}
+			if strings.Contains(results[1].Snippet, "<b>") {
+				t.Errorf("expected the description to be escaped, got %q", results[1].Snippet)
+			}
+
+			results, err = s.Search(ctx, store.SearchQuery{Query: `buy "bre`})
+			if err != nil {
+				t.Fatal(err)
+			}
+			assertIds(t, todosOf(results), []int{bread.Id})
+
+			results, err = s.Search(ctx, store.SearchQuery{Query: "buy", Limit: 1})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(results) != 1 {
+				t.Errorf("expected 1 result, got %d", len(results))
+			}
+
+			if _, err := s.Update(ctx, store.Todo{Id: bread.Id, Description: "Bake sourdough"}); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := s.Delete(ctx, store.Ref{Id: milk.Id}); err != nil {
+				t.Fatal(err)
+			}
+			results, err = s.Search(ctx, store.SearchQuery{Query: "sourdough milk"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			assertIds(t, todosOf(results), []int{})
+
+			results, err = s.Search(ctx, store.SearchQuery{Query: "sourdough"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			assertIds(t, todosOf(results), []int{bread.Id})
+		})
+	}
+}
+
+func todosOf(results []store.SearchResult) []store.Todo {
+	todos := make([]store.Todo, len(results))
+	for i, r := range results {
+		todos[i] = r.Todo
+	}
+	return todos
+}
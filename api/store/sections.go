@@ -0,0 +1,226 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrSectionNotFound = errors.New("section not found")
+	ErrSectionNotEmpty = errors.New("section still has todos")
+)
+
+// Section groups todos of a list under a heading. Todos are put in one with
+// Move.
+type Section struct {
+	Id        int
+	Name      string
+	CreatedAt Timestamp
+}
+
+// SectionStore keeps the sections of the personal and shared lists. Like
+// todos, the sections it sees are scoped with WithOwner and WithList.
+type SectionStore interface {
+	// Sections returns the sections of the list, oldest first.
+	Sections(ctx context.Context) ([]Section, error)
+	CreateSection(ctx context.Context, name string) (Section, error)
+	RenameSection(ctx context.Context, id int, name string) (Section, error)
+	// DeleteSection fails with ErrSectionNotEmpty while todos are in the
+	// section, including in the trash.
+	DeleteSection(ctx context.Context, id int) error
+}
+
+func (d *DbTodoStore) Sections(ctx context.Context) ([]Section, error) {
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+
+	scope, args := scopeFilter(ctx, "")
+	rows, err := d.db.QueryContext(ctx, "SELECT id, name, created_at FROM sections WHERE TRUE"+scope+" ORDER BY id", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sections := []Section{}
+	for rows.Next() {
+		var section Section
+		if err := rows.Scan(&section.Id, &section.Name, &section.CreatedAt); err != nil {
+			return nil, err
+		}
+		sections = append(sections, section)
+	}
+	return sections, rows.Err()
+}
+
+func (d *DbTodoStore) CreateSection(ctx context.Context, name string) (Section, error) {
+	log.Info(fmt.Sprintf("Creating section %q", name))
+
+	owner, _ := OwnerFrom(ctx)
+	list, _ := ListFrom(ctx)
+	section := Section{Name: name, CreatedAt: NewTimestamp(time.Now())}
+	err := d.WithTx(ctx, func(tx *sql.Tx) error {
+		return tx.QueryRowContext(ctx, "INSERT INTO sections(name, owner_id, list_id, created_at) VALUES(?,?,?,?) RETURNING id",
+			name, owner, list, section.CreatedAt).Scan(&section.Id)
+	})
+	if err != nil {
+		log.Errorf("Error: %s", err)
+		return Section{}, err
+	}
+	return section, nil
+}
+
+func (d *DbTodoStore) RenameSection(ctx context.Context, id int, name string) (Section, error) {
+	log.Info(fmt.Sprintf("Renaming section %d to %q", id, name))
+
+	scope, args := scopeFilter(ctx, "")
+	var section Section
+	err := d.WithTx(ctx, func(tx *sql.Tx) error {
+		err := tx.QueryRowContext(ctx, "UPDATE sections SET name=? WHERE id=?"+scope+" RETURNING id, name, created_at",
+			append([]any{name, id}, args...)...).Scan(&section.Id, &section.Name, &section.CreatedAt)
+		if errors.Is(err, sql.ErrNoRows) {
+			return errors.Wrapf(ErrSectionNotFound, "Id %d", id)
+		}
+		return err
+	})
+	if err != nil {
+		return Section{}, err
+	}
+	return section, nil
+}
+
+func (d *DbTodoStore) DeleteSection(ctx context.Context, id int) error {
+	log.Info(fmt.Sprintf("Deleting section %d", id))
+
+	scope, args := scopeFilter(ctx, "")
+	return d.WithTx(ctx, func(tx *sql.Tx) error {
+		var exists, todos bool
+		err := tx.QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM sections WHERE id=?"+scope+"), EXISTS(SELECT 1 FROM todo WHERE section_id=?)",
+			append(append([]any{id}, args...), id)...).Scan(&exists, &todos)
+		switch {
+		case err != nil:
+			return err
+		case !exists:
+			return errors.Wrapf(ErrSectionNotFound, "Id %d", id)
+		case todos:
+			return errors.Wrapf(ErrSectionNotEmpty, "Id %d", id)
+		}
+		_, err = tx.ExecContext(ctx, "DELETE FROM sections WHERE id=?", id)
+		return err
+	})
+}
+
+// sectionExistsTx checks that a todo can be moved to a section of the list
+// the context is scoped to. Section 0 always exists.
+func sectionExistsTx(ctx context.Context, tx *sql.Tx, id int) error {
+	if id == 0 {
+		return nil
+	}
+	scope, args := scopeFilter(ctx, "")
+	var exists bool
+	if err := tx.QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM sections WHERE id=?"+scope+")", append([]any{id}, args...)...).Scan(&exists); err != nil {
+		return err
+	}
+	if !exists {
+		return errors.Wrapf(ErrValidation, "Section: section %d not found", id)
+	}
+	return nil
+}
+
+// memorySection is how a MemoryTodoStore keeps a section, with the owner and
+// list it belongs to.
+type memorySection struct {
+	Section
+	Owner int
+	List  int
+}
+
+func (m *MemoryTodoStore) Sections(ctx context.Context) ([]Section, error) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	sections := []Section{}
+	for _, section := range m.sections {
+		if InScope(ctx, section.Owner, section.List) {
+			sections = append(sections, section.Section)
+		}
+	}
+	sort.Slice(sections, func(i, j int) bool {
+		return sections[i].Id < sections[j].Id
+	})
+	return sections, nil
+}
+
+func (m *MemoryTodoStore) CreateSection(ctx context.Context, name string) (Section, error) {
+	log.Info(fmt.Sprintf("Creating section %q", name))
+
+	var section memorySection
+	err := m.write(func() error {
+		section.Section = Section{Id: m.nextSectionId, Name: name, CreatedAt: NewTimestamp(time.Now())}
+		section.Owner, _ = OwnerFrom(ctx)
+		section.List, _ = ListFrom(ctx)
+		m.nextSectionId++
+		m.sections[section.Id] = section
+		return nil
+	})
+	if err != nil {
+		return Section{}, err
+	}
+	return section.Section, nil
+}
+
+func (m *MemoryTodoStore) RenameSection(ctx context.Context, id int, name string) (Section, error) {
+	log.Info(fmt.Sprintf("Renaming section %d to %q", id, name))
+
+	var section memorySection
+	err := m.write(func() error {
+		var ok bool
+		section, ok = m.sections[id]
+		if !ok || !InScope(ctx, section.Owner, section.List) {
+			return errors.Wrapf(ErrSectionNotFound, "Id %d", id)
+		}
+		section.Name = name
+		m.sections[id] = section
+		return nil
+	})
+	if err != nil {
+		return Section{}, err
+	}
+	return section.Section, nil
+}
+
+func (m *MemoryTodoStore) DeleteSection(ctx context.Context, id int) error {
+	log.Info(fmt.Sprintf("Deleting section %d", id))
+
+	return m.write(func() error {
+		section, ok := m.sections[id]
+		if !ok || !InScope(ctx, section.Owner, section.List) {
+			return errors.Wrapf(ErrSectionNotFound, "Id %d", id)
+		}
+		for _, todo := range m.todos {
+			if todo.Section == id {
+				return errors.Wrapf(ErrSectionNotEmpty, "Id %d", id)
+			}
+		}
+		for _, trashed := range m.trash {
+			if trashed.Section == id {
+				return errors.Wrapf(ErrSectionNotEmpty, "Id %d", id)
+			}
+		}
+		delete(m.sections, id)
+		return nil
+	})
+}
+
+// sectionExists is sectionExistsTx for the memory store. The lock must be
+// held.
+func (m *MemoryTodoStore) sectionExists(ctx context.Context, id int) error {
+	if section, ok := m.sections[id]; id != 0 && (!ok || !InScope(ctx, section.Owner, section.List)) {
+		return errors.Wrapf(ErrValidation, "Section: section %d not found", id)
+	}
+	return nil
+}
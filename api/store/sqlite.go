@@ -0,0 +1,621 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/pkg/errors"
+)
+
+func NewDbTodoStore(file string) (*DbTodoStore, error) {
+	env := os.Getenv("env")
+	log.Info("Running on " + env)
+	log.Info(fmt.Sprintf("Opening sqlite file at %s", file))
+	db, err := sql.Open("sqlite3", file)
+	if err != nil {
+		return nil, err
+	}
+	if err := requireFTS5(context.Background(), db); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	migrator, err := NewMigrator(db)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := migrator.Up(context.Background()); err != nil {
+		return nil, err
+	}
+
+	insert, err := db.Prepare("INSERT INTO todo(time, description, completed) VALUES(?,?,?);")
+	if err != nil {
+		return nil, err
+	}
+	defer insert.Close()
+
+	list, err := db.Prepare("SELECT * FROM todo")
+	if err != nil {
+		return nil, err
+	}
+	defer list.Close()
+
+	// Seed data if db empty
+	if rows, err := list.Query(); err == nil && env != "test" {
+		if !rows.Next() {
+			log.Info("Seeding data")
+			insert.Exec(NewTimestamp(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)), "test", false)
+		}
+		rows.Close()
+	}
+
+	return &DbTodoStore{
+		db:   db,
+		lock: sync.RWMutex{},
+	}, nil
+}
+
+type DbTodoStore struct {
+	db *sql.DB
+	// lock lets reads run in parallel but never alongside a write
+	// transaction, which shared cache in-memory databases fail with
+	// SQLITE_LOCKED rather than waiting.
+	lock sync.RWMutex
+}
+
+func withContext[T any](ctx context.Context, def func() (T, error)) (T, error) {
+	data := make(chan T)
+	e := make(chan error)
+
+	go func() {
+		var result T
+		select {
+		case <-ctx.Done():
+			return
+		default:
+			if res, err := def(); err != nil {
+				e <- err
+				close(e)
+				return
+			} else {
+				result = res
+			}
+		}
+		data <- result
+		close(data)
+	}()
+
+	var t T
+	select {
+	case <-ctx.Done():
+		log.Error("Connection closed")
+		return t, ctx.Err()
+	case result := <-data:
+		log.Info(fmt.Sprintf("%+v", result))
+		return result, nil
+	case err := <-e:
+		log.Info(fmt.Sprintf("%v", err))
+		return t, err
+	}
+}
+
+func (dts *DbTodoStore) Get(ctx context.Context, id int) (Todo, error) {
+	log.Info(fmt.Sprintf("Getting todo item: %d", id))
+	dts.lock.RLock()
+	defer dts.lock.RUnlock()
+
+	where, args := refMatches(ctx, Ref{Id: id})
+	return withContext(ctx, func() (Todo, error) {
+		todo, err := scanTodo(dts.db.QueryRowContext(ctx, "SELECT "+todoColumns+" FROM todo WHERE "+where, args...))
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return Todo{}, errors.Wrapf(ErrNotFound, "Id %d", id)
+			}
+			return Todo{}, errors.Wrap(err, "Get failed")
+		}
+
+		return todo, nil
+	})
+
+}
+
+func (dts *DbTodoStore) List(ctx context.Context, opts ListOptions) (Page, error) {
+	log.Info(fmt.Sprintf("Getting todos %+v", opts))
+
+	query, args, err := listQuery(ctx, opts)
+	if err != nil {
+		return Page{}, err
+	}
+
+	dts.lock.RLock()
+	defer dts.lock.RUnlock()
+	return withContext(ctx, func() (Page, error) {
+		rows, err := dts.db.QueryContext(ctx, query, args...)
+
+		if err != nil {
+			return Page{}, err
+		}
+
+		defer rows.Close()
+
+		todos := []Todo{}
+
+		for rows.Next() {
+			todo, err := scanTodo(rows)
+			if err != nil {
+				return Page{}, errors.Wrap(err, "Error scanning row")
+			}
+			todos = append(todos, todo)
+		}
+		if err := rows.Err(); err != nil {
+			return Page{}, err
+		}
+
+		page := Page{Todos: todos}
+		if opts.Limit > 0 && len(todos) > opts.Limit {
+			page.Todos = todos[:opts.Limit]
+			page.NextCursor = encodeCursor(opts, page.Todos[opts.Limit-1])
+		}
+
+		log.Info(fmt.Sprintf("Found %d items", len(page.Todos)))
+		return page, nil
+	})
+}
+
+// listQuery builds the SELECT for a page of todos. One row more than the
+// limit is requested so we know whether there is a next page.
+func listQuery(ctx context.Context, opts ListOptions) (string, []any, error) {
+	scope, args := scopeFilter(ctx, "")
+	where := []string{notDeleted + scope}
+
+	if opts.Completed != nil {
+		where = append(where, "completed = ?")
+		args = append(args, *opts.Completed)
+	}
+	if !opts.DueBefore.IsZero() {
+		where = append(where, "time IS NOT NULL AND time < ?")
+		args = append(args, opts.DueBefore)
+	}
+	if !opts.DueAfter.IsZero() {
+		where = append(where, "time IS NOT NULL AND time > ?")
+		args = append(args, opts.DueAfter)
+	}
+	if opts.Query != "" {
+		where = append(where, `description LIKE ? ESCAPE '\'`)
+		args = append(args, "%"+likeEscaper.Replace(opts.Query)+"%")
+	}
+
+	column := "id"
+	switch opts.sortField() {
+	case SortByPosition:
+		column = "position"
+	case SortByTime:
+		column = "COALESCE(time, '')"
+	case SortByDescription:
+		column = "COALESCE(description, '')"
+	}
+	direction, op := "ASC", ">"
+	if opts.Desc {
+		direction, op = "DESC", "<"
+	}
+
+	if opts.Cursor != "" {
+		c, err := decodeCursor(opts.Cursor)
+		if err != nil {
+			return "", nil, err
+		}
+		if opts.sortField() == SortById {
+			where = append(where, "id "+op+" ?")
+			args = append(args, c.Id)
+		} else {
+			where = append(where, fmt.Sprintf("(%[1]s %[2]s ? OR (%[1]s = ? AND id %[2]s ?))", column, op))
+			args = append(args, c.Value, c.Value, c.Id)
+		}
+	}
+
+	query := "SELECT " + todoColumns + " FROM todo WHERE " + strings.Join(where, " AND ")
+	query += fmt.Sprintf(" ORDER BY %s %s", column, direction)
+	if column != "id" {
+		query += ", id " + direction
+	}
+	if opts.Limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, opts.Limit+1)
+	}
+	return query, args, nil
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// WithTx runs fn in a transaction, committing it when fn returns nil and
+// rolling it back otherwise. It holds the write lock, so transactions never
+// interleave with each other or with reads.
+func (d *DbTodoStore) WithTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (t *DbTodoStore) Insert(ctx context.Context, todo Todo) (Todo, error) {
+	log.Info("Inserting todo", todo)
+
+	err := t.WithTx(ctx, func(tx *sql.Tx) (err error) {
+		todo, err = insertTx(ctx, tx, todo)
+		return err
+	})
+	if err != nil {
+		log.Errorf("Error: %s", err)
+		return Todo{}, err
+	}
+	return todo, nil
+}
+
+func (d *DbTodoStore) Update(ctx context.Context, todo Todo) (bool, error) {
+	log.Info(fmt.Sprintf("Updating todo %+v", todo))
+
+	err := d.WithTx(ctx, func(tx *sql.Tx) error {
+		_, err := updateTx(ctx, tx, Ref{Id: todo.Id, Revision: todo.Revision}, todo)
+		return err
+	})
+	if err != nil {
+		log.Infof("Error: %s", err)
+		return false, errors.Wrap(err, "Update failed")
+	}
+	return true, nil
+}
+
+func (d *DbTodoStore) Delete(ctx context.Context, ref Ref) (bool, error) {
+	log.Info(fmt.Sprintf("Deleting todo %d", ref.Id))
+
+	err := d.WithTx(ctx, func(tx *sql.Tx) error {
+		return deleteTx(ctx, tx, ref)
+	})
+	if err != nil {
+		log.Errorf("Error: %s", err)
+		return false, err
+	}
+	return true, nil
+}
+
+func (d *DbTodoStore) Toggle(ctx context.Context, ref Ref) (bool, error) {
+	log.Info(fmt.Sprintf("Toggling complete status for todo %d", ref.Id))
+
+	err := d.WithTx(ctx, func(tx *sql.Tx) error {
+		_, err := toggleTx(ctx, tx, ref)
+		return err
+	})
+	if err != nil {
+		log.Errorf("Error: %s", err)
+		return false, err
+	}
+	return true, nil
+}
+
+// Batch runs every op in one transaction. Failed ops leave nothing behind as
+// each is a single statement, so with ContinueOnError the rest still commit.
+func (d *DbTodoStore) Batch(ctx context.Context, batch Batch) ([]OpResult, error) {
+	log.Info(fmt.Sprintf("Applying batch of %d operations", len(batch.Ops)))
+
+	results := make([]OpResult, len(batch.Ops))
+	err := d.WithTx(ctx, func(tx *sql.Tx) error {
+		for i, op := range batch.Ops {
+			todo, err := applyTx(ctx, tx, op)
+			if err != nil && !batch.ContinueOnError {
+				return &BatchError{Index: i, Err: err}
+			}
+			results[i] = OpResult{Todo: todo, Err: err}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Errorf("Error: %s", err)
+		return nil, err
+	}
+	return results, nil
+}
+
+func (d *DbTodoStore) CompleteAll(ctx context.Context) (int, error) {
+	log.Info("Completing all todos")
+	scope, scopeArgs := scopeFilter(ctx, "")
+	return d.writeEach(ctx, func(todo Todo) Event {
+		before := todo
+		before.Completed, before.Revision = false, todo.Revision-1
+		return newEvent(ctx, EventComplete, &before, &todo)
+	}, "UPDATE todo SET completed=1, revision=revision+1 WHERE NOT completed AND "+notDeleted+scope+" RETURNING "+todoColumns, scopeArgs...)
+}
+
+func (d *DbTodoStore) DeleteCompleted(ctx context.Context) (int, error) {
+	log.Info("Deleting completed todos")
+	scope, scopeArgs := scopeFilter(ctx, "")
+	return d.writeEach(ctx, func(todo Todo) Event {
+		return deletedEvent(ctx, todo)
+	}, "UPDATE todo SET deleted_at=?, revision=revision+1 WHERE completed AND "+notDeleted+scope+" RETURNING "+todoColumns,
+		append([]any{NewTimestamp(time.Now())}, scopeArgs...)...)
+}
+
+// writeEach runs a write returning the todo columns of every row it changed
+// and records the event made of each row, all in one transaction. It returns
+// the number of rows changed.
+func (d *DbTodoStore) writeEach(ctx context.Context, event func(todo Todo) Event, query string, args ...any) (int, error) {
+	var n int
+	err := d.WithTx(ctx, func(tx *sql.Tx) error {
+		rows, err := tx.QueryContext(ctx, query, args...)
+		if err != nil {
+			return err
+		}
+		var todos []Todo
+		for rows.Next() {
+			todo, err := scanTodo(rows)
+			if err != nil {
+				rows.Close()
+				return err
+			}
+			todos = append(todos, todo)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		for _, todo := range todos {
+			if err := recordTx(ctx, tx, event(todo)); err != nil {
+				return err
+			}
+		}
+		n = len(todos)
+		return nil
+	})
+	if err != nil {
+		log.Errorf("Error: %s", err)
+		return 0, err
+	}
+	return n, nil
+}
+
+// applyTx performs one op of a batch.
+func applyTx(ctx context.Context, tx *sql.Tx, op Op) (Todo, error) {
+	switch op.Kind {
+	case OpCreate:
+		return insertTx(ctx, tx, op.Todo)
+	case OpUpdate:
+		return updateTx(ctx, tx, op.Ref, op.Todo)
+	case OpDelete:
+		return Todo{Id: op.Ref.Id}, deleteTx(ctx, tx, op.Ref)
+	case OpToggle:
+		return toggleTx(ctx, tx, op.Ref)
+	default:
+		return Todo{}, unknownOp(op.Kind)
+	}
+}
+
+func insertTx(ctx context.Context, tx *sql.Tx, todo Todo) (Todo, error) {
+	owner, _ := OwnerFrom(ctx)
+	list, _ := ListFrom(ctx)
+	// The trash counts so restored todos keep a position of their own.
+	scope, scopeArgs := scopeFilter(ctx, "")
+	var last string
+	if err := tx.QueryRowContext(ctx, "SELECT COALESCE(MAX(position), '') FROM todo WHERE TRUE"+scope, scopeArgs...).Scan(&last); err != nil {
+		return Todo{}, err
+	}
+	position, err := positionBetween(last, "")
+	if err != nil {
+		return Todo{}, err
+	}
+	row := tx.QueryRowContext(ctx, "INSERT INTO todo(time, description, completed, owner_id, list_id, position) VALUES(?,?,?,?,?,?) RETURNING "+todoColumns,
+		todo.Time, todo.Description, todo.Completed, owner, list, position)
+	todo, err = scanTodo(row)
+	if err != nil {
+		return Todo{}, err
+	}
+	return todo, recordTx(ctx, tx, newEvent(ctx, EventCreate, nil, &todo))
+}
+
+// notDeleted excludes todos in the trash.
+const notDeleted = "deleted_at IS NULL"
+
+// The write statements only match the row when it is not in the trash and
+// revision is 0 or the current revision, and bump it on success.
+const revisionMatches = "id=? AND " + notDeleted + " AND (?=0 OR revision=?)"
+
+// refMatches is revisionMatches for a ref, limited to the todos the context
+// is scoped to, and its arguments.
+func refMatches(ctx context.Context, ref Ref) (string, []any) {
+	scope, scopeArgs := scopeFilter(ctx, "")
+	return revisionMatches + scope, append([]any{ref.Id, ref.Revision, ref.Revision}, scopeArgs...)
+}
+
+// updateTx reads the todo first as the event needs the values it replaces.
+func updateTx(ctx context.Context, tx *sql.Tx, ref Ref, todo Todo) (Todo, error) {
+	where, args := refMatches(ctx, ref)
+	before, err := scanTodo(tx.QueryRowContext(ctx, "SELECT "+todoColumns+" FROM todo WHERE "+where, args...))
+	if err != nil {
+		return Todo{}, checkWritten(ctx, tx, err, ref)
+	}
+
+	row := tx.QueryRowContext(ctx, "UPDATE todo SET time=?, description=?, revision=revision+1 WHERE id=? RETURNING "+todoColumns,
+		todo.Time, todo.Description, ref.Id)
+	if todo, err = scanTodo(row); err != nil {
+		return Todo{}, err
+	}
+	return todo, recordTx(ctx, tx, newEvent(ctx, EventUpdate, &before, &todo))
+}
+
+func deleteTx(ctx context.Context, tx *sql.Tx, ref Ref) error {
+	where, args := refMatches(ctx, ref)
+	row := tx.QueryRowContext(ctx, "UPDATE todo SET deleted_at=?, revision=revision+1 WHERE "+where+" RETURNING "+todoColumns,
+		append([]any{NewTimestamp(time.Now())}, args...)...)
+	todo, err := scanTodo(row)
+	if err != nil {
+		return checkWritten(ctx, tx, err, ref)
+	}
+	return recordTx(ctx, tx, deletedEvent(ctx, todo))
+}
+
+// deletedEvent records moving a todo to the trash, given the todo as it was
+// written there.
+func deletedEvent(ctx context.Context, trashed Todo) Event {
+	before := trashed
+	before.Revision--
+	return newEvent(ctx, EventDelete, &before, nil)
+}
+
+// toggleTx flips completed in a single statement, so concurrent toggles can
+// never read the same value and lose an update.
+func toggleTx(ctx context.Context, tx *sql.Tx, ref Ref) (Todo, error) {
+	where, args := refMatches(ctx, ref)
+	row := tx.QueryRowContext(ctx, "UPDATE todo SET completed = NOT completed, revision=revision+1 WHERE "+where+" RETURNING "+todoColumns, args...)
+	todo, err := scanTodo(row)
+	if err != nil {
+		return Todo{}, checkWritten(ctx, tx, err, ref)
+	}
+	before := todo
+	before.Completed, before.Revision = !todo.Completed, todo.Revision-1
+	return todo, recordTx(ctx, tx, newEvent(ctx, EventToggle, &before, &todo))
+}
+
+// Patch reads, patches and writes the todo in one transaction so concurrent
+// writers cannot interleave with it.
+func (d *DbTodoStore) Patch(ctx context.Context, ref Ref, patch Patch) (Todo, error) {
+	log.Info(fmt.Sprintf("Patching todo %d", ref.Id))
+
+	var patched Todo
+	err := d.WithTx(ctx, func(tx *sql.Tx) error {
+		where, args := refMatches(ctx, Ref{Id: ref.Id})
+		todo, err := scanTodo(tx.QueryRowContext(ctx, "SELECT "+todoColumns+" FROM todo WHERE "+where, args...))
+		if err != nil {
+			return checkWritten(ctx, tx, err, ref)
+		}
+		if ref.Revision != 0 && ref.Revision != todo.Revision {
+			return errors.Wrapf(ErrRevisionMismatch, "Id %d is at revision %d, not %d", ref.Id, todo.Revision, ref.Revision)
+		}
+
+		if patched, err = patch.Apply(todo); err != nil {
+			return err
+		}
+		row := tx.QueryRowContext(ctx, "UPDATE todo SET time=?, description=?, completed=?, revision=revision+1 WHERE id=? RETURNING "+todoColumns,
+			patched.Time, patched.Description, patched.Completed, ref.Id)
+		if patched, err = scanTodo(row); err != nil {
+			return err
+		}
+		return recordTx(ctx, tx, newEvent(ctx, EventPatch, &todo, &patched))
+	})
+	if err != nil {
+		return Todo{}, err
+	}
+	return patched, nil
+}
+
+// checkWritten turns a conditional write that matched no row into
+// ErrNotFound or ErrRevisionMismatch. Other errors are returned unchanged.
+func checkWritten(ctx context.Context, tx *sql.Tx, err error, ref Ref) error {
+	if !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+
+	var revision int
+	where, args := refMatches(ctx, Ref{Id: ref.Id})
+	if err := tx.QueryRowContext(ctx, "SELECT revision FROM todo WHERE "+where, args...).Scan(&revision); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return errors.Wrapf(ErrNotFound, "Id %d", ref.Id)
+		}
+		return err
+	}
+	return errors.Wrapf(ErrRevisionMismatch, "Id %d is at revision %d, not %d", ref.Id, revision, ref.Revision)
+}
+
+func (d *DbTodoStore) Trash(ctx context.Context) ([]TrashedTodo, error) {
+	log.Info("Getting trash")
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+
+	scope, scopeArgs := scopeFilter(ctx, "")
+	return withContext(ctx, func() ([]TrashedTodo, error) {
+		rows, err := d.db.QueryContext(ctx, "SELECT "+todoColumns+", deleted_at FROM todo WHERE deleted_at IS NOT NULL"+scope+" ORDER BY deleted_at DESC, id DESC", scopeArgs...)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+
+		trash := []TrashedTodo{}
+		for rows.Next() {
+			var t TrashedTodo
+			if err := rows.Scan(&t.Id, &t.Time, &t.Description, &t.Completed, &t.Revision, &t.Position, &t.Section, &t.DeletedAt); err != nil {
+				return nil, errors.Wrap(err, "Error scanning row")
+			}
+			trash = append(trash, t)
+		}
+		return trash, rows.Err()
+	})
+}
+
+func (d *DbTodoStore) Restore(ctx context.Context, ref Ref) (Todo, error) {
+	log.Info(fmt.Sprintf("Restoring todo %d", ref.Id))
+
+	var todo Todo
+	err := d.WithTx(ctx, func(tx *sql.Tx) error {
+		var revision int
+		scope, scopeArgs := scopeFilter(ctx, "")
+		err := tx.QueryRowContext(ctx, "SELECT revision FROM todo WHERE id=? AND deleted_at IS NOT NULL"+scope, append([]any{ref.Id}, scopeArgs...)...).Scan(&revision)
+		if errors.Is(err, sql.ErrNoRows) {
+			return errors.Wrapf(ErrNotFound, "Id %d is not in the trash", ref.Id)
+		}
+		if err != nil {
+			return err
+		}
+		if ref.Revision != 0 && ref.Revision != revision {
+			return errors.Wrapf(ErrRevisionMismatch, "Id %d is at revision %d, not %d", ref.Id, revision, ref.Revision)
+		}
+
+		row := tx.QueryRowContext(ctx, "UPDATE todo SET deleted_at=NULL, revision=revision+1 WHERE id=? RETURNING "+todoColumns, ref.Id)
+		if todo, err = scanTodo(row); err != nil {
+			return err
+		}
+		return recordTx(ctx, tx, newEvent(ctx, EventRestore, nil, &todo))
+	})
+	if err != nil {
+		log.Errorf("Error: %s", err)
+		return Todo{}, err
+	}
+	return todo, nil
+}
+
+func (d *DbTodoStore) Purge(ctx context.Context, before time.Time) (int, error) {
+	log.Info(fmt.Sprintf("Purging todos deleted before %s", before))
+	scope, scopeArgs := scopeFilter(ctx, "")
+	return d.writeEach(ctx, func(todo Todo) Event {
+		return newEvent(ctx, EventPurge, &todo, nil)
+	}, "DELETE FROM todo WHERE deleted_at < ?"+scope+" RETURNING "+todoColumns, append([]any{NewTimestamp(before)}, scopeArgs...)...)
+}
+
+func (dts *DbTodoStore) Close() {
+	dts.db.Close()
+}
+
+func prepareGet(db *sql.DB) (*sql.Stmt, error) {
+	return db.Prepare("SELECT " + todoColumns + " FROM todo WHERE id=?")
+}
+
+// todoColumns are the columns scanTodo expects, in order.
+const todoColumns = "id, time, description, completed, revision, position, section_id"
+
+func scanTodo(row interface{ Scan(dest ...any) error }) (Todo, error) {
+	todo := Todo{}
+	err := row.Scan(&todo.Id, &todo.Time, &todo.Description, &todo.Completed, &todo.Revision, &todo.Position, &todo.Section)
+	return todo, err
+}
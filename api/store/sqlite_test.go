@@ -0,0 +1,69 @@
+package store_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/mcadenas-bjss/go-do-it/store"
+)
+
+func TestConcurrentWrites(t *testing.T) {
+	ctx := context.Background()
+	os.Setenv("env", "test")
+
+	s, err := store.NewDbTodoStore("file:concurrent?mode=memory&cache=shared")
+	if errors.Is(err, store.ErrNoFTS5) {
+		t.Skip(err)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	milk, err := s.Insert(ctx, store.Todo{Description: "Buy milk"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const toggles, patches, reads = 101, 20, 50
+	var wg sync.WaitGroup
+	errs := make(chan error, toggles+patches+reads)
+	run := func(n int, op func() error) {
+		for i := 0; i < n; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if err := op(); err != nil {
+					errs <- err
+				}
+			}()
+		}
+	}
+
+	run(toggles, func() error {
+		_, err := s.Toggle(ctx, store.Ref{Id: milk.Id})
+		return err
+	})
+	run(patches, func() error {
+		_, err := s.Patch(ctx, store.Ref{Id: milk.Id}, store.MergePatch(`{"Description": "Buy oat milk"}`))
+		return err
+	})
+	run(reads, func() error {
+		_, err := s.Get(ctx, milk.Id)
+		return err
+	})
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+
+	got, err := s.Get(ctx, milk.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertTodo(t, got, store.Todo{Id: milk.Id, Description: "Buy oat milk", Completed: toggles%2 == 1, Revision: 1 + toggles + patches})
+}
@@ -2,306 +2,83 @@ package store
 
 import (
 	"context"
-	"database/sql"
-	"fmt"
-	"os"
-	"sync"
+	"time"
 
-	_ "github.com/mattn/go-sqlite3"
 	"github.com/mcadenas-bjss/go-do-it/logger"
+	"github.com/mcadenas-bjss/go-do-it/validate"
 	"github.com/pkg/errors"
 )
 
 var log = logger.NewLogger(nil)
 
-const create string = `
-  CREATE TABLE IF NOT EXISTS todo (
-  id INTEGER NOT NULL PRIMARY KEY,
-  time TEXT,
-  description TEXT,
-  completed BOOLEAN NOT NULL DEFAULT FALSE
-  );`
+// Errors returned by every TodoStore, wrapped with details. Check for them
+// with errors.Is.
+var (
+	ErrNotFound   = errors.New("todo not found")
+	ErrConflict   = errors.New("todo was changed concurrently")
+	ErrValidation = validate.ErrInvalid
 
-func NewDbTodoStore(file string) (*DbTodoStore, error) {
-	env := os.Getenv("env")
-	log.Info("Running on " + env)
-	log.Info(fmt.Sprintf("Opening sqlite file at %s", file))
-	db, err := sql.Open("sqlite3", file)
-	if err != nil {
-		return nil, err
-	}
-	if _, err := db.Exec(create); err != nil {
-		return nil, err
-	}
-
-	insert, err := db.Prepare("INSERT INTO todo VALUES(NULL,?,?,?);")
-	if err != nil {
-		return nil, err
-	}
-	defer insert.Close()
-
-	list, err := db.Prepare("SELECT * FROM todo")
-	if err != nil {
-		return nil, err
-	}
-	defer list.Close()
-
-	// Seed data if db empty
-	if rows, err := list.Query(); err == nil && env != "test" {
-		if !rows.Next() {
-			log.Info("Seeding data")
-			insert.Exec("2020-01-01T00:00:00Z", "test", false)
-		}
-		rows.Close()
-	}
-
-	return &DbTodoStore{
-		db:   db,
-		lock: sync.RWMutex{},
-	}, nil
-}
-
-type DbTodoStore struct {
-	db             *sql.DB
-	CommandChannel chan Command
-	lock           sync.RWMutex
-}
+	// ErrRevisionMismatch is a conflict caused by writing with a stale
+	// revision.
+	ErrRevisionMismatch = errors.Wrap(ErrConflict, "revision mismatch")
+)
 
 type Todo struct {
 	Id          int
-	Time        string
+	Time        Timestamp
 	Description string
 	Completed   bool
+	// Revision starts at 1 and is incremented by every write.
+	Revision int
+	// Position orders the todos of a list when compared as strings. New
+	// todos are added last, and Move places them anywhere else.
+	Position string
+	// Section is the id of the section the todo is in, or 0 for none.
+	Section int `json:",omitempty"`
 }
 
-type CommandType int
-
-const (
-	GetCommand = iota
-	GetAllCommand
-	InsertCommand
-	UpdateCommand
-	DeleteCommand
-	ToggleCommand
-)
-
-type Command struct {
-	Cmd     CommandType
-	Ctx     context.Context
-	Payload interface{}
-	Reply   chan interface{}
-	Err     chan error
-}
-
-func (dts *DbTodoStore) StartManager() chan<- Command {
-	cmds := make(chan Command)
-
-	go func() {
-		for cmd := range cmds {
-			switch cmd.Cmd {
-			case GetCommand:
-				if todo, err := dts.get(cmd.Ctx, cmd.Payload.(int)); err != nil {
-					cmd.Err <- err
-				} else {
-					cmd.Reply <- todo
-				}
-			case GetAllCommand:
-				if todos, err := dts.all(cmd.Ctx); err != nil {
-					cmd.Err <- err
-				} else {
-					cmd.Reply <- todos
-				}
-			case InsertCommand:
-				if id, err := dts.insert(cmd.Ctx, cmd.Payload.(Todo)); err != nil {
-					cmd.Err <- err
-				} else {
-					cmd.Reply <- id
-				}
-			case UpdateCommand:
-				if ok, err := dts.update(cmd.Ctx, cmd.Payload.(Todo)); err != nil {
-					cmd.Err <- err
-				} else {
-					cmd.Reply <- ok
-				}
-			case DeleteCommand:
-				if ok, err := dts.delete(cmd.Ctx, cmd.Payload.(int)); err != nil {
-					cmd.Err <- err
-				} else {
-					cmd.Reply <- ok
-				}
-			case ToggleCommand:
-				if ok, err := dts.toggle(cmd.Ctx, cmd.Payload.(int)); err != nil {
-					cmd.Err <- err
-				} else {
-					cmd.Reply <- ok
-				}
-			default:
-				log.Fatal("unknown command type", cmd.Cmd)
-			}
-		}
-	}()
-	return cmds
-}
-
-func withContext[T any](ctx context.Context, def func() (T, error)) (T, error) {
-	data := make(chan T)
-	e := make(chan error)
-
-	go func() {
-		var result T
-		select {
-		case <-ctx.Done():
-			return
-		default:
-			if res, err := def(); err != nil {
-				e <- err
-				close(e)
-				return
-			} else {
-				result = res
-			}
-		}
-		data <- result
-		close(data)
-	}()
-
-	var t T
-	select {
-	case <-ctx.Done():
-		log.Error("Connection closed")
-		return t, ctx.Err()
-	case result := <-data:
-		log.Info(fmt.Sprintf("%+v", result))
-		return result, nil
-	case err := <-e:
-		log.Info(fmt.Sprintf("%v", err))
-		return t, err
-	}
-}
-
-func (dts *DbTodoStore) get(ctx context.Context, id int) (Todo, error) {
-	log.Info(fmt.Sprintf("Getting todo item: %d", id))
-
-	return withContext(ctx, func() (Todo, error) {
-		row := dts.db.QueryRowContext(ctx, "SELECT * FROM todo WHERE id=?", id)
-		todo := Todo{}
-		if err := row.Scan(&todo.Id, &todo.Time, &todo.Description, &todo.Completed); err != nil {
-			return Todo{}, errors.Wrap(err, "Id not found")
-		}
-
-		return todo, nil
-	})
-
-}
-
-func (dts *DbTodoStore) all(ctx context.Context) ([]Todo, error) {
-	log.Info("Getting all todos")
-
-	return withContext(ctx, func() ([]Todo, error) {
-		rows, err := dts.db.QueryContext(ctx, "SELECT * FROM todo")
-
-		if err != nil {
-			return nil, err
-		}
-
-		defer rows.Close()
-
-		todos := []Todo{}
-
-		for rows.Next() {
-			todo := Todo{}
-			if err := rows.Scan(&todo.Id, &todo.Time, &todo.Description, &todo.Completed); err != nil {
-				return nil, errors.Wrap(err, "Error scanning row")
-			}
-			todos = append(todos, todo)
-		}
-
-		log.Info(fmt.Sprintf("Found %d items", len(todos)))
-		return todos, nil
-	})
-}
-
-func (t *DbTodoStore) insert(ctx context.Context, todo Todo) (int, error) {
-	log.Info("Inserting todo", todo)
-
-	return withContext(ctx, func() (int, error) {
-		res, err := t.db.ExecContext(ctx, "INSERT INTO todo VALUES(NULL,?,?,?);", todo.Time, todo.Description, todo.Completed)
-		if err != nil {
-			log.Errorf("Error: %s", err)
-			return 0, err
-		}
-
-		id, err := res.LastInsertId()
-		if err != nil {
-			log.Errorf("Error: %s", err)
-			return 0, err
-		}
-
-		return int(id), nil
-	})
-
-}
-
-func (d *DbTodoStore) update(ctx context.Context, todo Todo) (bool, error) {
-	log.Info(fmt.Sprintf("Updating todo %+v", todo))
-
-	return withContext(ctx, func() (bool, error) {
-		res, err := d.db.ExecContext(ctx, "UPDATE todo SET time=?, description=? WHERE id=?", todo.Time, todo.Description, todo.Id)
-		if err != nil {
-			log.Infof("Error: %s", err)
-			return false, errors.Wrap(err, "Update failed")
-		}
-		if n, e := res.RowsAffected(); n != 1 {
-			log.Infof("Error: %s", e)
-			return false, e
-		}
-		return true, nil
-	})
-
-}
-
-func (d *DbTodoStore) delete(ctx context.Context, id int) (bool, error) {
-	log.Info(fmt.Sprintf("Deleting todo %d", id))
-	return withContext(ctx, func() (bool, error) {
-
-		res, err := d.db.ExecContext(ctx, "DELETE FROM todo WHERE id=?", id)
-		if err != nil {
-			log.Errorf("Error: %s", err)
-			return false, err
-		}
-		if n, e := res.RowsAffected(); n > 1 {
-			log.Errorf("Error: %s", e)
-			return false, e
-		}
-		return true, nil
-	})
-}
-
-func (d *DbTodoStore) toggle(ctx context.Context, id int) (bool, error) {
-	log.Info(fmt.Sprintf("Toggling complete status for todo %d", id))
-	return withContext(ctx, func() (bool, error) {
-		todo, e := d.get(ctx, id)
-		if e != nil {
-			log.Errorf("Error: %s", e)
-			return false, e
-		}
-		res, err := d.db.ExecContext(ctx, "UPDATE todo SET completed=? WHERE id=?", !todo.Completed, id)
-		if err != nil {
-			log.Errorf("Error: %s", err)
-			return false, err
-		}
-		if n, e := res.RowsAffected(); n != 1 {
-			log.Errorf("Error: %s", e)
-			return false, e
-		}
-		return true, nil
-	})
-}
-
-func (dts *DbTodoStore) Close() {
-	dts.db.Close()
+// Ref names the todo a write applies to. When Revision is not zero the write
+// fails with ErrRevisionMismatch unless it is the todo's current revision.
+type Ref struct {
+	Id       int
+	Revision int
 }
 
-func prepareGet(db *sql.DB) (*sql.Stmt, error) {
-	return db.Prepare("SELECT * FROM todo WHERE id=?")
+// TodoStore is implemented by every storage backend. The command manager is
+// built on top of it, so a backend only has to provide the data access. Every
+// write appends an Event for each todo it changes, made by the actor set with
+// WithActor.
+type TodoStore interface {
+	Get(ctx context.Context, id int) (Todo, error)
+	List(ctx context.Context, opts ListOptions) (Page, error)
+	// Insert returns the stored todo, with its id, revision and position.
+	Insert(ctx context.Context, todo Todo) (Todo, error)
+	// Update checks todo.Revision the same way as a Ref.
+	Update(ctx context.Context, todo Todo) (bool, error)
+	// Delete moves a todo to the trash, where every other method but Trash,
+	// Restore and Purge ignores it.
+	Delete(ctx context.Context, ref Ref) (bool, error)
+	Toggle(ctx context.Context, ref Ref) (bool, error)
+	Patch(ctx context.Context, ref Ref, patch Patch) (Todo, error)
+	// Move only changes the position and section of the todo it moves.
+	Move(ctx context.Context, ref Ref, move Move) (Todo, error)
+	// Batch returns one result per op, in order.
+	Batch(ctx context.Context, batch Batch) ([]OpResult, error)
+	// CompleteAll and DeleteCompleted return how many todos they changed.
+	CompleteAll(ctx context.Context) (int, error)
+	DeleteCompleted(ctx context.Context) (int, error)
+	// Trash lists deleted todos, most recently deleted first.
+	Trash(ctx context.Context) ([]TrashedTodo, error)
+	Restore(ctx context.Context, ref Ref) (Todo, error)
+	// Purge permanently removes todos deleted before the given time and
+	// returns how many there were.
+	Purge(ctx context.Context, before time.Time) (int, error)
+	// History lists the events of one todo, oldest first. It fails with
+	// ErrNotFound for a todo that never existed.
+	History(ctx context.Context, id int) ([]Event, error)
+	Events(ctx context.Context, q EventQuery) ([]Event, error)
+	// LastEventId returns the id of the newest event of any user, or 0 when
+	// nothing has been written yet.
+	LastEventId(ctx context.Context) (int, error)
+	Search(ctx context.Context, q SearchQuery) ([]SearchResult, error)
 }
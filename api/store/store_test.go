@@ -0,0 +1,199 @@
+package store_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mcadenas-bjss/go-do-it/store"
+)
+
+// newStores returns one empty instance of every backend, keyed by name.
+func newStores(t *testing.T) map[string]store.TodoStore {
+	t.Helper()
+	os.Setenv("env", "test")
+
+	file, err := store.NewFileTodoStore(filepath.Join(t.TempDir(), "todo.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	stores := map[string]store.TodoStore{
+		"memory": store.NewMemoryTodoStore(),
+		"file":   file,
+	}
+
+	// sqlite needs the sqlite_fts5 build tag, which make test sets.
+	db, err := store.NewDbTodoStore(fmt.Sprintf("file:%s?mode=memory&cache=shared", t.Name()))
+	switch {
+	case errors.Is(err, store.ErrNoFTS5):
+		t.Logf("skipping sqlite: %v", err)
+	case err != nil:
+		t.Fatal(err)
+	default:
+		t.Cleanup(db.Close)
+		stores["sqlite"] = db
+	}
+	return stores
+}
+
+func TestBackends(t *testing.T) {
+	ctx := context.Background()
+
+	for name, s := range newStores(t) {
+		t.Run(name, func(t *testing.T) {
+			milk, err := s.Insert(ctx, store.Todo{Time: due("2024-01-01T00:00:00Z"), Description: "Buy milk"})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := s.Get(ctx, milk.Id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assertTodo(t, got, store.Todo{Id: milk.Id, Time: due("2024-01-01T00:00:00Z"), Description: "Buy milk", Revision: 1})
+			if milk.Position == "" {
+				t.Error("want the inserted todo to have a position")
+			}
+			assertTodo(t, milk, got)
+
+			if _, err := s.Update(ctx, store.Todo{Id: milk.Id, Time: due("2024-01-02T00:00:00Z"), Description: "Buy oat milk"}); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := s.Toggle(ctx, store.Ref{Id: milk.Id}); err != nil {
+				t.Fatal(err)
+			}
+
+			page, err := s.List(ctx, store.ListOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			todos := page.Todos
+			if len(todos) != 1 {
+				t.Fatalf("expected 1 todo, got %d", len(todos))
+			}
+			assertTodo(t, todos[0], store.Todo{Id: milk.Id, Time: due("2024-01-02T00:00:00Z"), Description: "Buy oat milk", Completed: true, Revision: 3})
+
+			if _, err := s.Delete(ctx, store.Ref{Id: milk.Id}); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := s.Get(ctx, milk.Id); !errors.Is(err, store.ErrNotFound) {
+				t.Errorf("got %v getting a deleted todo, want %v", err, store.ErrNotFound)
+			}
+			if _, err := s.Update(ctx, store.Todo{Id: milk.Id, Description: "Gone"}); !errors.Is(err, store.ErrNotFound) {
+				t.Errorf("got %v updating a deleted todo, want %v", err, store.ErrNotFound)
+			}
+			if _, err := s.Toggle(ctx, store.Ref{Id: milk.Id}); !errors.Is(err, store.ErrNotFound) {
+				t.Errorf("got %v toggling a deleted todo, want %v", err, store.ErrNotFound)
+			}
+			if _, err := s.Delete(ctx, store.Ref{Id: milk.Id}); !errors.Is(err, store.ErrNotFound) {
+				t.Errorf("got %v deleting a deleted todo, want %v", err, store.ErrNotFound)
+			}
+		})
+	}
+}
+
+func TestRevisions(t *testing.T) {
+	ctx := context.Background()
+
+	for name, s := range newStores(t) {
+		t.Run(name, func(t *testing.T) {
+			milk, err := s.Insert(ctx, store.Todo{Description: "Buy milk"})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := s.Update(ctx, store.Todo{Id: milk.Id, Description: "Buy oat milk", Revision: 1}); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := s.Toggle(ctx, store.Ref{Id: milk.Id, Revision: 2}); err != nil {
+				t.Fatal(err)
+			}
+
+			stale := []struct {
+				name string
+				err  error
+			}{
+				{"update", func() error {
+					_, err := s.Update(ctx, store.Todo{Id: milk.Id, Description: "Buy bread", Revision: 1})
+					return err
+				}()},
+				{"toggle", func() error { _, err := s.Toggle(ctx, store.Ref{Id: milk.Id, Revision: 2}); return err }()},
+				{"patch", func() error {
+					_, err := s.Patch(ctx, store.Ref{Id: milk.Id, Revision: 2}, store.MergePatch(`{"Completed": false}`))
+					return err
+				}()},
+				{"delete", func() error { _, err := s.Delete(ctx, store.Ref{Id: milk.Id, Revision: 2}); return err }()},
+			}
+			for _, tt := range stale {
+				if !errors.Is(tt.err, store.ErrRevisionMismatch) || !errors.Is(tt.err, store.ErrConflict) {
+					t.Errorf("stale %s: got %v want %v", tt.name, tt.err, store.ErrRevisionMismatch)
+				}
+			}
+
+			got, err := s.Get(ctx, milk.Id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assertTodo(t, got, store.Todo{Id: milk.Id, Description: "Buy oat milk", Completed: true, Revision: 3})
+
+			if _, err := s.Delete(ctx, store.Ref{Id: milk.Id, Revision: 3}); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestFileStoreReloads(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "todo.json")
+
+	first, err := store.NewFileTodoStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	persisted, err := first.Insert(ctx, store.Todo{Description: "Persist me"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	second, err := store.NewFileTodoStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := second.Get(ctx, persisted.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertTodo(t, got, store.Todo{Id: persisted.Id, Description: "Persist me", Revision: 1})
+
+	next, err := second.Insert(ctx, store.Todo{Description: "Next"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next.Id == persisted.Id {
+		t.Errorf("expected a new id after reload, got %d again", next.Id)
+	}
+}
+
+// assertTodo compares the position only when want has one, as where a todo
+// lands is up to the store.
+func assertTodo(t testing.TB, got, want store.Todo) {
+	t.Helper()
+	if want.Position == "" {
+		got.Position = ""
+	}
+	if got != want {
+		t.Errorf("got %+v want %+v", got, want)
+	}
+}
+
+func due(s string) store.Timestamp {
+	ts, err := store.ParseTimestamp(s)
+	if err != nil {
+		panic(err)
+	}
+	return ts
+}
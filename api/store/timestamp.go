@@ -0,0 +1,161 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// timestampLayout is how due dates are stored. It is fixed width and always
+// UTC so stored values sort chronologically as text.
+const timestampLayout = "2006-01-02T15:04:05Z"
+
+// legacyLayouts are the formats accepted from older databases besides
+// RFC 3339. Values without an offset are taken to be UTC.
+var legacyLayouts = []string{
+	"2006-01-02T15:04:05Z0700",
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+}
+
+// Timestamp is an optional point in time, such as a todo's due date. The zero
+// value means it is not set. It is encoded as an RFC 3339 string in JSON, or
+// null when unset, and stored as UTC text in sqlite.
+type Timestamp struct {
+	time.Time
+}
+
+func NewTimestamp(t time.Time) Timestamp {
+	if t.IsZero() {
+		return Timestamp{}
+	}
+	return Timestamp{t.UTC().Truncate(time.Second)}
+}
+
+// ParseTimestamp parses an RFC 3339 string. An empty string is the zero
+// Timestamp.
+func ParseTimestamp(s string) (Timestamp, error) {
+	if s == "" {
+		return Timestamp{}, nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return Timestamp{}, err
+	}
+	return NewTimestamp(t), nil
+}
+
+func (t Timestamp) String() string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(timestampLayout)
+}
+
+func (t Timestamp) MarshalJSON() ([]byte, error) {
+	if t.IsZero() {
+		return []byte("null"), nil
+	}
+	return json.Marshal(t.String())
+}
+
+// UnmarshalJSON accepts an RFC 3339 string, or null or "" for no time.
+func (t *Timestamp) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		*t = Timestamp{}
+		return nil
+	}
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	parsed, err := ParseTimestamp(s)
+	if err != nil {
+		return err
+	}
+	*t = parsed
+	return nil
+}
+
+func (t Timestamp) Value() (driver.Value, error) {
+	if t.IsZero() {
+		return nil, nil
+	}
+	return t.String(), nil
+}
+
+func (t *Timestamp) Scan(src any) error {
+	switch v := src.(type) {
+	case nil:
+		*t = Timestamp{}
+	case time.Time:
+		*t = NewTimestamp(v)
+	case string:
+		parsed, err := parseStoredTime(v)
+		if err != nil {
+			return err
+		}
+		*t = parsed
+	case []byte:
+		return t.Scan(string(v))
+	default:
+		return fmt.Errorf("cannot scan %T into Timestamp", src)
+	}
+	return nil
+}
+
+func parseStoredTime(s string) (Timestamp, error) {
+	if s == "" {
+		return Timestamp{}, nil
+	}
+	if ts, err := ParseTimestamp(s); err == nil {
+		return ts, nil
+	}
+	for _, layout := range legacyLayouts {
+		if parsed, err := time.Parse(layout, s); err == nil {
+			return NewTimestamp(parsed), nil
+		}
+	}
+	return Timestamp{}, fmt.Errorf("unrecognised time %q", s)
+}
+
+// normalizeDueTimes rewrites the free-form strings older builds stored in
+// todo.time as UTC timestamps. Values that cannot be parsed are cleared so
+// they stop rendering as year 1.
+func normalizeDueTimes(ctx context.Context, tx *sql.Tx) error {
+	rows, err := tx.QueryContext(ctx, "SELECT id, time FROM todo WHERE time IS NOT NULL")
+	if err != nil {
+		return err
+	}
+
+	converted := make(map[int]Timestamp)
+	for rows.Next() {
+		var id int
+		var raw string
+		if err := rows.Scan(&id, &raw); err != nil {
+			rows.Close()
+			return err
+		}
+		ts, err := parseStoredTime(raw)
+		if err != nil {
+			log.Warn(fmt.Sprintf("Clearing unparseable time %q of todo %d", raw, id))
+		}
+		converted[id] = ts
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for id, ts := range converted {
+		if _, err := tx.ExecContext(ctx, "UPDATE todo SET time=? WHERE id=?", ts, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
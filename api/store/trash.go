@@ -0,0 +1,21 @@
+package store
+
+import (
+	"sort"
+)
+
+// TrashedTodo is a deleted todo, kept until it is restored or purged.
+type TrashedTodo struct {
+	Todo
+	DeletedAt Timestamp
+}
+
+// sortTrash orders the trash most recently deleted first.
+func sortTrash(trash []TrashedTodo) {
+	sort.Slice(trash, func(i, j int) bool {
+		if !trash[i].DeletedAt.Equal(trash[j].DeletedAt.Time) {
+			return trash[i].DeletedAt.After(trash[j].DeletedAt.Time)
+		}
+		return trash[i].Id > trash[j].Id
+	})
+}
@@ -0,0 +1,106 @@
+package store_test
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mcadenas-bjss/go-do-it/store"
+)
+
+func TestTrash(t *testing.T) {
+	ctx := context.Background()
+
+	for name, s := range newStores(t) {
+		t.Run(name, func(t *testing.T) {
+			milk, _ := s.Insert(ctx, store.Todo{Description: "Buy milk"})
+			bread, _ := s.Insert(ctx, store.Todo{Description: "Buy bread"})
+
+			if _, err := s.Delete(ctx, store.Ref{Id: milk.Id}); err != nil {
+				t.Fatal(err)
+			}
+
+			assertTodos(t, s, []store.Todo{{Id: bread.Id, Description: "Buy bread", Revision: 1}})
+			if results, err := s.Search(ctx, store.SearchQuery{Query: "milk"}); err != nil || len(results) != 0 {
+				t.Errorf("got %+v, %v searching the trash", results, err)
+			}
+
+			trash, err := s.Trash(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(trash) != 1 || trash[0].DeletedAt.IsZero() {
+				t.Fatalf("unexpected trash %+v", trash)
+			}
+			assertTodo(t, trash[0].Todo, store.Todo{Id: milk.Id, Description: "Buy milk", Revision: 2})
+
+			t.Run("restores with the current revision", func(t *testing.T) {
+				if _, err := s.Restore(ctx, store.Ref{Id: milk.Id, Revision: 1}); !errors.Is(err, store.ErrRevisionMismatch) {
+					t.Errorf("got %v want %v", err, store.ErrRevisionMismatch)
+				}
+				if _, err := s.Restore(ctx, store.Ref{Id: bread.Id}); !errors.Is(err, store.ErrNotFound) {
+					t.Errorf("got %v restoring a todo not in the trash, want %v", err, store.ErrNotFound)
+				}
+
+				todo, err := s.Restore(ctx, store.Ref{Id: milk.Id, Revision: 2})
+				if err != nil {
+					t.Fatal(err)
+				}
+				assertTodo(t, todo, store.Todo{Id: milk.Id, Description: "Buy milk", Revision: 3})
+				assertTodos(t, s, []store.Todo{
+					{Id: milk.Id, Description: "Buy milk", Revision: 3},
+					{Id: bread.Id, Description: "Buy bread", Revision: 1},
+				})
+			})
+
+			t.Run("purges todos deleted before the cut off", func(t *testing.T) {
+				if _, err := s.Delete(ctx, store.Ref{Id: bread.Id}); err != nil {
+					t.Fatal(err)
+				}
+
+				if n, err := s.Purge(ctx, time.Now().Add(-time.Hour)); err != nil || n != 0 {
+					t.Errorf("purged %d, %v recently deleted todos, want 0", n, err)
+				}
+				if n, err := s.Purge(ctx, time.Now().Add(time.Hour)); err != nil || n != 1 {
+					t.Errorf("purged %d, %v todos, want 1", n, err)
+				}
+				if trash, _ := s.Trash(ctx); len(trash) != 0 {
+					t.Errorf("expected an empty trash, got %+v", trash)
+				}
+				if _, err := s.Restore(ctx, store.Ref{Id: bread.Id}); !errors.Is(err, store.ErrNotFound) {
+					t.Errorf("got %v restoring a purged todo, want %v", err, store.ErrNotFound)
+				}
+			})
+		})
+	}
+}
+
+func TestFileStoreKeepsTrash(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "todo.json")
+
+	first, err := store.NewFileTodoStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	milk, _ := first.Insert(ctx, store.Todo{Description: "Buy milk"})
+	if _, err := first.Delete(ctx, store.Ref{Id: milk.Id}); err != nil {
+		t.Fatal(err)
+	}
+
+	second, err := store.NewFileTodoStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	todo, err := second.Restore(ctx, store.Ref{Id: milk.Id})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertTodo(t, todo, store.Todo{Id: milk.Id, Description: "Buy milk", Revision: 3})
+
+	if next, _ := second.Insert(ctx, store.Todo{Description: "Next"}); next.Id == milk.Id {
+		t.Errorf("expected a new id after reload, got %d again", next.Id)
+	}
+}
@@ -0,0 +1,490 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrUserExists = errors.New("username is taken")
+	// ErrUnauthenticated is returned for unknown usernames and for sessions
+	// and tokens that expired or were revoked.
+	ErrUnauthenticated = errors.New("unauthenticated")
+	ErrTokenNotFound   = errors.New("token not found")
+)
+
+// User is an account. The todos a user creates are only visible to them.
+type User struct {
+	Id        int
+	Username  string
+	CreatedAt Timestamp
+}
+
+// Scope is something an API token is allowed to do.
+type Scope string
+
+const (
+	ScopeTodosRead  Scope = "todos:read"
+	ScopeTodosWrite Scope = "todos:write"
+	// ScopeAdmin allows managing the user's API tokens.
+	ScopeAdmin Scope = "admin"
+)
+
+// Scopes are every scope there is.
+var Scopes = []Scope{ScopeTodosRead, ScopeTodosWrite, ScopeAdmin}
+
+// APIToken is a long lived bearer token a user created for a program such as
+// the desktop app or a CI job. Only a hash of the secret is stored.
+type APIToken struct {
+	Id     int
+	Name   string
+	Scopes []Scope
+	// ExpiresAt is when the token stops working, or zero if it never does.
+	ExpiresAt Timestamp
+	CreatedAt Timestamp
+	// LastUsedAt is recorded at most once per TokenUseInterval.
+	LastUsedAt Timestamp
+}
+
+// TokenUseInterval is how stale an API token's LastUsedAt may get, so busy
+// tokens do not cost a write per request.
+const TokenUseInterval = time.Minute
+
+// expired reports whether the token no longer works.
+func (t APIToken) expired(now time.Time) bool {
+	return !t.ExpiresAt.IsZero() && !t.ExpiresAt.After(now)
+}
+
+// staleUse reports whether the token's last use should be recorded again.
+func (t APIToken) staleUse(now time.Time) bool {
+	return t.LastUsedAt.Before(now.Add(-TokenUseInterval))
+}
+
+// UserStore keeps accounts and the ways of signing in to them. Secrets are
+// hashed by the caller; the store only compares hashes.
+type UserStore interface {
+	// CreateUser fails with ErrUserExists when the username is taken,
+	// ignoring case. The first user takes over the todos created before
+	// there were any users.
+	CreateUser(ctx context.Context, username string, passwordHash []byte) (User, error)
+	// UserByName returns a user and their password hash.
+	UserByName(ctx context.Context, username string) (User, []byte, error)
+	CreateSession(ctx context.Context, userId int, tokenHash string, expires time.Time) error
+	// SessionUser returns the user signed in with a session that has not
+	// expired.
+	SessionUser(ctx context.Context, tokenHash string) (User, error)
+	DeleteSession(ctx context.Context, tokenHash string) error
+	// CreateToken stores a token with the name, scopes and expiry of the
+	// given one, and returns it with its id and creation time.
+	CreateToken(ctx context.Context, userId int, token APIToken, tokenHash string) (APIToken, error)
+	// TokenUser returns a token that has not expired and its user, and
+	// records that it was used.
+	TokenUser(ctx context.Context, tokenHash string) (User, APIToken, error)
+	// Tokens lists the tokens of a user, oldest first.
+	Tokens(ctx context.Context, userId int) ([]APIToken, error)
+	// DeleteToken fails with ErrTokenNotFound unless the token belongs to
+	// the user.
+	DeleteToken(ctx context.Context, userId, tokenId int) error
+}
+
+type ownerKey struct{}
+
+// WithOwner returns a context whose reads and writes only see the personal
+// todos of the user with the given id, and whose new todos belong to them.
+func WithOwner(ctx context.Context, userId int) context.Context {
+	return context.WithValue(ctx, ownerKey{}, userId)
+}
+
+// OwnerFrom returns the user a context is scoped to. Contexts without one,
+// such as the one purging the trash, see the todos of every user.
+func OwnerFrom(ctx context.Context) (int, bool) {
+	owner, ok := ctx.Value(ownerKey{}).(int)
+	return owner, ok
+}
+
+func (d *DbTodoStore) CreateUser(ctx context.Context, username string, passwordHash []byte) (User, error) {
+	log.Info(fmt.Sprintf("Creating user %s", username))
+
+	user := User{Username: username, CreatedAt: NewTimestamp(time.Now())}
+	err := d.WithTx(ctx, func(tx *sql.Tx) error {
+		var users int
+		var taken bool
+		err := tx.QueryRowContext(ctx, "SELECT COUNT(*), EXISTS(SELECT 1 FROM users WHERE username=?) FROM users", username).Scan(&users, &taken)
+		if err != nil {
+			return err
+		}
+		if taken {
+			return errors.Wrapf(ErrUserExists, "%q", username)
+		}
+
+		row := tx.QueryRowContext(ctx, "INSERT INTO users(username, password_hash, created_at) VALUES(?,?,?) RETURNING id", username, passwordHash, user.CreatedAt)
+		if err := row.Scan(&user.Id); err != nil {
+			return err
+		}
+		if users > 0 {
+			return nil
+		}
+		if _, err := tx.ExecContext(ctx, "UPDATE todo SET owner_id=? WHERE owner_id=0", user.Id); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, "UPDATE sections SET owner_id=? WHERE owner_id=0", user.Id); err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, "UPDATE todo_events SET owner_id=? WHERE owner_id=0", user.Id)
+		return err
+	})
+	if err != nil {
+		log.Errorf("Error: %s", err)
+		return User{}, err
+	}
+	return user, nil
+}
+
+func (d *DbTodoStore) UserByName(ctx context.Context, username string) (User, []byte, error) {
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+
+	var user User
+	var hash []byte
+	err := d.db.QueryRowContext(ctx, "SELECT id, username, created_at, password_hash FROM users WHERE username=?", username).
+		Scan(&user.Id, &user.Username, &user.CreatedAt, &hash)
+	if errors.Is(err, sql.ErrNoRows) {
+		return User{}, nil, errors.Wrapf(ErrUnauthenticated, "no user %q", username)
+	}
+	if err != nil {
+		return User{}, nil, err
+	}
+	return user, hash, nil
+}
+
+// CreateSession also removes the sessions that have expired, so they do not
+// pile up.
+func (d *DbTodoStore) CreateSession(ctx context.Context, userId int, tokenHash string, expires time.Time) error {
+	return d.WithTx(ctx, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, "DELETE FROM sessions WHERE expires_at <= ?", NewTimestamp(time.Now())); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, "INSERT INTO sessions(token_hash, user_id, expires_at) VALUES(?,?,?)", tokenHash, userId, NewTimestamp(expires))
+		return err
+	})
+}
+
+func (d *DbTodoStore) SessionUser(ctx context.Context, tokenHash string) (User, error) {
+	return d.queryUser(ctx, "sessions s ON s.user_id=u.id WHERE s.token_hash=? AND s.expires_at > ?", tokenHash, NewTimestamp(time.Now()))
+}
+
+func (d *DbTodoStore) DeleteSession(ctx context.Context, tokenHash string) error {
+	return d.WithTx(ctx, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, "DELETE FROM sessions WHERE token_hash=?", tokenHash)
+		return err
+	})
+}
+
+const tokenColumns = "t.id, t.name, t.scopes, t.expires_at, t.created_at, t.last_used_at"
+
+func (d *DbTodoStore) CreateToken(ctx context.Context, userId int, token APIToken, tokenHash string) (APIToken, error) {
+	log.Info(fmt.Sprintf("Creating token %q for user %d", token.Name, userId))
+
+	token = APIToken{Name: token.Name, Scopes: token.Scopes, ExpiresAt: NewTimestamp(token.ExpiresAt.Time), CreatedAt: NewTimestamp(time.Now())}
+	err := d.WithTx(ctx, func(tx *sql.Tx) error {
+		row := tx.QueryRowContext(ctx, "INSERT INTO api_tokens(user_id, name, scopes, expires_at, token_hash, created_at) VALUES(?,?,?,?,?,?) RETURNING id",
+			userId, token.Name, joinScopes(token.Scopes), token.ExpiresAt, tokenHash, token.CreatedAt)
+		return row.Scan(&token.Id)
+	})
+	if err != nil {
+		return APIToken{}, err
+	}
+	return token, nil
+}
+
+func (d *DbTodoStore) TokenUser(ctx context.Context, tokenHash string) (User, APIToken, error) {
+	d.lock.RLock()
+	var user User
+	token, err := scanToken(d.db.QueryRowContext(ctx, "SELECT "+tokenColumns+", u.id, u.username, u.created_at FROM api_tokens t JOIN users u ON t.user_id=u.id WHERE t.token_hash=?", tokenHash),
+		&user.Id, &user.Username, &user.CreatedAt)
+	d.lock.RUnlock()
+	now := time.Now()
+	if errors.Is(err, sql.ErrNoRows) || err == nil && token.expired(now) {
+		return User{}, APIToken{}, ErrUnauthenticated
+	}
+	if err != nil {
+		return User{}, APIToken{}, err
+	}
+
+	if token.staleUse(now) {
+		token.LastUsedAt = NewTimestamp(now)
+		err = d.WithTx(ctx, func(tx *sql.Tx) error {
+			_, err := tx.ExecContext(ctx, "UPDATE api_tokens SET last_used_at=? WHERE id=?", token.LastUsedAt, token.Id)
+			return err
+		})
+		if err != nil {
+			return User{}, APIToken{}, err
+		}
+	}
+	return user, token, nil
+}
+
+func (d *DbTodoStore) Tokens(ctx context.Context, userId int) ([]APIToken, error) {
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+
+	rows, err := d.db.QueryContext(ctx, "SELECT "+tokenColumns+" FROM api_tokens t WHERE t.user_id=? ORDER BY t.id", userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens := []APIToken{}
+	for rows.Next() {
+		token, err := scanToken(rows)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, token)
+	}
+	return tokens, rows.Err()
+}
+
+// scanToken reads the tokenColumns of a row, followed by any extra columns.
+func scanToken(row interface{ Scan(...any) error }, extra ...any) (APIToken, error) {
+	var token APIToken
+	var scopes string
+	dest := append([]any{&token.Id, &token.Name, &scopes, &token.ExpiresAt, &token.CreatedAt, &token.LastUsedAt}, extra...)
+	if err := row.Scan(dest...); err != nil {
+		return APIToken{}, err
+	}
+	for _, scope := range strings.Fields(scopes) {
+		token.Scopes = append(token.Scopes, Scope(scope))
+	}
+	return token, nil
+}
+
+// joinScopes is how scopes are stored in sqlite, separated by spaces as in
+// OAuth.
+func joinScopes(scopes []Scope) string {
+	s := make([]string, len(scopes))
+	for i, scope := range scopes {
+		s[i] = string(scope)
+	}
+	return strings.Join(s, " ")
+}
+
+func (d *DbTodoStore) DeleteToken(ctx context.Context, userId, tokenId int) error {
+	log.Info(fmt.Sprintf("Deleting token %d of user %d", tokenId, userId))
+
+	return d.WithTx(ctx, func(tx *sql.Tx) error {
+		result, err := tx.ExecContext(ctx, "DELETE FROM api_tokens WHERE id=? AND user_id=?", tokenId, userId)
+		if err != nil {
+			return err
+		}
+		if n, err := result.RowsAffected(); err != nil || n == 0 {
+			return errors.Wrapf(ErrTokenNotFound, "Id %d", tokenId)
+		}
+		return nil
+	})
+}
+
+// queryUser returns the user joined with the rest of a query, which signs
+// them in.
+func (d *DbTodoStore) queryUser(ctx context.Context, join string, args ...any) (User, error) {
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+
+	var user User
+	err := d.db.QueryRowContext(ctx, "SELECT u.id, u.username, u.created_at FROM users u JOIN "+join, args...).
+		Scan(&user.Id, &user.Username, &user.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return User{}, ErrUnauthenticated
+	}
+	return user, err
+}
+
+// memoryUser, memorySession and memoryToken are how a MemoryTodoStore keeps
+// accounts, exported field by field so FileTodoStore can save them.
+type memoryUser struct {
+	User
+	PasswordHash []byte
+}
+
+type memorySession struct {
+	UserId    int
+	ExpiresAt Timestamp
+}
+
+type memoryToken struct {
+	APIToken
+	UserId int
+	Hash   string
+}
+
+func (m *MemoryTodoStore) CreateUser(ctx context.Context, username string, passwordHash []byte) (User, error) {
+	log.Info(fmt.Sprintf("Creating user %s", username))
+
+	var user User
+	err := m.write(func() error {
+		for _, u := range m.users {
+			if strings.EqualFold(u.Username, username) {
+				return errors.Wrapf(ErrUserExists, "%q", username)
+			}
+		}
+
+		user = User{Id: m.nextUserId, Username: username, CreatedAt: NewTimestamp(time.Now())}
+		m.nextUserId++
+		m.users[user.Id] = memoryUser{User: user, PasswordHash: passwordHash}
+		if len(m.users) == 1 {
+			m.adopt(user.Id)
+		}
+		return nil
+	})
+	if err != nil {
+		return User{}, err
+	}
+	return user, nil
+}
+
+// adopt gives the todos and sections without an owner, including todos only
+// left in the audit log, to a user. The lock must be held.
+func (m *MemoryTodoStore) adopt(userId int) {
+	ids := make(map[int]bool)
+	for id := range m.todos {
+		ids[id] = true
+	}
+	for id := range m.trash {
+		ids[id] = true
+	}
+	for _, e := range m.events {
+		ids[e.TodoId] = true
+	}
+	for id := range ids {
+		if m.owners[id] == 0 {
+			m.owners[id] = userId
+		}
+	}
+	for id, section := range m.sections {
+		if section.Owner == 0 {
+			section.Owner = userId
+			m.sections[id] = section
+		}
+	}
+}
+
+func (m *MemoryTodoStore) UserByName(ctx context.Context, username string) (User, []byte, error) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	for _, u := range m.users {
+		if strings.EqualFold(u.Username, username) {
+			return u.User, u.PasswordHash, nil
+		}
+	}
+	return User{}, nil, errors.Wrapf(ErrUnauthenticated, "no user %q", username)
+}
+
+func (m *MemoryTodoStore) CreateSession(ctx context.Context, userId int, tokenHash string, expires time.Time) error {
+	return m.write(func() error {
+		for hash, session := range m.sessions {
+			if !session.ExpiresAt.After(time.Now()) {
+				delete(m.sessions, hash)
+			}
+		}
+		m.sessions[tokenHash] = memorySession{UserId: userId, ExpiresAt: NewTimestamp(expires)}
+		return nil
+	})
+}
+
+func (m *MemoryTodoStore) SessionUser(ctx context.Context, tokenHash string) (User, error) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	session, ok := m.sessions[tokenHash]
+	if !ok || !session.ExpiresAt.After(time.Now()) {
+		return User{}, ErrUnauthenticated
+	}
+	return m.users[session.UserId].User, nil
+}
+
+func (m *MemoryTodoStore) DeleteSession(ctx context.Context, tokenHash string) error {
+	return m.write(func() error {
+		delete(m.sessions, tokenHash)
+		return nil
+	})
+}
+
+func (m *MemoryTodoStore) CreateToken(ctx context.Context, userId int, token APIToken, tokenHash string) (APIToken, error) {
+	log.Info(fmt.Sprintf("Creating token %q for user %d", token.Name, userId))
+
+	err := m.write(func() error {
+		token = APIToken{Id: m.nextTokenId, Name: token.Name, Scopes: slices.Clone(token.Scopes), ExpiresAt: NewTimestamp(token.ExpiresAt.Time), CreatedAt: NewTimestamp(time.Now())}
+		m.nextTokenId++
+		m.tokens[tokenHash] = memoryToken{APIToken: token, UserId: userId, Hash: tokenHash}
+		return nil
+	})
+	if err != nil {
+		return APIToken{}, err
+	}
+	return token, nil
+}
+
+func (m *MemoryTodoStore) TokenUser(ctx context.Context, tokenHash string) (User, APIToken, error) {
+	m.lock.RLock()
+	token, ok := m.tokens[tokenHash]
+	user := m.users[token.UserId].User
+	m.lock.RUnlock()
+	now := time.Now()
+	if !ok || token.expired(now) {
+		return User{}, APIToken{}, ErrUnauthenticated
+	}
+
+	if token.staleUse(now) {
+		err := m.write(func() error {
+			// The token may have been revoked since it was read.
+			if token, ok := m.tokens[tokenHash]; ok {
+				token.LastUsedAt = NewTimestamp(now)
+				m.tokens[tokenHash] = token
+			}
+			return nil
+		})
+		if err != nil {
+			return User{}, APIToken{}, err
+		}
+		token.LastUsedAt = NewTimestamp(now)
+	}
+	return user, token.APIToken, nil
+}
+
+func (m *MemoryTodoStore) Tokens(ctx context.Context, userId int) ([]APIToken, error) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	tokens := []APIToken{}
+	for _, token := range m.tokens {
+		if token.UserId == userId {
+			tokens = append(tokens, token.APIToken)
+		}
+	}
+	sort.Slice(tokens, func(i, j int) bool {
+		return tokens[i].Id < tokens[j].Id
+	})
+	return tokens, nil
+}
+
+func (m *MemoryTodoStore) DeleteToken(ctx context.Context, userId, tokenId int) error {
+	log.Info(fmt.Sprintf("Deleting token %d of user %d", tokenId, userId))
+
+	return m.write(func() error {
+		for hash, token := range m.tokens {
+			if token.Id == tokenId && token.UserId == userId {
+				delete(m.tokens, hash)
+				return nil
+			}
+		}
+		return errors.Wrapf(ErrTokenNotFound, "Id %d", tokenId)
+	})
+}
@@ -0,0 +1,200 @@
+package store_test
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mcadenas-bjss/go-do-it/store"
+)
+
+func TestUsers(t *testing.T) {
+	ctx := context.Background()
+
+	for name, s := range newStores(t) {
+		users := s.(store.UserStore)
+		t.Run(name, func(t *testing.T) {
+			legacy, _ := s.Insert(ctx, store.Todo{Description: "From before accounts"})
+			shopping, _ := s.(store.SectionStore).CreateSection(ctx, "Shopping")
+
+			alice, err := users.CreateUser(ctx, "alice", []byte("hash"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			bob, err := users.CreateUser(ctx, "bob", []byte("hash"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := users.CreateUser(ctx, "Alice", nil); !errors.Is(err, store.ErrUserExists) {
+				t.Errorf("got %v want %v", err, store.ErrUserExists)
+			}
+
+			user, hash, err := users.UserByName(ctx, "ALICE")
+			if err != nil || user.Id != alice.Id || string(hash) != "hash" {
+				t.Errorf("got %+v, %q, %v", user, hash, err)
+			}
+			if _, _, err := users.UserByName(ctx, "carol"); !errors.Is(err, store.ErrUnauthenticated) {
+				t.Errorf("got %v want %v", err, store.ErrUnauthenticated)
+			}
+
+			asAlice, asBob := store.WithOwner(ctx, alice.Id), store.WithOwner(ctx, bob.Id)
+			milk, _ := s.Insert(asBob, store.Todo{Description: "Buy milk"})
+
+			t.Run("scopes todos by owner", func(t *testing.T) {
+				assertTodos(t, s, []store.Todo{
+					{Id: legacy.Id, Description: "From before accounts", Revision: 1},
+					{Id: milk.Id, Description: "Buy milk", Revision: 1},
+				})
+				if page, _ := s.List(asAlice, store.ListOptions{}); len(page.Todos) != 1 || page.Todos[0].Id != legacy.Id {
+					t.Errorf("got %+v want the first user to own the older todo", page.Todos)
+				}
+				if page, _ := s.List(asBob, store.ListOptions{}); len(page.Todos) != 1 || page.Todos[0].Id != milk.Id {
+					t.Errorf("got %+v want only bob's todo", page.Todos)
+				}
+				if sections, _ := s.(store.SectionStore).Sections(asAlice); len(sections) != 1 || sections[0].Id != shopping.Id {
+					t.Errorf("got %+v want the first user to own the older section", sections)
+				}
+
+				if _, err := s.Get(asAlice, milk.Id); !errors.Is(err, store.ErrNotFound) {
+					t.Errorf("got %v getting another user's todo", err)
+				}
+				if _, err := s.Toggle(asAlice, store.Ref{Id: milk.Id}); !errors.Is(err, store.ErrNotFound) {
+					t.Errorf("got %v toggling another user's todo", err)
+				}
+				if _, err := s.Patch(asAlice, store.Ref{Id: milk.Id}, store.MergePatch(`{"Completed":true}`)); !errors.Is(err, store.ErrNotFound) {
+					t.Errorf("got %v patching another user's todo", err)
+				}
+				if n, _ := s.CompleteAll(asAlice); n != 1 {
+					t.Errorf("completed %d todos want only alice's", n)
+				}
+				if results, _ := s.Search(asAlice, store.SearchQuery{Query: "milk"}); len(results) != 0 {
+					t.Errorf("got %+v searching another user's todos", results)
+				}
+				if _, err := s.History(asAlice, milk.Id); !errors.Is(err, store.ErrNotFound) {
+					t.Errorf("got %v reading another user's history", err)
+				}
+			})
+
+			t.Run("scopes the trash and events by owner", func(t *testing.T) {
+				if _, err := s.Delete(asAlice, store.Ref{Id: milk.Id}); !errors.Is(err, store.ErrNotFound) {
+					t.Errorf("got %v deleting another user's todo", err)
+				}
+				s.Delete(asBob, store.Ref{Id: milk.Id})
+				if trash, _ := s.Trash(asAlice); len(trash) != 0 {
+					t.Errorf("got %+v in alice's trash", trash)
+				}
+				if _, err := s.Restore(asAlice, store.Ref{Id: milk.Id}); !errors.Is(err, store.ErrNotFound) {
+					t.Errorf("got %v restoring another user's todo", err)
+				}
+				if n, _ := s.Purge(asAlice, time.Now().Add(time.Minute)); n != 0 {
+					t.Errorf("purged %d of bob's todos as alice", n)
+				}
+				if n, _ := s.Purge(ctx, time.Now().Add(time.Minute)); n != 1 {
+					t.Errorf("purged %d todos want 1", n)
+				}
+
+				events, err := s.Events(asBob, store.EventQuery{})
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(events) != 3 || events[2].Op != store.EventPurge {
+					t.Fatalf("got %+v want bob's create, delete and purge", events)
+				}
+				for _, e := range events {
+					if e.Owner != bob.Id {
+						t.Errorf("event %+v is not owned by bob", e)
+					}
+				}
+				if events, _ := s.Events(asAlice, store.EventQuery{}); len(events) != 2 {
+					t.Errorf("got %+v want alice's create and complete", events)
+				}
+			})
+
+			t.Run("signs in with sessions and tokens", func(t *testing.T) {
+				users.CreateSession(ctx, alice.Id, "expired", time.Now().Add(-time.Minute))
+				users.CreateSession(ctx, alice.Id, "session", time.Now().Add(time.Hour))
+				if user, err := users.SessionUser(ctx, "session"); err != nil || user.Id != alice.Id {
+					t.Errorf("got %+v, %v", user, err)
+				}
+				if _, err := users.SessionUser(ctx, "expired"); !errors.Is(err, store.ErrUnauthenticated) {
+					t.Errorf("got %v for an expired session", err)
+				}
+				users.DeleteSession(ctx, "session")
+				if _, err := users.SessionUser(ctx, "session"); !errors.Is(err, store.ErrUnauthenticated) {
+					t.Errorf("got %v after signing out", err)
+				}
+
+				token, err := users.CreateToken(ctx, bob.Id, store.APIToken{Name: "laptop", Scopes: []store.Scope{store.ScopeTodosRead}}, "secret")
+				if err != nil {
+					t.Fatal(err)
+				}
+				user, used, err := users.TokenUser(ctx, "secret")
+				if err != nil || user.Id != bob.Id || used.Id != token.Id || len(used.Scopes) != 1 || used.Scopes[0] != store.ScopeTodosRead {
+					t.Errorf("got %+v, %+v, %v", user, used, err)
+				}
+				if used.LastUsedAt.IsZero() {
+					t.Error("want the token's use recorded")
+				}
+				if tokens, _ := users.Tokens(ctx, bob.Id); len(tokens) != 1 || tokens[0].Name != "laptop" || tokens[0].LastUsedAt != used.LastUsedAt {
+					t.Errorf("got %+v", tokens)
+				}
+				if err := users.DeleteToken(ctx, alice.Id, token.Id); !errors.Is(err, store.ErrTokenNotFound) {
+					t.Errorf("got %v deleting another user's token", err)
+				}
+				if err := users.DeleteToken(ctx, bob.Id, token.Id); err != nil {
+					t.Fatal(err)
+				}
+				if _, _, err := users.TokenUser(ctx, "secret"); !errors.Is(err, store.ErrUnauthenticated) {
+					t.Errorf("got %v for a revoked token", err)
+				}
+
+				expiring := store.APIToken{Name: "ci", Scopes: []store.Scope{store.ScopeAdmin}, ExpiresAt: store.NewTimestamp(time.Now().Add(-time.Minute))}
+				if _, err := users.CreateToken(ctx, bob.Id, expiring, "expired"); err != nil {
+					t.Fatal(err)
+				}
+				if _, _, err := users.TokenUser(ctx, "expired"); !errors.Is(err, store.ErrUnauthenticated) {
+					t.Errorf("got %v for an expired token", err)
+				}
+				if tokens, _ := users.Tokens(ctx, bob.Id); len(tokens) != 1 || tokens[0].ExpiresAt != expiring.ExpiresAt || tokens[0].Scopes[0] != store.ScopeAdmin {
+					t.Errorf("got %+v want the expired token still listed", tokens)
+				}
+			})
+		})
+	}
+}
+
+func TestFileStoreKeepsUsers(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "todo.json")
+
+	s, err := store.NewFileTodoStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	user, _ := s.CreateUser(ctx, "alice", []byte("hash"))
+	s.Insert(store.WithOwner(ctx, user.Id), store.Todo{Description: "Buy milk"})
+	s.CreateToken(ctx, user.Id, store.APIToken{Name: "laptop", Scopes: []store.Scope{store.ScopeTodosWrite}}, "secret")
+
+	reopened, err := store.NewFileTodoStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, token, err := reopened.TokenUser(ctx, "secret")
+	if err != nil || got.Id != user.Id || got.Username != "alice" {
+		t.Errorf("got %+v, %v want %+v", got, err, user)
+	}
+	if len(token.Scopes) != 1 || token.Scopes[0] != store.ScopeTodosWrite {
+		t.Errorf("got scopes %v want todos:write", token.Scopes)
+	}
+	if page, _ := reopened.List(store.WithOwner(ctx, user.Id+1), store.ListOptions{}); len(page.Todos) != 0 {
+		t.Errorf("got %+v want the todo to stay owned by alice", page.Todos)
+	}
+	if _, err := reopened.CreateUser(ctx, "bob", nil); err != nil {
+		t.Fatal(err)
+	}
+	if tokens, _ := reopened.Tokens(ctx, user.Id); len(tokens) != 1 {
+		t.Errorf("got %+v", tokens)
+	}
+}
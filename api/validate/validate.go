@@ -0,0 +1,103 @@
+// Package validate holds the rules a todo must satisfy before it is stored.
+// It has no dependencies so clients such as the desktop app can check a todo
+// before submitting it.
+package validate
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// MaxDescriptionLength is the longest description accepted, in characters.
+const MaxDescriptionLength = 500
+
+// ErrInvalid is matched by every Errors value with errors.Is.
+var ErrInvalid = errors.New("todo is invalid")
+
+// FieldError is a single broken rule. Field is the JSON name of the field.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// Errors collects every broken rule of a todo so they can be reported at
+// once.
+type Errors []FieldError
+
+func (e Errors) Error() string {
+	msgs := make([]string, len(e))
+	for i, fe := range e {
+		msgs[i] = fmt.Sprintf("%s %s", fe.Field, fe.Message)
+	}
+	return "todo is invalid: " + strings.Join(msgs, ", ")
+}
+
+func (e Errors) Is(target error) bool {
+	return target == ErrInvalid
+}
+
+func (e *Errors) add(field, message string) {
+	*e = append(*e, FieldError{Field: field, Message: message})
+}
+
+// err returns nil when no rule was broken.
+func (e Errors) err() error {
+	if len(e) == 0 {
+		return nil
+	}
+	return e
+}
+
+// Todo is a todo as submitted by a client. Time is an RFC 3339 string, or
+// empty for no due date. Revision, Position and Section are accepted so a
+// todo can be sent back as it was received, but are not checked here.
+type Todo struct {
+	Id          int
+	Time        string
+	Description string
+	Completed   bool
+	Revision    int
+	Position    string
+	Section     int
+}
+
+// Create checks a todo about to be created. Ids are assigned by the store,
+// so one must not be supplied.
+func (t Todo) Create() error {
+	var errs Errors
+	if t.Id != 0 {
+		errs.add("Id", "must not be set, it is assigned by the server")
+	}
+	t.check(&errs)
+	return errs.err()
+}
+
+// Update checks a todo replacing the one with the given id. Id may be
+// omitted, but must match when it is supplied.
+func (t Todo) Update(id int) error {
+	var errs Errors
+	if t.Id != 0 && t.Id != id {
+		errs.add("Id", fmt.Sprintf("must be %d to match the URL, or omitted", id))
+	}
+	t.check(&errs)
+	return errs.err()
+}
+
+func (t Todo) check(errs *Errors) {
+	description := strings.TrimSpace(t.Description)
+	switch {
+	case description == "":
+		errs.add("Description", "is required")
+	case utf8.RuneCountInString(description) > MaxDescriptionLength:
+		errs.add("Description", fmt.Sprintf("must be at most %d characters", MaxDescriptionLength))
+	}
+
+	if t.Time != "" {
+		if _, err := time.Parse(time.RFC3339, t.Time); err != nil {
+			errs.add("Time", "must be an RFC 3339 timestamp such as 2006-01-02T15:04:05Z")
+		}
+	}
+}
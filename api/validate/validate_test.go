@@ -0,0 +1,60 @@
+package validate_test
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/mcadenas-bjss/go-do-it/validate"
+)
+
+func TestTodo(t *testing.T) {
+	tests := []struct {
+		name   string
+		todo   validate.Todo
+		update bool
+		want   []string
+	}{
+		{"valid", validate.Todo{Time: "2024-01-01T09:00:00+01:00", Description: "Buy milk"}, false, nil},
+		{"no due date", validate.Todo{Description: "Buy milk"}, false, nil},
+		{"id on create", validate.Todo{Id: 1, Description: "Buy milk"}, false, []string{"Id"}},
+		{"blank description", validate.Todo{Description: " \t"}, false, []string{"Description"}},
+		{"longest description", validate.Todo{Description: strings.Repeat("é", validate.MaxDescriptionLength)}, false, nil},
+		{"description too long", validate.Todo{Description: strings.Repeat("a", validate.MaxDescriptionLength+1)}, false, []string{"Description"}},
+		{"time without offset", validate.Todo{Time: "2024-01-01T09:00:00", Description: "Buy milk"}, false, []string{"Time"}},
+		{"matching id on update", validate.Todo{Id: 7, Description: "Buy milk"}, true, nil},
+		{"other id on update", validate.Todo{Id: 8, Description: ""}, true, []string{"Id", "Description"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var err error
+			if tt.update {
+				err = tt.todo.Update(7)
+			} else {
+				err = tt.todo.Create()
+			}
+
+			if tt.want == nil {
+				if err != nil {
+					t.Fatalf("expected no error, got %v", err)
+				}
+				return
+			}
+
+			if !errors.Is(err, validate.ErrInvalid) {
+				t.Fatalf("got %v want %v", err, validate.ErrInvalid)
+			}
+			var errs validate.Errors
+			errors.As(err, &errs)
+			got := make([]string, len(errs))
+			for i, fe := range errs {
+				got[i] = fe.Field
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got invalid fields %v want %v", got, tt.want)
+			}
+		})
+	}
+}
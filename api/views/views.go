@@ -14,12 +14,22 @@ var (
 	todoTemplates embed.FS
 )
 
+var funcs = template.FuncMap{
+	"completed": func(b bool) string {
+		if b {
+			return "checked"
+		}
+		return ""
+	},
+	"formatTime": formatTime,
+}
+
 type TodoRenderer struct {
 	templ *template.Template
 }
 
 func NewTodoRenderer() (*TodoRenderer, error) {
-	templ, err := template.ParseFS(todoTemplates, "templates/*.gohtml")
+	templ, err := template.New("templates").Funcs(funcs).ParseFS(todoTemplates, "templates/*.gohtml")
 	if err != nil {
 		return nil, err
 	}
@@ -27,73 +37,117 @@ func NewTodoRenderer() (*TodoRenderer, error) {
 	return &TodoRenderer{templ: templ}, nil
 }
 
-func (tr *TodoRenderer) RenderTodo(w io.Writer, todo store.Todo) error {
+// todoView is a todo with the timezone its due date is rendered in, and the
+// API path its routes are under.
+type todoView struct {
+	store.Todo
+	Base string
+	Loc  *time.Location
+}
+
+// RenderTodo writes the list item for a todo, with relative due dates such as
+// "Today at" worked out in loc. base is the path of the list the todo is
+// in, /api for a personal list or /api/lists/{id} for a shared one.
+func (tr *TodoRenderer) RenderTodo(w io.Writer, todo store.Todo, base string, loc *time.Location) error {
 	todoTemplate := `<li id="todo-{{.Id}}">
   <div class="todo">
     <input id="todo-{{.Id}}-checkbox" type="checkbox" {{completed .Completed}} />
     <p>{{.Description}}</p>
     <button
-      hx-delete="/api/todo/{{.Id}}"
-      hx-swap="delete"
+      hx-delete="{{.Base}}/todo/{{.Id}}"
+      hx-swap="outerHTML"
       hx-target="#todo-{{.Id}}">Delete</button
     >
     <div class="meta">
-      <time datetime={{.Time}}>{{formatTime .Time}}</time>
+      <time datetime={{.Time}}>{{formatTime .Time .Loc}}</time>
     </div>
   </div>
 </li>`
 
-	templ, err := template.New("todo").Funcs(
-		template.FuncMap{
-			"completed": func(b bool) string {
-				if b {
-					return "checked"
-				}
-				return ""
-			},
-			"formatTime": func(t string) string {
-				if len(t) == 0 {
-					return ""
-				}
-
-				var layout = "2006-01-02T15:04:05Z0700" // ISO 8601 format
-				var output = "Mon, 02 Jan 2006 15:04"
-
-				check_t, _ := time.Parse(layout, t)
-				checkDate_t, _ := time.Parse("2006-01-02", check_t.Format("2006-01-02"))
-				nowDate_t, _ := time.Parse("2006-01-02", time.Now().Format("2006-01-02"))
-
-				if len(t) == 0 {
-					return ""
-				}
-
-				f := check_t.Format(output)
-
-				if inTimeSpan(nowDate_t.AddDate(0, 0, -1), nowDate_t, checkDate_t) {
-					f = "Yesterday at " + check_t.Format("3:04 PM")
-				}
-				if inTimeSpan(nowDate_t, nowDate_t.AddDate(0, 0, 1), checkDate_t) {
-					f = "Today at " + check_t.Format("3:04 PM")
-				}
-				if inTimeSpan(nowDate_t.AddDate(0, 0, 1), nowDate_t.AddDate(0, 0, 2), checkDate_t) {
-					f = "Tomorrow at " + check_t.Format("3:04 PM")
-				}
-
-				return f
-			},
-		},
-	).Parse(todoTemplate)
+	templ, err := template.New("todo").Funcs(funcs).Parse(todoTemplate)
 	if err != nil {
 		return err
 	}
 
-	if err := templ.Execute(w, todo); err != nil {
+	if err := templ.Execute(w, todoView{Todo: todo, Base: base, Loc: loc}); err != nil {
 		return err
 	}
 
 	return nil
 }
 
+// RenderUndo writes the list item that replaces a deleted todo, with a
+// button restoring it from the trash. base is as for RenderTodo.
+func (tr *TodoRenderer) RenderUndo(w io.Writer, id int, base string) error {
+	return tr.templ.ExecuteTemplate(w, "undo.gohtml", struct {
+		Id   int
+		Base string
+	}{id, base})
+}
+
+// RenderListSwitcher writes the links between the personal list and the
+// shared lists, marking the current one. current is 0 for the personal list.
+func (tr *TodoRenderer) RenderListSwitcher(w io.Writer, lists []store.List, current int) error {
+	return tr.templ.ExecuteTemplate(w, "lists.gohtml", struct {
+		Lists   []store.List
+		Current int
+	}{lists, current})
+}
+
+// searchResult is a store.SearchResult with its snippet marked as safe HTML.
+type searchResult struct {
+	store.SearchResult
+	Highlighted template.HTML
+}
+
+// RenderSearchResults writes the search results partial that HTMX swaps into
+// the page as the user types.
+func (tr *TodoRenderer) RenderSearchResults(w io.Writer, query string, results []store.SearchResult, loc *time.Location) error {
+	view := struct {
+		Query   string
+		Results []searchResult
+		Loc     *time.Location
+	}{Query: query, Loc: loc}
+	for _, r := range results {
+		// The store escapes the description before adding <mark> tags.
+		view.Results = append(view.Results, searchResult{SearchResult: r, Highlighted: template.HTML(r.Snippet)})
+	}
+
+	return tr.templ.ExecuteTemplate(w, "search.gohtml", view)
+}
+
+// formatTime renders a due date in loc, using "Yesterday", "Today" or
+// "Tomorrow" when it is close to the current date in that timezone.
+func formatTime(t store.Timestamp, loc *time.Location) string {
+	if t.IsZero() {
+		return ""
+	}
+	if loc == nil {
+		loc = time.Local
+	}
+
+	var output = "Mon, 02 Jan 2006 15:04"
+
+	check_t := t.In(loc)
+	now := time.Now().In(loc)
+	checkDate_t := time.Date(check_t.Year(), check_t.Month(), check_t.Day(), 0, 0, 0, 0, loc)
+	nowDate_t := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc)
+
+	f := check_t.Format(output)
+
+	if inTimeSpan(nowDate_t.AddDate(0, 0, -1), nowDate_t, checkDate_t) {
+		f = "Yesterday at " + check_t.Format("3:04 PM")
+	}
+	if inTimeSpan(nowDate_t, nowDate_t.AddDate(0, 0, 1), checkDate_t) {
+		f = "Today at " + check_t.Format("3:04 PM")
+	}
+	if inTimeSpan(nowDate_t.AddDate(0, 0, 1), nowDate_t.AddDate(0, 0, 2), checkDate_t) {
+		f = "Tomorrow at " + check_t.Format("3:04 PM")
+	}
+
+	return f
+}
+
 func inTimeSpan(start, end, check time.Time) bool {
 	if start.Before(end) {
 		return !check.Before(start) && !check.After(end)
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Pending write operations.
+const (
+	opInsert = "insert"
+	opToggle = "toggle"
+)
+
+// pendingWrite is a write the API has not confirmed yet. For toggles Todo
+// holds the wanted Completed state and the Revision it was made against.
+type pendingWrite struct {
+	Op   string
+	Todo Todo
+}
+
+// localState is the part of the Store kept on disk, so the list can be shown
+// and written to while the API is down.
+type localState struct {
+	Todos  []Todo
+	Outbox []pendingWrite
+	// Since is the last sync event applied.
+	Since int
+	// NextLocalId numbers todos created offline. Local ids are negative so
+	// they never clash with the API's.
+	NextLocalId int
+}
+
+// cachePath is where the local state for the server and token in s is kept,
+// in the user's config directory. Each server and user has a cache of their
+// own, so the sync cursor and pending writes are never used with another.
+// The token is hashed to keep it out of the file name.
+func cachePath(s Settings) string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		dir = os.TempDir()
+	}
+	sum := sha256.Sum256([]byte(strings.TrimSuffix(s.ServerURL, "/") + "\n" + s.Token))
+	return filepath.Join(dir, "go-do-it", fmt.Sprintf("desktop-%x.json", sum[:8]))
+}
+
+// use switches to the local state kept at path, dropping the list, sync
+// cursor and pending writes of the one used before.
+func (s *Store) use(path string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.path = path
+	s.data = make(map[int]Todo)
+	s.outbox = nil
+	s.since = 0
+	s.nextLocalId = 0
+	return s.load()
+}
+
+// load reads the local state left at the path by the last run, if there is
+// one. Callers hold the lock.
+func (s *Store) load() error {
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var state localState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return err
+	}
+
+	for _, t := range state.Todos {
+		s.data[t.Id] = t
+	}
+	s.outbox = state.Outbox
+	s.since = state.Since
+	s.nextLocalId = state.NextLocalId
+	return nil
+}
+
+// save writes the local state. Callers hold the lock.
+func (s *Store) save() {
+	state := localState{Outbox: s.outbox, Since: s.since, NextLocalId: s.nextLocalId}
+	for _, t := range s.data {
+		state.Todos = append(state.Todos, t)
+	}
+	sort.Slice(state.Todos, func(i, j int) bool { return state.Todos[i].Id < state.Todos[j].Id })
+
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		log.Printf("encoding the local cache failed: %v", err)
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o755); err != nil {
+		log.Printf("saving the local cache failed: %v", err)
+		return
+	}
+	// Write a temporary file first so a crash never leaves half a cache.
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		log.Printf("saving the local cache failed: %v", err)
+		return
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		log.Printf("saving the local cache failed: %v", err)
+	}
+}
+
+// overlay shows the pending writes on top of the todos from the API.
+// Callers hold the lock.
+func (s *Store) overlay() {
+	for _, w := range s.outbox {
+		switch w.Op {
+		case opInsert:
+			s.data[w.Todo.Id] = w.Todo
+		case opToggle:
+			if t, ok := s.data[w.Todo.Id]; ok {
+				t.Completed = w.Todo.Completed
+				s.data[w.Todo.Id] = t
+			}
+		}
+	}
+}
+
+// replace swaps the list for the one fetched from the API.
+func (s *Store) replace(todos []Todo) {
+	m := make(map[int]Todo)
+	for _, t := range todos {
+		m[t.Id] = t
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.data = m
+	s.overlay()
+	s.save()
+}
+
+// apply updates the list with a change from the sync socket. Changes that
+// are already part of the list, because they raced the snapshot, are
+// skipped by revision.
+func (s *Store) apply(e Event) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.since = e.Id
+	if e.After == nil {
+		delete(s.data, e.TodoId)
+	} else if current, ok := s.data[e.TodoId]; !ok || current.Revision < e.After.Revision {
+		s.data[e.TodoId] = *e.After
+	}
+	s.overlay()
+	s.save()
+}
+
+// lastEvent is the id of the last sync event applied.
+func (s *Store) lastEvent() int {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.since
+}
+
+func (s *Store) get(id int) (Todo, bool) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	t, ok := s.data[id]
+	return t, ok
+}
+
+// queue shows a write in the list straight away and keeps it until the API
+// confirms it. New todos get a local id.
+func (s *Store) queue(w pendingWrite) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	switch {
+	case w.Op == opInsert:
+		s.nextLocalId--
+		w.Todo.Id = s.nextLocalId
+	case w.Op == opToggle && w.Todo.Id < 0:
+		// The todo itself has not been sent yet, so send it toggled.
+		for i := range s.outbox {
+			if s.outbox[i].Op == opInsert && s.outbox[i].Todo.Id == w.Todo.Id {
+				s.outbox[i].Todo.Completed = w.Todo.Completed
+			}
+		}
+		s.overlay()
+		s.save()
+		return
+	}
+	s.outbox = append(s.outbox, w)
+	s.overlay()
+	s.save()
+}
+
+// next returns the oldest pending write.
+func (s *Store) next() (pendingWrite, bool) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	if len(s.outbox) == 0 {
+		return pendingWrite{}, false
+	}
+	return s.outbox[0], true
+}
+
+// done removes the oldest pending write once the API has applied or refused
+// it. A todo created offline is dropped from the list until it comes back
+// from the API with its real id. An applied toggle moves the todo on a
+// revision, which later toggles of it are then made against.
+func (s *Store) done(applied bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if len(s.outbox) == 0 {
+		return
+	}
+	w := s.outbox[0]
+	s.outbox = s.outbox[1:]
+	switch {
+	case w.Op == opInsert:
+		delete(s.data, w.Todo.Id)
+	case w.Op == opToggle && applied && w.Todo.Revision > 0:
+		for i := range s.outbox {
+			if s.outbox[i].Op == opToggle && s.outbox[i].Todo.Id == w.Todo.Id {
+				s.outbox[i].Todo.Revision++
+			}
+		}
+		if t, ok := s.data[w.Todo.Id]; ok && t.Revision == w.Todo.Revision {
+			t.Revision++
+			s.data[w.Todo.Id] = t
+		}
+	}
+	s.save()
+}
+
+func (s *Store) pending() int {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return len(s.outbox)
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func newTestStore(t *testing.T) *Store {
+	t.Helper()
+	s := &Store{}
+	if err := s.use(filepath.Join(t.TempDir(), "desktop.json")); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestOutbox(t *testing.T) {
+	t.Run("numbers todos created offline below zero", func(t *testing.T) {
+		s := newTestStore(t)
+		s.queue(pendingWrite{Op: opInsert, Todo: Todo{Description: "Buy milk"}})
+		s.queue(pendingWrite{Op: opInsert, Todo: Todo{Description: "Buy eggs"}})
+
+		var ids []int
+		for _, todo := range s.sorted() {
+			ids = append(ids, todo.Id)
+		}
+		if want := []int{-1, -2}; !reflect.DeepEqual(ids, want) {
+			t.Errorf("got ids %v want %v", ids, want)
+		}
+		if s.pending() != 2 {
+			t.Errorf("got %d pending writes want 2", s.pending())
+		}
+	})
+
+	t.Run("toggling an unsent todo sends it toggled", func(t *testing.T) {
+		s := newTestStore(t)
+		s.queue(pendingWrite{Op: opInsert, Todo: Todo{Description: "Buy milk"}})
+		s.queue(pendingWrite{Op: opToggle, Todo: Todo{Id: -1, Completed: true}})
+
+		if s.pending() != 1 {
+			t.Fatalf("got %d pending writes want 1", s.pending())
+		}
+		w, _ := s.next()
+		if w.Op != opInsert || !w.Todo.Completed {
+			t.Errorf("got %+v want a completed insert", w)
+		}
+		if todo, _ := s.get(-1); !todo.Completed {
+			t.Errorf("got %+v want it shown completed", todo)
+		}
+	})
+
+	t.Run("an applied toggle moves later toggles on a revision", func(t *testing.T) {
+		s := newTestStore(t)
+		s.replace([]Todo{{Id: 1, Description: "Buy milk", Revision: 3}})
+		s.queue(pendingWrite{Op: opToggle, Todo: Todo{Id: 1, Completed: true, Revision: 3}})
+		s.queue(pendingWrite{Op: opToggle, Todo: Todo{Id: 1, Completed: false, Revision: 3}})
+
+		s.done(true)
+		w, ok := s.next()
+		if !ok || w.Todo.Revision != 4 {
+			t.Errorf("got %+v want the next toggle made against revision 4", w)
+		}
+		if todo, _ := s.get(1); todo.Revision != 4 || todo.Completed {
+			t.Errorf("got %+v want revision 4 shown not completed", todo)
+		}
+	})
+
+	t.Run("a refused toggle leaves later toggles alone", func(t *testing.T) {
+		s := newTestStore(t)
+		s.replace([]Todo{{Id: 1, Description: "Buy milk", Revision: 3}})
+		s.queue(pendingWrite{Op: opToggle, Todo: Todo{Id: 1, Completed: true, Revision: 3}})
+		s.queue(pendingWrite{Op: opToggle, Todo: Todo{Id: 1, Completed: false, Revision: 3}})
+
+		s.done(false)
+		if w, _ := s.next(); w.Todo.Revision != 3 {
+			t.Errorf("got %+v want revision 3", w)
+		}
+	})
+
+	t.Run("a sent todo is dropped until it comes back from the api", func(t *testing.T) {
+		s := newTestStore(t)
+		s.queue(pendingWrite{Op: opInsert, Todo: Todo{Description: "Buy milk"}})
+
+		s.done(true)
+		if _, ok := s.get(-1); ok {
+			t.Error("want the local todo dropped")
+		}
+		if s.pending() != 0 {
+			t.Errorf("got %d pending writes want 0", s.pending())
+		}
+	})
+}
+
+func TestStoreUse(t *testing.T) {
+	dir := t.TempDir()
+	first, second := filepath.Join(dir, "first.json"), filepath.Join(dir, "second.json")
+
+	s := &Store{}
+	if err := s.use(first); err != nil {
+		t.Fatal(err)
+	}
+	s.apply(Event{Id: 7, TodoId: 1, After: &Todo{Id: 1, Description: "Buy milk", Revision: 1}})
+	s.queue(pendingWrite{Op: opInsert, Todo: Todo{Description: "Buy eggs"}})
+
+	if err := s.use(second); err != nil {
+		t.Fatal(err)
+	}
+	if s.lastEvent() != 0 || s.pending() != 0 || len(s.sorted()) != 0 {
+		t.Errorf("got cursor %d, %d pending and %d todos want an empty cache", s.lastEvent(), s.pending(), len(s.sorted()))
+	}
+	s.queue(pendingWrite{Op: opInsert, Todo: Todo{Description: "Buy bread"}})
+	if todo, _ := s.get(-1); todo.Description != "Buy bread" {
+		t.Errorf("got %+v want local ids numbered from the start", todo)
+	}
+
+	if err := s.use(first); err != nil {
+		t.Fatal(err)
+	}
+	if s.lastEvent() != 7 || s.pending() != 1 || len(s.sorted()) != 2 {
+		t.Errorf("got cursor %d, %d pending and %d todos want the first cache back", s.lastEvent(), s.pending(), len(s.sorted()))
+	}
+}
+
+func TestCachePath(t *testing.T) {
+	base := Settings{ServerURL: "http://localhost:8000/api", Token: "alice"}
+	if cachePath(base) != cachePath(Settings{ServerURL: base.ServerURL + "/", Token: base.Token}) {
+		t.Error("want a trailing slash to use the same cache")
+	}
+	for _, other := range []Settings{
+		{ServerURL: "http://example.com/api", Token: base.Token},
+		{ServerURL: base.ServerURL, Token: "bob"},
+	} {
+		if cachePath(other) == cachePath(base) {
+			t.Errorf("want %+v to use its own cache", other)
+		}
+	}
+}
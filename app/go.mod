@@ -2,7 +2,11 @@ module github.com/mcadenas-bjss/go-do-it/desktop
 
 go 1.22.6
 
-require fyne.io/fyne/v2 v2.5.1
+require (
+	fyne.io/fyne/v2 v2.5.1
+	github.com/mcadenas-bjss/go-do-it v0.0.0
+	golang.org/x/net v0.25.0
+)
 
 require (
 	fyne.io/systray v1.11.0 // indirect
@@ -30,8 +34,9 @@ require (
 	github.com/yuin/goldmark v1.7.1 // indirect
 	golang.org/x/image v0.18.0 // indirect
 	golang.org/x/mobile v0.0.0-20231127183840-76ac6878050a // indirect
-	golang.org/x/net v0.25.0 // indirect
-	golang.org/x/sys v0.20.0 // indirect
+	golang.org/x/sys v0.21.0 // indirect
 	golang.org/x/text v0.16.0 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
+
+replace github.com/mcadenas-bjss/go-do-it => ../api
@@ -1,35 +1,51 @@
 package main
 
 import (
-	"bytes"
-	"encoding/json"
+	"context"
+	"errors"
 	"fmt"
 	"image/color"
-	"io"
 	"log"
-	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/app"
 	"fyne.io/fyne/v2/canvas"
 	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
 	"fyne.io/fyne/v2/layout"
 	"fyne.io/fyne/v2/widget"
+	"github.com/mcadenas-bjss/go-do-it/client"
 	"github.com/mcadenas-bjss/go-do-it/desktop/utils"
+	"github.com/mcadenas-bjss/go-do-it/validate"
 )
 
-const (
-	baseURL    = "http://localhost:8000/api"
-	WEBAPP_URL = "https://cricket-rational-pika.ngrok-free.app"
-)
+// appID names the app for Fyne preferences.
+const appID = "com.github.mcadenas-bjss.go-do-it"
 
 func main() {
 	fmt.Println("Running Fyne app")
 
 	app := NewApp()
+	settings, err := loadSettings(app.App.Preferences(), os.Args[1:])
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := app.api.configure(settings); err != nil {
+		log.Fatal(err)
+	}
+	if err := app.Store.use(cachePath(settings)); err != nil {
+		log.Printf("ignoring the local cache: %v", err)
+	}
 	app.Window.Resize(fyne.NewSize(700, 500))
 
 	todos := app.newTodoList()
+	app.list = todos
 
 	buttonBox := container.New(layout.NewVBoxLayout())
 	form := app.newTodoForm()
@@ -37,81 +53,189 @@ func main() {
 	syncButton := widget.NewButton("Sync", func() {
 		log.Println("Synchronizing list")
 		go func() {
+			app.flush()
 			app.fetchAll()
 			todos.Refresh()
 		}()
 	})
 	app.Synchronize = syncButton
+	settingsButton := widget.NewButton("Settings", app.showSettings)
 	buttonBox.Add(utils.NewSectionLabel("Add a new todo:"))
 	buttonBox.Add(form)
-	buttonBox.Add(syncButton)
+	buttonBox.Add(container.NewGridWithColumns(2, syncButton, settingsButton))
 
 	top := canvas.NewText("To Do:", color.White)
 	top.Alignment = fyne.TextAlignLeading
 	top.TextSize = 24.0
 	top.TextStyle = fyne.TextStyle{Bold: true}
-	appLayout := container.NewBorder(top, buttonBox, nil, nil, todos)
+	header := container.NewHBox(top, layout.NewSpacer(), app.status)
+	appLayout := container.NewBorder(header, buttonBox, nil, nil, todos)
 	app.Window.SetContent(appLayout)
 
-	app.Synchronize.OnTapped()
+	go app.sync.run()
 	app.Window.ShowAndRun()
 }
 
-type Todo struct {
-	Id          int
-	Time        string
-	Description string
-	Completed   bool
+// Todo is a todo as the API sends it.
+type Todo = client.Todo
+
+// validateTodo applies the same rules the API checks on create, so mistakes
+// are shown before the request is sent.
+func validateTodo(t Todo) error {
+	input := validate.Todo{Id: t.Id, Description: t.Description, Completed: t.Completed}
+	if t.Time != nil {
+		input.Time = t.Time.Format(time.RFC3339)
+	}
+	return input.Create()
 }
 
+var errChangedElsewhere = errors.New("this todo was changed somewhere else, the list has been refreshed")
+
+// errOffline is returned when the API cannot be reached at all.
+var errOffline = client.ErrUnavailable
+
 type Store struct {
+	lock           sync.RWMutex
 	data           map[int]Todo
+	outbox         []pendingWrite
+	since          int
+	nextLocalId    int
+	path           string
+	api            *apiClient
 	RequestChannel chan<- Command
 }
 
-type CommandType int
+// sorted returns the todos in the order they are listed: todos from the API
+// by position, then those created offline in the order they were added.
+func (s *Store) sorted() []Todo {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
 
-const (
-	GetCommand = iota
-	GetAllCommand
-	InsertCommand
-	UpdateCommand
-	DeleteCommand
-	ToggleCommand
-)
+	todos := make([]Todo, 0, len(s.data))
+	for _, t := range s.data {
+		todos = append(todos, t)
+	}
+	sort.Slice(todos, func(i, j int) bool {
+		a, b := todos[i].Id, todos[j].Id
+		if (a < 0) != (b < 0) {
+			return b < 0
+		}
+		if a < 0 {
+			return a > b
+		}
+		if todos[i].Position != todos[j].Position {
+			return todos[i].Position < todos[j].Position
+		}
+		return a < b
+	})
+	return todos
+}
+
+// Result is the reply to a command: either a value or an error.
+type Result[T any] struct {
+	Value T
+	Err   error
+}
+
+// Command is anything the store manager can serve.
+type Command interface {
+	Fail(err error)
+}
+
+// Request holds the payload and typed reply channel shared by every command.
+type Request[P, R any] struct {
+	Payload P
+	Reply   chan Result[R]
+}
+
+func newRequest[P, R any](payload P) Request[P, R] {
+	return Request[P, R]{Payload: payload, Reply: make(chan Result[R], 1)}
+}
 
-type Command struct {
-	Cmd     CommandType
-	Payload interface{}
-	Reply   chan interface{}
-	Err     chan error
+func (r Request[P, R]) Fail(err error) {
+	r.Reply <- Result[R]{Err: err}
 }
 
+func (r Request[P, R]) resolve(value R, err error) {
+	r.Reply <- Result[R]{Value: value, Err: err}
+}
+
+func (r Request[P, R]) Wait() (R, error) {
+	res := <-r.Reply
+	return res.Value, res.Err
+}
+
+type GetAllCommand struct{ Request[struct{}, []Todo] }
+type InsertCommand struct{ Request[Todo, bool] }
+type ToggleCommand struct{ Request[Todo, bool] }
+
 type App struct {
 	App         fyne.App
 	Window      fyne.Window
-	Store       Store
+	Store       *Store
 	Synchronize *widget.Button
 	form        *widget.Form
+	list        *widget.List
+	status      *widget.Label
+	api         *apiClient
+	sync        *syncer
+	online      atomic.Bool
+	// flushing makes sure pending writes are sent one flush at a time.
+	flushing sync.Mutex
 }
 
 func NewApp() *App {
-	a := app.New()
+	a := app.NewWithID(appID)
 	w := a.NewWindow("Go Do It")
-	store := Store{
+	api := &apiClient{}
+	store := &Store{
 		data: make(map[int]Todo),
+		api:  api,
 	}
 	store.StartManager()
-	return &App{
+	app := &App{
 		App:    a,
 		Window: w,
 		Store:  store,
+		status: widget.NewLabel(""),
+		api:    api,
+	}
+	app.sync = &syncer{app: app}
+	app.setOnline(false)
+	return app
+}
+
+// setOnline shows whether the API can be reached, and how many writes are
+// waiting for it.
+func (a *App) setOnline(online bool) {
+	a.online.Store(online)
+	text := "Online"
+	if !online {
+		text = "Offline"
+	}
+	if n := a.Store.pending(); n > 0 {
+		text = fmt.Sprintf("%s, %d changes waiting", text, n)
+	}
+	a.status.SetText(text)
+}
+
+func (a *App) refreshList() {
+	if a.list != nil {
+		a.list.Refresh()
 	}
 }
 
-func (a *App) newTodoList() fyne.CanvasObject {
+// refetch reloads the list after a write, unless the sync socket is already
+// delivering the change.
+func (a *App) refetch() {
+	if !a.sync.live.Load() {
+		a.Synchronize.OnTapped()
+	}
+}
+
+func (a *App) newTodoList() *widget.List {
 	length := func() int {
-		return len(a.Store.data)
+		return len(a.Store.sorted())
 	}
 	create := func() fyne.CanvasObject {
 		return a.NewTodoListItem()
@@ -120,14 +244,21 @@ func (a *App) newTodoList() fyne.CanvasObject {
 		fmt.Println("Selected", id)
 	}
 	updateItem := func(id widget.ListItemID, obj fyne.CanvasObject) {
-		todo := a.Store.data[id+1]
+		todos := a.Store.sorted()
+		if id >= len(todos) {
+			return
+		}
+		todo := todos[id]
 
 		checkbox := obj.(*fyne.Container).Objects[0].(*widget.Check)
+		// Clear the handler first so reusing the row for another todo does
+		// not toggle the one it showed before.
+		checkbox.OnChanged = nil
 		checkbox.SetChecked(todo.Completed)
 		checkbox.OnChanged = func(value bool) {
 			log.Printf("checkbox %d clicked", id)
 			go func() {
-				a.toggle(id + 1)
+				a.toggle(todo, value)
 			}()
 		}
 
@@ -135,7 +266,7 @@ func (a *App) newTodoList() fyne.CanvasObject {
 		description.SetText(todo.Description)
 
 		dueText := obj.(*fyne.Container).Objects[3].(*canvas.Text)
-		if len(todo.Time) > 0 {
+		if todo.Time != nil {
 			dueText.Text = "Due:"
 			dueText.Show()
 		} else {
@@ -176,11 +307,21 @@ func (a *App) newTodoForm() *widget.Form {
 		},
 		OnSubmit: func() {
 			log.Println("Submitting todo")
-			var timeString = ""
+			var due *time.Time
 			if len(day.Text) > 0 {
-				timeString = fmt.Sprintf("%s-%s-%sT%s:%s:00Z", year.Text, month.Text, day.Text, hours.Text, minutes.Text)
+				t, err := utils.ParseDueDateTime(year.Text, month.Text, day.Text, hours.Text, minutes.Text)
+				if err != nil {
+					dialog.ShowError(err, a.Window)
+					return
+				}
+				due = &t
+			}
+			todo := Todo{Id: 0, Description: strings.TrimSpace(description.Text), Time: due, Completed: false}
+			if err := validateTodo(todo); err != nil {
+				dialog.ShowError(err, a.Window)
+				return
 			}
-			a.insert(Todo{Id: 0, Description: description.Text, Time: timeString, Completed: false})
+			a.insert(todo)
 		},
 	}
 	form.Orientation = widget.Horizontal
@@ -207,30 +348,21 @@ func (s *Store) StartManager() {
 
 	go func() {
 		for cmd := range cmds {
-			switch cmd.Cmd {
+			switch c := cmd.(type) {
 			case GetAllCommand:
 				log.Println("GetAllCommand")
-				if todos, err := s.all(); err != nil {
-					cmd.Err <- err
-				} else {
-					cmd.Reply <- todos
-				}
+				c.resolve(s.all())
 			case InsertCommand:
 				log.Println("InsertCommand")
-				if err := s.insert(cmd.Payload.(Todo)); err != nil {
-					cmd.Err <- err
-				} else {
-					cmd.Reply <- true
-				}
+				err := s.insert(c.Payload)
+				c.resolve(err == nil, err)
 			case ToggleCommand:
 				log.Println("ToggleCommand")
-				if err := s.toggle(cmd.Payload.(int)); err != nil {
-					cmd.Err <- err
-				} else {
-					cmd.Reply <- true
-				}
+				err := s.toggle(c.Payload)
+				c.resolve(err == nil, err)
 			default:
-				log.Fatal("unknown command type", cmd.Cmd)
+				log.Printf("unknown command type %T", cmd)
+				cmd.Fail(fmt.Errorf("unknown command type %T", cmd))
 			}
 		}
 	}()
@@ -238,157 +370,123 @@ func (s *Store) StartManager() {
 }
 
 func (s *Store) all() ([]Todo, error) {
-	url := fmt.Sprintf("%s/todos", baseURL)
-
-	request, _ := http.NewRequest(http.MethodGet, url, nil)
-	request.Header.Add("Accept", "application/json")
-	client := &http.Client{}
-
-	response, err := client.Do(request)
-
-	if response.StatusCode != 200 {
-		return []Todo{}, err
-	}
-
-	content, err := io.ReadAll(response.Body)
-	if err != nil {
-		return []Todo{}, err
-	}
-
-	v := make([]Todo, 0)
-
-	err = json.Unmarshal(content, &v)
+	page, err := s.api.todos().List(context.Background(), client.ListOptions{})
 	if err != nil {
 		return []Todo{}, err
 	}
-
-	return v, nil
+	return page.Todos, nil
 }
 
 func (s *Store) insert(todo Todo) error {
-	url := fmt.Sprintf("%s/todo", baseURL)
-
-	buff := bytes.Buffer{}
-	err := json.NewEncoder(&buff).Encode(todo)
-	if err != nil {
-		return err
-	}
-	request, _ := http.NewRequest(http.MethodPost, url, &buff)
-	request.Header.Add("Accept", "application/json")
-	client := &http.Client{}
-
-	response, err := client.Do(request)
-
-	if response.StatusCode != 200 {
-		return err
-	}
-
-	return nil
+	_, err := s.api.todos().Create(context.Background(), todo)
+	return err
 }
 
-func (s *Store) toggle(id int) error {
-	url := fmt.Sprintf("%s/todo/toggle/%d", baseURL, id)
-
-	request, _ := http.NewRequest(http.MethodPost, url, nil)
-	request.Header.Add("Accept", "application/json")
-	client := &http.Client{}
-
-	response, err := client.Do(request)
-
-	if response.StatusCode != 200 {
-		return err
+// toggle only applies when the todo is still at the revision the list was
+// loaded with, so a change made in the web app is not silently overwritten.
+func (s *Store) toggle(todo Todo) error {
+	err := s.api.todos().Toggle(context.Background(), todo.Id, todo.Revision)
+	if errors.Is(err, client.ErrPreconditionFailed) {
+		return errChangedElsewhere
 	}
-
-	return nil
+	return err
 }
 
 func (a *App) fetchAll() {
 	log.Println("Fetching all todos")
 
-	errChan := make(chan error)
-	defer close(errChan)
-	replyChan := make(chan interface{})
-	defer close(replyChan)
-
-	cmd := Command{
-		Cmd:     GetAllCommand,
-		Payload: nil,
-		Reply:   replyChan,
-		Err:     errChan,
-	}
-
+	cmd := GetAllCommand{newRequest[struct{}, []Todo](struct{}{})}
 	a.Store.RequestChannel <- cmd
 
-	select {
-	case err := <-errChan:
-		if err != nil {
-			log.Printf("%v", err)
-			return
-		}
-	case reply := <-replyChan:
-		log.Printf("Received reply from fetchAll. Count: %d", len(reply.([]Todo)))
-		m := make(map[int]Todo)
-		for _, t := range reply.([]Todo) {
-			m[t.Id] = t
+	todos, err := cmd.Wait()
+	if err != nil {
+		log.Printf("%v", err)
+		if errors.Is(err, errOffline) {
+			a.setOnline(false)
 		}
-		a.Store.data = m
+		return
 	}
+
+	log.Printf("Received reply from fetchAll. Count: %d", len(todos))
+	a.Store.replace(todos)
+	a.setOnline(true)
 }
 
+// insert adds the todo to the list straight away and sends it to the API
+// when it can be reached.
 func (a *App) insert(todo Todo) {
 	log.Println("Inserting todo")
-	errChan := make(chan error)
-	defer close(errChan)
-	replyChan := make(chan interface{})
-	defer close(replyChan)
-
-	cmd := Command{
-		Cmd:     InsertCommand,
-		Payload: todo,
-		Reply:   replyChan,
-		Err:     errChan,
-	}
 
-	a.Store.RequestChannel <- cmd
+	a.Store.queue(pendingWrite{Op: opInsert, Todo: todo})
+	a.resetForm()
+	a.refreshList()
+	go a.flush()
+}
 
-	select {
-	case err := <-errChan:
-		if err != nil {
-			log.Printf("%v", err)
-			return
-		}
-	case reply := <-replyChan:
-		log.Println("Received reply from insert", reply)
-		a.Synchronize.OnTapped()
-		a.resetForm()
-	}
+func (a *App) toggle(todo Todo, completed bool) {
+	log.Printf("Toggling todo %d", todo.Id)
+
+	todo.Completed = completed
+	a.Store.queue(pendingWrite{Op: opToggle, Todo: todo})
+	go a.flush()
 }
 
-func (a *App) toggle(id int) {
-	log.Printf("Toggling todo %d", id)
-	errChan := make(chan error)
-	defer close(errChan)
-	replyChan := make(chan interface{})
-	defer close(replyChan)
-
-	cmd := Command{
-		Cmd:     ToggleCommand,
-		Payload: id,
-		Reply:   replyChan,
-		Err:     errChan,
-	}
+// flush sends the pending writes to the API in the order they were made. It
+// stops at the first write that cannot reach the API, which stays queued for
+// the next attempt. A toggle of a todo that was changed elsewhere in the
+// meantime is dropped and the API's version kept.
+func (a *App) flush() {
+	a.flushing.Lock()
+	defer a.flushing.Unlock()
+
+	sent := false
+	for {
+		w, ok := a.Store.next()
+		if !ok {
+			break
+		}
 
-	a.Store.RequestChannel <- cmd
+		var err error
+		switch w.Op {
+		case opInsert:
+			todo := w.Todo
+			todo.Id = 0
+			cmd := InsertCommand{newRequest[Todo, bool](todo)}
+			a.Store.RequestChannel <- cmd
+			_, err = cmd.Wait()
+		case opToggle:
+			cmd := ToggleCommand{newRequest[Todo, bool](w.Todo)}
+			a.Store.RequestChannel <- cmd
+			_, err = cmd.Wait()
+		default:
+			err = fmt.Errorf("unknown pending write %q", w.Op)
+		}
 
-	select {
-	case err := <-errChan:
-		if err != nil {
+		switch {
+		case errors.Is(err, errOffline):
 			log.Printf("%v", err)
+			a.setOnline(false)
 			return
+		case errors.Is(err, errChangedElsewhere):
+			a.Store.done(false)
+			a.fetchAll()
+			if current, ok := a.Store.get(w.Todo.Id); ok && current.Completed != w.Todo.Completed {
+				dialog.ShowError(fmt.Errorf("%q was changed somewhere else, so your change was not applied", w.Todo.Description), a.Window)
+			}
+		case err != nil:
+			log.Printf("%v", err)
+			a.Store.done(false)
+			dialog.ShowError(err, a.Window)
+		default:
+			log.Printf("Sent pending %s of todo %d", w.Op, w.Todo.Id)
+			a.Store.done(true)
 		}
-	case reply := <-replyChan:
-		log.Println("Received reply from toggle", reply)
-		a.Synchronize.OnTapped()
+		sent = true
+		a.setOnline(true)
+		a.refreshList()
+	}
+	if sent {
+		a.refetch()
 	}
 }
 
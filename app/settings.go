@@ -0,0 +1,301 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+	"github.com/mcadenas-bjss/go-do-it/client"
+	"golang.org/x/net/websocket"
+)
+
+// Settings are how the app reaches the API.
+type Settings struct {
+	// ServerURL is the base of every API path, such as
+	// http://localhost:8000/api.
+	ServerURL string
+	// Token is sent as a bearer token when set.
+	Token   string
+	Timeout time.Duration
+	// CAFile is a PEM file of extra certificate authorities trusted for
+	// https servers.
+	CAFile string
+}
+
+// Preference keys and the environment variables that override them.
+const (
+	prefServerURL = "serverURL"
+	prefToken     = "token"
+	prefTimeout   = "timeout"
+	prefCAFile    = "caFile"
+
+	envServerURL = "GODOIT_SERVER_URL"
+	envToken     = "GODOIT_TOKEN"
+	envTimeout   = "GODOIT_TIMEOUT"
+	envCAFile    = "GODOIT_CA_FILE"
+)
+
+func defaultSettings() Settings {
+	return Settings{ServerURL: "http://localhost:8000/api", Timeout: 10 * time.Second}
+}
+
+// loadSettings reads the saved preferences, then applies the environment and
+// finally the command line flags on top. Overrides are not saved.
+func loadSettings(prefs fyne.Preferences, args []string) (Settings, error) {
+	s := defaultSettings()
+	s.ServerURL = prefs.StringWithFallback(prefServerURL, s.ServerURL)
+	s.Token = prefs.String(prefToken)
+	s.CAFile = prefs.String(prefCAFile)
+	if v := prefs.String(prefTimeout); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			s.Timeout = d
+		}
+	}
+
+	if v, ok := os.LookupEnv(envServerURL); ok {
+		s.ServerURL = v
+	}
+	if v, ok := os.LookupEnv(envToken); ok {
+		s.Token = v
+	}
+	if v, ok := os.LookupEnv(envCAFile); ok {
+		s.CAFile = v
+	}
+	if v, ok := os.LookupEnv(envTimeout); ok {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return Settings{}, fmt.Errorf("%s: %w", envTimeout, err)
+		}
+		s.Timeout = d
+	}
+
+	flags := flag.NewFlagSet("go-do-it", flag.ContinueOnError)
+	flags.StringVar(&s.ServerURL, "server", s.ServerURL, "Base URL of the API")
+	flags.StringVar(&s.Token, "token", s.Token, "Token sent to the API")
+	flags.DurationVar(&s.Timeout, "timeout", s.Timeout, "Timeout for each request to the API")
+	flags.StringVar(&s.CAFile, "ca", s.CAFile, "PEM file of extra certificate authorities to trust")
+	if err := flags.Parse(args); err != nil {
+		return Settings{}, err
+	}
+	return s, s.validate()
+}
+
+func (s Settings) save(prefs fyne.Preferences) {
+	prefs.SetString(prefServerURL, s.ServerURL)
+	prefs.SetString(prefToken, s.Token)
+	prefs.SetString(prefTimeout, s.Timeout.String())
+	prefs.SetString(prefCAFile, s.CAFile)
+}
+
+func (s Settings) validate() error {
+	u, err := url.Parse(s.ServerURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("server URL %q must be an http or https URL", s.ServerURL)
+	}
+	if s.Timeout <= 0 {
+		return errors.New("timeout must be more than zero")
+	}
+	_, err = s.tlsConfig()
+	return err
+}
+
+// tlsConfig trusts the CA file on top of the system's authorities.
+func (s Settings) tlsConfig() (*tls.Config, error) {
+	if s.CAFile == "" {
+		return nil, nil
+	}
+	pem, err := os.ReadFile(s.CAFile)
+	if err != nil {
+		return nil, fmt.Errorf("reading the CA file failed: %w", err)
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("%s has no PEM certificates", s.CAFile)
+	}
+	return &tls.Config{RootCAs: pool}, nil
+}
+
+// apiClient holds the API client for the current settings, which the
+// Settings dialog can change while the app runs.
+type apiClient struct {
+	lock     sync.RWMutex
+	settings Settings
+	client   *client.Client
+}
+
+func (c *apiClient) configure(s Settings) error {
+	tlsConfig, err := s.tlsConfig()
+	if err != nil {
+		return err
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	httpClient := &http.Client{Timeout: s.Timeout, Transport: transport}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.settings = s
+	c.client = client.New(s.ServerURL, client.WithHTTPClient(httpClient), client.WithToken(s.Token))
+	return nil
+}
+
+func (c *apiClient) current() Settings {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.settings
+}
+
+// todos returns the client to call the API with.
+func (c *apiClient) todos() *client.Client {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.client
+}
+
+// dialSync opens the sync socket.
+func (c *apiClient) dialSync() (*websocket.Conn, error) {
+	s := c.current()
+	base := strings.TrimSuffix(s.ServerURL, "/")
+	config, err := websocket.NewConfig("ws"+strings.TrimPrefix(base, "http")+"/sync", base)
+	if err != nil {
+		return nil, err
+	}
+	if config.TlsConfig, err = s.tlsConfig(); err != nil {
+		return nil, err
+	}
+	if s.Token != "" {
+		config.Header.Set("Authorization", "Bearer "+s.Token)
+	}
+	config.Dialer = &net.Dialer{Timeout: s.Timeout}
+	return websocket.DialConfig(config)
+}
+
+// checkConnection calls GET /health, then GET /auth/me as the health check
+// is public and would not notice a token the API refuses. A server without
+// sign in has no /auth/me, so the connection is fine as anyone.
+func (c *apiClient) checkConnection() (string, error) {
+	ctx := context.Background()
+	if err := c.todos().Health(ctx); err != nil {
+		return "", err
+	}
+	user, err := c.todos().Me(ctx)
+	if errors.Is(err, client.ErrNotFound) {
+		return "Connected", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("Connected as %s", user.Username), nil
+}
+
+// showSettings opens the Settings dialog. Saved settings are used straight
+// away, with the local cache of their server and user, and the sync socket
+// reconnects with them.
+func (a *App) showSettings() {
+	s := a.api.current()
+	serverURL := widget.NewEntry()
+	serverURL.SetText(s.ServerURL)
+	token := widget.NewPasswordEntry()
+	token.SetText(s.Token)
+	timeout := widget.NewEntry()
+	timeout.SetText(s.Timeout.String())
+	caFile := widget.NewEntry()
+	caFile.SetText(s.CAFile)
+	caFile.SetPlaceHolder("optional PEM file")
+
+	read := func() (Settings, error) {
+		d, err := time.ParseDuration(strings.TrimSpace(timeout.Text))
+		if err != nil {
+			return Settings{}, fmt.Errorf("timeout %q is not a duration such as 10s", timeout.Text)
+		}
+		s := Settings{
+			ServerURL: strings.TrimSpace(serverURL.Text),
+			Token:     strings.TrimSpace(token.Text),
+			Timeout:   d,
+			CAFile:    strings.TrimSpace(caFile.Text),
+		}
+		return s, s.validate()
+	}
+
+	result := widget.NewLabel("")
+	test := widget.NewButton("Test connection", func() {
+		s, err := read()
+		if err != nil {
+			result.SetText(err.Error())
+			return
+		}
+		result.SetText("Connecting...")
+		go func() {
+			var c apiClient
+			if err := c.configure(s); err != nil {
+				result.SetText(err.Error())
+				return
+			}
+			text, err := c.checkConnection()
+			if err != nil {
+				result.SetText(err.Error())
+				return
+			}
+			result.SetText(text)
+		}()
+	})
+
+	form := widget.NewForm(
+		widget.NewFormItem("Server URL", serverURL),
+		widget.NewFormItem("Token", token),
+		widget.NewFormItem("Timeout", timeout),
+		widget.NewFormItem("CA file", caFile),
+	)
+	content := container.NewVBox(form, container.NewHBox(test, result))
+
+	settings := dialog.NewCustomConfirm("Settings", "Save", "Cancel", content, func(save bool) {
+		if !save {
+			return
+		}
+		s, err := read()
+		if err == nil {
+			err = a.api.configure(s)
+		}
+		if err != nil {
+			dialog.ShowError(err, a.Window)
+			return
+		}
+		s.save(a.App.Preferences())
+		go a.useCache(cachePath(s))
+	}, a.Window)
+	settings.Resize(fyne.NewSize(500, 0))
+	settings.Show()
+}
+
+// useCache switches the store to the local cache at path once any flush in
+// progress is done, so its reply is not applied to the wrong cache. The sync
+// socket is dropped first so no more events of the old server arrive.
+func (a *App) useCache(path string) {
+	a.flushing.Lock()
+	defer a.flushing.Unlock()
+
+	a.sync.reconnect()
+	if err := a.Store.use(path); err != nil {
+		log.Printf("ignoring the local cache: %v", err)
+	}
+	a.setOnline(false)
+	a.refreshList()
+}
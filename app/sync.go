@@ -0,0 +1,118 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mcadenas-bjss/go-do-it/client"
+	"golang.org/x/net/websocket"
+)
+
+// pollInterval is how often the list is refetched while the sync socket is
+// down, and how long to wait before reconnecting it.
+const pollInterval = 10 * time.Second
+
+// syncMessage mirrors the API's WebSocket sync protocol messages.
+type syncMessage struct {
+	Type  string        `json:"type"`
+	Since int           `json:"since,omitempty"`
+	Todos []Todo        `json:"todos,omitempty"`
+	Event *Event        `json:"event,omitempty"`
+	Id    int           `json:"id,omitempty"`
+	Error *client.Error `json:"error,omitempty"`
+}
+
+// Event is one change to a todo. Before is nil for new todos and After for
+// deleted ones.
+type Event = client.Event
+
+// syncer keeps the store in step with the API over a WebSocket, falling back
+// to polling while the socket is down.
+type syncer struct {
+	app  *App
+	live atomic.Bool
+
+	lock sync.Mutex
+	ws   *websocket.Conn
+}
+
+// reconnect drops the socket so it is opened again with the current
+// settings.
+func (s *syncer) reconnect() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.ws != nil {
+		s.ws.Close()
+	}
+}
+
+func (s *syncer) run() {
+	for {
+		err := s.connect()
+		s.live.Store(false)
+		log.Printf("sync socket closed, polling instead: %v", err)
+
+		s.app.fetchAll()
+		if s.app.online.Load() {
+			s.app.flush()
+		}
+		s.app.refreshList()
+		time.Sleep(pollInterval)
+	}
+}
+
+// connect subscribes and applies messages until the socket drops.
+func (s *syncer) connect() error {
+	ws, err := s.app.api.dialSync()
+	if err != nil {
+		return err
+	}
+	s.lock.Lock()
+	s.ws = ws
+	s.lock.Unlock()
+	defer func() {
+		s.lock.Lock()
+		s.ws = nil
+		s.lock.Unlock()
+		ws.Close()
+	}()
+
+	// Resume after the last event applied, which the cache of this server and
+	// user keeps across restarts, so only what was missed is sent.
+	since := s.app.Store.lastEvent()
+	if err := websocket.JSON.Send(ws, syncMessage{Type: "subscribe", Since: since}); err != nil {
+		return err
+	}
+	s.live.Store(true)
+	s.app.setOnline(true)
+	log.Printf("sync socket connected after event %d", since)
+	go s.app.flush()
+
+	for {
+		var msg syncMessage
+		if err := websocket.JSON.Receive(ws, &msg); err != nil {
+			return err
+		}
+		switch msg.Type {
+		case "snapshot":
+			s.app.Store.replace(msg.Todos)
+		case "delta":
+			s.app.Store.apply(*msg.Event)
+			if err := websocket.JSON.Send(ws, syncMessage{Type: "ack", Id: msg.Id}); err != nil {
+				return err
+			}
+		case "error":
+			if msg.Error == nil {
+				return errors.New("sync refused")
+			}
+			return fmt.Errorf("sync refused: %w", msg.Error)
+		default:
+			continue
+		}
+		s.app.refreshList()
+	}
+}
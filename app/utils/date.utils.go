@@ -1,24 +1,24 @@
 package utils
 
 import (
+	"fmt"
+	"strconv"
 	"time"
 )
 
-func FormatDueDateTime(t string) string {
-	if len(t) == 0 {
+// FormatDueDateTime renders a due date in the local timezone, using relative
+// labels for yesterday, today and tomorrow.
+func FormatDueDateTime(t *time.Time) string {
+	if t == nil || t.IsZero() {
 		return ""
 	}
 
-	var layout = "2006-01-02T15:04:05Z0700" // ISO 8601 format
 	var output = "Mon, 02 Jan 2006 15:04"
 
-	check_t, _ := time.Parse(layout, t)
-	checkDate_t, _ := time.Parse("2006-01-02", check_t.Format("2006-01-02"))
-	nowDate_t, _ := time.Parse("2006-01-02", time.Now().Format("2006-01-02"))
-
-	if len(t) == 0 {
-		return ""
-	}
+	check_t := t.Local()
+	now := time.Now()
+	checkDate_t := time.Date(check_t.Year(), check_t.Month(), check_t.Day(), 0, 0, 0, 0, time.Local)
+	nowDate_t := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local)
 
 	f := check_t.Format(output)
 
@@ -35,6 +35,26 @@ func FormatDueDateTime(t string) string {
 	return f
 }
 
+// ParseDueDateTime builds a due date in the local timezone from the form
+// fields, rejecting dates that do not exist such as 31 February.
+func ParseDueDateTime(year, month, day, hours, minutes string) (time.Time, error) {
+	fields := []string{year, month, day, hours, minutes}
+	values := make([]int, len(fields))
+	for i, field := range fields {
+		v, err := strconv.Atoi(field)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("%q is not a number", field)
+		}
+		values[i] = v
+	}
+
+	t := time.Date(values[0], time.Month(values[1]), values[2], values[3], values[4], 0, 0, time.Local)
+	if t.Year() != values[0] || int(t.Month()) != values[1] || t.Day() != values[2] || t.Hour() != values[3] || t.Minute() != values[4] {
+		return time.Time{}, fmt.Errorf("%s-%s-%s %s:%s is not a valid date", year, month, day, hours, minutes)
+	}
+	return t, nil
+}
+
 func inTimeSpan(start, end, check time.Time) bool {
 	if start.Before(end) {
 		return !check.Before(start) && !check.After(end)
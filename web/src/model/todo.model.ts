@@ -1,8 +1,16 @@
 type Todo = {
     Id: number;
-    Time: string;
+    Time: string | null;
     Description: string;
     Completed: boolean;
+    Revision?: number;
+    Position?: string;
+    Section?: number;
   };
   
   type Todos = Array<Todo>;
+
+  type Section = {
+    Id: number;
+    Name: string;
+  };
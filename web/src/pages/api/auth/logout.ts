@@ -0,0 +1,22 @@
+import type { APIRoute } from "astro";
+import { AUTH_PATH } from "../../../utils/globals";
+import { apiFetch, relayCookies } from "../../../utils/session";
+
+export const POST: APIRoute = async ({ request }) => {
+    console.log('POST /api/auth/logout');
+    try {
+        const response = await apiFetch(request, `${AUTH_PATH}/logout`, { method: "POST" });
+        const headers = new Headers({ Location: "/login" });
+        relayCookies(response, headers);
+        return new Response(null, { status: 303, headers });
+    } catch (e) {
+        return new Response(
+            JSON.stringify({
+                message: "An error occurred.",
+            }),
+            {
+                status: 500,
+            }
+        );
+    }
+}
@@ -0,0 +1,19 @@
+import type { APIRoute } from "astro";
+import { AUTH_PATH } from "../../../utils/globals";
+import { signIn } from "../../../utils/session";
+
+export const POST: APIRoute = async ({ request }) => {
+    console.log('POST /api/auth/register');
+    try {
+        return await signIn(request, `${AUTH_PATH}/register`);
+    } catch (e) {
+        return new Response(
+            JSON.stringify({
+                message: "An error occurred.",
+            }),
+            {
+                status: 500,
+            }
+        );
+    }
+}
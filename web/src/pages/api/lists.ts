@@ -0,0 +1,25 @@
+import type { APIRoute } from "astro";
+import { LISTS_PATH } from "../../utils/globals";
+import { apiFetch } from "../../utils/session";
+
+// GET renders the list switcher, marking the list named by ?list.
+export const GET: APIRoute = async ({ url, request }) => {
+  try {
+    const response = await apiFetch(request, `${LISTS_PATH}${url.search}`, {
+      headers: { "HX-Request": "true" },
+    });
+    return new Response(await response.text(), {
+      status: response.status,
+      headers: { "Content-Type": response.headers.get("Content-Type") ?? "text/html" },
+    });
+  } catch (e) {
+    return new Response(
+      JSON.stringify({
+        message: "An error occurred.",
+      }),
+      {
+        status: 500,
+      }
+    );
+  }
+};
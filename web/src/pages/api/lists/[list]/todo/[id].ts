@@ -0,0 +1 @@
+export { GET, POST, DELETE } from "../../../todo/[id]";
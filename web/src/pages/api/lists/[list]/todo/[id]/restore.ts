@@ -0,0 +1 @@
+export { POST } from "../../../../todo/[id]/restore";
@@ -0,0 +1 @@
+export { GET } from "../../../../todo/edit/[id]";
@@ -0,0 +1,2 @@
+// The todo routes of a shared list proxy to the list's routes in the API.
+export { POST } from "../../../todo/index";
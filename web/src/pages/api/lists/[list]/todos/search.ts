@@ -0,0 +1 @@
+export { GET } from "../../../todos/search";
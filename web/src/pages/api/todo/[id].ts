@@ -1,10 +1,11 @@
 import type { APIRoute } from "astro";
-import { BASE_URL, TODO_PATH, TODOS_PATH } from "../../../utils/globals";
+import { listPath, TODO_PATH, TODOS_PATH } from "../../../utils/globals";
+import { apiFetch } from "../../../utils/session";
 
-export const GET: APIRoute = async ({params}) => {
+export const GET: APIRoute = async ({ params, request }) => {
     try {
         const id = params.id
-        const response = await fetch(`${BASE_URL}${TODOS_PATH}/${id}`);
+        const response = await apiFetch(request, `${listPath(params.list)}${TODOS_PATH}/${id}`);
         const data: Todos = await response.json();
         return new Response(JSON.stringify(data), { status: 200 })
     } catch (e) {
@@ -32,7 +33,7 @@ export const POST: APIRoute = async ({ params, request }) => {
             Description,
             Completed: false,
         }
-        await fetch(`${BASE_URL}${TODO_PATH}/${id}`, {
+        await apiFetch(request, `${listPath(params.list)}${TODO_PATH}/${id}`, {
             body: JSON.stringify(body),
             method: "PUT",
             headers: {
@@ -53,14 +54,21 @@ export const POST: APIRoute = async ({ params, request }) => {
     }
 }
 
-export const DELETE: APIRoute = async ({ params }) => {
+export const DELETE: APIRoute = async ({ params, request }) => {
     try {
         const id = params.id
-        await fetch(`${BASE_URL}${TODO_PATH}/${id}`, {
+        const res = await apiFetch(request, `${listPath(params.list)}${TODO_PATH}/${id}`, {
             method: "DELETE",
+            headers: {
+                "HX-Request": "true",
+            },
         })
+        if (!res.ok) throw new Error("Error");
 
-        return new Response(null, { status: 200 })
+        // The API answers with an Undo item that replaces the deleted todo.
+        return new Response(await res.text(), { status: 200, headers: {
+            "Content-Type": "text/html"
+        } })
     } catch (e) {
         return new Response(
             JSON.stringify({
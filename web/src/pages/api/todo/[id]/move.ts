@@ -0,0 +1,29 @@
+import type { APIRoute } from "astro";
+import { listPath, TODO_PATH } from "../../../../utils/globals";
+import { apiFetch } from "../../../../utils/session";
+
+// POST passes a drag and drop move, such as {"After": 2}, on to the API.
+export const POST: APIRoute = async ({ params, request }) => {
+    try {
+        const id = params.id;
+        const res = await apiFetch(request, `${listPath(params.list)}${TODO_PATH}/${id}/move`, {
+            method: "POST",
+            headers: {
+                "Content-Type": "application/json",
+            },
+            body: await request.text(),
+        });
+        return new Response(await res.text(), { status: res.status, headers: {
+            "Content-Type": res.headers.get("Content-Type") ?? "application/json"
+        } })
+    } catch (e) {
+        return new Response(
+            JSON.stringify({
+                message: "An error occurred.",
+            }),
+            {
+                status: 500,
+            }
+        );
+    }
+}
@@ -0,0 +1,28 @@
+import type { APIRoute } from "astro";
+import { listPath, TODO_PATH } from "../../../../utils/globals";
+import { apiFetch } from "../../../../utils/session";
+
+export const POST: APIRoute = async ({ params, request }) => {
+    try {
+        const id = params.id;
+        const res = await apiFetch(request, `${listPath(params.list)}${TODO_PATH}/${id}/restore`, {
+            method: "POST",
+            headers: {
+                "HX-Request": "true",
+            },
+        });
+        if (!res.ok) throw new Error("Error");
+        return new Response(await res.text(), { status: 200, headers: {
+            "Content-Type": "text/html"
+        } })
+    } catch (e) {
+        return new Response(
+            JSON.stringify({
+                message: "An error occurred.",
+            }),
+            {
+                status: 500,
+            }
+        );
+    }
+}
@@ -1,4 +1,5 @@
 import type { APIRoute } from "astro";
+import { listPath } from "../../../../utils/globals";
 
 export const GET: APIRoute = async ({params}) => {
     try {
@@ -26,7 +27,7 @@ export const GET: APIRoute = async ({params}) => {
               </div>
               <button
                 id="save-${id}"
-                hx-post="/api/todo/${id}"
+                hx-post="/api${listPath(params.list)}/todo/${id}"
                 hx-swap="delete"
                 hx-target="this"
               >
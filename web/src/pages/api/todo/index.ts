@@ -1,5 +1,6 @@
 import type { APIRoute } from "astro";
-import { BASE_URL, TODO_PATH } from "../../../utils/globals";
+import { listPath, TODO_PATH } from "../../../utils/globals";
+import { apiFetch } from "../../../utils/session";
 
 export const POST: APIRoute = async ({ params, request }) => {
     console.log('POST /api/todo');
@@ -13,7 +14,7 @@ export const POST: APIRoute = async ({ params, request }) => {
             Description,
             Completed: false,
         }
-        const todo = await fetch(`${BASE_URL}${TODO_PATH}`, {
+        const todo = await apiFetch(request, `${listPath(params.list)}${TODO_PATH}`, {
             method: "POST",
             headers: {
                 "Content-Type": "application/json",
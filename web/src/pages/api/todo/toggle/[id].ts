@@ -1,10 +1,11 @@
 import type { APIRoute } from "astro";
-import { BASE_URL, TOGGLE_TODO_PATH, TODO_PATH } from "../../../../utils/globals";
+import { listPath, TOGGLE_TODO_PATH } from "../../../../utils/globals";
+import { apiFetch } from "../../../../utils/session";
 
-export const POST: APIRoute = async ({params}) => {
+export const POST: APIRoute = async ({ params, request }) => {
     try {
         const id = params.id;
-        const res = await fetch(`${BASE_URL}${TOGGLE_TODO_PATH}/${id}`, {method: "POST"});
+        const res = await apiFetch(request, `${listPath(params.list)}${TOGGLE_TODO_PATH}/${id}`, {method: "POST"});
         if (!res.ok) throw new Error("Error");
         return new Response(null, { status: 200 })
     } catch (e) {
@@ -1,11 +1,12 @@
 import type { APIRoute } from "astro";
-import { BASE_URL, TODOS_PATH } from "../../utils/globals";
+import { TODOS_PATH } from "../../utils/globals";
+import { apiFetch } from "../../utils/session";
 
-export async function GET() {
+export const GET: APIRoute = async ({ request }) => {
   try {
-    const response = await fetch(`${BASE_URL}${TODOS_PATH}`);
+    const response = await apiFetch(request, TODOS_PATH);
     const data: Todos = await response.json();
-    return new Response(JSON.stringify(data), { status: 200 })
+    return new Response(JSON.stringify(data), { status: response.status })
   } catch (e) {
     return new Response(
       JSON.stringify({
@@ -16,4 +17,4 @@ export async function GET() {
       }
     );
   }
-}
\ No newline at end of file
+};
@@ -0,0 +1,24 @@
+import type { APIRoute } from "astro";
+import { listPath, SEARCH_PATH } from "../../../utils/globals";
+import { apiFetch } from "../../../utils/session";
+
+export const GET: APIRoute = async ({ params, url, request }) => {
+  try {
+    const response = await apiFetch(request, `${listPath(params.list)}${SEARCH_PATH}${url.search}`, {
+      headers: { "HX-Request": request.headers.get("HX-Request") ?? "" },
+    });
+    return new Response(await response.text(), {
+      status: response.status,
+      headers: { "Content-Type": response.headers.get("Content-Type") ?? "text/html" },
+    });
+  } catch (e) {
+    return new Response(
+      JSON.stringify({
+        message: "An error occurred.",
+      }),
+      {
+        status: 500,
+      }
+    );
+  }
+};
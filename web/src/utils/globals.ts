@@ -2,3 +2,13 @@ export const BASE_URL = "http://localhost:8000/api";
 export const TODO_PATH = "/todo";
 export const TOGGLE_TODO_PATH = `${TODO_PATH}/toggle`;
 export const TODOS_PATH = "/todos";
+export const SEARCH_PATH = `${TODOS_PATH}/search`;
+export const AUTH_PATH = "/auth";
+export const LISTS_PATH = "/lists";
+export const SECTIONS_PATH = "/sections";
+
+// listPath is the API path the todo routes of a shared list are under, or ""
+// for the personal list.
+export function listPath(list?: string) {
+  return list ? `${LISTS_PATH}/${list}` : "";
+}
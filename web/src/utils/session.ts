@@ -0,0 +1,41 @@
+import { BASE_URL } from "./globals";
+
+// apiFetch calls the API on behalf of the browser that made `request`,
+// forwarding its session cookie so the API knows which user is signed in.
+export function apiFetch(request: Request, path: string, init: RequestInit = {}) {
+  const headers = new Headers(init.headers);
+  const cookie = request.headers.get("cookie");
+  if (cookie) headers.set("cookie", cookie);
+  return fetch(`${BASE_URL}${path}`, { ...init, headers });
+}
+
+// relayCookies copies the cookies set by an API response onto ours, so
+// signing in or out through the web app updates the browser's session.
+export function relayCookies(from: Response, to: Headers) {
+  for (const cookie of from.headers.getSetCookie()) {
+    to.append("Set-Cookie", cookie);
+  }
+}
+
+// signIn posts the login or register form to the API and redirects to the
+// todo list, or back to the login page with the reason it failed.
+export async function signIn(request: Request, path: string) {
+  const form = await request.formData();
+  const response = await apiFetch(request, path, {
+    method: "POST",
+    headers: { "Content-Type": "application/json" },
+    body: JSON.stringify({
+      Username: form.get("username"),
+      Password: form.get("password"),
+    }),
+  });
+
+  const headers = new Headers({ Location: "/" });
+  if (response.ok) {
+    relayCookies(response, headers);
+  } else {
+    const problem = await response.json();
+    headers.set("Location", `/login?error=${encodeURIComponent(problem.detail ?? problem.title)}`);
+  }
+  return new Response(null, { status: 303, headers });
+}